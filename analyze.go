@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+)
+
+// Exit codes of the commands.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the server or the analysis failed
+	exitUsage   = 2 // invalid flags or input
+)
+
+// Output formats of the analyze command.
+const (
+	formatHuman = "human" // one line with the label, scores and language
+	formatJSON  = "json"  // the response body of POST /analyze
+)
+
+// runAnalyze runs the analyze command, which analyzes the text of its
+// arguments, of the file given by -file or of stdin, in that order, the way
+// POST /analyze does with the same environment and -config file, and prints
+// the result to stdout. Logs go to stderr, so that the output can be piped.
+func runAnalyze(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "read the text from `path` rather than from the arguments or stdin")
+	format := fs.String("format", formatHuman, "output `format`: human or json")
+	language := fs.String("language", "", "ISO-639-1 `code` of the text; detected when empty")
+	sentences := fs.Bool("sentences", false, "include the per-sentence breakdown")
+	configPath := fs.String("config", "", "read the settings the environment does not set from the YAML or JSON file at `path`")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s analyze [flags] [text ...]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != formatHuman && *format != formatJSON {
+		fmt.Fprintf(stderr, "analyze: unknown format %q: must be %s or %s\n", *format, formatHuman, formatJSON)
+		return exitUsage
+	}
+	text, err := analyzeInput(fs.Args(), *file, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "analyze: %v\n", err)
+		return exitUsage
+	}
+
+	cf, err := loadConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "analyze: %v\n", err)
+		return exitFailure
+	}
+	e := newEnv(cf)
+	level := new(slog.LevelVar)
+	logger, err := newLogger(stderr, e.get("LOG_FORMAT"), level)
+	if err != nil {
+		fmt.Fprintf(stderr, "analyze: %v\n", e.explain(err))
+		return exitFailure
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	resp, err := analyzeOnce(ctx, logger, level, e, api.SentimentRequest{
+		Text:             &text,
+		Language:         *language,
+		IncludeSentences: *sentences,
+	})
+	switch {
+	case errors.Is(err, api.ErrInvalidRequest):
+		fmt.Fprintf(stderr, "analyze: %v\n", err)
+		return exitUsage
+	case err != nil:
+		fmt.Fprintf(stderr, "analyze: %v\n", e.explain(err))
+		return exitFailure
+	}
+
+	if *format == formatJSON {
+		err = json.NewEncoder(stdout).Encode(resp)
+	} else {
+		err = printHuman(stdout, resp)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "analyze: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// analyzeInput returns the text to analyze: the arguments joined by spaces,
+// or the content of file, or else all of stdin.
+func analyzeInput(args []string, file string, stdin io.Reader) (string, error) {
+	switch {
+	case len(args) > 0 && file != "":
+		return "", errors.New("give the text as arguments or with -file, not both")
+	case len(args) > 0:
+		return strings.Join(args, " "), nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		return string(data), err
+	default:
+		data, err := io.ReadAll(stdin)
+		return string(data), err
+	}
+}
+
+// analyzeOnce builds the analyzer and the server from the settings of e, as
+// run does, and analyzes req with them, logging at the level of the
+// settings. Nothing is served, stored or exported.
+func analyzeOnce(ctx context.Context, logger *slog.Logger, level *slog.LevelVar, e *env, req api.SentimentRequest) (api.SentimentResponse, error) {
+	sec := newSecrets()
+	defer sec.close()
+	e, err := sec.resolve(ctx, e)
+	if err != nil {
+		return api.SentimentResponse{}, err
+	}
+	cfg, err := loadConfig(e)
+	if err != nil {
+		return api.SentimentResponse{}, err
+	}
+	level.Set(cfg.LogLevel)
+	cache, closeCache, err := loadCache(cfg.Cache)
+	if err != nil {
+		return api.SentimentResponse{}, err
+	}
+	defer closeCache()
+
+	metrics := api.NewMetrics()
+	as, err := loadAnalyzer(logger, metrics, cfg.Analyzer)
+	if err != nil {
+		return api.SentimentResponse{}, err
+	}
+	defer as.lang.Close()
+	if err := as.connect(); err != nil {
+		return api.SentimentResponse{}, err
+	}
+
+	s, err := api.NewServer(cfg.API, as.analyzer, as.lang, cache, logger, metrics)
+	if err != nil {
+		return api.SentimentResponse{}, err
+	}
+	return s.Analyze(ctx, req)
+}
+
+// printHuman prints resp as one line, followed by one indented line per
+// sentence if any.
+func printHuman(w io.Writer, resp api.SentimentResponse) error {
+	if _, err := fmt.Fprintf(w, "%s score=%.2f magnitude=%.2f language=%s\n", resp.Sentiment, resp.Score, resp.Magnitude, resp.Language); err != nil {
+		return err
+	}
+	for _, s := range resp.Sentences {
+		if _, err := fmt.Fprintf(w, "  %+.2f %s\n", s.Score, s.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deniedLanguageService is a Language API rejecting every call with
+// PermissionDenied, which is not retried.
+type deniedLanguageService struct {
+	languagepb.UnimplementedLanguageServiceServer
+}
+
+func (deniedLanguageService) AnalyzeSentiment(context.Context, *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	return nil, status.Error(codes.PermissionDenied, "the API is disabled")
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Setenv("ANALYZER", "fake")
+	// Quiet the warning about the fake analyzer, so that stderr holds the
+	// errors alone.
+	t.Setenv("LOG_LEVEL", "error")
+	textFile := filepath.Join(t.TempDir(), "text.txt")
+	writeFile(t, textFile, []byte("What a great day"))
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"arguments", []string{"analyze", "I", "love", "this"}, "", exitOK, "positive score=1.00 magnitude=1.00 language=\n", ""},
+		{"stdin", []string{"analyze", "-language", "en"}, "This is awful\n", exitOK, "negative score=-1.00 magnitude=1.00 language=en\n", ""},
+		{"file", []string{"analyze", "-file", textFile}, "ignored", exitOK, "positive score=1.00 magnitude=1.00 language=\n", ""},
+		{"sentences", []string{"analyze", "-sentences", "Good. Bad."}, "", exitOK, "neutral score=0.00 magnitude=2.00 language=\n  +1.00 Good.\n  -1.00 Bad.\n", ""},
+		{"help", []string{"analyze", "-h"}, "", exitOK, "", "Usage:"},
+
+		{"unknown command", []string{"analyse", "text"}, "", exitUsage, "", `unknown command "analyse"`},
+		{"unknown flag", []string{"analyze", "-verbose", "text"}, "", exitUsage, "", "flag provided but not defined: -verbose"},
+		{"unknown format", []string{"analyze", "-format", "xml", "text"}, "", exitUsage, "", `analyze: unknown format "xml"`},
+		{"arguments and file", []string{"analyze", "-file", textFile, "text"}, "", exitUsage, "", "not both"},
+		{"missing file", []string{"analyze", "-file", textFile + ".missing"}, "", exitUsage, "", "no such file"},
+		{"empty text", []string{"analyze"}, "", exitUsage, "", "analyze: invalid request"},
+
+		{"missing config file", []string{"analyze", "-config", textFile + ".yaml", "text"}, "", exitFailure, "", "analyze:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runCommand(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d; stderr:\n%s", code, tt.wantCode, stderr.String())
+			}
+			if got := stdout.String(); got != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", got, tt.wantStdout)
+			}
+			if tt.wantStderr == "" && stderr.Len() > 0 {
+				t.Errorf("stderr = %q, want nothing", stderr.String())
+			} else if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to hold %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRunAnalyzeJSON(t *testing.T) {
+	t.Setenv("ANALYZER", "fake")
+	// The command has the settings of the server.
+	t.Setenv("SCORE_PRECISION", "1")
+
+	var stdout, stderr bytes.Buffer
+	if code := runCommand([]string{"analyze", "-format", "json", "-language", "en", "Good good bad."}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit code = %d, want %d; stderr:\n%s", code, exitOK, stderr.String())
+	}
+	var resp struct {
+		Sentiment string
+		Score     float64
+		Magnitude float64
+		Language  string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		t.Fatalf("stdout %q is not JSON: %v", stdout.String(), err)
+	}
+	if resp.Sentiment != "positive" || resp.Score != 0.3 || resp.Magnitude != 3 || resp.Language != "en" {
+		t.Errorf("response %+v, want positive, score 0.3 rounded to one place, magnitude 3, en", resp)
+	}
+	if !strings.HasSuffix(stdout.String(), "}\n") || strings.Count(stdout.String(), "\n") != 1 {
+		t.Errorf("stdout = %q, want one line of JSON", stdout.String())
+	}
+}
+
+func TestRunAnalyzeFailure(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	languagepb.RegisterLanguageServiceServer(srv, deniedLanguageService{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	t.Setenv("ANALYZER", "gcp")
+	t.Setenv("LANGUAGE_EMULATOR_HOST", lis.Addr().String())
+	t.Setenv("LOG_LEVEL", "error")
+
+	var stdout, stderr bytes.Buffer
+	code := runCommand([]string{"analyze", "I love this"}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitFailure {
+		t.Errorf("exit code = %d, want %d", code, exitFailure)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("stdout = %q, want nothing", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "analyze:") || !strings.Contains(stderr.String(), "PermissionDenied") {
+		t.Errorf("stderr = %q, want the error of the analysis", stderr.String())
+	}
+
+	// So does an invalid setting.
+	t.Setenv("ANALYZER", "bogus")
+	stdout.Reset()
+	stderr.Reset()
+	if code := runCommand([]string{"analyze", "I love this"}, strings.NewReader(""), &stdout, &stderr); code != exitFailure {
+		t.Errorf("invalid ANALYZER: exit code = %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr.String(), "ANALYZER") {
+		t.Errorf("invalid ANALYZER: stderr = %q, want it named", stderr.String())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+)
+
+// setBuildVars sets the variables of -ldflags for the test.
+func setBuildVars(t *testing.T, v, c, bt string) {
+	t.Helper()
+	oldVersion, oldCommit, oldBuildTime := version, commit, buildTime
+	version, commit, buildTime = v, c, bt
+	t.Cleanup(func() { version, commit, buildTime = oldVersion, oldCommit, oldBuildTime })
+}
+
+func TestBuildInfo(t *testing.T) {
+	setBuildVars(t, "v1.2.3", "abc0123", "2026-10-01T12:00:00Z")
+	want := api.BuildInfo{Version: "v1.2.3", Commit: "abc0123", BuildTime: "2026-10-01T12:00:00Z", GoVersion: runtime.Version()}
+	if got := buildInfo(); got != want {
+		t.Errorf("buildInfo() = %+v, want the injected %+v", got, want)
+	}
+
+	// Test binaries carry no VCS settings: what is not injected stays empty.
+	setBuildVars(t, "", "", "")
+	got := buildInfo()
+	if got.GoVersion != runtime.Version() || got.Commit != "" || got.BuildTime != "" {
+		t.Errorf("buildInfo() = %+v, want only the Go version and the module version", got)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	setBuildVars(t, "v1.2.3", "abc0123", "2026-10-01T12:00:00Z")
+	addr, done := startRun(t, nil)
+	defer stopRun(t, done)
+
+	resp, err := http.Get("http://" + addr + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var got api.BuildInfo
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := api.BuildInfo{Version: "v1.2.3", Commit: "abc0123", BuildTime: "2026-10-01T12:00:00Z", GoVersion: runtime.Version()}
+	if got != want {
+		t.Errorf("version %+v, want the injected %+v", got, want)
+	}
+}
@@ -0,0 +1,772 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// config holds the settings of the process, read once at startup by
+// loadConfig and passed to what needs them. Each is read from the variable
+// named in its comment; the defaults of API are documented in package api.
+type config struct {
+	// Mode is MODE: modeHTTP, the default, modePubSub or modeBoth.
+	Mode string
+	// LogFormat is LOG_FORMAT: logFormatJSON, the default, logFormatText or
+	// logFormatGCP.
+	LogFormat string
+	// LogLevel is LOG_LEVEL, the least severe level logged: debug, info,
+	// the default, warn or error.
+	LogLevel slog.Level
+	// Port is PORT, defaultPort by default.
+	Port int
+	// GRPCAddr is GRPC_ADDR, defaultGRPCAddr by default.
+	GRPCAddr string
+	// ShutdownTimeout is SHUTDOWN_TIMEOUT, defaultShutdownTimeout by default.
+	ShutdownTimeout time.Duration
+	// SecretsRefresh is SECRETS_REFRESH_INTERVAL, how often the API keys
+	// read from Secret Manager are read again; never by default.
+	SecretsRefresh time.Duration
+	// Project is GOOGLE_CLOUD_PROJECT, the project of the access log and of
+	// Error Reporting; on Google Cloud, that of the metadata server by
+	// default.
+	Project string
+	// H2C is H2C: whether the API port also serves HTTP/2 without TLS.
+	H2C bool
+
+	API            api.Config
+	Analyzer       analyzerConfig
+	Cache          cacheConfig
+	TLS            tlsConfig
+	Tracing        tracingConfig
+	Pprof          pprofConfig
+	Storage        storageConfig
+	Export         exportConfig
+	PubSub         pubSubConfig
+	IDToken        idTokenConfig
+	Async          asyncConfig
+	GCS            api.GCSConfig
+	ErrorReporting errorReportingConfig
+	Quotas         quotaConfig
+}
+
+// analyzerConfig selects the sentiment analyzer and configures the Language
+// API client.
+type analyzerConfig struct {
+	// Name is ANALYZER: gcp, the default, fake or scripted.
+	Name string
+	// Script is ANALYZER_SCRIPT, the script of the scripted analyzer.
+	Script string
+	// Fallback is ANALYZER_FALLBACK: none, the default, or local.
+	Fallback string
+	// Retry is read by loadRetryPolicy and Breaker by loadBreakerConfig.
+	Retry   sentiment.RetryPolicy
+	Breaker sentiment.BreakerConfig
+	// MaxInFlight is LANGUAGE_MAX_IN_FLIGHT, the number of concurrent
+	// Language API calls, sentiment.DefaultMaxInFlight by default and 0 for
+	// no limit. QueueTimeout is LANGUAGE_QUEUE_TIMEOUT, how long a call
+	// waits for a slot, sentiment.DefaultQueueTimeout by default.
+	MaxInFlight  int
+	QueueTimeout time.Duration
+	Language     languageConfig
+}
+
+// languageConfig is where the Language API clients connect and with which
+// credentials.
+type languageConfig struct {
+	// Endpoint is LANGUAGE_ENDPOINT, host:port replacing the global
+	// endpoint, for instance with the EU one, eu-language.googleapis.com:443.
+	Endpoint string
+	// EmulatorHost is LANGUAGE_EMULATOR_HOST, the host:port of an emulator,
+	// reached without TLS or credentials.
+	EmulatorHost string
+	// CredentialsFile is LANGUAGE_CREDENTIALS_FILE and CredentialsJSON
+	// LANGUAGE_CREDENTIALS_JSON, credentials replacing the default ones.
+	CredentialsFile string
+	CredentialsJSON string
+	// UserAgent is LANGUAGE_USER_AGENT, sent as the user agent.
+	UserAgent string
+}
+
+// cacheConfig selects the result cache.
+type cacheConfig struct {
+	// Backend is CACHE_BACKEND: memory, the default, redis or none.
+	Backend string
+	// MaxEntries is CACHE_MAX_ENTRIES, the size of the memory cache,
+	// api.DefaultCacheMaxEntries by default; 0 disables it.
+	MaxEntries int
+	// TTL is CACHE_TTL, api.DefaultCacheTTL by default.
+	TTL time.Duration
+	// RedisAddr is REDIS_ADDR, required by the redis backends of the cache
+	// and the quotas, and RedisKeyPrefix REDIS_KEY_PREFIX,
+	// api.DefaultRedisKeyPrefix by default.
+	RedisAddr      string
+	RedisKeyPrefix string
+}
+
+// tlsConfig is how the API listener is served over TLS, if at all: with the
+// certificate files, or with certificates obtained from Let's Encrypt for
+// AutocertHosts.
+type tlsConfig struct {
+	// CertFile is TLS_CERT_FILE and KeyFile TLS_KEY_FILE, the PEM
+	// certificate and key; ClientCAFile is TLS_CLIENT_CA_FILE, a PEM bundle
+	// of the CAs that must have signed the certificates of clients.
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// AutocertHosts is TLS_AUTOCERT_HOSTS, the comma-separated host names
+	// certificates are requested for, as they are first needed;
+	// AutocertCacheDir is TLS_AUTOCERT_CACHE_DIR, where they are kept across
+	// restarts, and AutocertEmail TLS_AUTOCERT_EMAIL, the contact address of
+	// the account.
+	AutocertHosts    []string
+	AutocertCacheDir string
+	AutocertEmail    string
+	// RedirectAddr is TLS_REDIRECT_ADDR, where plain HTTP requests are
+	// redirected to HTTPS; not at all by default.
+	RedirectAddr string
+}
+
+// enabled reports whether the API is served over TLS.
+func (tc tlsConfig) enabled() bool {
+	return tc.CertFile != "" || len(tc.AutocertHosts) > 0
+}
+
+// tracingConfig is where spans are exported.
+type tracingConfig struct {
+	// Endpoint is OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or else
+	// OTEL_EXPORTER_OTLP_ENDPOINT, the URL of the OTLP/gRPC collector.
+	// Spans are not exported without it.
+	Endpoint string
+}
+
+// pprofConfig enables the profiling endpoints.
+type pprofConfig struct {
+	// Enabled is ENABLE_PPROF, false by default.
+	Enabled bool
+	// Addr is PPROF_ADDR, defaultPprofAddr by default.
+	Addr string
+}
+
+// storageConfig selects where the analyses are stored.
+type storageConfig struct {
+	// Backend is STORAGE: none, the default, or firestore.
+	Backend string
+	// FirestoreProject is FIRESTORE_PROJECT, detected by default, and
+	// FirestoreCollection FIRESTORE_COLLECTION,
+	// api.DefaultFirestoreCollection by default.
+	FirestoreProject    string
+	FirestoreCollection string
+	// QueueSize is STORAGE_QUEUE_SIZE, api.DefaultStorageQueueSize by
+	// default.
+	QueueSize int
+}
+
+// exportConfig enables the export of analysis events to BigQuery.
+type exportConfig struct {
+	// Dataset is BIGQUERY_DATASET, which enables the export, in the project
+	// BIGQUERY_PROJECT and the table BIGQUERY_TABLE, both then required.
+	Dataset string
+	Project string
+	Table   string
+	// The ExportConfig is EXPORT_BATCH_SIZE, EXPORT_FLUSH_INTERVAL and
+	// EXPORT_MAX_BUFFERED, with the defaults of package api.
+	api.ExportConfig
+}
+
+// pubSubConfig configures the Pub/Sub worker of modePubSub and modeBoth.
+type pubSubConfig struct {
+	// Subscription is PUBSUB_SUBSCRIPTION and ResultTopic
+	// PUBSUB_RESULT_TOPIC, required by the worker, in the project
+	// PUBSUB_PROJECT, detected by default.
+	Subscription string
+	ResultTopic  string
+	Project      string
+	// The PubSubConfig is PUBSUB_CONCURRENCY and PUBSUB_ORDERING_KEYS.
+	api.PubSubConfig
+}
+
+// idTokenConfig enables the authentication of service accounts with ID
+// tokens.
+type idTokenConfig struct {
+	// ServiceAccounts is ID_TOKEN_SERVICE_ACCOUNTS, the comma-separated
+	// accounts allowed, and Audience ID_TOKEN_AUDIENCE, required with them.
+	ServiceAccounts []string
+	Audience        string
+}
+
+// asyncConfig enables asynchronous analysis through Cloud Tasks.
+type asyncConfig struct {
+	// Queue is CLOUD_TASKS_QUEUE, which enables it. HandlerURL is
+	// TASKS_HANDLER_URL, ServiceAccount TASKS_SERVICE_ACCOUNT and
+	// CallbackSecret CALLBACK_SECRET, all required with it.
+	Queue          string
+	HandlerURL     string
+	ServiceAccount string
+	CallbackSecret string
+}
+
+// errorReportingConfig enables the reporting of failed requests to Error
+// Reporting.
+type errorReportingConfig struct {
+	// Enabled is ERROR_REPORTING, false by default.
+	Enabled bool
+	// Project is ERROR_REPORTING_PROJECT, the project of the process by
+	// default.
+	Project string
+	// Service is K_SERVICE, as set by Cloud Run,
+	// defaultErrorReportingService by default.
+	Service string
+}
+
+// quotaConfig enables usage accounting and daily quotas per API key.
+type quotaConfig struct {
+	// Backend is QUOTAS, the counter: none, the default, memory or redis.
+	Backend string
+	// Default is QUOTA_REQUESTS_PER_DAY and QUOTA_CHARS_PER_DAY, 0 being
+	// unlimited, and Keys QUOTA_KEYS, which overrides them for some keys.
+	Default api.QuotaLimits
+	Keys    map[string]api.QuotaLimits
+	// ResetOffset is QUOTA_RESET_TIME, the UTC time of day usage is reset
+	// at, as HH:MM; midnight by default.
+	ResetOffset time.Duration
+}
+
+// loadConfig reads the settings of the process from e, fills in the
+// defaults and validates them.
+func loadConfig(e *env) (config, error) {
+	cfg := config{
+		Mode:      cmp.Or(e.get("MODE"), modeHTTP),
+		LogFormat: cmp.Or(e.get("LOG_FORMAT"), logFormatJSON),
+		GRPCAddr:  cmp.Or(e.get("GRPC_ADDR"), defaultGRPCAddr),
+		Project:   e.get("GOOGLE_CLOUD_PROJECT"),
+	}
+	if err := cfg.LogLevel.UnmarshalText([]byte(cmp.Or(e.get("LOG_LEVEL"), "info"))); err != nil {
+		return cfg, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	var err error
+	if cfg.Port, err = e.integer("PORT", defaultPort, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.ShutdownTimeout, err = e.duration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.SecretsRefresh, err = e.duration("SECRETS_REFRESH_INTERVAL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.H2C, err = e.boolean("H2C", false); err != nil {
+		return cfg, err
+	}
+	if cfg.API, err = loadAPIConfig(e, cfg.LogFormat, cfg.Project); err != nil {
+		return cfg, err
+	}
+	if cfg.Analyzer, err = loadAnalyzerConfig(e); err != nil {
+		return cfg, err
+	}
+	if cfg.Cache, err = loadCacheConfig(e); err != nil {
+		return cfg, err
+	}
+	cfg.TLS = tlsConfig{
+		CertFile:         e.get("TLS_CERT_FILE"),
+		KeyFile:          e.get("TLS_KEY_FILE"),
+		ClientCAFile:     e.get("TLS_CLIENT_CA_FILE"),
+		AutocertHosts:    e.list("TLS_AUTOCERT_HOSTS", nil),
+		AutocertCacheDir: e.get("TLS_AUTOCERT_CACHE_DIR"),
+		AutocertEmail:    e.get("TLS_AUTOCERT_EMAIL"),
+		RedirectAddr:     e.get("TLS_REDIRECT_ADDR"),
+	}
+	cfg.Tracing.Endpoint = cmp.Or(e.get("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), e.get("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	cfg.Pprof.Addr = cmp.Or(e.get("PPROF_ADDR"), defaultPprofAddr)
+	if cfg.Pprof.Enabled, err = e.boolean("ENABLE_PPROF", false); err != nil {
+		return cfg, err
+	}
+	if cfg.Storage, err = loadStorageConfig(e); err != nil {
+		return cfg, err
+	}
+	if cfg.Export, err = loadExportConfig(e); err != nil {
+		return cfg, err
+	}
+	if cfg.PubSub, err = loadPubSubConfig(e); err != nil {
+		return cfg, err
+	}
+	cfg.IDToken = idTokenConfig{
+		ServiceAccounts: e.list("ID_TOKEN_SERVICE_ACCOUNTS", nil),
+		Audience:        e.get("ID_TOKEN_AUDIENCE"),
+	}
+	cfg.Async = asyncConfig{
+		Queue:          e.get("CLOUD_TASKS_QUEUE"),
+		HandlerURL:     e.get("TASKS_HANDLER_URL"),
+		ServiceAccount: e.get("TASKS_SERVICE_ACCOUNT"),
+		CallbackSecret: e.get("CALLBACK_SECRET"),
+	}
+	if cfg.GCS, err = loadGCSConfig(e); err != nil {
+		return cfg, err
+	}
+	cfg.ErrorReporting = errorReportingConfig{
+		Project: e.get("ERROR_REPORTING_PROJECT"),
+		Service: cmp.Or(e.get("K_SERVICE"), defaultErrorReportingService),
+	}
+	if cfg.ErrorReporting.Enabled, err = e.boolean("ERROR_REPORTING", false); err != nil {
+		return cfg, err
+	}
+	if cfg.Quotas, err = loadQuotaConfig(e); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+// loadAnalyzerConfig reads the analyzerConfig from e.
+func loadAnalyzerConfig(e *env) (analyzerConfig, error) {
+	ac := analyzerConfig{
+		Name:     cmp.Or(e.get("ANALYZER"), "gcp"),
+		Script:   e.get("ANALYZER_SCRIPT"),
+		Fallback: cmp.Or(e.get("ANALYZER_FALLBACK"), "none"),
+		Language: languageConfig{
+			Endpoint:        e.get("LANGUAGE_ENDPOINT"),
+			EmulatorHost:    e.get("LANGUAGE_EMULATOR_HOST"),
+			CredentialsFile: e.get("LANGUAGE_CREDENTIALS_FILE"),
+			CredentialsJSON: e.get("LANGUAGE_CREDENTIALS_JSON"),
+			UserAgent:       e.get("LANGUAGE_USER_AGENT"),
+		},
+	}
+	var err error
+	if ac.Retry, err = loadRetryPolicy(e); err != nil {
+		return ac, err
+	}
+	if ac.Breaker, err = loadBreakerConfig(e); err != nil {
+		return ac, err
+	}
+	if ac.MaxInFlight, err = e.integer("LANGUAGE_MAX_IN_FLIGHT", sentiment.DefaultMaxInFlight, 0); err != nil {
+		return ac, err
+	}
+	if ac.QueueTimeout, err = e.duration("LANGUAGE_QUEUE_TIMEOUT", sentiment.DefaultQueueTimeout); err != nil {
+		return ac, err
+	}
+	return ac, nil
+}
+
+// loadCacheConfig reads the cacheConfig from e.
+func loadCacheConfig(e *env) (cacheConfig, error) {
+	cc := cacheConfig{
+		Backend:        cmp.Or(e.get("CACHE_BACKEND"), "memory"),
+		RedisAddr:      e.get("REDIS_ADDR"),
+		RedisKeyPrefix: cmp.Or(e.get("REDIS_KEY_PREFIX"), api.DefaultRedisKeyPrefix),
+	}
+	var err error
+	if cc.MaxEntries, err = e.integer("CACHE_MAX_ENTRIES", api.DefaultCacheMaxEntries, 0); err != nil {
+		return cc, err
+	}
+	if cc.TTL, err = e.duration("CACHE_TTL", api.DefaultCacheTTL); err != nil {
+		return cc, err
+	}
+	return cc, nil
+}
+
+// loadStorageConfig reads the storageConfig from e.
+func loadStorageConfig(e *env) (storageConfig, error) {
+	sc := storageConfig{
+		Backend:             cmp.Or(e.get("STORAGE"), "none"),
+		FirestoreProject:    e.get("FIRESTORE_PROJECT"),
+		FirestoreCollection: cmp.Or(e.get("FIRESTORE_COLLECTION"), api.DefaultFirestoreCollection),
+	}
+	var err error
+	if sc.QueueSize, err = e.integer("STORAGE_QUEUE_SIZE", api.DefaultStorageQueueSize, 1); err != nil {
+		return sc, err
+	}
+	return sc, nil
+}
+
+// loadExportConfig reads the exportConfig from e.
+func loadExportConfig(e *env) (exportConfig, error) {
+	ec := exportConfig{
+		Dataset: e.get("BIGQUERY_DATASET"),
+		Project: e.get("BIGQUERY_PROJECT"),
+		Table:   e.get("BIGQUERY_TABLE"),
+	}
+	var err error
+	if ec.BatchSize, err = e.integer("EXPORT_BATCH_SIZE", api.DefaultExportBatchSize, 1); err != nil {
+		return ec, err
+	}
+	if ec.FlushInterval, err = e.duration("EXPORT_FLUSH_INTERVAL", api.DefaultExportFlushInterval); err != nil {
+		return ec, err
+	}
+	if ec.MaxBuffered, err = e.integer("EXPORT_MAX_BUFFERED", max(api.DefaultExportMaxBuffered, ec.BatchSize), 1); err != nil {
+		return ec, err
+	}
+	return ec, nil
+}
+
+// loadPubSubConfig reads the pubSubConfig from e.
+func loadPubSubConfig(e *env) (pubSubConfig, error) {
+	pc := pubSubConfig{
+		Subscription: e.get("PUBSUB_SUBSCRIPTION"),
+		ResultTopic:  e.get("PUBSUB_RESULT_TOPIC"),
+		Project:      e.get("PUBSUB_PROJECT"),
+	}
+	var err error
+	if pc.Concurrency, err = e.integer("PUBSUB_CONCURRENCY", api.DefaultPubSubConcurrency, 1); err != nil {
+		return pc, err
+	}
+	if pc.OrderingKeys, err = e.boolean("PUBSUB_ORDERING_KEYS", false); err != nil {
+		return pc, err
+	}
+	return pc, nil
+}
+
+// loadGCSConfig reads GCS_BUCKETS, GCS_OUTPUT_BUCKET, GCS_OUTPUT_PREFIX and
+// GCS_CONCURRENCY. An empty GCS_OUTPUT_PREFIX writes the results at the root
+// of the bucket.
+func loadGCSConfig(e *env) (api.GCSConfig, error) {
+	gc := api.GCSConfig{
+		Buckets:      e.list("GCS_BUCKETS", nil),
+		OutputBucket: e.get("GCS_OUTPUT_BUCKET"),
+		OutputPrefix: api.DefaultGCSOutputPrefix,
+	}
+	if prefix, ok := e.lookup("GCS_OUTPUT_PREFIX"); ok {
+		gc.OutputPrefix = prefix
+	}
+	var err error
+	if gc.Concurrency, err = e.integer("GCS_CONCURRENCY", api.DefaultGCSConcurrency, 1); err != nil {
+		return gc, err
+	}
+	return gc, nil
+}
+
+// loadQuotaConfig reads the quotaConfig from e.
+func loadQuotaConfig(e *env) (quotaConfig, error) {
+	qc := quotaConfig{Backend: cmp.Or(e.get("QUOTAS"), "none")}
+	requests, err := e.integer("QUOTA_REQUESTS_PER_DAY", 0, 0)
+	if err != nil {
+		return qc, err
+	}
+	chars, err := e.integer("QUOTA_CHARS_PER_DAY", 0, 0)
+	if err != nil {
+		return qc, err
+	}
+	qc.Default = api.QuotaLimits{Requests: int64(requests), Chars: int64(chars)}
+	if qc.Keys, err = parseQuotaKeys(e.list("QUOTA_KEYS", nil)); err != nil {
+		return qc, fmt.Errorf("QUOTA_KEYS: %w", err)
+	}
+	if reset := e.get("QUOTA_RESET_TIME"); reset != "" {
+		t, err := time.Parse("15:04", reset)
+		if err != nil {
+			return qc, fmt.Errorf("QUOTA_RESET_TIME: must be HH:MM, got %q", reset)
+		}
+		qc.ResetOffset = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return qc, nil
+}
+
+// validate checks the choices among fixed options, the ranges no single
+// reader checks, and the settings that depend on one another.
+func (cfg config) validate() error {
+	switch cfg.Mode {
+	case modeHTTP, modePubSub, modeBoth:
+	default:
+		return fmt.Errorf("MODE: unknown mode %q", cfg.Mode)
+	}
+	switch cfg.LogFormat {
+	case logFormatJSON, logFormatText, logFormatGCP:
+	default:
+		return fmt.Errorf("LOG_FORMAT: unknown format %q: must be %s, %s or %s", cfg.LogFormat, logFormatJSON, logFormatText, logFormatGCP)
+	}
+	if cfg.Port > 65535 {
+		return fmt.Errorf("PORT: must be at most 65535, got %d", cfg.Port)
+	}
+	if cfg.API.LoadShedding.QueueTimeout > 0 && cfg.API.LoadShedding.MaxInFlight == 0 {
+		return errors.New("IN_FLIGHT_QUEUE_TIMEOUT: set MAX_IN_FLIGHT_REQUESTS as well, requests only queue beyond a limit")
+	}
+
+	if err := cfg.Analyzer.validate(); err != nil {
+		return err
+	}
+
+	switch cfg.Cache.Backend {
+	case "memory", "none":
+	case "redis":
+		if cfg.Cache.RedisAddr == "" {
+			return errors.New("REDIS_ADDR is required when CACHE_BACKEND is redis")
+		}
+	default:
+		return fmt.Errorf("CACHE_BACKEND: unknown backend %q", cfg.Cache.Backend)
+	}
+
+	if err := cfg.validateListeners(); err != nil {
+		return err
+	}
+	if err := cfg.validateServices(); err != nil {
+		return err
+	}
+	return cfg.validateQuotas()
+}
+
+// validate checks the analyzer, its fallback, the retry delays and the
+// connection settings of the Language API.
+func (ac analyzerConfig) validate() error {
+	switch ac.Name {
+	case "gcp", "fake":
+		if ac.Script != "" {
+			return errors.New("ANALYZER_SCRIPT: only the scripted analyzer reads a script, set ANALYZER=scripted or unset it")
+		}
+	case "scripted":
+		if ac.Script == "" {
+			return errors.New("ANALYZER: ANALYZER_SCRIPT must be set for the scripted analyzer")
+		}
+	default:
+		return fmt.Errorf("ANALYZER: unknown analyzer %q", ac.Name)
+	}
+	switch ac.Fallback {
+	case "none", "local":
+	default:
+		return fmt.Errorf("ANALYZER_FALLBACK: unknown fallback %q", ac.Fallback)
+	}
+	if ac.Retry.BaseDelay > ac.Retry.MaxDelay {
+		return fmt.Errorf("RETRY_BASE_DELAY: must not exceed RETRY_MAX_DELAY, %s, got %s", ac.Retry.MaxDelay, ac.Retry.BaseDelay)
+	}
+
+	lc := ac.Language
+	switch {
+	case lc.EmulatorHost != "" && lc.Endpoint != "":
+		return errors.New("LANGUAGE_EMULATOR_HOST: unset LANGUAGE_ENDPOINT, the emulator replaces it")
+	case lc.EmulatorHost != "" && (lc.CredentialsFile != "" || lc.CredentialsJSON != ""):
+		return errors.New("LANGUAGE_EMULATOR_HOST: unset LANGUAGE_CREDENTIALS_FILE and LANGUAGE_CREDENTIALS_JSON, the emulator takes no credentials")
+	case lc.CredentialsFile != "" && lc.CredentialsJSON != "":
+		return errors.New("LANGUAGE_CREDENTIALS_JSON: unset LANGUAGE_CREDENTIALS_FILE, only one of them may be set")
+	}
+	if lc.Endpoint != "" {
+		if _, _, err := net.SplitHostPort(lc.Endpoint); err != nil {
+			return fmt.Errorf("LANGUAGE_ENDPOINT: must be host:port, such as eu-language.googleapis.com:443: %w", err)
+		}
+	}
+	if lc.EmulatorHost != "" {
+		if _, _, err := net.SplitHostPort(lc.EmulatorHost); err != nil {
+			return fmt.Errorf("LANGUAGE_EMULATOR_HOST: must be host:port, such as localhost:8085: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateListeners checks the settings of what the process listens on:
+// TLS, h2c, the profiling endpoints and the trace exporter.
+func (cfg config) validateListeners() error {
+	tc := cfg.TLS
+	switch {
+	case len(tc.AutocertHosts) > 0 && (tc.CertFile != "" || tc.KeyFile != "" || tc.ClientCAFile != ""):
+		return errors.New("TLS_AUTOCERT_HOSTS: unset TLS_CERT_FILE, TLS_KEY_FILE and TLS_CLIENT_CA_FILE, the certificates are obtained from Let's Encrypt")
+	case len(tc.AutocertHosts) > 0 && tc.AutocertCacheDir == "":
+		return errors.New("TLS_AUTOCERT_HOSTS: TLS_AUTOCERT_CACHE_DIR must be set as well, or every restart requests new certificates")
+	case (tc.CertFile == "") != (tc.KeyFile == ""):
+		return errors.New("TLS_CERT_FILE: TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case tc.ClientCAFile != "" && tc.CertFile == "":
+		return errors.New("TLS_CLIENT_CA_FILE: set TLS_CERT_FILE and TLS_KEY_FILE as well, clients are only verified over TLS")
+	case tc.RedirectAddr != "" && !tc.enabled():
+		return errors.New("TLS_REDIRECT_ADDR: set TLS_CERT_FILE or TLS_AUTOCERT_HOSTS, the API is not served over TLS")
+	case cfg.H2C && tc.enabled():
+		return errors.New("H2C: the API is served over TLS, which negotiates HTTP/2 already")
+	}
+
+	if cfg.Pprof.Enabled {
+		_, port, err := net.SplitHostPort(cfg.Pprof.Addr)
+		if err != nil {
+			return fmt.Errorf("PPROF_ADDR: %w", err)
+		}
+		if port == strconv.Itoa(cfg.Port) {
+			return fmt.Errorf("PPROF_ADDR: must not use the API port %d", cfg.Port)
+		}
+	}
+
+	if cfg.Tracing.Endpoint != "" {
+		u, err := url.Parse(cfg.Tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT: must be an http or https URL, such as http://localhost:4317, got %q", cfg.Tracing.Endpoint)
+		}
+	}
+	return nil
+}
+
+// validateServices checks the settings of the Google Cloud services the
+// process may use, each of which requires some settings once enabled.
+func (cfg config) validateServices() error {
+	switch cfg.Storage.Backend {
+	case "none", "firestore":
+	default:
+		return fmt.Errorf("STORAGE: unknown backend %q", cfg.Storage.Backend)
+	}
+	if cfg.Export.Dataset != "" && (cfg.Export.Project == "" || cfg.Export.Table == "") {
+		return errors.New("BIGQUERY_DATASET: BIGQUERY_PROJECT and BIGQUERY_TABLE must be set as well")
+	}
+	if cfg.Export.MaxBuffered < cfg.Export.BatchSize {
+		return fmt.Errorf("EXPORT_MAX_BUFFERED: must be at least EXPORT_BATCH_SIZE, %d, got %d", cfg.Export.BatchSize, cfg.Export.MaxBuffered)
+	}
+	if cfg.Mode != modeHTTP && (cfg.PubSub.Subscription == "" || cfg.PubSub.ResultTopic == "") {
+		return errors.New("MODE: PUBSUB_SUBSCRIPTION and PUBSUB_RESULT_TOPIC must be set")
+	}
+	if len(cfg.IDToken.ServiceAccounts) > 0 && cfg.IDToken.Audience == "" {
+		return errors.New("ID_TOKEN_SERVICE_ACCOUNTS: ID_TOKEN_AUDIENCE must be set as well")
+	}
+	ac := cfg.Async
+	if ac.Queue != "" && (ac.HandlerURL == "" || ac.ServiceAccount == "" || ac.CallbackSecret == "") {
+		return errors.New("CLOUD_TASKS_QUEUE: TASKS_HANDLER_URL, TASKS_SERVICE_ACCOUNT and CALLBACK_SECRET must be set as well")
+	}
+	return nil
+}
+
+// validateQuotas checks the quota counter, which needs API keys to count
+// for.
+func (cfg config) validateQuotas() error {
+	switch cfg.Quotas.Backend {
+	case "none":
+		return nil
+	case "memory":
+	case "redis":
+		if cfg.Cache.RedisAddr == "" {
+			return errors.New("REDIS_ADDR is required when QUOTAS is redis")
+		}
+	default:
+		return fmt.Errorf("QUOTAS: unknown backend %q", cfg.Quotas.Backend)
+	}
+	if len(cfg.API.APIKeys) == 0 {
+		return errors.New("QUOTAS: quotas apply to API keys, set API_KEYS or API_KEYS_FILE")
+	}
+	return nil
+}
+
+// duration reads a time.Duration such as "10s" from the variable name,
+// falling back to def when it is unset.
+func (e *env) duration(name string, def time.Duration) (time.Duration, error) {
+	v := e.get(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: must be positive, got %s", name, v)
+	}
+	return d, nil
+}
+
+// integer reads an integer of at least atLeast from the variable name,
+// falling back to def when it is unset.
+func (e *env) integer(name string, def, atLeast int) (int, error) {
+	v := e.get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if n < atLeast {
+		return 0, fmt.Errorf("%s: must be at least %d, got %d", name, atLeast, n)
+	}
+	return n, nil
+}
+
+// list reads a comma-separated list from the variable name, falling back to
+// def when it is unset. Items are trimmed and empty items are dropped.
+func (e *env) list(name string, def []string) []string {
+	v, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// boolean reads a boolean such as "true" or "0" from the variable name,
+// falling back to def when it is unset.
+func (e *env) boolean(name string, def bool) (bool, error) {
+	v := e.get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+// float reads a non-negative number from the variable name, falling back to
+// def when it is unset.
+func (e *env) float(name string, def float64) (float64, error) {
+	v := e.get(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if f < 0 {
+		return 0, fmt.Errorf("%s: must not be negative, got %s", name, v)
+	}
+	return f, nil
+}
+
+// configAttrs returns the settings of cfg as log attributes. API keys and
+// signing secrets are only counted and the admin credentials only reported
+// as set.
+func configAttrs(cfg api.Config) []any {
+	scorePrecision := "none"
+	if cfg.ScorePrecision != nil {
+		scorePrecision = strconv.Itoa(*cfg.ScorePrecision)
+	}
+	return []any{
+		"request_timeout", cfg.RequestTimeout.String(),
+		"max_text_bytes", cfg.MaxTextBytes,
+		"max_chunks", cfg.MaxChunks,
+		"max_body_bytes", cfg.MaxBodyBytes,
+		"lenient_json", cfg.LenientJSON,
+		"max_batch_items", cfg.MaxBatchItems,
+		"batch_concurrency", cfg.BatchConcurrency,
+		"max_file_bytes", cfg.MaxFileBytes,
+		"feed_max_entries", cfg.FeedMaxEntries,
+		"urls_timeout", cfg.URLsTimeout.String(),
+		"trusted_proxy_hops", cfg.TrustedProxyHops,
+		"neutral_band", cfg.NeutralBand,
+		"score_precision", scorePrecision,
+		"idempotency_ttl", cfg.IdempotencyTTL.String(),
+		"history_preview_bytes", cfg.HistoryPreviewBytes,
+		"slow_request_threshold", cfg.SlowRequestThreshold.String(),
+		"api_keys", len(cfg.APIKeys),
+		"signing_secrets", len(cfg.SigningSecrets),
+		"signature_max_skew", cfg.SignatureMaxSkew.String(),
+		"debug_api_keys", len(cfg.DebugAPIKeys),
+		"admin_api_keys", len(cfg.AdminAPIKeys),
+		"admin_basic_auth", cfg.AdminAuth.Username != "",
+		"api_allowed_cidrs", cfg.APIIPFilter.Allow,
+		"api_denied_cidrs", cfg.APIIPFilter.Deny,
+		"admin_allowed_cidrs", cfg.AdminIPFilter.Allow,
+		"admin_denied_cidrs", cfg.AdminIPFilter.Deny,
+		"debug", cfg.Debug,
+		"rate_limit_rps", cfg.RateLimit.RPS,
+		"rate_limit_burst", cfg.RateLimit.Burst,
+		"max_in_flight_requests", cfg.LoadShedding.MaxInFlight,
+		"in_flight_queue_timeout", cfg.LoadShedding.QueueTimeout.String(),
+		"cors_allowed_origins", cfg.CORS.AllowedOrigins,
+		"x_frame_options", cfg.SecurityHeaders.FrameOptions,
+		"referrer_policy", cfg.SecurityHeaders.ReferrerPolicy,
+		"docs_content_security_policy", cfg.SecurityHeaders.DocsCSP,
+		"strict_transport_security", cfg.SecurityHeaders.HSTS,
+		"access_log_format", cfg.AccessLog.Format,
+		"access_log_exclude", cfg.AccessLog.Exclude,
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// testEnv returns the env of vars alone, whatever the environment of the
+// test process.
+func testEnv(vars map[string]string) *env {
+	return &env{vars: vars}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig(testEnv(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"Mode", cfg.Mode, modeHTTP},
+		{"LogFormat", cfg.LogFormat, logFormatJSON},
+		{"LogLevel", cfg.LogLevel.String(), "INFO"},
+		{"Port", cfg.Port, defaultPort},
+		{"GRPCAddr", cfg.GRPCAddr, defaultGRPCAddr},
+		{"ShutdownTimeout", cfg.ShutdownTimeout, defaultShutdownTimeout},
+		{"SecretsRefresh", cfg.SecretsRefresh, time.Duration(0)},
+		{"H2C", cfg.H2C, false},
+		{"Analyzer.Name", cfg.Analyzer.Name, "gcp"},
+		{"Analyzer.Fallback", cfg.Analyzer.Fallback, "none"},
+		{"Analyzer.MaxInFlight", cfg.Analyzer.MaxInFlight, sentiment.DefaultMaxInFlight},
+		{"Analyzer.QueueTimeout", cfg.Analyzer.QueueTimeout, sentiment.DefaultQueueTimeout},
+		{"Cache.Backend", cfg.Cache.Backend, "memory"},
+		{"Cache.MaxEntries", cfg.Cache.MaxEntries, api.DefaultCacheMaxEntries},
+		{"Cache.TTL", cfg.Cache.TTL, api.DefaultCacheTTL},
+		{"Cache.RedisKeyPrefix", cfg.Cache.RedisKeyPrefix, api.DefaultRedisKeyPrefix},
+		{"TLS.enabled", cfg.TLS.enabled(), false},
+		{"Tracing.Endpoint", cfg.Tracing.Endpoint, ""},
+		{"Pprof.Enabled", cfg.Pprof.Enabled, false},
+		{"Pprof.Addr", cfg.Pprof.Addr, defaultPprofAddr},
+		{"Storage.Backend", cfg.Storage.Backend, "none"},
+		{"Storage.FirestoreCollection", cfg.Storage.FirestoreCollection, api.DefaultFirestoreCollection},
+		{"Storage.QueueSize", cfg.Storage.QueueSize, api.DefaultStorageQueueSize},
+		{"Export.Dataset", cfg.Export.Dataset, ""},
+		{"Export.BatchSize", cfg.Export.BatchSize, api.DefaultExportBatchSize},
+		{"Export.FlushInterval", cfg.Export.FlushInterval, api.DefaultExportFlushInterval},
+		{"Export.MaxBuffered", cfg.Export.MaxBuffered, max(api.DefaultExportMaxBuffered, api.DefaultExportBatchSize)},
+		{"PubSub.Concurrency", cfg.PubSub.Concurrency, api.DefaultPubSubConcurrency},
+		{"PubSub.OrderingKeys", cfg.PubSub.OrderingKeys, false},
+		{"GCS.OutputPrefix", cfg.GCS.OutputPrefix, api.DefaultGCSOutputPrefix},
+		{"GCS.Concurrency", cfg.GCS.Concurrency, api.DefaultGCSConcurrency},
+		{"ErrorReporting.Enabled", cfg.ErrorReporting.Enabled, false},
+		{"ErrorReporting.Service", cfg.ErrorReporting.Service, defaultErrorReportingService},
+		{"Quotas.Backend", cfg.Quotas.Backend, "none"},
+		{"Quotas.ResetOffset", cfg.Quotas.ResetOffset, time.Duration(0)},
+		{"API.ScorePrecision set", cfg.API.ScorePrecision != nil, false},
+		{"API.SecurityHeaders", cfg.API.SecurityHeaders, api.DefaultSecurityHeaders()},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoadConfigSettings(t *testing.T) {
+	cfg, err := loadConfig(testEnv(map[string]string{
+		"MODE":                               modeBoth,
+		"PORT":                               "8443",
+		"GOOGLE_CLOUD_PROJECT":               "proj",
+		"TLS_CERT_FILE":                      "cert.pem",
+		"TLS_KEY_FILE":                       "key.pem",
+		"TLS_CLIENT_CA_FILE":                 "ca.pem",
+		"TLS_REDIRECT_ADDR":                  ":8080",
+		"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4317",
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://traces:4317",
+		"ENABLE_PPROF":                       "true",
+		"PPROF_ADDR":                         "localhost:7070",
+		"STORAGE":                            "firestore",
+		"FIRESTORE_PROJECT":                  "fs-proj",
+		"STORAGE_QUEUE_SIZE":                 "7",
+		"BIGQUERY_DATASET":                   "ds",
+		"BIGQUERY_PROJECT":                   "bq-proj",
+		"BIGQUERY_TABLE":                     "events",
+		"EXPORT_BATCH_SIZE":                  "20",
+		"PUBSUB_SUBSCRIPTION":                "sub",
+		"PUBSUB_RESULT_TOPIC":                "topic",
+		"PUBSUB_ORDERING_KEYS":               "true",
+		"ID_TOKEN_SERVICE_ACCOUNTS":          "a@x.iam.gserviceaccount.com, b@x.iam.gserviceaccount.com",
+		"ID_TOKEN_AUDIENCE":                  "https://api.example.com",
+		"GCS_BUCKETS":                        "in",
+		"GCS_OUTPUT_PREFIX":                  "",
+		"ERROR_REPORTING":                    "1",
+		"K_SERVICE":                          "svc",
+		"API_KEYS":                           "k1",
+		"QUOTAS":                             "memory",
+		"QUOTA_REQUESTS_PER_DAY":             "100",
+		"QUOTA_KEYS":                         "k1:5:0",
+		"QUOTA_RESET_TIME":                   "06:30",
+		"LANGUAGE_ENDPOINT":                  "eu-language.googleapis.com:443",
+		"LANGUAGE_USER_AGENT":                "ua",
+		"SCORE_PRECISION":                    "0",
+		"X_FRAME_OPTIONS":                    "SAMEORIGIN",
+		"STRICT_TRANSPORT_SECURITY":          "",
+	}))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"Project", cfg.Project, "proj"},
+		{"TLS.ClientCAFile", cfg.TLS.ClientCAFile, "ca.pem"},
+		{"TLS.RedirectAddr", cfg.TLS.RedirectAddr, ":8080"},
+		// The traces-specific endpoint wins, as for the OTLP exporter.
+		{"Tracing.Endpoint", cfg.Tracing.Endpoint, "http://traces:4317"},
+		{"Pprof.Addr", cfg.Pprof.Addr, "localhost:7070"},
+		{"Storage.FirestoreProject", cfg.Storage.FirestoreProject, "fs-proj"},
+		{"Storage.QueueSize", cfg.Storage.QueueSize, 7},
+		{"Export.Table", cfg.Export.Table, "events"},
+		{"Export.BatchSize", cfg.Export.BatchSize, 20},
+		{"PubSub.Subscription", cfg.PubSub.Subscription, "sub"},
+		{"PubSub.OrderingKeys", cfg.PubSub.OrderingKeys, true},
+		{"IDToken.ServiceAccounts", len(cfg.IDToken.ServiceAccounts), 2},
+		// An empty prefix is kept: the results go to the root of the bucket.
+		{"GCS.OutputPrefix", cfg.GCS.OutputPrefix, ""},
+		{"ErrorReporting.Enabled", cfg.ErrorReporting.Enabled, true},
+		{"ErrorReporting.Service", cfg.ErrorReporting.Service, "svc"},
+		{"Quotas.Default.Requests", cfg.Quotas.Default.Requests, int64(100)},
+		{"Quotas.Keys[k1]", cfg.Quotas.Keys["k1"], api.QuotaLimits{Requests: 5}},
+		{"Quotas.ResetOffset", cfg.Quotas.ResetOffset, 6*time.Hour + 30*time.Minute},
+		{"Analyzer.Language.Endpoint", cfg.Analyzer.Language.Endpoint, "eu-language.googleapis.com:443"},
+		{"Analyzer.Language.UserAgent", cfg.Analyzer.Language.UserAgent, "ua"},
+		{"API.SecurityHeaders.FrameOptions", cfg.API.SecurityHeaders.FrameOptions, "SAMEORIGIN"},
+		{"API.SecurityHeaders.ReferrerPolicy", cfg.API.SecurityHeaders.ReferrerPolicy, api.DefaultSecurityHeaders().ReferrerPolicy},
+		// An empty value leaves the header out.
+		{"API.SecurityHeaders.HSTS", cfg.API.SecurityHeaders.HSTS, ""},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	// 0 is a precision, of whole numbers.
+	if p := cfg.API.ScorePrecision; p == nil || *p != 0 {
+		t.Errorf("API.ScorePrecision = %v, want 0", p)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		// want is the start of the error, the variable it is about.
+		want string
+	}{
+		{"unknown mode", map[string]string{"MODE": "batch"}, "MODE: unknown mode"},
+		{"unknown log format", map[string]string{"LOG_FORMAT": "xml"}, "LOG_FORMAT: unknown format"},
+		{"unknown log level", map[string]string{"LOG_LEVEL": "loud"}, "LOG_LEVEL:"},
+		{"port not a number", map[string]string{"PORT": "http"}, "PORT:"},
+		{"port zero", map[string]string{"PORT": "0"}, "PORT: must be at least 1"},
+		{"port too high", map[string]string{"PORT": "65536"}, "PORT: must be at most 65535"},
+		{"negative shutdown timeout", map[string]string{"SHUTDOWN_TIMEOUT": "-1s"}, "SHUTDOWN_TIMEOUT: must be positive"},
+		{"h2c not a boolean", map[string]string{"H2C": "maybe"}, "H2C:"},
+		{"queue timeout without limit", map[string]string{"IN_FLIGHT_QUEUE_TIMEOUT": "1s"}, "IN_FLIGHT_QUEUE_TIMEOUT:"},
+		{"negative neutral band", map[string]string{"NEUTRAL_BAND": "-0.1"}, "NEUTRAL_BAND: must not be negative"},
+		{"neutral band of 1", map[string]string{"NEUTRAL_BAND": "1"}, "NEUTRAL_BAND: must be less than 1"},
+		{"negative score precision", map[string]string{"SCORE_PRECISION": "-1"}, "SCORE_PRECISION: must be at least 0"},
+
+		{"unknown analyzer", map[string]string{"ANALYZER": "magic"}, "ANALYZER: unknown analyzer"},
+		{"script without scripted analyzer", map[string]string{"ANALYZER_SCRIPT": "s.json"}, "ANALYZER_SCRIPT:"},
+		{"scripted analyzer without script", map[string]string{"ANALYZER": "scripted"}, "ANALYZER: ANALYZER_SCRIPT must be set"},
+		{"unknown fallback", map[string]string{"ANALYZER_FALLBACK": "remote"}, "ANALYZER_FALLBACK: unknown fallback"},
+		{"base delay above max delay", map[string]string{"RETRY_BASE_DELAY": "2s", "RETRY_MAX_DELAY": "1s"}, "RETRY_BASE_DELAY:"},
+		{"emulator and endpoint", map[string]string{"LANGUAGE_EMULATOR_HOST": "localhost:8085", "LANGUAGE_ENDPOINT": "eu-language.googleapis.com:443"}, "LANGUAGE_EMULATOR_HOST: unset LANGUAGE_ENDPOINT"},
+		{"emulator and credentials", map[string]string{"LANGUAGE_EMULATOR_HOST": "localhost:8085", "LANGUAGE_CREDENTIALS_JSON": "{}"}, "LANGUAGE_EMULATOR_HOST: unset LANGUAGE_CREDENTIALS_FILE"},
+		{"two credentials", map[string]string{"LANGUAGE_CREDENTIALS_FILE": "c.json", "LANGUAGE_CREDENTIALS_JSON": "{}"}, "LANGUAGE_CREDENTIALS_JSON:"},
+		{"endpoint without port", map[string]string{"LANGUAGE_ENDPOINT": "eu-language.googleapis.com"}, "LANGUAGE_ENDPOINT: must be host:port"},
+		{"emulator without port", map[string]string{"LANGUAGE_EMULATOR_HOST": "localhost"}, "LANGUAGE_EMULATOR_HOST: must be host:port"},
+
+		{"unknown cache backend", map[string]string{"CACHE_BACKEND": "disk"}, "CACHE_BACKEND: unknown backend"},
+		{"redis cache without address", map[string]string{"CACHE_BACKEND": "redis"}, "REDIS_ADDR is required when CACHE_BACKEND is redis"},
+
+		{"autocert and files", map[string]string{"TLS_AUTOCERT_HOSTS": "api.example.com", "TLS_AUTOCERT_CACHE_DIR": "/tmp", "TLS_CERT_FILE": "c.pem", "TLS_KEY_FILE": "k.pem"}, "TLS_AUTOCERT_HOSTS: unset TLS_CERT_FILE"},
+		{"autocert without cache", map[string]string{"TLS_AUTOCERT_HOSTS": "api.example.com"}, "TLS_AUTOCERT_HOSTS: TLS_AUTOCERT_CACHE_DIR must be set"},
+		{"certificate without key", map[string]string{"TLS_CERT_FILE": "c.pem"}, "TLS_CERT_FILE: TLS_CERT_FILE and TLS_KEY_FILE must be set together"},
+		{"key without certificate", map[string]string{"TLS_KEY_FILE": "k.pem"}, "TLS_CERT_FILE: TLS_CERT_FILE and TLS_KEY_FILE must be set together"},
+		{"client CA without TLS", map[string]string{"TLS_CLIENT_CA_FILE": "ca.pem"}, "TLS_CLIENT_CA_FILE:"},
+		{"redirect without TLS", map[string]string{"TLS_REDIRECT_ADDR": ":80"}, "TLS_REDIRECT_ADDR:"},
+		{"h2c with TLS", map[string]string{"H2C": "true", "TLS_CERT_FILE": "c.pem", "TLS_KEY_FILE": "k.pem"}, "H2C:"},
+		{"pprof address without port", map[string]string{"ENABLE_PPROF": "true", "PPROF_ADDR": "localhost"}, "PPROF_ADDR:"},
+		{"pprof on the API port", map[string]string{"ENABLE_PPROF": "true", "PPROF_ADDR": "localhost:8080"}, "PPROF_ADDR: must not use the API port"},
+		{"OTLP endpoint without scheme", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4317"}, "OTEL_EXPORTER_OTLP_ENDPOINT: must be an http or https URL"},
+
+		{"unknown storage", map[string]string{"STORAGE": "sql"}, "STORAGE: unknown backend"},
+		{"storage queue size zero", map[string]string{"STORAGE_QUEUE_SIZE": "0"}, "STORAGE_QUEUE_SIZE: must be at least 1"},
+		{"dataset without table", map[string]string{"BIGQUERY_DATASET": "ds", "BIGQUERY_PROJECT": "p"}, "BIGQUERY_DATASET: BIGQUERY_PROJECT and BIGQUERY_TABLE"},
+		{"buffer below batch", map[string]string{"EXPORT_BATCH_SIZE": "50", "EXPORT_MAX_BUFFERED": "10"}, "EXPORT_MAX_BUFFERED: must be at least EXPORT_BATCH_SIZE"},
+		{"flush interval zero", map[string]string{"EXPORT_FLUSH_INTERVAL": "0s"}, "EXPORT_FLUSH_INTERVAL: must be positive"},
+		{"pubsub mode without subscription", map[string]string{"MODE": modePubSub, "PUBSUB_RESULT_TOPIC": "t"}, "MODE: PUBSUB_SUBSCRIPTION and PUBSUB_RESULT_TOPIC"},
+		{"both modes without topic", map[string]string{"MODE": modeBoth, "PUBSUB_SUBSCRIPTION": "s"}, "MODE: PUBSUB_SUBSCRIPTION and PUBSUB_RESULT_TOPIC"},
+		{"pubsub concurrency zero", map[string]string{"PUBSUB_CONCURRENCY": "0"}, "PUBSUB_CONCURRENCY: must be at least 1"},
+		{"service accounts without audience", map[string]string{"ID_TOKEN_SERVICE_ACCOUNTS": "a@x"}, "ID_TOKEN_SERVICE_ACCOUNTS: ID_TOKEN_AUDIENCE"},
+		{"queue without callback secret", map[string]string{"CLOUD_TASKS_QUEUE": "q", "TASKS_HANDLER_URL": "https://h", "TASKS_SERVICE_ACCOUNT": "a@x"}, "CLOUD_TASKS_QUEUE:"},
+		{"GCS concurrency zero", map[string]string{"GCS_CONCURRENCY": "0"}, "GCS_CONCURRENCY: must be at least 1"},
+		{"error reporting not a boolean", map[string]string{"ERROR_REPORTING": "yes please"}, "ERROR_REPORTING:"},
+
+		{"unknown quota backend", map[string]string{"QUOTAS": "disk", "API_KEYS": "k"}, "QUOTAS: unknown backend"},
+		{"quotas without API keys", map[string]string{"QUOTAS": "memory"}, "QUOTAS: quotas apply to API keys"},
+		{"redis quotas without address", map[string]string{"QUOTAS": "redis", "API_KEYS": "k"}, "REDIS_ADDR is required when QUOTAS is redis"},
+		{"negative quota", map[string]string{"QUOTA_CHARS_PER_DAY": "-1"}, "QUOTA_CHARS_PER_DAY: must be at least 0"},
+		{"malformed quota key", map[string]string{"QUOTA_KEYS": "k:1"}, "QUOTA_KEYS:"},
+		{"malformed reset time", map[string]string{"QUOTA_RESET_TIME": "6am"}, "QUOTA_RESET_TIME: must be HH:MM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(testEnv(tt.vars))
+			if err == nil {
+				t.Fatalf("loadConfig succeeded, want an error starting with %q", tt.want)
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("loadConfig error = %q, want it to start with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvExplain(t *testing.T) {
+	file := &configFile{
+		path:   "config.yaml",
+		fields: map[string]fileField{"PORT": {key: "server.port", line: 3}},
+		values: map[string]string{"PORT": "0"},
+	}
+
+	e := &env{vars: map[string]string{}, file: file}
+	_, err := loadConfig(e)
+	if err == nil {
+		t.Fatal("loadConfig succeeded with PORT 0")
+	}
+	if got, want := e.explain(err).Error(), "config.yaml:3: server.port: PORT: must be at least 1, got 0"; got != want {
+		t.Errorf("explain = %q, want %q", got, want)
+	}
+
+	// The environment overrides the file, so the error is about its value.
+	e = &env{vars: map[string]string{"PORT": "0"}, file: file}
+	if _, err = loadConfig(e); err == nil {
+		t.Fatal("loadConfig succeeded with PORT 0")
+	}
+	if got := e.explain(err).Error(); strings.HasPrefix(got, "config.yaml") {
+		t.Errorf("explain = %q, want no file position for a variable of the environment", got)
+	}
+}
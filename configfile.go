@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the schema of the file given with -config, in YAML or JSON.
+// Every setting stands for the environment variable of its env tag: a
+// variable that is set, even to an empty value, overrides the file, and the
+// defaults apply to what neither sets. See config.example.yaml.
+type fileConfig struct {
+	Mode           string        `yaml:"mode" env:"MODE"`
+	LogFormat      string        `yaml:"log_format" env:"LOG_FORMAT"`
+	LogLevel       string        `yaml:"log_level" env:"LOG_LEVEL"`
+	Project        string        `yaml:"project" env:"GOOGLE_CLOUD_PROJECT"`
+	SecretsRefresh time.Duration `yaml:"secrets_refresh_interval" env:"SECRETS_REFRESH_INTERVAL"`
+
+	Server struct {
+		Port                 int           `yaml:"port" env:"PORT"`
+		GRPCAddr             string        `yaml:"grpc_addr" env:"GRPC_ADDR"`
+		ShutdownTimeout      time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+		RequestTimeout       time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT"`
+		TrustedProxyHops     int           `yaml:"trusted_proxy_hops" env:"TRUSTED_PROXY_HOPS"`
+		H2C                  bool          `yaml:"h2c" env:"H2C"`
+		MaxInFlightRequests  int           `yaml:"max_in_flight_requests" env:"MAX_IN_FLIGHT_REQUESTS"`
+		InFlightQueueTimeout time.Duration `yaml:"in_flight_queue_timeout" env:"IN_FLIGHT_QUEUE_TIMEOUT"`
+		SlowRequestThreshold time.Duration `yaml:"slow_request_threshold" env:"SLOW_REQUEST_THRESHOLD"`
+		URLsTimeout          time.Duration `yaml:"urls_timeout" env:"URLS_TIMEOUT"`
+		IdempotencyTTL       time.Duration `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+		LenientJSON          bool          `yaml:"lenient_json" env:"LENIENT_JSON"`
+		DebugResponses       bool          `yaml:"debug_responses" env:"DEBUG_RESPONSES"`
+	} `yaml:"server"`
+
+	Limits struct {
+		MaxTextBytes        int `yaml:"max_text_bytes" env:"MAX_TEXT_BYTES"`
+		MaxChunks           int `yaml:"max_chunks" env:"MAX_CHUNKS"`
+		MaxBodyBytes        int `yaml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+		MaxBatchItems       int `yaml:"max_batch_items" env:"MAX_BATCH_ITEMS"`
+		BatchConcurrency    int `yaml:"batch_concurrency" env:"BATCH_CONCURRENCY"`
+		MaxFileBytes        int `yaml:"max_file_bytes" env:"MAX_FILE_BYTES"`
+		FeedMaxEntries      int `yaml:"feed_max_entries" env:"FEED_MAX_ENTRIES"`
+		HistoryPreviewBytes int `yaml:"history_preview_bytes" env:"HISTORY_PREVIEW_BYTES"`
+	} `yaml:"limits"`
+
+	Analyzer struct {
+		Provider       string  `yaml:"provider" env:"ANALYZER"`
+		Script         string  `yaml:"script" env:"ANALYZER_SCRIPT"`
+		Fallback       string  `yaml:"fallback" env:"ANALYZER_FALLBACK"`
+		NeutralBand    float64 `yaml:"neutral_band" env:"NEUTRAL_BAND"`
+		ScorePrecision int     `yaml:"score_precision" env:"SCORE_PRECISION"`
+	} `yaml:"analyzer"`
+
+	Language struct {
+		Endpoint           string        `yaml:"endpoint" env:"LANGUAGE_ENDPOINT"`
+		EmulatorHost       string        `yaml:"emulator_host" env:"LANGUAGE_EMULATOR_HOST"`
+		CredentialsFile    string        `yaml:"credentials_file" env:"LANGUAGE_CREDENTIALS_FILE"`
+		CredentialsJSON    string        `yaml:"credentials_json" env:"LANGUAGE_CREDENTIALS_JSON"`
+		UserAgent          string        `yaml:"user_agent" env:"LANGUAGE_USER_AGENT"`
+		MaxInFlight        int           `yaml:"max_in_flight" env:"LANGUAGE_MAX_IN_FLIGHT"`
+		QueueTimeout       time.Duration `yaml:"queue_timeout" env:"LANGUAGE_QUEUE_TIMEOUT"`
+		RetryMaxAttempts   int           `yaml:"retry_max_attempts" env:"RETRY_MAX_ATTEMPTS"`
+		RetryBaseDelay     time.Duration `yaml:"retry_base_delay" env:"RETRY_BASE_DELAY"`
+		RetryMaxDelay      time.Duration `yaml:"retry_max_delay" env:"RETRY_MAX_DELAY"`
+		BreakerFailureRate float64       `yaml:"breaker_failure_rate" env:"BREAKER_FAILURE_RATE"`
+		BreakerMinRequests int           `yaml:"breaker_min_requests" env:"BREAKER_MIN_REQUESTS"`
+		BreakerWindow      time.Duration `yaml:"breaker_window" env:"BREAKER_WINDOW"`
+		BreakerOpenTimeout time.Duration `yaml:"breaker_open_timeout" env:"BREAKER_OPEN_TIMEOUT"`
+	} `yaml:"language"`
+
+	Cache struct {
+		Backend        string        `yaml:"backend" env:"CACHE_BACKEND"`
+		MaxEntries     int           `yaml:"max_entries" env:"CACHE_MAX_ENTRIES"`
+		TTL            time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+		RedisAddr      string        `yaml:"redis_addr" env:"REDIS_ADDR"`
+		RedisKeyPrefix string        `yaml:"redis_key_prefix" env:"REDIS_KEY_PREFIX"`
+	} `yaml:"cache"`
+
+	Auth struct {
+		APIKeys           []string      `yaml:"api_keys" env:"API_KEYS"`
+		APIKeysFile       string        `yaml:"api_keys_file" env:"API_KEYS_FILE"`
+		DebugAPIKeys      []string      `yaml:"debug_api_keys" env:"DEBUG_API_KEYS"`
+		AdminAPIKeys      []string      `yaml:"admin_api_keys" env:"ADMIN_API_KEYS"`
+		AdminUsername     string        `yaml:"admin_username" env:"ADMIN_USERNAME"`
+		AdminPassword     string        `yaml:"admin_password" env:"ADMIN_PASSWORD"`
+		AdminPasswordHash string        `yaml:"admin_password_hash" env:"ADMIN_PASSWORD_HASH"`
+		SigningSecrets    []string      `yaml:"signing_secrets" env:"SIGNING_SECRETS"`
+		SignatureMaxSkew  time.Duration `yaml:"signature_max_skew" env:"SIGNATURE_MAX_SKEW"`
+	} `yaml:"auth"`
+
+	RateLimit struct {
+		RPS   float64 `yaml:"rps" env:"RATE_LIMIT_RPS"`
+		Burst int     `yaml:"burst" env:"RATE_LIMIT_BURST"`
+	} `yaml:"rate_limit"`
+
+	IPFilter struct {
+		APIAllowed   []string `yaml:"api_allowed" env:"API_ALLOWED_CIDRS"`
+		APIDenied    []string `yaml:"api_denied" env:"API_DENIED_CIDRS"`
+		AdminAllowed []string `yaml:"admin_allowed" env:"ADMIN_ALLOWED_CIDRS"`
+		AdminDenied  []string `yaml:"admin_denied" env:"ADMIN_DENIED_CIDRS"`
+	} `yaml:"ip_filter"`
+
+	CORS struct {
+		AllowedOrigins []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+		AllowedMethods []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+		AllowedHeaders []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+		MaxAge         time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+	} `yaml:"cors"`
+
+	SecurityHeaders struct {
+		FrameOptions            string `yaml:"frame_options" env:"X_FRAME_OPTIONS"`
+		ReferrerPolicy          string `yaml:"referrer_policy" env:"REFERRER_POLICY"`
+		DocsContentSecurity     string `yaml:"docs_content_security_policy" env:"DOCS_CONTENT_SECURITY_POLICY"`
+		StrictTransportSecurity string `yaml:"strict_transport_security" env:"STRICT_TRANSPORT_SECURITY"`
+	} `yaml:"security_headers"`
+
+	AccessLog struct {
+		Format  string   `yaml:"format" env:"ACCESS_LOG_FORMAT"`
+		Exclude []string `yaml:"exclude" env:"ACCESS_LOG_EXCLUDE"`
+	} `yaml:"access_log"`
+
+	TLS struct {
+		CertFile         string   `yaml:"cert_file" env:"TLS_CERT_FILE"`
+		KeyFile          string   `yaml:"key_file" env:"TLS_KEY_FILE"`
+		ClientCAFile     string   `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+		AutocertHosts    []string `yaml:"autocert_hosts" env:"TLS_AUTOCERT_HOSTS"`
+		AutocertCacheDir string   `yaml:"autocert_cache_dir" env:"TLS_AUTOCERT_CACHE_DIR"`
+		AutocertEmail    string   `yaml:"autocert_email" env:"TLS_AUTOCERT_EMAIL"`
+		RedirectAddr     string   `yaml:"redirect_addr" env:"TLS_REDIRECT_ADDR"`
+	} `yaml:"tls"`
+
+	Tracing struct {
+		OTLPEndpoint       string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+		OTLPTracesEndpoint string `yaml:"otlp_traces_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	} `yaml:"tracing"`
+
+	Pprof struct {
+		Enabled bool   `yaml:"enabled" env:"ENABLE_PPROF"`
+		Addr    string `yaml:"addr" env:"PPROF_ADDR"`
+	} `yaml:"pprof"`
+
+	Storage struct {
+		Backend             string `yaml:"backend" env:"STORAGE"`
+		QueueSize           int    `yaml:"queue_size" env:"STORAGE_QUEUE_SIZE"`
+		FirestoreProject    string `yaml:"firestore_project" env:"FIRESTORE_PROJECT"`
+		FirestoreCollection string `yaml:"firestore_collection" env:"FIRESTORE_COLLECTION"`
+	} `yaml:"storage"`
+
+	Export struct {
+		BigQueryProject string        `yaml:"bigquery_project" env:"BIGQUERY_PROJECT"`
+		BigQueryDataset string        `yaml:"bigquery_dataset" env:"BIGQUERY_DATASET"`
+		BigQueryTable   string        `yaml:"bigquery_table" env:"BIGQUERY_TABLE"`
+		BatchSize       int           `yaml:"batch_size" env:"EXPORT_BATCH_SIZE"`
+		FlushInterval   time.Duration `yaml:"flush_interval" env:"EXPORT_FLUSH_INTERVAL"`
+		MaxBuffered     int           `yaml:"max_buffered" env:"EXPORT_MAX_BUFFERED"`
+	} `yaml:"export"`
+
+	PubSub struct {
+		Project      string `yaml:"project" env:"PUBSUB_PROJECT"`
+		Subscription string `yaml:"subscription" env:"PUBSUB_SUBSCRIPTION"`
+		ResultTopic  string `yaml:"result_topic" env:"PUBSUB_RESULT_TOPIC"`
+		Concurrency  int    `yaml:"concurrency" env:"PUBSUB_CONCURRENCY"`
+		OrderingKeys bool   `yaml:"ordering_keys" env:"PUBSUB_ORDERING_KEYS"`
+	} `yaml:"pubsub"`
+
+	IDToken struct {
+		ServiceAccounts []string `yaml:"service_accounts" env:"ID_TOKEN_SERVICE_ACCOUNTS"`
+		Audience        string   `yaml:"audience" env:"ID_TOKEN_AUDIENCE"`
+	} `yaml:"id_token"`
+
+	Async struct {
+		Queue          string `yaml:"queue" env:"CLOUD_TASKS_QUEUE"`
+		HandlerURL     string `yaml:"handler_url" env:"TASKS_HANDLER_URL"`
+		ServiceAccount string `yaml:"service_account" env:"TASKS_SERVICE_ACCOUNT"`
+		CallbackSecret string `yaml:"callback_secret" env:"CALLBACK_SECRET"`
+	} `yaml:"async"`
+
+	GCS struct {
+		Buckets      []string `yaml:"buckets" env:"GCS_BUCKETS"`
+		OutputBucket string   `yaml:"output_bucket" env:"GCS_OUTPUT_BUCKET"`
+		OutputPrefix string   `yaml:"output_prefix" env:"GCS_OUTPUT_PREFIX"`
+		Concurrency  int      `yaml:"concurrency" env:"GCS_CONCURRENCY"`
+	} `yaml:"gcs"`
+
+	ErrorReporting struct {
+		Enabled bool   `yaml:"enabled" env:"ERROR_REPORTING"`
+		Project string `yaml:"project" env:"ERROR_REPORTING_PROJECT"`
+		Service string `yaml:"service" env:"K_SERVICE"`
+	} `yaml:"error_reporting"`
+
+	Quotas struct {
+		Backend        string   `yaml:"backend" env:"QUOTAS"`
+		RequestsPerDay int      `yaml:"requests_per_day" env:"QUOTA_REQUESTS_PER_DAY"`
+		CharsPerDay    int      `yaml:"chars_per_day" env:"QUOTA_CHARS_PER_DAY"`
+		Keys           []string `yaml:"keys" env:"QUOTA_KEYS"`
+		ResetTime      string   `yaml:"reset_time" env:"QUOTA_RESET_TIME"`
+	} `yaml:"quotas"`
+}
+
+// configFile holds the settings of a -config file, by variable, and where
+// they came from, to explain the errors of their values and to read the
+// file again.
+type configFile struct {
+	path string
+	// fields maps the variables the file sets to their setting.
+	fields map[string]fileField
+	// values holds the values of the variables, lists joined by commas, the
+	// way the environment gives them.
+	values map[string]string
+}
+
+type fileField struct {
+	key  string // dotted path of the setting, such as server.port
+	line int
+}
+
+// loadConfigFile reads the configuration file at path. Unknown settings and
+// values of the wrong type are errors, with their line. It returns nil when
+// path is empty.
+func loadConfigFile(path string) (*configFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("-config: %w", err)
+	}
+
+	// YAML is a superset of JSON, so both are decoded alike.
+	var cfg fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	f := &configFile{path: path, fields: make(map[string]fileField), values: make(map[string]string)}
+	if len(root.Content) > 0 {
+		f.read(reflect.TypeOf(cfg), root.Content[0], "")
+	}
+	return f, nil
+}
+
+// reload reads the file of f again and returns the new version. It returns
+// nil when f is nil.
+func (f *configFile) reload() (*configFile, error) {
+	if f == nil {
+		return nil, nil
+	}
+	return loadConfigFile(f.path)
+}
+
+// value returns the value the file gives the variable name. f may be nil.
+func (f *configFile) value(name string) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	v, ok := f.values[name]
+	return v, ok
+}
+
+// settings returns the values of the variables the file sets. f may be nil.
+func (f *configFile) settings() map[string]string {
+	if f == nil {
+		return nil
+	}
+	return f.values
+}
+
+// field returns the setting of the variable name. f may be nil.
+func (f *configFile) field(name string) (fileField, bool) {
+	if f == nil {
+		return fileField{}, false
+	}
+	field, ok := f.fields[name]
+	return field, ok
+}
+
+// read collects the variables of the settings of node, a mapping decoded
+// into a struct of type t, under the key prefix.
+func (f *configFile) read(t reflect.Type, node *yaml.Node, prefix string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, ok := fieldByTag(t, key.Value)
+		if !ok {
+			continue
+		}
+		path := prefix + key.Value
+		if field.Type.Kind() == reflect.Struct {
+			f.read(field.Type, value, path+".")
+			continue
+		}
+		if value.Tag == "!!null" {
+			continue
+		}
+		name := field.Tag.Get("env")
+		f.fields[name] = fileField{key: path, line: key.Line}
+		v := value.Value
+		if value.Kind == yaml.SequenceNode {
+			items := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				items = append(items, item.Value)
+			}
+			v = strings.Join(items, ",")
+		}
+		f.values[name] = v
+	}
+}
+
+// fieldByTag returns the field of t with the yaml key name.
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		if field := t.Field(i); field.Tag.Get("yaml") == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes data to a file of the test and returns its path.
+func writeConfigFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfigFile = `
+mode: both
+server:
+  port: 9000
+  request_timeout: 3s
+auth:
+  api_keys: [k1, k2]
+pubsub:
+  subscription: sub
+  result_topic: topic
+gcs:
+  buckets: [in]
+  output_prefix: results/
+quotas:
+  backend: memory
+  reset_time: "06:30"
+`
+
+func TestConfigFileApplies(t *testing.T) {
+	cf, err := loadConfigFile(writeConfigFile(t, "config.yaml", testConfigFile))
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	cfg, err := loadConfig(&env{vars: map[string]string{}, file: cf})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"Mode", cfg.Mode, modeBoth},
+		{"Port", cfg.Port, 9000},
+		{"API.RequestTimeout", cfg.API.RequestTimeout, 3 * time.Second},
+		{"API.APIKeys", strings.Join(cfg.API.APIKeys, ","), "k1,k2"},
+		{"PubSub.Subscription", cfg.PubSub.Subscription, "sub"},
+		{"GCS.OutputPrefix", cfg.GCS.OutputPrefix, "results/"},
+		{"Quotas.Backend", cfg.Quotas.Backend, "memory"},
+		{"Quotas.ResetOffset", cfg.Quotas.ResetOffset, 6*time.Hour + 30*time.Minute},
+		// What neither the file nor the environment sets has its default.
+		{"GRPCAddr", cfg.GRPCAddr, defaultGRPCAddr},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestConfigFileEnvironmentOverrides(t *testing.T) {
+	cf, err := loadConfigFile(writeConfigFile(t, "config.yaml", testConfigFile))
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	e := &env{vars: map[string]string{
+		"PORT":     "9001",
+		"API_KEYS": "k3",
+		// A variable set to an empty value overrides the file as well.
+		"GCS_OUTPUT_PREFIX": "",
+	}, file: cf}
+	cfg, err := loadConfig(e)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Port != 9001 {
+		t.Errorf("Port = %d, want 9001", cfg.Port)
+	}
+	if got := strings.Join(cfg.API.APIKeys, ","); got != "k3" {
+		t.Errorf("API.APIKeys = %q, want k3", got)
+	}
+	if cfg.GCS.OutputPrefix != "" {
+		t.Errorf("GCS.OutputPrefix = %q, want empty", cfg.GCS.OutputPrefix)
+	}
+	if cfg.Mode != modeBoth {
+		t.Errorf("Mode = %q, want the %q of the file", cfg.Mode, modeBoth)
+	}
+
+	got := e.overridden()
+	if want := []string{"API_KEYS", "GCS_OUTPUT_PREFIX", "PORT"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("overridden = %v, want %v", got, want)
+	}
+}
+
+func TestConfigFileJSON(t *testing.T) {
+	cf, err := loadConfigFile(writeConfigFile(t, "config.json", `{"server": {"port": 9002}, "auth": {"api_keys": ["k1"]}}`))
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	cfg, err := loadConfig(&env{file: cf})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Port != 9002 || len(cfg.API.APIKeys) != 1 {
+		t.Errorf("Port = %d, API keys %v, want 9002 and [k1]", cfg.Port, cfg.API.APIKeys)
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	tests := []struct {
+		name, data string
+		// want are parts of the error.
+		want []string
+	}{
+		{"unknown key", "server:\n  prot: 9000\n", []string{"config.yaml", "line 2", "prot"}},
+		{"unknown section", "servers:\n  port: 9000\n", []string{"line 1", "servers"}},
+		{"wrong type", "server:\n  port: http\n", []string{"line 2", "http"}},
+		{"invalid duration", "server:\n  request_timeout: soon\n", []string{"line 2", "soon"}},
+		{"not a mapping", "- port\n", []string{"config.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfigFile(writeConfigFile(t, "config.yaml", tt.data))
+			if err == nil {
+				t.Fatal("loadConfigFile succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+
+	if _, err := loadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.HasPrefix(err.Error(), "-config:") {
+		t.Errorf("missing file: error %v, want one about -config", err)
+	}
+}
+
+func TestConfigExample(t *testing.T) {
+	cf, err := loadConfigFile("config.example.yaml")
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	e := &env{file: cf}
+	cfg, err := loadConfig(e)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", e.explain(err))
+	}
+	defaults, err := loadConfig(&env{})
+	if err != nil {
+		t.Fatalf("loadConfig without settings: %v", err)
+	}
+	// The sample spells out the defaults, apart from the API keys and rate
+	// limits it shows.
+	if cfg.Port != defaults.Port || cfg.Cache != defaults.Cache || cfg.Export != defaults.Export || cfg.Storage != defaults.Storage {
+		t.Errorf("the settings of the sample differ from the defaults")
+	}
+}
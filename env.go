@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// env is where the settings are read from: the environment, then the -config
+// file for the variables the environment does not set, with the secrets
+// their values refer to in place of the references. Nothing is written to
+// the process environment, so that the file and the secrets can be read
+// again without leaving the values of the previous version behind.
+type env struct {
+	// vars holds the environment variables by name.
+	vars map[string]string
+	// file is nil without -config.
+	file *configFile
+	// secrets maps the variables holding a secret reference to the secret.
+	secrets map[string]string
+}
+
+// newEnv returns the env of the process environment and file, which may be
+// nil.
+func newEnv(file *configFile) *env {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		vars[name] = value
+	}
+	return &env{vars: vars, file: file}
+}
+
+// lookup returns the value of the variable name and whether it is set.
+func (e *env) lookup(name string) (string, bool) {
+	if v, ok := e.secrets[name]; ok {
+		return v, true
+	}
+	return e.raw(name)
+}
+
+// get returns the value of the variable name, or "" when it is unset.
+func (e *env) get(name string) string {
+	v, _ := e.lookup(name)
+	return v
+}
+
+// raw is lookup with the secret references left as they are.
+func (e *env) raw(name string) (string, bool) {
+	if v, ok := e.vars[name]; ok {
+		return v, true
+	}
+	return e.file.value(name)
+}
+
+// references returns the variables whose value is a secret reference, with
+// the reference.
+func (e *env) references() map[string]string {
+	refs := make(map[string]string)
+	for _, names := range []map[string]string{e.vars, e.file.settings()} {
+		for name := range names {
+			if v, _ := e.raw(name); strings.HasPrefix(v, secretRefPrefix) {
+				refs[name] = v
+			}
+		}
+	}
+	return refs
+}
+
+// withSecrets returns a copy of e where the variables of secrets read as
+// their secret, in place of those of e.
+func (e *env) withSecrets(secrets map[string]string) *env {
+	next := *e
+	next.secrets = secrets
+	return &next
+}
+
+// overridden returns the variables of the file the environment sets too,
+// sorted.
+func (e *env) overridden() []string {
+	var names []string
+	for name := range e.file.settings() {
+		if _, ok := e.vars[name]; ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// explain prefixes err with the file, line and key of the setting it is
+// about, when err is about a variable only the file set.
+func (e *env) explain(err error) error {
+	if err == nil {
+		return nil
+	}
+	name, _, _ := strings.Cut(err.Error(), ":")
+	if _, ok := e.vars[name]; ok {
+		return err
+	}
+	field, ok := e.file.field(name)
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%s:%d: %s: %w", e.file.path, field.line, field.key, err)
+}
+
+// attrs returns the file and the variables overriding it as log attributes.
+func (e *env) attrs() []any {
+	if e.file == nil {
+		return []any{"config_file", ""}
+	}
+	return []any{"config_file", e.file.path, "config_overridden_by_env", e.overridden()}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// loadH2C makes srv accept HTTP/2 without TLS, with prior knowledge or an
+// h2c upgrade, along with HTTP/1.1, when enabled. It is meant for proxies
+// such as Envoy that speak h2c to their upstreams; over TLS, HTTP/2 is
+// negotiated anyway.
+func loadH2C(srv *http.Server, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	h2s := &http2.Server{}
+	// Configuring srv registers h2s for its shutdown, so that Shutdown also
+	// drains the h2c connections, which net/http no longer tracks once they
+	// are taken over.
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	return nil
+}
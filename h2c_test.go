@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// h2cClient returns a client speaking HTTP/2 with prior knowledge over plain
+// TCP.
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func TestH2C(t *testing.T) {
+	addr, done := startRun(t, map[string]string{"H2C": "true"})
+	client := h2cClient()
+
+	resp, err := client.Post("http://"+addr+"/v1/analyze", "application/json", strings.NewReader(`{"text": "I love this"}`))
+	if err != nil {
+		t.Fatalf("HTTP/2 request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP/2 request: %s %d %s, want HTTP/2.0 200", resp.Proto, resp.StatusCode, body)
+	}
+
+	// HTTP/1.1 is still served on the same listener.
+	resp, err = http.Post("http://"+addr+"/v1/analyze", "application/json", strings.NewReader(`{"text": "I love this"}`))
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 || resp.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP/1.1 request: %s %d, want HTTP/1.1 200", resp.Proto, resp.StatusCode)
+	}
+
+	// A streamed batch answers each line before the next one is sent, which
+	// takes both a full duplex stream and a flush per result.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/v1/analyze/batch", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("NDJSON request: %v", err)
+			pr.Close()
+			close(respc)
+			return
+		}
+		respc <- resp
+	}()
+	var lines *bufio.Scanner
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := io.WriteString(pw, `{"id": "`+id+`", "text": "I love this"}`+"\n"); err != nil {
+			t.Fatalf("send line %s: %v", id, err)
+		}
+		if lines == nil {
+			resp, ok := <-respc
+			if !ok {
+				t.FailNow()
+			}
+			defer resp.Body.Close()
+			if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+				t.Fatalf("NDJSON request: %s %d, want HTTP/2.0 200", resp.Proto, resp.StatusCode)
+			}
+			lines = bufio.NewScanner(resp.Body)
+		}
+		result := make(chan string, 1)
+		go func() {
+			if lines.Scan() {
+				result <- lines.Text()
+			}
+			close(result)
+		}()
+		select {
+		case line := <-result:
+			var got struct{ ID string }
+			if err := json.Unmarshal([]byte(line), &got); err != nil || got.ID != id {
+				t.Fatalf("result line %q, want that of %s", line, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no result for line %s while the request is open", id)
+		}
+	}
+	pw.Close()
+
+	// The shutdown closes the idle h2c connections rather than waiting for
+	// them.
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the shutdown")
+	}
+}
+
+func TestH2CDisabled(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	if err := loadH2C(ts.Config, false); err != nil {
+		t.Fatalf("loadH2C: %v", err)
+	}
+	ts.Start()
+	defer ts.Close()
+
+	if resp, err := h2cClient().Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Fatalf("HTTP/2 request without h2c: %s %d, want an error", resp.Proto, resp.StatusCode)
+	}
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "HTTP/1.1" {
+		t.Errorf("served %q, want HTTP/1.1", body)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// aggregateBuckets is the number of equal-width buckets the score range
+// [-1, 1] is divided into for AggregateResponse.Histogram.
+const aggregateBuckets = 10
+
+type AggregateRequest struct {
+	Texts []string `json:"texts"`
+}
+
+// AggregateResponse summarizes the sentiment of a set of texts. The texts that
+// failed are listed in Errors and left out of every statistic.
+type AggregateResponse struct {
+	Count          int               `json:"count" doc:"Texts analyzed successfully"`
+	Labels         map[string]int    `json:"labels" doc:"Texts by sentiment label"`
+	MeanScore      float64           `json:"mean_score"`
+	MedianScore    float64           `json:"median_score"`
+	TotalMagnitude float64           `json:"total_magnitude"`
+	Histogram      []ScoreBucket     `json:"histogram" doc:"Texts by score, in buckets of width 0.2 from -1 to 1"`
+	MostPositive   *int              `json:"most_positive,omitempty" doc:"Index of the text with the highest score, the first one if tied; absent when no text was analyzed"`
+	MostNegative   *int              `json:"most_negative,omitempty" doc:"Index of the text with the lowest score, the first one if tied; absent when no text was analyzed"`
+	Errors         []BatchItemResult `json:"errors" doc:"The texts that could not be analyzed, identified by index"`
+}
+
+// ScoreBucket counts the scores from From, inclusive, to To, exclusive except
+// for the last bucket, which ends at 1.
+type ScoreBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+func (s *Server) analyzeAggregateHandler(w http.ResponseWriter, r *http.Request) {
+	var req AggregateRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if len(req.Texts) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "texts must contain at least one item")
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	results := s.analyzeBatch(ctx, RequestIDFromContext(r.Context()), req.Texts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(aggregate(results))
+}
+
+// aggregate computes the statistics of the batch results.
+func aggregate(results []BatchResult) AggregateResponse {
+	resp := AggregateResponse{
+		Labels:    map[string]int{"positive": 0, "negative": 0, "neutral": 0},
+		Histogram: make([]ScoreBucket, aggregateBuckets),
+		Errors:    []BatchItemResult{},
+	}
+	for i := range resp.Histogram {
+		resp.Histogram[i] = ScoreBucket{
+			From: float64(2*i-aggregateBuckets) / aggregateBuckets,
+			To:   float64(2*(i+1)-aggregateBuckets) / aggregateBuckets,
+		}
+	}
+
+	var scores []float64
+	var sum float64
+	for i, result := range results {
+		if result.SentimentResponse == nil {
+			resp.Errors = append(resp.Errors, BatchItemResult{ID: strconv.Itoa(i), BatchResult: result})
+			continue
+		}
+		score := result.Score
+		resp.Labels[result.Sentiment]++
+		resp.TotalMagnitude += result.Magnitude
+		sum += score
+		scores = append(scores, score)
+
+		bucket := int((score + 1) / 2 * aggregateBuckets)
+		resp.Histogram[min(max(bucket, 0), aggregateBuckets-1)].Count++
+
+		if resp.MostPositive == nil || score > results[*resp.MostPositive].Score {
+			resp.MostPositive = &i
+		}
+		if resp.MostNegative == nil || score < results[*resp.MostNegative].Score {
+			resp.MostNegative = &i
+		}
+	}
+
+	resp.Count = len(scores)
+	if resp.Count == 0 {
+		return resp
+	}
+	resp.MeanScore = sum / float64(resp.Count)
+	slices.Sort(scores)
+	if mid := resp.Count / 2; resp.Count%2 == 1 {
+		resp.MedianScore = scores[mid]
+	} else {
+		resp.MedianScore = (scores[mid-1] + scores[mid]) / 2
+	}
+	return resp
+}
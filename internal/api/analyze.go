@@ -0,0 +1,530 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// SentimentRequest is the body of POST /analyze. Text is a pointer so that a
+// missing field can be told apart from an empty one.
+type SentimentRequest struct {
+	Text             *string `json:"text" required:"true"`
+	Language         string  `json:"language,omitempty" doc:"ISO-639-1 language code of the text; detected automatically when omitted"`
+	IncludeSentences bool    `json:"include_sentences,omitempty" doc:"Include a per-sentence sentiment breakdown in the response"`
+	// DocumentType is "plain_text" (the default) or "html".
+	DocumentType string `json:"document_type,omitempty" enum:"plain_text,html" default:"plain_text" doc:"Format of the text; HTML markup is ignored by the analysis"`
+	// Granularity is "coarse" (the default) or "fine", which adds
+	// SentimentResponse.SentimentFine.
+	Granularity string `json:"granularity,omitempty" enum:"coarse,fine" default:"coarse" doc:"fine adds the five-level sentiment_fine label to the response"`
+	// IncludeEntities adds SentimentResponse.Entities. Only /analyze
+	// honors it.
+	IncludeEntities bool `json:"include_entities,omitempty" doc:"Include the most salient entities of the text in the response"`
+
+	// debug attaches the raw Language API response and bypasses the cache.
+	debug bool
+}
+
+type SentimentResponse struct {
+	XMLName       xml.Name `json:"-" xml:"sentiment_response"`
+	Sentiment     string   `json:"sentiment" xml:"sentiment"`
+	SentimentFine string   `json:"sentiment_fine,omitempty" xml:"sentiment_fine,omitempty" enum:"very_negative,negative,neutral,positive,very_positive" doc:"Five-level label, present with granularity fine: very_ when the absolute score is at least 0.6, or at least 0.3 with a magnitude of at least 3"`
+	Score         float64  `json:"score" xml:"score" doc:"Document score, from -1 (negative) to 1 (positive)"`
+	// SentimentScore is the absolute value of Score.
+	//
+	// Deprecated: use Score, which keeps the sign.
+	SentimentScore float64 `json:"sentiment_score" xml:"sentiment_score" doc:"Deprecated: the absolute value of score, which keeps the sign"`
+	Magnitude      float64 `json:"magnitude" xml:"magnitude"`
+	// Sentences and Entities are left out when nil only, so that they are
+	// empty arrays when requested for a text that has none.
+	Sentences []SentenceSentiment `json:"sentences,omitzero" xml:"sentence,omitempty"`
+	// Language is the language of the text, as given or as detected.
+	Language string `json:"language,omitempty" xml:"language,omitempty" doc:"Language of the text, as given or as detected"`
+	// LanguageDetected reports whether Language was detected rather than
+	// given in the request.
+	LanguageDetected bool `json:"language_detected" xml:"language_detected" doc:"Whether language was detected by the analyzer; false when the request gave it"`
+	// Provider names the analyzer that produced the result: "gcp", or
+	// "local" when the Language API was unavailable.
+	Provider string `json:"provider,omitempty" xml:"provider,omitempty" doc:"Analyzer that produced the result: gcp, or local when the Language API was unavailable and the fallback is enabled"`
+	// Chunks breaks the result down by chunk when the text was too large to
+	// analyze in one call.
+	Chunks []ChunkSentiment `json:"chunks,omitempty" xml:"chunk,omitempty" doc:"Per-chunk breakdown, present when the text exceeded the per-call size limit and was analyzed in chunks; score is then the magnitude-weighted mean of the chunk scores"`
+	// Entities are the most salient entities of the text, with
+	// include_entities.
+	Entities []SalientEntity `json:"entities,omitzero" xml:"entity,omitempty" doc:"The 5 most salient entities of the text, most salient first, present with include_entities"`
+	// Warning tells why Entities is missing when the entity analysis failed
+	// but the sentiment analysis did not.
+	Warning string `json:"warning,omitempty" xml:"warning,omitempty" doc:"Present with include_entities when the entities could not be analyzed; the sentiment is still returned"`
+	// Raw is the Language API response in its protojson encoding, present
+	// only with debug=true.
+	Raw  json.RawMessage `json:"raw,omitempty" xml:"-" doc:"The Language API response as returned, present only with debug=true and when the Language API produced the result"`
+	Meta *ResponseMeta   `json:"meta,omitempty" xml:"meta,omitempty" doc:"Size of the input and processing times, present only with include_meta=true"`
+	// DryRun marks the stand-in results of dry runs.
+	DryRun bool `json:"dry_run,omitempty" xml:"dry_run,omitempty" doc:"Present and true for requests made with dry_run=true, whose text was validated but not analyzed; scores are then 0"`
+
+	// upstreamTime is how long the analyzer took; 0 for cached responses.
+	upstreamTime time.Duration
+}
+
+type ResponseMeta struct {
+	Characters int     `json:"characters" xml:"characters" doc:"Number of characters (Unicode code points) of the text"`
+	Words      int     `json:"words" xml:"words" doc:"Approximate number of words of the text"`
+	UpstreamMS float64 `json:"upstream_ms" xml:"upstream_ms" doc:"Milliseconds spent in sentiment analysis; 0 when served from the cache"`
+	TotalMS    float64 `json:"total_ms" xml:"total_ms" doc:"Milliseconds spent handling the request"`
+}
+
+type SentenceSentiment struct {
+	Text      string  `json:"text" xml:"text"`
+	Score     float64 `json:"score" xml:"score"`
+	Magnitude float64 `json:"magnitude" xml:"magnitude"`
+}
+
+// Texts whose score and magnitude both fall below these thresholds carry too
+// little emotion to be labeled positive or negative.
+const (
+	neutralScoreThreshold     = 0.1
+	neutralMagnitudeThreshold = 0.5
+)
+
+// Positive and negative texts are labeled very_positive and very_negative in
+// the fine granularity when the absolute score reaches strongScoreThreshold,
+// or reaches moderateScoreThreshold with a magnitude of at least
+// strongMagnitudeThreshold.
+const (
+	strongScoreThreshold     = 0.6
+	moderateScoreThreshold   = 0.3
+	strongMagnitudeThreshold = 3
+)
+
+// maxQueryTextBytes caps the text of GET /analyze, since URLs have practical
+// length limits; longer texts must be sent with POST.
+const maxQueryTextBytes = 2000
+
+// analyzeHandler serves POST /analyze with a JSON body, and GET /analyze with
+// the same fields as query parameters.
+func (s *Server) analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req SentimentRequest
+	switch r.Method {
+	case http.MethodPost:
+		switch mt := mediaType(r); mt {
+		case "", "application/json":
+			if err := s.decodeJSON(w, r, &req); err != nil {
+				writeDecodeError(w, r, err)
+				return
+			}
+		case "text/plain":
+			var err error
+			if req, err = sentimentRequestFromQuery(r.URL.RawQuery); err != nil {
+				writeQueryError(w, r, err)
+				return
+			}
+			text, err := s.readText(w, r)
+			if err != nil {
+				writeDecodeError(w, r, err)
+				return
+			}
+			req.Text = &text
+		default:
+			writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia,
+				"Content-Type must be application/json or text/plain, got "+mt)
+			return
+		}
+	case http.MethodGet, http.MethodHead:
+		var err error
+		if req, err = sentimentRequestFromQuery(r.URL.RawQuery); err != nil {
+			writeQueryError(w, r, err)
+			return
+		}
+	}
+
+	if err := s.validateSentimentRequest(&req); err != nil {
+		writeTextError(w, r, err)
+		return
+	}
+	debug, err := boolQuery(r, "debug")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if debug && !s.debugAllowed(r) {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "debug output is not enabled for this client")
+		return
+	}
+	req.debug = debug
+	includeMeta, err := boolQuery(r, "include_meta")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	// The entities are analyzed alongside, and left out if that fails.
+	var entities chan entitiesResult
+	if req.IncludeEntities && !isDryRun(ctx) {
+		entities = make(chan entitiesResult, 1)
+		go func() {
+			resp, err := s.salientEntities(ctx, req)
+			entities <- entitiesResult{resp, err}
+		}()
+	}
+
+	resp, cached, err := s.analyzeCached(ctx, req)
+	if err != nil {
+		s.writeUpstreamError(w, r, err, "analyze sentiment")
+		return
+	}
+	if entities != nil {
+		result := <-entities
+		if result.err != nil {
+			s.log.Warn("failed to analyze entities, answering with the sentiment only",
+				"request_id", RequestIDFromContext(r.Context()), "error", result.err.Error())
+			resp.Warning = "the entities could not be analyzed"
+		} else {
+			resp.Entities = result.entities
+		}
+	} else if req.IncludeEntities {
+		// A dry run has the shape of a real response.
+		resp.Entities = []SalientEntity{}
+	}
+
+	if s.cache != nil && !req.debug {
+		if cached {
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+	}
+	if includeMeta {
+		resp.Meta = &ResponseMeta{
+			Characters: utf8.RuneCountInString(*req.Text),
+			Words:      len(strings.Fields(*req.Text)),
+			UpstreamMS: milliseconds(resp.upstreamTime),
+			TotalMS:    milliseconds(time.Since(start)),
+		}
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// boolQuery reads the boolean query parameter name, which is false when
+// absent.
+func boolQuery(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", name, v)
+	}
+	return b, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// validateSentimentRequest checks req the way every sentiment endpoint does
+// and normalizes its language code.
+func (s *Server) validateSentimentRequest(req *SentimentRequest) error {
+	if req.Text == nil {
+		return errMissingText
+	}
+	if err := s.validateSentimentText(*req.Text); err != nil {
+		return err
+	}
+
+	lang, err := normalizeLanguage(req.Language)
+	if err != nil {
+		return &requestError{err}
+	}
+	req.Language = lang
+
+	if _, err := documentType(req.DocumentType); err != nil {
+		return &requestError{err}
+	}
+	switch req.Granularity {
+	case "", "coarse", "fine":
+	default:
+		return &requestError{fmt.Errorf("unsupported granularity %q: must be coarse or fine", req.Granularity)}
+	}
+	return nil
+}
+
+// Analyze validates and analyzes req under the same rules as POST /analyze,
+// outside of any HTTP request, for the command line. Validation errors wrap
+// ErrInvalidRequest. Entities are not analyzed.
+func (s *Server) Analyze(ctx context.Context, req SentimentRequest) (SentimentResponse, error) {
+	if err := s.validateSentimentRequest(&req); err != nil {
+		return SentimentResponse{}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	resp, _, err := s.analyzeCached(ctx, req)
+	return resp, err
+}
+
+// sentimentRequestFromQuery reads a SentimentRequest from the text, language,
+// include_sentences, include_entities, document_type and granularity query
+// parameters. A text/plain POST takes the text from the body and the other
+// fields from the query.
+func sentimentRequestFromQuery(rawQuery string) (SentimentRequest, error) {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return SentimentRequest{}, fmt.Errorf("invalid query string: %w", err)
+	}
+
+	var req SentimentRequest
+	if query.Has("text") {
+		text := query.Get("text")
+		if len(text) > maxQueryTextBytes {
+			return SentimentRequest{}, fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes for the text query parameter; use POST for longer texts",
+				errTextTooLarge, len(text), maxQueryTextBytes)
+		}
+		req.Text = &text
+	}
+	req.Language = query.Get("language")
+	req.DocumentType = query.Get("document_type")
+	req.Granularity = query.Get("granularity")
+	if v := query.Get("include_sentences"); v != "" {
+		if req.IncludeSentences, err = strconv.ParseBool(v); err != nil {
+			return SentimentRequest{}, fmt.Errorf("include_sentences must be true or false, got %q", v)
+		}
+	}
+	if v := query.Get("include_entities"); v != "" {
+		if req.IncludeEntities, err = strconv.ParseBool(v); err != nil {
+			return SentimentRequest{}, fmt.Errorf("include_entities must be true or false, got %q", v)
+		}
+	}
+	return req, nil
+}
+
+// writeQueryError reports an error returned by sentimentRequestFromQuery.
+func writeQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errTextTooLarge) {
+		writeTextError(w, r, err)
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+}
+
+// analyzeCached is analyze with the result cache consulted first, except for
+// debug requests. It reports whether the response was served from the cache.
+// Successful analyses have their scores rounded and are queued for storage.
+// The text is counted against the quota of the request, cached or not. Dry
+// runs get dryRunResponse and nothing else.
+func (s *Server) analyzeCached(ctx context.Context, req SentimentRequest) (SentimentResponse, bool, error) {
+	if isDryRun(ctx) {
+		return s.dryRunResponse(ctx, req), false, nil
+	}
+	s.countAnalyzed(ctx, *req.Text)
+	resp, cached, err := s.lookupOrAnalyze(ctx, req)
+	if err == nil {
+		s.label(ctx, &resp, req.Granularity)
+		s.roundScores(&resp)
+		s.record(ctx, req, resp, cached)
+	}
+	return resp, cached, err
+}
+
+func (s *Server) lookupOrAnalyze(ctx context.Context, req SentimentRequest) (SentimentResponse, bool, error) {
+	if s.cache == nil || req.debug {
+		resp, err := s.analyze(ctx, req)
+		return resp, false, err
+	}
+
+	key := cacheKey(req)
+	resp, ok, err := s.cache.Get(ctx, key)
+	if err != nil {
+		s.log.Warn("cache lookup failed, calling the Language API directly",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+	}
+	s.metrics.observeCacheLookup(ok)
+	if ok {
+		resp.upstreamTime = 0
+		return resp, true, nil
+	}
+
+	resp, err = s.analyze(ctx, req)
+	if err != nil {
+		return SentimentResponse{}, false, err
+	}
+	// A fallback result is only a stand-in; don't let it outlive the outage.
+	if resp.Provider == sentiment.ProviderLocal {
+		return resp, false, nil
+	}
+	if err := s.cache.Set(ctx, key, resp); err != nil {
+		s.log.Warn("failed to store result in cache",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+	}
+	return resp, false, nil
+}
+
+// analyze runs sentiment analysis on the request text and maps the result
+// onto the public response shape, but for the labels, which analyzeCached
+// sets.
+func (s *Server) analyze(ctx context.Context, req SentimentRequest) (SentimentResponse, error) {
+	docType, err := documentType(req.DocumentType)
+	if err != nil {
+		return SentimentResponse{}, err
+	}
+	doc := sentiment.Document{
+		Text:     *req.Text,
+		Language: req.Language,
+		Type:     docType,
+	}
+	var (
+		result sentiment.Result
+		chunks []ChunkSentiment
+	)
+	start := time.Now()
+	if len(doc.Text) > s.maxTextBytes {
+		result, chunks, err = s.analyzeChunks(ctx, doc, splitText(doc.Text, s.maxTextBytes))
+	} else {
+		result, err = s.analyzer.Analyze(ctx, doc)
+	}
+	upstreamTime := time.Since(start)
+	if err != nil {
+		return SentimentResponse{}, err
+	}
+
+	score := result.Score
+	magnitude := result.Magnitude
+
+	sentimentScore := score
+	if sentimentScore < 0 {
+		sentimentScore = -sentimentScore
+	}
+
+	out := SentimentResponse{
+		Score:          score,
+		SentimentScore: sentimentScore,
+		Magnitude:      magnitude,
+		Language:       result.Language,
+		Provider:       result.Provider,
+		Chunks:         chunks,
+		upstreamTime:   upstreamTime,
+	}
+	if req.Language != "" {
+		out.Language = req.Language
+	} else {
+		out.LanguageDetected = true
+	}
+
+	if req.debug && result.Raw != nil {
+		if out.Raw, err = protojson.Marshal(result.Raw); err != nil {
+			return SentimentResponse{}, err
+		}
+	}
+
+	if req.IncludeSentences {
+		out.Sentences = make([]SentenceSentiment, 0, len(result.Sentences))
+		for _, sentence := range result.Sentences {
+			out.Sentences = append(out.Sentences, SentenceSentiment{
+				Text:      sentence.Text,
+				Score:     sentence.Score,
+				Magnitude: sentence.Magnitude,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// label sets the labels of resp from its unrounded score and magnitude.
+// They are left out of the cache, as the neutral band may be reloaded.
+func (s *Server) label(ctx context.Context, resp *SentimentResponse, granularity string) {
+	resp.Sentiment = sentimentLabel(resp.Score, resp.Magnitude, s.settingsFor(ctx).neutralBand)
+	resp.SentimentFine = ""
+	if granularity == "fine" {
+		resp.SentimentFine = fineSentimentLabel(resp.Sentiment, resp.Score, resp.Magnitude)
+	}
+}
+
+// roundScores rounds the scores and magnitudes of resp to s.scorePrecision
+// decimal places, if set. Labels are left as given by the unrounded score.
+func (s *Server) roundScores(resp *SentimentResponse) {
+	if s.scorePrecision == nil {
+		return
+	}
+	precision := *s.scorePrecision
+	round := func(v float64) float64 {
+		v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'f', precision, 64), 64)
+		if v == 0 {
+			// A small negative value is rounded to 0, not -0.
+			return 0
+		}
+		return v
+	}
+	resp.Score = round(resp.Score)
+	resp.SentimentScore = round(resp.SentimentScore)
+	resp.Magnitude = round(resp.Magnitude)
+	// The slices may be shared with the cache.
+	resp.Sentences = slices.Clone(resp.Sentences)
+	for i := range resp.Sentences {
+		resp.Sentences[i].Score = round(resp.Sentences[i].Score)
+		resp.Sentences[i].Magnitude = round(resp.Sentences[i].Magnitude)
+	}
+	resp.Chunks = slices.Clone(resp.Chunks)
+	for i := range resp.Chunks {
+		resp.Chunks[i].Score = round(resp.Chunks[i].Score)
+		resp.Chunks[i].Magnitude = round(resp.Chunks[i].Magnitude)
+	}
+}
+
+// documentType maps the document_type field to a sentiment.DocumentType.
+func documentType(name string) (sentiment.DocumentType, error) {
+	switch name {
+	case "", "plain_text":
+		return sentiment.PlainText, nil
+	case "html":
+		return sentiment.HTML, nil
+	default:
+		return 0, fmt.Errorf("unsupported document_type %q: must be plain_text or html", name)
+	}
+}
+
+// sentimentLabel maps a document score and magnitude to a coarse label.
+// Scores strictly inside (-band, band) are neutral regardless of magnitude.
+func sentimentLabel(score, magnitude, band float64) string {
+	low := score < neutralScoreThreshold && score > -neutralScoreThreshold
+	switch {
+	case score == 0, score < band && score > -band, low && magnitude < neutralMagnitudeThreshold:
+		return "neutral"
+	case score > 0:
+		return "positive"
+	default:
+		return "negative"
+	}
+}
+
+// fineSentimentLabel refines the coarse label of a score and magnitude into
+// one of five levels.
+func fineSentimentLabel(coarse string, score, magnitude float64) string {
+	if coarse == "neutral" {
+		return coarse
+	}
+	if score < 0 {
+		score = -score
+	}
+	if score >= strongScoreThreshold || score >= moderateScoreThreshold && magnitude >= strongMagnitudeThreshold {
+		return "very_" + coarse
+	}
+	return coarse
+}
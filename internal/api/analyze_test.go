@@ -0,0 +1,599 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scoreAnalyzer answers every analysis with its score and magnitude.
+type scoreAnalyzer struct{ score, magnitude float64 }
+
+func (a scoreAnalyzer) Analyze(context.Context, sentiment.Document) (sentiment.Result, error) {
+	return sentiment.Result{Score: a.score, Magnitude: a.magnitude, Language: "en"}, nil
+}
+
+// analyzerFunc turns a function into an Analyzer.
+type analyzerFunc func(ctx context.Context, doc sentiment.Document) (sentiment.Result, error)
+
+func (f analyzerFunc) Analyze(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+	return f(ctx, doc)
+}
+
+// newScoreServer returns a Server of cfg whose analyses all have score and
+// magnitude.
+func newScoreServer(t *testing.T, cfg Config, score, magnitude float64) *Server {
+	t.Helper()
+	s, err := NewServer(cfg, scoreAnalyzer{score, magnitude}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s
+}
+
+func TestSentimentLabel(t *testing.T) {
+	below := func(v float64) float64 { return math.Nextafter(v, math.Inf(-1)) }
+	above := func(v float64) float64 { return math.Nextafter(v, math.Inf(1)) }
+
+	tests := []struct {
+		score, magnitude, band float64
+		want                   string
+	}{
+		// Without a band, a score inside the neutral thresholds is neutral
+		// only with a low magnitude.
+		{0, 0, 0, "neutral"},
+		{0, 10, 0, "neutral"},
+		{below(neutralScoreThreshold), below(neutralMagnitudeThreshold), 0, "neutral"},
+		{below(neutralScoreThreshold), neutralMagnitudeThreshold, 0, "positive"},
+		{neutralScoreThreshold, 0, 0, "positive"},
+		{above(-neutralScoreThreshold), below(neutralMagnitudeThreshold), 0, "neutral"},
+		{above(-neutralScoreThreshold), neutralMagnitudeThreshold, 0, "negative"},
+		{-neutralScoreThreshold, 0, 0, "negative"},
+		{0.05, 1, 0, "positive"},
+		{-0.05, 1, 0, "negative"},
+
+		// Inside the band, a score is neutral whatever its magnitude.
+		{below(0.25), 10, 0.25, "neutral"},
+		{0.25, 10, 0.25, "positive"},
+		{above(-0.25), 10, 0.25, "neutral"},
+		{-0.25, 10, 0.25, "negative"},
+		// Outside it, the thresholds still apply.
+		{0.05, 0.1, 0.01, "neutral"},
+		{0.05, 1, 0.01, "positive"},
+		{-0.05, 1, 0.01, "negative"},
+		{1, 0, 0.25, "positive"},
+		{-1, 0, 0.25, "negative"},
+	}
+	for _, tt := range tests {
+		if got := sentimentLabel(tt.score, tt.magnitude, tt.band); got != tt.want {
+			t.Errorf("sentimentLabel(%v, %v, %v) = %q, want %q", tt.score, tt.magnitude, tt.band, got, tt.want)
+		}
+	}
+}
+
+func TestFineSentimentLabel(t *testing.T) {
+	below := func(v float64) float64 { return math.Nextafter(v, math.Inf(-1)) }
+
+	tests := []struct {
+		score, magnitude float64
+		want             string
+	}{
+		{0, 0, "neutral"},
+		{0.05, 0.1, "neutral"},
+		// A strong score is very positive or negative whatever its magnitude.
+		{strongScoreThreshold, 0, "very_positive"},
+		{-strongScoreThreshold, 0, "very_negative"},
+		{1, 0, "very_positive"},
+		{below(strongScoreThreshold), below(strongMagnitudeThreshold), "positive"},
+		{-below(strongScoreThreshold), below(strongMagnitudeThreshold), "negative"},
+		// A moderate score is only with a strong magnitude.
+		{moderateScoreThreshold, strongMagnitudeThreshold, "very_positive"},
+		{-moderateScoreThreshold, strongMagnitudeThreshold, "very_negative"},
+		{moderateScoreThreshold, below(strongMagnitudeThreshold), "positive"},
+		{-moderateScoreThreshold, below(strongMagnitudeThreshold), "negative"},
+		{below(moderateScoreThreshold), 100, "positive"},
+		{-below(moderateScoreThreshold), 100, "negative"},
+	}
+	for _, tt := range tests {
+		coarse := sentimentLabel(tt.score, tt.magnitude, 0)
+		if got := fineSentimentLabel(coarse, tt.score, tt.magnitude); got != tt.want {
+			t.Errorf("fineSentimentLabel(%q, %v, %v) = %q, want %q", coarse, tt.score, tt.magnitude, got, tt.want)
+		}
+	}
+
+	// A score the band made neutral stays neutral.
+	if got := fineSentimentLabel("neutral", 0.7, 5); got != "neutral" {
+		t.Errorf("fineSentimentLabel of a neutral label = %q, want neutral", got)
+	}
+}
+
+func TestAnalyzeGranularity(t *testing.T) {
+	h := newScoreServer(t, testConfig(), -0.4, 3.5).Handler()
+
+	tests := []struct {
+		name, method, target, body string
+		wantFine                   string
+	}{
+		{"coarse", http.MethodPost, "/v1/analyze", `{"text": "awful"}`, ""},
+		{"fine field", http.MethodPost, "/v1/analyze", `{"text": "awful", "granularity": "fine"}`, "very_negative"},
+		{"fine query", http.MethodGet, "/v1/analyze?text=awful&granularity=fine", "", "very_negative"},
+	}
+	for _, tt := range tests {
+		w := serve(h, tt.method, tt.target, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200; body %s", tt.name, w.Code, w.Body)
+		}
+		var resp SentimentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode %q: %v", tt.name, w.Body, err)
+		}
+		// The coarse label is kept next to the fine one.
+		if resp.Sentiment != "negative" || resp.SentimentFine != tt.wantFine {
+			t.Errorf("%s: sentiment %q, sentiment_fine %q, want negative and %q", tt.name, resp.Sentiment, resp.SentimentFine, tt.wantFine)
+		}
+	}
+
+	if w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "awful", "granularity": "finest"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown granularity: status = %d, want 400", w.Code)
+	}
+}
+
+func TestAnalyzeSignedScore(t *testing.T) {
+	tests := []struct {
+		name             string
+		score, magnitude float64
+		want             string
+	}{
+		{"positive", 0.8, 1.6, `"sentiment":"positive","score":0.8,"sentiment_score":0.8,"magnitude":1.6`},
+		{"negative", -0.8, 1.6, `"sentiment":"negative","score":-0.8,"sentiment_score":0.8,"magnitude":1.6`},
+		// Zero is emitted rather than left out.
+		{"zero", 0, 0, `"sentiment":"neutral","score":0,"sentiment_score":0,"magnitude":0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newScoreServer(t, testConfig(), tt.score, tt.magnitude).Handler()
+			w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "some text"}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body %s, want it to hold %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeNeutralBand(t *testing.T) {
+	tests := []struct {
+		band, score float64
+		want        string
+	}{
+		{0, 0.2, "positive"},
+		{0, -0.2, "negative"},
+		{0.25, 0.2, "neutral"},
+		{0.25, -0.2, "neutral"},
+		{0.25, 0.25, "positive"},
+		{0.25, -0.25, "negative"},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.NeutralBand = tt.band
+		// The magnitude is past the default thresholds, so that only the
+		// band makes the score neutral.
+		h := newScoreServer(t, cfg, tt.score, 2).Handler()
+		w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "some text"}`)
+		var resp SentimentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %q: %v", w.Body, err)
+		}
+		if resp.Sentiment != tt.want {
+			t.Errorf("band %v, score %v: sentiment = %q, want %q", tt.band, tt.score, resp.Sentiment, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeScorePrecision(t *testing.T) {
+	a := textAnalyzer{"some text": {
+		Score:     -0.56789,
+		Magnitude: 3.14159,
+		Language:  "en",
+		Sentences: []sentiment.Sentence{
+			{Text: "some", Score: 0.30000001192092896, Magnitude: 0.30000001192092896},
+			{Text: "text", Score: -0.4, Magnitude: 0.4},
+		},
+	}}
+	precision := func(n int) *int { return &n }
+
+	tests := []struct {
+		name      string
+		precision *int
+		want      string
+	}{
+		{"unset", nil, `"score":-0.56789,"sentiment_score":0.56789,"magnitude":3.14159,"sentences":[{"text":"some","score":0.30000001192092896,"magnitude":0.30000001192092896},{"text":"text","score":-0.4,"magnitude":0.4}]`},
+		{"three places", precision(3), `"score":-0.568,"sentiment_score":0.568,"magnitude":3.142,"sentences":[{"text":"some","score":0.3,"magnitude":0.3},{"text":"text","score":-0.4,"magnitude":0.4}]`},
+		// 0 rounds to whole numbers, and a small negative score to 0
+		// rather than -0.
+		{"whole numbers", precision(0), `"score":-1,"sentiment_score":1,"magnitude":3,"sentences":[{"text":"some","score":0,"magnitude":0},{"text":"text","score":0,"magnitude":0}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ScorePrecision = tt.precision
+			s, err := NewServer(cfg, a, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			w := serve(s.Handler(), http.MethodPost, "/v1/analyze", `{"text": "some text", "include_sentences": true}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body %s, want it to hold %s", w.Body, tt.want)
+			}
+			// The label is that of the unrounded score.
+			if !strings.Contains(w.Body.String(), `"sentiment":"negative"`) {
+				t.Errorf("body %s, want the negative label", w.Body)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentences(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	tests := []struct {
+		name, method, target, body string
+		want                       []SentenceSentiment
+	}{
+		{"single sentence", http.MethodPost, "/v1/analyze", `{"text": "I love it.", "include_sentences": true}`, []SentenceSentiment{
+			{"I love it.", 1, 1},
+		}},
+		{"multiple sentences", http.MethodPost, "/v1/analyze", `{"text": "I love it. This is awful! Is it blue?", "include_sentences": true}`, []SentenceSentiment{
+			{"I love it.", 1, 1},
+			{"This is awful!", -1, 1},
+			{"Is it blue?", 0, 0},
+		}},
+		{"query", http.MethodGet, "/v1/analyze?text=Good.+Bad.&include_sentences=true", "", []SentenceSentiment{
+			{"Good.", 1, 1},
+			{"Bad.", -1, 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+			}
+			var resp SentimentResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body, err)
+			}
+			if len(resp.Sentences) != len(tt.want) {
+				t.Fatalf("sentences = %+v, want %+v", resp.Sentences, tt.want)
+			}
+			for i, s := range resp.Sentences {
+				if s != tt.want[i] {
+					t.Errorf("sentence %d = %+v, want %+v", i, s, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Without the flag, the response has the fields it had before.
+	keys := func(body string) []string {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(body), &fields); err != nil {
+			t.Fatalf("decode %q: %v", body, err)
+		}
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	for _, body := range []string{`{"text": "I love it. This is awful!"}`, `{"text": "I love it. This is awful!", "include_sentences": false}`} {
+		w := serve(h, http.MethodPost, "/v1/analyze", body)
+		got := keys(w.Body.String())
+		want := []string{"language_detected", "magnitude", "provider", "score", "sentiment", "sentiment_score"}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: fields %q, want %q", body, got, want)
+		}
+	}
+
+	// A text without sentences gets an empty array rather than none.
+	s, err := NewServer(testConfig(), textAnalyzer{"...": {}}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	w := serve(s.Handler(), http.MethodPost, "/v1/analyze", `{"text": "...", "include_sentences": true}`)
+	if !strings.Contains(w.Body.String(), `"sentences":[]`) {
+		t.Errorf("body %s, want an empty sentences array", w.Body)
+	}
+
+	if w := serve(h, http.MethodGet, "/v1/analyze?text=Good.&include_sentences=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid include_sentences: status = %d, want 400", w.Code)
+	}
+}
+
+func TestAnalyzeFallback(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	primary := analyzerFunc(func(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+		if failing.Load() {
+			return sentiment.Result{}, status.Error(codes.Unavailable, "the Language API is down")
+		}
+		return sentiment.Result{Score: 0.9, Magnitude: 0.9, Language: "en", Provider: sentiment.ProviderGCP}, nil
+	})
+	a := sentiment.Fallback{Primary: primary, Secondary: sentiment.Lexicon{}}
+	s, err := NewServer(testConfig(), a, stubLanguage{}, NewLRUCache(10, time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	analyze := func() SentimentResponse {
+		t.Helper()
+		w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "I love it"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+		}
+		var resp SentimentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %q: %v", w.Body, err)
+		}
+		return resp
+	}
+
+	if resp := analyze(); resp.Provider != sentiment.ProviderLocal || resp.Sentiment != "positive" {
+		t.Errorf("during the outage: provider %q, sentiment %q, want local and positive", resp.Provider, resp.Sentiment)
+	}
+	// The stand-in is not cached past the outage.
+	failing.Store(false)
+	if resp := analyze(); resp.Provider != sentiment.ProviderGCP || resp.Score != 0.9 {
+		t.Errorf("after the outage: provider %q, score %v, want the gcp result", resp.Provider, resp.Score)
+	}
+
+	// Without the fallback, the outage fails the request.
+	s, err = NewServer(testConfig(), failingAnalyzer{status.Error(codes.Unavailable, "down")}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if w := serve(s.Handler(), http.MethodPost, "/v1/analyze", `{"text": "I love it"}`); w.Code < 500 {
+		t.Errorf("without the fallback: status = %d, want a 5xx", w.Code)
+	}
+}
+
+func TestAnalyzePlainText(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	tests := []struct {
+		name, target, contentType, body string
+		wantStatus                      int
+		wantCode, wantLabel             string
+	}{
+		{"JSON", "/v1/analyze", "application/json", `{"text": "I love it"}`, http.StatusOK, "", "positive"},
+		{"JSON with charset", "/v1/analyze", "application/json; charset=utf-8", `{"text": "I love it"}`, http.StatusOK, "", "positive"},
+		// Without a Content-Type, the body is JSON.
+		{"no Content-Type", "/v1/analyze", "", `{"text": "This is awful"}`, http.StatusOK, "", "negative"},
+		{"no Content-Type, plain body", "/v1/analyze", "", "This is awful", http.StatusBadRequest, codeInvalidRequest, ""},
+		{"plain text", "/v1/analyze", "text/plain", "This is awful", http.StatusOK, "", "negative"},
+		{"plain text with charset", "/v1/analyze", "text/plain; charset=utf-8", "I love it", http.StatusOK, "", "positive"},
+		// Quotes need no escaping, and a JSON-looking body is text.
+		{"plain text with quotes", "/v1/analyze", "text/plain", `She said "great" {"text": "awful"}`, http.StatusOK, "", "neutral"},
+		{"empty plain text", "/v1/analyze", "text/plain", "", http.StatusBadRequest, codeEmptyText, ""},
+		{"blank plain text", "/v1/analyze", "text/plain", " \n\t", http.StatusBadRequest, codeEmptyText, ""},
+		{"plain text too large", "/v1/analyze", "text/plain", strings.Repeat("a ", 1000), http.StatusRequestEntityTooLarge, codeTextTooLarge, ""},
+		{"plain text not UTF-8", "/v1/analyze", "text/plain", "caf\xe9", http.StatusBadRequest, codeInvalidRequest, ""},
+		{"plain text with invalid option", "/v1/analyze?include_sentences=maybe", "text/plain", "I love it", http.StatusBadRequest, codeInvalidRequest, ""},
+		{"XML", "/v1/analyze", "application/xml", "<text>I love it</text>", http.StatusUnsupportedMediaType, codeUnsupportedMedia, ""},
+		{"form", "/v1/analyze", "application/x-www-form-urlencoded", "text=I+love+it", http.StatusUnsupportedMediaType, codeUnsupportedMedia, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, w); code != tt.wantCode {
+					t.Errorf("code = %q, want %q", code, tt.wantCode)
+				}
+				return
+			}
+			var resp SentimentResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body, err)
+			}
+			if resp.Sentiment != tt.wantLabel {
+				t.Errorf("sentiment = %q, want %q", resp.Sentiment, tt.wantLabel)
+			}
+		})
+	}
+
+	// The other fields of a plain text request are query parameters.
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze?language=en&include_sentences=true", strings.NewReader(`Good. "Bad".`))
+	r.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var resp SentimentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", w.Body, err)
+	}
+	if resp.Language != "en" || resp.LanguageDetected || len(resp.Sentences) != 2 || resp.Sentences[1].Text != `"Bad".` {
+		t.Errorf("response %+v, want en as given and the two sentences verbatim", resp)
+	}
+}
+
+func TestAnalyzeDocumentType(t *testing.T) {
+	var got []sentiment.Document
+	a := analyzerFunc(func(_ context.Context, doc sentiment.Document) (sentiment.Result, error) {
+		got = append(got, doc)
+		return sentiment.Result{Language: "en"}, nil
+	})
+	s, err := NewServer(testConfig(), a, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	tests := []struct {
+		name, method, target, body string
+		want                       sentiment.DocumentType
+	}{
+		{"default", http.MethodPost, "/v1/analyze", `{"text": "<b>nice</b>"}`, sentiment.PlainText},
+		{"plain_text", http.MethodPost, "/v1/analyze", `{"text": "<b>nice</b>", "document_type": "plain_text"}`, sentiment.PlainText},
+		{"html", http.MethodPost, "/v1/analyze", `{"text": "<b>nice</b>", "document_type": "html"}`, sentiment.HTML},
+		{"html query", http.MethodGet, "/v1/analyze?text=%3Cb%3Enice%3C%2Fb%3E&document_type=html", "", sentiment.HTML},
+	}
+	for _, tt := range tests {
+		got = nil
+		w := serve(h, tt.method, tt.target, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200; body %s", tt.name, w.Code, w.Body)
+		}
+		if len(got) != 1 || got[0].Type != tt.want || got[0].Text != "<b>nice</b>" {
+			t.Errorf("%s: analyzed %+v, want the markup as type %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, body := range []string{`{"text": "nice", "document_type": "markdown"}`, `{"text": "nice", "document_type": "HTML"}`} {
+		got = nil
+		w := serve(h, http.MethodPost, "/v1/analyze", body)
+		if w.Code != http.StatusBadRequest || errorCode(t, w) != codeInvalidRequest {
+			t.Errorf("%s: status = %d, body %s, want 400 %s", body, w.Code, w.Body, codeInvalidRequest)
+		}
+		if len(got) != 0 {
+			t.Errorf("%s: analyzed %+v", body, got)
+		}
+	}
+
+	// The field is documented with its values.
+	var doc struct {
+		Definitions map[string]struct {
+			Properties map[string]struct {
+				Enum    []string `json:"enum"`
+				Default string   `json:"default"`
+			} `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(serve(h, http.MethodGet, "/docs", "").Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode /docs: %v", err)
+	}
+	field := doc.Definitions["SentimentRequest"].Properties["document_type"]
+	if !slices.Equal(field.Enum, []string{"plain_text", "html"}) || field.Default != "plain_text" {
+		t.Errorf("document_type is documented as %+v, want the values plain_text and html, plain_text by default", field)
+	}
+}
+
+// TestAnalyzeLanguage checks the language of the responses: the one the
+// Language API detected when the request gave none, and otherwise the one
+// requested, normalized.
+func TestAnalyzeLanguage(t *testing.T) {
+	m := NewMetrics()
+	s, err := NewServer(testConfig(), newLanguageClient(t, m), stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), m)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	tests := []struct {
+		name, body   string
+		wantLanguage string
+		wantDetected bool
+	}{
+		// fakeLanguageService detects English.
+		{"detected", `{"text": "I love it"}`, "en", true},
+		{"explicit", `{"text": "Me encanta", "language": "es"}`, "es", false},
+		{"explicit, normalized", `{"text": "Me encanta", "language": "ES"}`, "es", false},
+	}
+	for _, tt := range tests {
+		w := serve(h, http.MethodPost, "/v1/analyze", tt.body)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200; body %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		var resp map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode %s: %v", tt.name, w.Body, err)
+		}
+		// language_detected is sent when false as well.
+		if resp["language"] != tt.wantLanguage || resp["language_detected"] != tt.wantDetected {
+			t.Errorf("%s: language %v, language_detected %v, want %q and %t", tt.name, resp["language"], resp["language_detected"], tt.wantLanguage, tt.wantDetected)
+		}
+	}
+
+	w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "Hallo", "language": "xx"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported language: status = %d, want 400", w.Code)
+	}
+}
+
+func TestAnalyzeMeta(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	slow := analyzerFunc(func(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+		time.Sleep(delay)
+		return sentiment.Fake{}.Analyze(ctx, doc)
+	})
+	s, err := NewServer(testConfig(), slow, stubLanguage{}, NewLRUCache(10, time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+	const body = `{"text": "Zażółć gęślą jaźń.  I love it"}`
+
+	meta := func(target string) ResponseMeta {
+		t.Helper()
+		w := serve(h, http.MethodPost, target, body)
+		var resp SentimentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Meta == nil {
+			t.Fatalf("%s: body %s, want meta", target, w.Body)
+		}
+		return *resp.Meta
+	}
+	m := meta("/v1/analyze?include_meta=true")
+	if m.Characters != 29 || m.Words != 6 {
+		t.Errorf("characters %d, words %d, want 29 code points and 6 words", m.Characters, m.Words)
+	}
+	if m.UpstreamMS < milliseconds(delay) || m.TotalMS < m.UpstreamMS {
+		t.Errorf("upstream %vms, total %vms, want at least %v and the total above the upstream time", m.UpstreamMS, m.TotalMS, delay)
+	}
+
+	// Without include_meta the response is unchanged.
+	w := serve(h, http.MethodPost, "/v1/analyze", body)
+	var plain map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &plain); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	if _, ok := plain["meta"]; ok {
+		t.Errorf("body %s, want no meta without include_meta", w.Body)
+	}
+
+	// A cached response took no analysis.
+	if m := meta("/v1/analyze?include_meta=true"); m.UpstreamMS != 0 || m.TotalMS <= 0 || m.Characters != 29 {
+		t.Errorf("cached: meta %+v, want no upstream time", m)
+	}
+
+	if w := serve(h, http.MethodPost, "/v1/analyze?include_meta=maybe", body); w.Code != http.StatusBadRequest {
+		t.Errorf("include_meta=maybe: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// signatureHeader carries the HMAC-SHA256 of a callback body, as
+	// sha256=<hex>.
+	signatureHeader = "X-Signature-256"
+	jobIDHeader     = "X-Job-ID"
+)
+
+// AsyncRequest is the body of POST /analyze/async.
+type AsyncRequest struct {
+	SentimentRequest
+	CallbackURL string `json:"callback_url" required:"true" format:"uri" doc:"Public http or https URL the AsyncResult is POSTed to"`
+}
+
+type AsyncResponse struct {
+	JobID string `json:"job_id" doc:"ID of the job, sent back with its AsyncResult"`
+}
+
+// AsyncResult is the body POSTed to the callback URL of a job. It holds
+// either the fields of SentimentResponse or an error.
+type AsyncResult struct {
+	JobID string `json:"job_id"`
+	*SentimentResponse
+	Error *ErrorDetail `json:"error,omitempty"`
+}
+
+// AnalysisTask is an asynchronous analysis as handed to a TaskQueue and
+// received back by the task handler.
+type AnalysisTask struct {
+	JobID       string           `json:"job_id"`
+	Request     SentimentRequest `json:"request"`
+	CallbackURL string           `json:"callback_url"`
+	APIKeyID    string           `json:"api_key_id,omitempty"`
+}
+
+// TaskQueue delivers each AnalysisTask to the task handler, /tasks/analyze,
+// retrying while the handler fails.
+type TaskQueue interface {
+	Enqueue(ctx context.Context, task AnalysisTask) error
+}
+
+// AsyncConfig enables asynchronous analysis.
+type AsyncConfig struct {
+	Queue TaskQueue
+	// Verify authenticates the requests of the task queue to the task
+	// handler. Without it every task is rejected.
+	Verify func(r *http.Request) error
+	// CallbackSecret is the HMAC key signing callback bodies.
+	CallbackSecret []byte
+}
+
+// SetAsync enables POST /analyze/async. It must be called before serving
+// requests.
+func (s *Server) SetAsync(cfg AsyncConfig) {
+	s.async = cfg
+	s.callbacks = newFetchClient()
+	// A redirected POST would be resent as a GET; treat it as a failure.
+	s.callbacks.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+}
+
+// analyzeAsyncHandler serves POST /analyze/async: it queues the analysis and
+// returns 202 with the job ID right away.
+func (s *Server) analyzeAsyncHandler(w http.ResponseWriter, r *http.Request) {
+	if s.async.Queue == nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "asynchronous analysis is disabled")
+		return
+	}
+
+	var req AsyncRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if err := s.validateSentimentRequest(&req.SentimentRequest); err != nil {
+		writeTextError(w, r, err)
+		return
+	}
+	u, err := url.Parse(req.CallbackURL)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid callback_url: "+err.Error())
+		return
+	}
+	if err := checkFetchURL(u); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeURLNotAllowed, err.Error())
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	task := AnalysisTask{
+		JobID:       newRequestID(),
+		Request:     req.SentimentRequest,
+		CallbackURL: req.CallbackURL,
+		APIKeyID:    apiKeyIDFromContext(ctx),
+	}
+	if err := s.async.Queue.Enqueue(ctx, task); err != nil {
+		s.log.Error("failed to enqueue analysis task",
+			"request_id", RequestIDFromContext(ctx), "job_id", task.JobID, "error", err.Error())
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "failed to queue the analysis, retry later")
+		return
+	}
+	s.log.Info("queued analysis task",
+		"request_id", RequestIDFromContext(ctx), "job_id", task.JobID)
+	// The task carries no quota charge; the text is counted now.
+	chargeChars(ctx, *req.Text)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(AsyncResponse{JobID: task.JobID})
+}
+
+// taskHandler serves /tasks/analyze for the task queue: it analyzes the text
+// of a task and POSTs the AsyncResult to its callback URL. The task queue
+// retries the task on any other status than 2xx, so tasks that cannot
+// succeed are acknowledged with 204 as well.
+func (s *Server) taskHandler(w http.ResponseWriter, r *http.Request) {
+	id := RequestIDFromContext(r.Context())
+	if s.async.Verify == nil {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "tasks are not accepted")
+		return
+	}
+	if err := s.async.Verify(r); err != nil {
+		s.log.Warn("rejected task request", "request_id", id, "error", err.Error())
+		writeError(w, r, http.StatusForbidden, codeForbidden, "not invoked by the task queue")
+		return
+	}
+
+	// Tasks may have been queued by another version of the server, so
+	// fields it does not know are ignored.
+	var task AnalysisTask
+	if err := s.decodeJSONBody(w, r, &task, false); err != nil {
+		s.log.Error("dropping malformed task", "request_id", id, "error", err.Error())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	if task.APIKeyID != "" {
+		ctx = context.WithValue(ctx, apiKeyIDKey{}, task.APIKeyID)
+	}
+
+	result := AsyncResult{JobID: task.JobID}
+	if err := s.validateSentimentRequest(&task.Request); err != nil {
+		result.Error = &ErrorDetail{Code: codeInvalidRequest, Message: err.Error()}
+	} else {
+		resp, _, err := s.analyzeCached(ctx, task.Request)
+		switch {
+		case err == nil:
+			result.SentimentResponse = &resp
+		case retryableError(err):
+			s.log.Warn("failed to analyze task, leaving it to be retried",
+				"request_id", id, "job_id", task.JobID, "error", err.Error())
+			writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "analysis failed, retry later")
+			return
+		default:
+			s.log.Error("failed to analyze task",
+				"request_id", id, "job_id", task.JobID, "error", err.Error())
+			result.Error = &ErrorDetail{Code: codeUpstreamError, Message: "failed to analyze sentiment"}
+		}
+	}
+
+	if err := s.sendCallback(ctx, task.CallbackURL, result); err != nil {
+		s.log.Warn("callback failed, leaving the task to be retried",
+			"request_id", id, "job_id", task.JobID, "error", err.Error())
+		writeError(w, r, http.StatusBadGateway, codeFetchFailed, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendCallback POSTs result to callbackURL, signed with the callback secret.
+func (s *Server) sendCallback(ctx context.Context, callbackURL string, result AsyncResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(jobIDHeader, result.JobID)
+	req.Header.Set(signatureHeader, signCallback(s.async.CallbackSecret, body))
+
+	resp, err := s.callbacks.Do(req)
+	if err != nil {
+		return &fetchError{err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, fetchMaxBytes))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &fetchError{Status: resp.Status}
+	}
+	return nil
+}
+
+// signCallback returns the signatureHeader value of body.
+func signCallback(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+type apiKeyIDKey struct{}
+
+// apiKeyID identifies key in exported data without revealing it.
+func apiKeyID(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:8])
+}
+
+// apiKeyIDFromContext returns the apiKeyID of the authenticated request, or
+// "" when authentication is disabled.
+func apiKeyIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyIDKey{}).(string)
+	return id
+}
+
+// apiKeys holds the SHA-256 digests of the accepted API keys. Comparing
+// fixed-size digests keeps the check constant-time regardless of key length.
+// With no keys configured authentication is disabled. The keys of a Server
+// are part of its settings, and replaced with them.
+type apiKeys struct {
+	digests [][sha256.Size]byte
+}
+
+func newAPIKeys(keys []string) apiKeys {
+	digests := make([][sha256.Size]byte, len(keys))
+	for i, key := range keys {
+		digests[i] = sha256.Sum256([]byte(key))
+	}
+	return apiKeys{digests: digests}
+}
+
+func (k apiKeys) enabled() bool {
+	return len(k.digests) > 0
+}
+
+// valid reports whether key is one of the configured keys. Every configured
+// key is compared so that timing does not reveal which one matched.
+func (k apiKeys) valid(key string) bool {
+	digest := sha256.Sum256([]byte(key))
+	match := 0
+	for i := range k.digests {
+		match |= subtle.ConstantTimeCompare(digest[:], k.digests[i][:])
+	}
+	return match == 1
+}
+
+// SetAPIKeys replaces the accepted API keys and debug keys, for instance once
+// they are rotated. It cannot enable or disable authentication, which is
+// decided by the keys the server was created with.
+func (s *Server) SetAPIKeys(keys, debugKeys []string) error {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	next := *s.settings.Load()
+	if (len(keys) > 0) != next.keys.enabled() {
+		return errors.New("replacing the API keys cannot enable or disable authentication")
+	}
+	next.keys = newAPIKeys(keys)
+	next.debugKeys = newAPIKeys(debugKeys)
+	s.settings.Store(&next)
+	return nil
+}
+
+// debugAllowed reports whether r may request debug output.
+func (s *Server) debugAllowed(r *http.Request) bool {
+	debugKeys := s.settingsFor(r.Context()).debugKeys
+	return s.debug || debugKeys.enabled() && debugKeys.valid(r.Header.Get(apiKeyHeader))
+}
+
+// authenticate is requireAPIKey, also accepting the ID tokens of
+// s.idTokens and the signatures of s.signatures when they are set. A request
+// with several credentials is let through if its API key, or else the first
+// other one, is valid.
+func (s *Server) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	keys := s.requireAPIKey(next)
+	if s.idTokens == nil && s.signatures == nil {
+		return keys
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := s.settingsFor(r.Context())
+		key := r.Header.Get(apiKeyHeader)
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		bearer = bearer && s.idTokens != nil
+		signed := r.Header.Get(requestSignatureHeader) != "" && s.signatures != nil
+		switch {
+		case key != "" && st.keys.enabled() && (!bearer && !signed || st.keys.valid(key)):
+			keys(w, r)
+		case bearer:
+			s.authenticateToken(w, r, token, next)
+		case signed:
+			s.authenticateSignature(w, r, next)
+		default:
+			var accepted []string
+			if st.keys.enabled() {
+				accepted = append(accepted, apiKeyHeader+" header")
+			}
+			if s.idTokens != nil {
+				accepted = append(accepted, "bearer token")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			if s.signatures != nil {
+				accepted = append(accepted, requestSignatureHeader+" header")
+			}
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing "+strings.Join(accepted, " or "))
+		}
+	}
+}
+
+// requireAPIKey rejects requests without a valid X-API-Key header when
+// authentication is enabled.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	if !s.APIKeyAuth() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+		if key == "" {
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing "+apiKeyHeader+" header")
+			return
+		}
+		if !s.settingsFor(r.Context()).keys.valid(key) {
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid API key")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyIDKey{}, apiKeyID(key))))
+	}
+}
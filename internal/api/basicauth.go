@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuthChallenge is the WWW-Authenticate header of the 401 responses of
+// the admin endpoints when Basic credentials are configured.
+const basicAuthChallenge = `Basic realm="admin", charset="UTF-8"`
+
+// BasicAuthConfig configures the HTTP Basic credentials accepted by the
+// admin endpoints, in addition to Config.AdminAPIKeys. An empty Username
+// disables them.
+type BasicAuthConfig struct {
+	Username string
+	// Password is the password in clear. Exactly one of Password and
+	// PasswordHash must be set along with Username.
+	Password string
+	// PasswordHash is the bcrypt hash of the password, as printed by
+	// htpasswd -nbB.
+	PasswordHash string
+}
+
+// basicAuth holds the admin credentials. Like apiKeys, it compares SHA-256
+// digests so that the comparison is constant-time; a bcrypt hash is compared
+// by bcrypt instead.
+type basicAuth struct {
+	username [sha256.Size]byte
+	password [sha256.Size]byte
+	hash     []byte
+}
+
+// newBasicAuth returns the credentials of cfg, or nil when cfg.Username is
+// empty.
+func newBasicAuth(cfg BasicAuthConfig) (*basicAuth, error) {
+	if cfg.Username == "" {
+		if cfg.Password != "" || cfg.PasswordHash != "" {
+			return nil, errors.New("admin basic auth: a password is set without a username")
+		}
+		return nil, nil
+	}
+	if (cfg.Password == "") == (cfg.PasswordHash == "") {
+		return nil, errors.New("admin basic auth: exactly one of the password and the password hash must be set")
+	}
+	a := &basicAuth{username: sha256.Sum256([]byte(cfg.Username))}
+	if cfg.PasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(cfg.PasswordHash)); err != nil {
+			return nil, errors.New("admin basic auth: the password hash is not a bcrypt hash")
+		}
+		a.hash = []byte(cfg.PasswordHash)
+	} else {
+		a.password = sha256.Sum256([]byte(cfg.Password))
+	}
+	return a, nil
+}
+
+// valid reports whether username and password are the configured
+// credentials. The password is checked even when the username is wrong so
+// that timing does not reveal the username.
+func (a *basicAuth) valid(username, password string) bool {
+	digest := sha256.Sum256([]byte(username))
+	match := subtle.ConstantTimeCompare(digest[:], a.username[:])
+	if a.hash != nil {
+		if bcrypt.CompareHashAndPassword(a.hash, []byte(password)) != nil {
+			match = 0
+		}
+	} else {
+		digest = sha256.Sum256([]byte(password))
+		match &= subtle.ConstantTimeCompare(digest[:], a.password[:])
+	}
+	return match == 1
+}
+
+// adminEnabled reports whether admin credentials of either kind are
+// configured.
+func (s *Server) adminEnabled() bool {
+	return s.settings.Load().adminKeys.enabled() || s.adminAuth != nil
+}
+
+// requireAdmin rejects requests without one of the admin keys in X-API-Key
+// or, when configured, the admin credentials in an Authorization header, and
+// those from clients not allowed by s.adminIPs. Without either kind of
+// credentials the admin endpoints are disabled.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	if !s.adminEnabled() {
+		return func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, http.StatusNotFound, codeNotFound, "no admin credentials are configured")
+		}
+	}
+	return s.adminIPs.filter(s.authenticateAdmin(next))
+}
+
+// ProtectAdmin wraps h, which is served apart from Handler, such as the
+// profiling endpoints, in the authentication and address filter of the admin
+// endpoints. Authentication is skipped when no admin credentials are
+// configured.
+func (s *Server) ProtectAdmin(h http.Handler) http.Handler {
+	if !s.adminEnabled() {
+		return s.adminIPs.filter(h.ServeHTTP)
+	}
+	return s.adminIPs.filter(s.authenticateAdmin(h.ServeHTTP))
+}
+
+func (s *Server) authenticateAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, password, basic := r.BasicAuth()
+		key := r.Header.Get(apiKeyHeader)
+		adminKeys := s.settingsFor(r.Context()).adminKeys
+		switch {
+		case basic && s.adminAuth != nil:
+			if !s.adminAuth.valid(username, password) {
+				s.unauthorizedAdmin(w, r, "invalid admin credentials")
+				return
+			}
+			next(w, r)
+		case key != "" && adminKeys.enabled():
+			if !adminKeys.valid(key) {
+				s.unauthorizedAdmin(w, r, "invalid API key")
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), apiKeyIDKey{}, apiKeyID(key))))
+		case s.adminAuth == nil:
+			s.unauthorizedAdmin(w, r, "missing "+apiKeyHeader+" header")
+		default:
+			s.unauthorizedAdmin(w, r, "missing admin credentials")
+		}
+	}
+}
+
+func (s *Server) unauthorizedAdmin(w http.ResponseWriter, r *http.Request, msg string) {
+	if s.adminAuth != nil {
+		w.Header().Set("WWW-Authenticate", basicAuthChallenge)
+	}
+	writeError(w, r, http.StatusUnauthorized, codeUnauthorized, msg)
+}
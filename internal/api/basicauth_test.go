@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, auth := range []struct {
+		name string
+		cfg  BasicAuthConfig
+	}{
+		{"password", BasicAuthConfig{Username: "admin", Password: "s3cret-pass"}},
+		{"bcrypt hash", BasicAuthConfig{Username: "admin", PasswordHash: string(hash)}},
+	} {
+		t.Run(auth.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminAuth = auth.cfg
+			cfg.AdminAPIKeys = []string{"admin-key"}
+			var logs bytes.Buffer
+			s, err := NewServer(cfg, sentiment.Fake{}, stubLanguage{}, nil, slog.New(slog.NewJSONHandler(&logs, nil)), NewMetrics())
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			h := s.Handler()
+
+			tests := []struct {
+				name       string
+				setAuth    func(*http.Request)
+				wantStatus int
+			}{
+				{"valid", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret-pass") }, http.StatusOK},
+				{"wrong password", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret-pas") }, http.StatusUnauthorized},
+				{"unknown user", func(r *http.Request) { r.SetBasicAuth("root", "s3cret-pass") }, http.StatusUnauthorized},
+				{"missing header", func(*http.Request) {}, http.StatusUnauthorized},
+				{"not Basic", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret-pass") }, http.StatusUnauthorized},
+				{"admin API key", func(r *http.Request) { r.Header.Set(apiKeyHeader, "admin-key") }, http.StatusOK},
+				{"wrong admin API key", func(r *http.Request) { r.Header.Set(apiKeyHeader, "s3cret-pass") }, http.StatusUnauthorized},
+			}
+			for _, tt := range tests {
+				r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+				tt.setAuth(r)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("%s: status = %d, want %d; body %s", tt.name, w.Code, tt.wantStatus, w.Body)
+					continue
+				}
+				challenge := w.Header().Get("WWW-Authenticate")
+				if tt.wantStatus == http.StatusUnauthorized {
+					if challenge != basicAuthChallenge {
+						t.Errorf("%s: WWW-Authenticate = %q, want %q", tt.name, challenge, basicAuthChallenge)
+					}
+					if code := errorCode(t, w); code != codeUnauthorized {
+						t.Errorf("%s: code = %q, want %q", tt.name, code, codeUnauthorized)
+					}
+				} else if challenge != "" {
+					t.Errorf("%s: WWW-Authenticate = %q on success", tt.name, challenge)
+				}
+			}
+
+			if strings.Contains(logs.String(), "s3cret-pas") {
+				t.Errorf("the password was logged:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func TestNewBasicAuthInvalid(t *testing.T) {
+	for _, cfg := range []BasicAuthConfig{
+		{Password: "p"},
+		{Username: "admin"},
+		{Username: "admin", Password: "p", PasswordHash: "$2a$10$x"},
+		{Username: "admin", PasswordHash: "not a hash"},
+	} {
+		if _, err := newBasicAuth(cfg); err == nil {
+			t.Errorf("newBasicAuth(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// DefaultMaxBatchItems is the number of texts a JSON batch may hold unless
+// configured otherwise.
+const DefaultMaxBatchItems = 1000
+
+// BatchRequest lists the texts of a batch either as Texts or, to give each
+// an ID, as Items: an array of BatchItem, or an object mapping IDs to texts.
+type BatchRequest struct {
+	Texts []string        `json:"texts,omitempty" doc:"The texts to analyze; their results are identified by index"`
+	Items json.RawMessage `json:"items,omitempty" doc:"The texts to analyze with the IDs of their results, instead of texts: either an array of BatchItem, answered with results, or an object mapping each ID to its text, answered with items. An ID repeated in the object is rejected with 400, unless lenient JSON decoding is configured, in which case the last text given for it is kept"`
+}
+
+type BatchItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// BatchResult is the outcome for one input text. Exactly one of the embedded
+// response and Error is set.
+type BatchResult struct {
+	Status int `json:"status" doc:"Status code the text would have been answered with on its own"`
+	*SentimentResponse
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResponse is the response to a JSON batch. It is sent with 200 as soon
+// as the batch itself is valid, however many of its texts fail.
+type BatchResponse struct {
+	Results []BatchItemResult `json:"results,omitempty" doc:"In input order; absent when items is an object"`
+	// Items holds the results of the texts given as an object, by ID.
+	Items   map[string]BatchResult `json:"items,omitempty" doc:"The result of each text, by ID, when items is an object; errors start with the ID"`
+	Summary BatchSummary           `json:"summary"`
+}
+
+type BatchItemResult struct {
+	ID string `json:"id" doc:"ID of the item, or index of the text"`
+	BatchResult
+}
+
+type BatchSummary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+func (s *Server) analyzeBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType(r) == ndjsonMediaType {
+		s.analyzeBatchNDJSON(w, r)
+		return
+	}
+
+	var req BatchRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	items, keyed, err := s.batchItems(req)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	switch {
+	case len(req.Texts) > 0 && len(items) > 0:
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "only one of texts and items may be given")
+		return
+	case len(req.Texts) > 0:
+		items = make([]BatchItem, len(req.Texts))
+		for i, text := range req.Texts {
+			items[i] = BatchItem{ID: strconv.Itoa(i), Text: text}
+		}
+	case len(items) == 0:
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "texts or items must contain at least one item")
+		return
+	}
+	if len(items) > s.maxBatchItems {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("the batch has %d items, more than the limit of %d", len(items), s.maxBatchItems))
+		return
+	}
+	ids := make([]string, len(items))
+	texts := make([]string, len(items))
+	for i, item := range items {
+		ids[i], texts[i] = item.ID, item.Text
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	var resp BatchResponse
+	if keyed {
+		resp.Items = make(map[string]BatchResult, len(items))
+	} else {
+		resp.Results = make([]BatchItemResult, len(items))
+	}
+	for i, result := range s.analyzeBatchIDs(ctx, RequestIDFromContext(r.Context()), ids, texts) {
+		if result.Error != "" {
+			resp.Summary.Failed++
+		} else {
+			resp.Summary.Succeeded++
+		}
+		if keyed {
+			if result.Error != "" {
+				result.Error = fmt.Sprintf("item %q: %s", ids[i], result.Error)
+			}
+			resp.Items[ids[i]] = result
+		} else {
+			resp.Results[i] = BatchItemResult{ID: ids[i], BatchResult: result}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// batchItems returns the items of req, sorted by ID when given as an object,
+// in which case keyed is set.
+func (s *Server) batchItems(req BatchRequest) (items []BatchItem, keyed bool, err error) {
+	switch data := bytes.TrimSpace(req.Items); {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		return nil, false, nil
+	case data[0] == '[':
+		err := s.unmarshalJSON(data, &items)
+		return items, false, err
+	case data[0] == '{':
+		var texts map[string]string
+		if err := s.unmarshalJSON(data, &texts); err != nil {
+			return nil, true, err
+		}
+		for _, id := range slices.Sorted(maps.Keys(texts)) {
+			items = append(items, BatchItem{ID: id, Text: texts[id]})
+		}
+		return items, true, nil
+	default:
+		return nil, false, errors.New("items must be an array of items or an object mapping IDs to texts")
+	}
+}
+
+// analyzeBatch analyzes texts with at most s.batchWorkers calls in
+// flight and returns the results in input order. The texts not started
+// before ctx is done fail with its error.
+func (s *Server) analyzeBatch(ctx context.Context, requestID string, texts []string) []BatchResult {
+	return s.analyzeBatchIDs(ctx, requestID, nil, texts)
+}
+
+// analyzeBatchIDs is analyzeBatch with the failures logged with the ID of
+// each text, ids[i] for texts[i], rather than its index; ids may be nil.
+func (s *Server) analyzeBatchIDs(ctx context.Context, requestID string, ids, texts []string) []BatchResult {
+	results := mapSlice(ctx, s.batchWorkers, texts, func(ctx context.Context, i int, text string) BatchResult {
+		if ids != nil {
+			return s.analyzeBatchItem(ctx, requestID, "id", ids[i], text)
+		}
+		return s.analyzeBatchItem(ctx, requestID, "index", i, text)
+	})
+	for len(results) < len(texts) {
+		err := context.Cause(ctx)
+		results = append(results, BatchResult{Status: upstreamStatus(err), Error: err.Error()})
+	}
+	return results
+}
+
+// analyzeBatchItem analyzes one text of a batch. Failures are logged with the
+// item identified by key and value.
+func (s *Server) analyzeBatchItem(ctx context.Context, requestID, key string, value any, text string) BatchResult {
+	if err := s.validateText(text); err != nil {
+		return BatchResult{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+
+	resp, _, err := s.analyzeCached(ctx, SentimentRequest{Text: &text})
+	if err != nil {
+		s.log.Error("failed to analyze batch item",
+			"request_id", requestID, key, value, "error", err.Error())
+		return BatchResult{Status: upstreamStatus(err), Error: err.Error()}
+	}
+	return BatchResult{Status: http.StatusOK, SentimentResponse: &resp}
+}
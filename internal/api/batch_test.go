@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newBatchServer returns a test server whose analyzer fails on "fail" and
+// times out on "slow".
+func newBatchServer(t *testing.T, cfg Config) http.Handler {
+	t.Helper()
+	analyzer := analyzerFunc(func(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+		switch doc.Text {
+		case "fail":
+			return sentiment.Result{}, status.Error(codes.Internal, "backend error")
+		case "slow":
+			return sentiment.Result{}, status.Error(codes.DeadlineExceeded, "deadline exceeded")
+		}
+		return sentiment.Fake{}.Analyze(ctx, doc)
+	})
+	s, err := NewServer(cfg, analyzer, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s.Handler()
+}
+
+// postBatch posts body to /v1/analyze/batch and decodes the BatchResponse,
+// along with the raw JSON of its results.
+func postBatch(t *testing.T, h http.Handler, body string) (BatchResponse, []json.RawMessage) {
+	t.Helper()
+	w := serve(h, http.MethodPost, "/v1/analyze/batch", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	var raw struct{ Results []json.RawMessage }
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	return resp, raw.Results
+}
+
+func TestAnalyzeBatchPartial(t *testing.T) {
+	h := newBatchServer(t, testConfig())
+
+	// One failure in 500 texts leaves the other results.
+	texts := make([]string, 500)
+	for i := range texts {
+		texts[i] = "I love it"
+	}
+	texts[42] = "fail"
+	body, _ := json.Marshal(BatchRequest{Texts: texts})
+	resp, raw := postBatch(t, h, string(body))
+	if resp.Summary != (BatchSummary{Succeeded: 499, Failed: 1}) {
+		t.Errorf("summary %+v, want 499 succeeded and 1 failed", resp.Summary)
+	}
+	if len(resp.Results) != len(texts) || resp.Items != nil {
+		t.Fatalf("%d results and items %v, want %d results", len(resp.Results), resp.Items, len(texts))
+	}
+	for i, result := range resp.Results {
+		if result.ID != fmt.Sprint(i) {
+			t.Errorf("result %d has ID %q, want its index", i, result.ID)
+		}
+		if i == 42 {
+			continue
+		}
+		if result.Status != http.StatusOK || result.SentimentResponse == nil || result.Sentiment != "positive" || result.Error != "" {
+			t.Errorf("result %d: %s, want positive", i, raw[i])
+		}
+	}
+	failed := resp.Results[42]
+	if failed.Status != http.StatusInternalServerError || failed.SentimentResponse != nil || failed.Error == "" {
+		t.Errorf("result 42: %s, want the error alone", raw[42])
+	}
+	if strings.Contains(string(raw[42]), "score") {
+		t.Errorf("result 42: %s, want no score", raw[42])
+	}
+
+	// Each item gets the status it would have had on its own.
+	resp, raw = postBatch(t, h, `{"items": [
+		{"id": "ok", "text": "This is awful"},
+		{"id": "empty", "text": ""},
+		{"id": "fail", "text": "fail"},
+		{"id": "slow", "text": "slow"}
+	]}`)
+	wantResults := []struct {
+		id     string
+		status int
+	}{
+		{"ok", http.StatusOK},
+		{"empty", http.StatusBadRequest},
+		{"fail", http.StatusInternalServerError},
+		{"slow", http.StatusGatewayTimeout},
+	}
+	if len(resp.Results) != len(wantResults) {
+		t.Fatalf("results %+v, want %d", resp.Results, len(wantResults))
+	}
+	for i, want := range wantResults {
+		if got := resp.Results[i]; got.ID != want.id || got.Status != want.status || (got.Error == "") != (want.status == http.StatusOK) {
+			t.Errorf("result %d: %s, want %s with status %d", i, raw[i], want.id, want.status)
+		}
+	}
+	if resp.Results[0].SentimentResponse == nil || resp.Results[0].Sentiment != "negative" {
+		t.Errorf("result ok: %s, want negative", raw[0])
+	}
+	if resp.Summary != (BatchSummary{Succeeded: 1, Failed: 3}) {
+		t.Errorf("summary %+v, want 1 succeeded and 3 failed", resp.Summary)
+	}
+}
+
+// TestAnalyzeBatchRejected checks the batches failed as a whole.
+func TestAnalyzeBatchRejected(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBatchItems = 3
+	h := newBatchServer(t, cfg)
+	for _, tt := range []struct {
+		name, body string
+	}{
+		{"malformed JSON", `{"texts": [`},
+		{"no texts", `{"texts": []}`},
+		{"texts and items", `{"texts": ["I love it"], "items": [{"id": "a", "text": "I love it"}]}`},
+		{"items of another type", `{"items": "I love it"}`},
+		{"too many texts", `{"texts": ["a", "b", "c", "d"]}`},
+		{"too many items", `{"items": [{"id": "a"}, {"id": "b"}, {"id": "c"}, {"id": "d"}]}`},
+	} {
+		w := serve(h, http.MethodPost, "/v1/analyze/batch", tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400; body %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		if code := errorCode(t, w); code != codeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", tt.name, code, codeInvalidRequest)
+		}
+	}
+
+	cfg = testConfig()
+	cfg.APIKeys = []string{"key"}
+	h = newBatchServer(t, cfg)
+	if w := serve(h, http.MethodPost, "/v1/analyze/batch", `{"texts": ["I love it"]}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("without an API key: status = %d, want 401", w.Code)
+	}
+}
+
+func TestAnalyzeBatchKeyed(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBatchItems = 4
+	h := newBatchServer(t, cfg)
+
+	w := serve(h, http.MethodPost, "/v1/analyze/batch", `{"items": {
+		"TICKET-2": "This is awful",
+		"TICKET-1": "I love it",
+		"ticket-1": "",
+		"TICKET \"3\"": "fail"
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	if resp.Results != nil || len(resp.Items) != 4 {
+		t.Fatalf("results %+v, items %+v, want 4 items alone", resp.Results, resp.Items)
+	}
+	for id, want := range map[string]string{"TICKET-1": "positive", "TICKET-2": "negative"} {
+		if got := resp.Items[id]; got.Status != http.StatusOK || got.SentimentResponse == nil || got.Sentiment != want {
+			t.Errorf("%s: %+v, want %s", id, got, want)
+		}
+	}
+	// The keys are verbatim in the errors.
+	for id, status := range map[string]int{"ticket-1": http.StatusBadRequest, `TICKET "3"`: http.StatusInternalServerError} {
+		got := resp.Items[id]
+		if got.Status != status || got.SentimentResponse != nil || !strings.HasPrefix(got.Error, fmt.Sprintf("item %q: ", id)) {
+			t.Errorf("%s: %+v, want status %d and an error naming the item", id, got, status)
+		}
+	}
+	if resp.Summary != (BatchSummary{Succeeded: 2, Failed: 2}) {
+		t.Errorf("summary %+v, want 2 succeeded and 2 failed", resp.Summary)
+	}
+
+	w = serve(h, http.MethodPost, "/v1/analyze/batch", `{"items": {"a": "a", "b": "b", "c": "c", "d": "d", "e": "e"}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "more than the limit of 4") {
+		t.Errorf("5 items: status %d, body %s, want 400 over the limit", w.Code, w.Body)
+	}
+
+	// A repeated key is rejected, unless JSON decoding is lenient, in which
+	// case the last text given for it is kept.
+	repeated := `{"items": {"TICKET-1": "I love it", "TICKET-1": "This is awful"}}`
+	w = serve(h, http.MethodPost, "/v1/analyze/batch", repeated)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `\"TICKET-1\"`) {
+		t.Errorf("repeated key: status %d, body %s, want 400 naming the key", w.Code, w.Body)
+	}
+	cfg.LenientJSON = true
+	w = serve(newBatchServer(t, cfg), http.MethodPost, "/v1/analyze/batch", repeated)
+	var lenient BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &lenient); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("lenient, repeated key: status %d, body %s, want 200", w.Code, w.Body)
+	}
+	if got := lenient.Items["TICKET-1"]; len(lenient.Items) != 1 || got.SentimentResponse == nil || got.Sentiment != "negative" {
+		t.Errorf("lenient, repeated key: items %+v, want the negative result of the last text", lenient.Items)
+	}
+}
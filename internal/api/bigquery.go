@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// AnalysisEventSchema is the schema of the BigQuery table AnalysisEvents are
+// exported to. Partitioning the table on timestamp is recommended.
+var AnalysisEventSchema = bigquery.Schema{
+	{Name: "timestamp", Type: bigquery.TimestampFieldType, Required: true},
+	{Name: "text_hash", Type: bigquery.StringFieldType, Required: true, Description: "Hex SHA-256 of the text"},
+	{Name: "sentiment", Type: bigquery.StringFieldType, Required: true},
+	{Name: "score", Type: bigquery.FloatFieldType, Required: true},
+	{Name: "magnitude", Type: bigquery.FloatFieldType, Required: true},
+	{Name: "language", Type: bigquery.StringFieldType},
+	{Name: "latency_ms", Type: bigquery.FloatFieldType, Required: true, Description: "Time spent analyzing, 0 for cached results"},
+	{Name: "cached", Type: bigquery.BooleanFieldType, Required: true},
+	{Name: "api_key_id", Type: bigquery.StringFieldType, Description: "Truncated SHA-256 of the API key; null when authentication is disabled"},
+}
+
+// BigQueryInserter is an EventInserter that appends rows to a BigQuery table
+// with the Storage Write API, through the table's default stream.
+type BigQueryInserter struct {
+	client  *managedwriter.Client
+	stream  *managedwriter.ManagedStream
+	message protoreflect.MessageDescriptor
+}
+
+// NewBigQueryInserter opens the default stream of projectID.dataset.table,
+// which must exist with AnalysisEventSchema.
+func NewBigQueryInserter(ctx context.Context, projectID, dataset, table string) (*BigQueryInserter, error) {
+	message, err := analysisEventDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	descProto, err := adapt.NormalizeDescriptor(message)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := managedwriter.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(projectID, dataset, table)),
+		managedwriter.WithType(managedwriter.DefaultStream),
+		managedwriter.WithSchemaDescriptor(descProto),
+	)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &BigQueryInserter{client: client, stream: stream, message: message}, nil
+}
+
+// analysisEventDescriptor returns the descriptor of the rows of
+// AnalysisEventSchema.
+func analysisEventDescriptor() (protoreflect.MessageDescriptor, error) {
+	tableSchema, err := adapt.BQSchemaToStorageTableSchema(AnalysisEventSchema)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := adapt.StorageSchemaToProto2Descriptor(tableSchema, "analysis_event")
+	if err != nil {
+		return nil, err
+	}
+	message, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("unexpected descriptor %T for the analysis event schema", desc)
+	}
+	return message, nil
+}
+
+func (b *BigQueryInserter) Insert(ctx context.Context, events []AnalysisEvent) error {
+	rows := make([][]byte, len(events))
+	for i, ev := range events {
+		row, err := proto.Marshal(b.row(ev))
+		if err != nil {
+			return err
+		}
+		rows[i] = row
+	}
+	result, err := b.stream.AppendRows(ctx, rows)
+	if err != nil {
+		return err
+	}
+	_, err = result.GetResult(ctx)
+	return err
+}
+
+// row encodes ev as a message of the table schema.
+func (b *BigQueryInserter) row(ev AnalysisEvent) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(b.message)
+	fields := b.message.Fields()
+	set := func(name string, v protoreflect.Value) {
+		msg.Set(fields.ByName(protoreflect.Name(name)), v)
+	}
+	// TIMESTAMP columns take microseconds since the epoch.
+	set("timestamp", protoreflect.ValueOfInt64(ev.Timestamp.UnixMicro()))
+	set("text_hash", protoreflect.ValueOfString(ev.TextHash))
+	set("sentiment", protoreflect.ValueOfString(ev.Sentiment))
+	set("score", protoreflect.ValueOfFloat64(ev.Score))
+	set("magnitude", protoreflect.ValueOfFloat64(ev.Magnitude))
+	if ev.Language != "" {
+		set("language", protoreflect.ValueOfString(ev.Language))
+	}
+	set("latency_ms", protoreflect.ValueOfFloat64(ev.LatencyMS))
+	set("cached", protoreflect.ValueOfBool(ev.Cached))
+	if ev.APIKeyID != "" {
+		set("api_key_id", protoreflect.ValueOfString(ev.APIKeyID))
+	}
+	return msg
+}
+
+func (b *BigQueryInserter) Close() error {
+	b.stream.Close()
+	return b.client.Close()
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the result cache size and entry lifetime.
+const (
+	DefaultCacheMaxEntries = 1000
+	DefaultCacheTTL        = time.Hour
+)
+
+// Cache stores analysis results by cacheKey. A failing cache is treated as a
+// miss by callers, so implementations should return errors rather than block.
+type Cache interface {
+	Get(ctx context.Context, key string) (SentimentResponse, bool, error)
+	Set(ctx context.Context, key string, resp SentimentResponse) error
+}
+
+// cacheKey identifies an analysis by a SHA-256 of its normalized text and the
+// options that affect the response. The labels are derived from the cached
+// scores on every read, so the neutral band is not part of the key.
+func cacheKey(req SentimentRequest) string {
+	h := sha256.New()
+	h.Write([]byte(req.Language))
+	if req.IncludeSentences {
+		h.Write([]byte{0, 1})
+	} else {
+		h.Write([]byte{0, 0})
+	}
+	if req.DocumentType == "html" {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	if req.Granularity == "fine" {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(normalizeText(*req.Text)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeText collapses runs of whitespace so that trivially different
+// copies of the same text share a cache entry.
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// LRUCache is a fixed-size, concurrency-safe cache of analysis results that
+// evicts the least recently used entry when full. Entries older than ttl are
+// treated as missing.
+type LRUCache struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	resp    SentimentResponse
+	expires time.Time
+}
+
+func NewLRUCache(maxEntries int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(_ context.Context, key string) (SentimentResponse, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return SentimentResponse{}, false, nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return SentimentResponse{}, false, nil
+	}
+	c.order.MoveToFront(el)
+	return entry.resp, true, nil
+}
+
+func (c *LRUCache) Set(_ context.Context, key string, resp SentimentResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.resp = resp
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, resp: resp, expires: expires})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return nil
+}
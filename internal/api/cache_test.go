@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(2, time.Hour)
+	ctx := context.Background()
+	c.Set(ctx, "a", SentimentResponse{Score: 0.1})
+	c.Set(ctx, "b", SentimentResponse{Score: 0.2})
+
+	// Reading a makes b the least recently used entry.
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("a is missing")
+	}
+	c.Set(ctx, "c", SentimentResponse{Score: 0.3})
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b was kept over the limit, want it evicted")
+	}
+	for key, score := range map[string]float64{"a": 0.1, "c": 0.3} {
+		resp, ok, err := c.Get(ctx, key)
+		if !ok || err != nil || resp.Score != score {
+			t.Errorf("Get(%q) = %+v, %t, %v, want score %v", key, resp, ok, err, score)
+		}
+	}
+
+	// Setting a key again replaces its entry rather than adding one.
+	c.Set(ctx, "c", SentimentResponse{Score: 0.4})
+	if resp, _, _ := c.Get(ctx, "c"); resp.Score != 0.4 {
+		t.Errorf("c after a second Set = %+v, want score 0.4", resp)
+	}
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Error("a was evicted by the update of c")
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLRUCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	c.Set(ctx, "a", SentimentResponse{Score: 0.1})
+
+	now = now.Add(time.Minute - time.Nanosecond)
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Error("the entry expired before its TTL")
+	}
+	now = now.Add(time.Nanosecond)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("the entry outlived its TTL")
+	}
+	if n := c.order.Len(); n != 0 {
+		t.Errorf("%d entries kept after expiry, want 0", n)
+	}
+
+	// Setting the key again starts a new TTL.
+	c.Set(ctx, "a", SentimentResponse{Score: 0.2})
+	now = now.Add(time.Second)
+	if resp, ok, _ := c.Get(ctx, "a"); !ok || resp.Score != 0.2 {
+		t.Errorf("Get after a new Set = %+v, %t, want score 0.2", resp, ok)
+	}
+}
+
+func TestLRUCacheConcurrent(t *testing.T) {
+	c := NewLRUCache(16, time.Hour)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 200 {
+				key := fmt.Sprint((i + j) % 32)
+				c.Set(ctx, key, SentimentResponse{Score: float64(j)})
+				c.Get(ctx, key)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.order.Len(); n != 16 || len(c.entries) != 16 {
+		t.Errorf("%d entries in the list and %d in the map, want 16", n, len(c.entries))
+	}
+}
+
+// countingAnalyzer is the fake analyzer counting its calls.
+type countingAnalyzer struct {
+	sentiment.Fake
+	calls atomic.Int32
+}
+
+func (a *countingAnalyzer) Analyze(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+	a.calls.Add(1)
+	return a.Fake.Analyze(ctx, doc)
+}
+
+func TestAnalyzeCache(t *testing.T) {
+	a := &countingAnalyzer{}
+	s, err := NewServer(testConfig(), a, stubLanguage{}, NewLRUCache(10, time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	tests := []struct {
+		name, body, want string
+		wantCalls        int32
+	}{
+		{"first request", `{"text": "I love it"}`, "MISS", 1},
+		{"same text", `{"text": "I love it"}`, "HIT", 1},
+		{"same text but for whitespace", `{"text": "  I love\n it "}`, "HIT", 1},
+		{"other language", `{"text": "I love it", "language": "fr"}`, "MISS", 2},
+		{"other text", `{"text": "I hate it"}`, "MISS", 3},
+	}
+	var first string
+	for _, tt := range tests {
+		w := serve(h, http.MethodPost, "/v1/analyze", tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200; body %s", tt.name, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-Cache"); got != tt.want {
+			t.Errorf("%s: X-Cache = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := a.calls.Load(); got != tt.wantCalls {
+			t.Errorf("%s: %d calls to the analyzer, want %d", tt.name, got, tt.wantCalls)
+		}
+		if first == "" {
+			first = w.Body.String()
+		} else if tt.want == "HIT" && w.Body.String() != first {
+			t.Errorf("%s: cached response %s, want %s", tt.name, w.Body, first)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// ChunkSentiment is the sentiment of one chunk of a text that was too large
+// to analyze in one call.
+type ChunkSentiment struct {
+	Start     int     `json:"start" xml:"start" doc:"Byte offset of the chunk in the text"`
+	End       int     `json:"end" xml:"end" doc:"Byte offset just past the end of the chunk"`
+	Score     float64 `json:"score" xml:"score"`
+	Magnitude float64 `json:"magnitude" xml:"magnitude"`
+}
+
+// textChunk is the byte range [start, end) of a text.
+type textChunk struct {
+	start, end int
+}
+
+// splitText splits text into chunks of at most limit bytes. A chunk ends
+// after the last sentence that fits, or failing that at the last whitespace,
+// and never inside a UTF-8 sequence. Whitespace between chunks is dropped.
+func splitText(text string, limit int) []textChunk {
+	var chunks []textChunk
+	start := skipSpace(text, 0)
+	for start < len(text) {
+		end := len(text)
+		if end-start > limit {
+			end = start + cutPoint(text[start:], limit)
+		}
+		chunks = append(chunks, textChunk{start, end})
+		start = skipSpace(text, end)
+	}
+	return chunks
+}
+
+// cutPoint returns where to end the first chunk of text, which is longer
+// than limit bytes.
+func cutPoint(text string, limit int) int {
+	// A sentence ends at a terminator followed by whitespace.
+	for i := limit; i > 0; i-- {
+		if strings.IndexByte(".!?\n", text[i-1]) >= 0 && isSpaceAt(text, i) {
+			return i
+		}
+	}
+	for i := limit; i > 0; i-- {
+		if isSpaceAt(text, i) {
+			return i
+		}
+	}
+	i := limit
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	if i == 0 {
+		// The limit is smaller than the first character; take it whole.
+		_, i = utf8.DecodeRuneInString(text)
+	}
+	return i
+}
+
+func isSpaceAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsSpace(r)
+}
+
+func skipSpace(text string, i int) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// validateSentimentText is validateText for sentiment analysis, which
+// accepts texts over s.maxTextBytes as long as they split into at most
+// s.maxChunks chunks.
+func (s *Server) validateSentimentText(text string) error {
+	if len(text) <= s.maxTextBytes {
+		return s.validateText(text)
+	}
+	if strings.TrimSpace(text) == "" {
+		return errEmptyText
+	}
+	if n := len(splitText(text, s.maxTextBytes)); n > s.maxChunks {
+		return fmt.Errorf("%w: %d bytes needs %d chunks of at most %d bytes, over the limit of %d chunks",
+			errTextTooLarge, len(text), n, s.maxTextBytes, s.maxChunks)
+	}
+	return nil
+}
+
+// analyzeChunks analyzes each chunk of doc with at most s.batchWorkers
+// calls in flight and combines the results. The document score is the mean
+// of the chunk scores weighted by their magnitudes, and the magnitude their
+// sum.
+func (s *Server) analyzeChunks(ctx context.Context, doc sentiment.Document, chunks []textChunk) (sentiment.Result, []ChunkSentiment, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := mapSlice(ctx, s.batchWorkers, chunks, func(ctx context.Context, _ int, chunk textChunk) sentiment.Result {
+		chunkDoc := doc
+		chunkDoc.Text = doc.Text[chunk.start:chunk.end]
+		res, err := s.analyzer.Analyze(ctx, chunkDoc)
+		if err != nil {
+			// The other chunks are of no use without this one. Only the
+			// first error is kept as the cause.
+			cancel(err)
+		}
+		return res
+	})
+	if err := context.Cause(ctx); err != nil {
+		return sentiment.Result{}, nil, err
+	}
+
+	out := sentiment.Result{Language: results[0].Language, Provider: results[0].Provider}
+	breakdown := make([]ChunkSentiment, len(chunks))
+	var weighted, scores float64
+	for i, res := range results {
+		breakdown[i] = ChunkSentiment{
+			Start:     chunks[i].start,
+			End:       chunks[i].end,
+			Score:     res.Score,
+			Magnitude: res.Magnitude,
+		}
+		weighted += res.Score * res.Magnitude
+		scores += res.Score
+		out.Magnitude += res.Magnitude
+		out.Sentences = append(out.Sentences, res.Sentences...)
+		// A result that is partly a stand-in is a stand-in.
+		if res.Provider == sentiment.ProviderLocal {
+			out.Provider = sentiment.ProviderLocal
+		}
+	}
+	if out.Magnitude > 0 {
+		out.Score = weighted / out.Magnitude
+	} else {
+		out.Score = scores / float64(len(results))
+	}
+	return out, breakdown, nil
+}
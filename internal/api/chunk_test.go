@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"fits", "One. Two.", 20, []string{"One. Two."}},
+		{"just over one chunk", "One. Two.", 8, []string{"One.", "Two."}},
+		{"last sentence that fits", "One. Two. Three four.", 12, []string{"One. Two.", "Three four."}},
+		{"other terminators", "Yes! No? Maybe\nso", 9, []string{"Yes! No?", "Maybe\nso"}},
+		{"terminator without space", "a.b.c d", 5, []string{"a.b.c", "d"}},
+		{"whitespace without sentence", "one two three", 9, []string{"one two", "three"}},
+		{"whitespace between chunks dropped", "  One.   Two.", 8, []string{"One.", "Two."}},
+		{"no whitespace", "abcdefgh", 3, []string{"abc", "def", "gh"}},
+		// Without whitespace, a chunk ends before the character the limit
+		// falls in.
+		{"multibyte", "ééééé", 3, []string{"é", "é", "é", "é", "é"}},
+		{"multibyte at the limit", "ééé", 4, []string{"éé", "é"}},
+		// A character longer than the limit is taken whole.
+		{"character over the limit", "€€", 2, []string{"€", "€"}},
+		{"unicode space", "one two", 5, []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range splitText(tt.text, tt.limit) {
+				got = append(got, tt.text[c.start:c.end])
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTextManyChunks(t *testing.T) {
+	var b strings.Builder
+	for i := range 200 {
+		fmt.Fprintf(&b, "Zdanie numer %d jest żółte. ", i)
+	}
+	text := strings.TrimSpace(b.String())
+	const limit = 100
+
+	chunks := splitText(text, limit)
+	if len(chunks) < len(text)/limit {
+		t.Fatalf("%d chunks of %d bytes, too few for %d bytes", len(chunks), limit, len(text))
+	}
+	var rebuilt []string
+	for i, c := range chunks {
+		chunk := text[c.start:c.end]
+		if len(chunk) > limit {
+			t.Errorf("chunk %d is %d bytes, over the limit", i, len(chunk))
+		}
+		if !utf8.ValidString(chunk) {
+			t.Errorf("chunk %d %q cuts a character", i, chunk)
+		}
+		if !strings.HasSuffix(chunk, ".") {
+			t.Errorf("chunk %d %q does not end a sentence", i, chunk)
+		}
+		if i > 0 && c.start < chunks[i-1].end {
+			t.Errorf("chunk %d overlaps the one before", i)
+		}
+		rebuilt = append(rebuilt, chunk)
+	}
+	if got := strings.Join(rebuilt, " "); got != text {
+		t.Errorf("the chunks do not cover the text")
+	}
+}
+
+// textAnalyzer answers with the result of each text, and fails for others.
+type textAnalyzer map[string]sentiment.Result
+
+func (a textAnalyzer) Analyze(_ context.Context, doc sentiment.Document) (sentiment.Result, error) {
+	res, ok := a[doc.Text]
+	if !ok {
+		return sentiment.Result{}, fmt.Errorf("unexpected text %q", doc.Text)
+	}
+	return res, nil
+}
+
+func TestAnalyzeChunks(t *testing.T) {
+	a := textAnalyzer{
+		"Good.":  {Score: 0.8, Magnitude: 2, Language: "en"},
+		"Bad.":   {Score: -0.4, Magnitude: 1, Language: "en"},
+		"Plain.": {Score: 0.2, Magnitude: 0, Language: "en"},
+		"Flat.":  {Score: 0, Magnitude: 0, Language: "en"},
+	}
+	cfg := testConfig()
+	cfg.MaxTextBytes = 6
+	cfg.MaxChunks = 3
+	s, err := NewServer(cfg, a, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	tests := []struct {
+		name, text       string
+		score, magnitude float64
+		chunks           []ChunkSentiment
+	}{
+		// The score is weighted by the magnitudes.
+		{"weighted", "Good. Bad.", 0.4, 3, []ChunkSentiment{{0, 5, 0.8, 2}, {6, 10, -0.4, 1}}},
+		{"many chunks", "Good. Good. Bad.", 0.56, 5, []ChunkSentiment{{0, 5, 0.8, 2}, {6, 11, 0.8, 2}, {12, 16, -0.4, 1}}},
+		// Without magnitude, it is the plain mean.
+		{"no magnitude", "Plain. Flat.", 0.1, 0, []ChunkSentiment{{0, 6, 0.2, 0}, {7, 12, 0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "`+tt.text+`"}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+			}
+			var resp SentimentResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body, err)
+			}
+			if !near(resp.Score, tt.score) || !near(resp.Magnitude, tt.magnitude) {
+				t.Errorf("score %v, magnitude %v, want %v and %v", resp.Score, resp.Magnitude, tt.score, tt.magnitude)
+			}
+			if len(resp.Chunks) != len(tt.chunks) {
+				t.Fatalf("chunks = %+v, want %+v", resp.Chunks, tt.chunks)
+			}
+			for i, c := range resp.Chunks {
+				want := tt.chunks[i]
+				if c.Start != want.Start || c.End != want.End || !near(c.Score, want.Score) || !near(c.Magnitude, want.Magnitude) {
+					t.Errorf("chunk %d = %+v, want %+v", i, c, want)
+				}
+			}
+		})
+	}
+
+	// A text that fits is analyzed whole, without a breakdown.
+	w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "Good."}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"chunks"`) {
+		t.Errorf("text within the limit: status %d, body %s, want 200 without chunks", w.Code, w.Body)
+	}
+
+	w = serve(h, http.MethodPost, "/v1/analyze", `{"text": "Good. Good. Good. Bad."}`)
+	if w.Code != http.StatusRequestEntityTooLarge || errorCode(t, w) != codeTextTooLarge {
+		t.Errorf("text over the chunk limit: status %d, body %s, want 413 %s", w.Code, w.Body, codeTextTooLarge)
+	}
+
+	// A chunk that fails fails the whole text.
+	w = serve(h, http.MethodPost, "/v1/analyze", `{"text": "Good. Other."}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("failed chunk: status %d, want 500", w.Code)
+	}
+}
+
+// near reports whether a and b are equal but for rounding errors.
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errTextTooShort is returned when the Language API refuses to classify a
+// text because it has too few tokens.
+var errTextTooShort = errors.New("text is too short to classify; provide at least 20 words")
+
+type ClassifyRequest struct {
+	Text string `json:"text"`
+}
+
+type ClassifyResponse struct {
+	Categories []Category `json:"categories"`
+}
+
+type Category struct {
+	Name       string  `json:"name"`
+	Confidence float32 `json:"confidence"`
+}
+
+func (s *Server) classifyHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClassifyRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if err := s.validateText(req.Text); err != nil {
+		writeTextError(w, r, err)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, err := s.classify(ctx, req)
+	if errors.Is(err, errTextTooShort) {
+		writeError(w, r, http.StatusUnprocessableEntity, codeTextTooShort, err.Error())
+		return
+	}
+	if err != nil {
+		s.writeUpstreamError(w, r, err, "classify text")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) classify(ctx context.Context, req ClassifyRequest) (ClassifyResponse, error) {
+	s.countAnalyzed(ctx, req.Text)
+	resp, err := s.lang.ClassifyText(ctx, &languagepb.ClassifyTextRequest{
+		Document: &languagepb.Document{
+			Source: &languagepb.Document_Content{
+				Content: req.Text,
+			},
+			Type: languagepb.Document_PLAIN_TEXT,
+		},
+	})
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.InvalidArgument &&
+			strings.Contains(strings.ToLower(st.Message()), "too few tokens") {
+			return ClassifyResponse{}, errTextTooShort
+		}
+		return ClassifyResponse{}, err
+	}
+
+	out := ClassifyResponse{
+		Categories: make([]Category, 0, len(resp.Categories)),
+	}
+	for _, category := range resp.Categories {
+		out.Categories = append(out.Categories, Category{
+			Name:       category.GetName(),
+			Confidence: category.GetConfidence(),
+		})
+	}
+
+	return out, nil
+}
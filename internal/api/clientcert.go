@@ -0,0 +1,24 @@
+package api
+
+import "net/http"
+
+// ClientCommonName returns the common name of the client certificate r was
+// authenticated with over mutual TLS, or "" when it was not. Only verified
+// certificates count, so that a name presented without a CA to check it
+// against is never trusted.
+func ClientCommonName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// rateLimitKey returns the key of the bucket r is counted against: the
+// client certificate when there is one, since callers inside the VPC may
+// share addresses, and the client IP otherwise.
+func rateLimitKey(r *http.Request, trustedHops int) string {
+	if cn := ClientCommonName(r); cn != "" {
+		return "cn:" + cn
+	}
+	return clientIP(r, trustedHops)
+}
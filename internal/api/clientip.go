@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the address of the client that sent r. When the server
+// runs behind trustedHops reverse proxies, each of which appends the address
+// it received the request from to X-Forwarded-For, the client is the
+// trustedHops-th entry from the right; entries further left are supplied by
+// the client and cannot be trusted.
+func clientIP(r *http.Request, trustedHops int) string {
+	if trustedHops > 0 {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			var hops []string
+			for _, v := range xff {
+				for _, hop := range strings.Split(v, ",") {
+					hops = append(hops, strings.TrimSpace(hop))
+				}
+			}
+			if len(hops) >= trustedHops {
+				if ip := net.ParseIP(hops[len(hops)-trustedHops]); ip != nil {
+					return ip.String()
+				}
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	clouderrorreporting "google.golang.org/api/clouderrorreporting/v1beta1"
+)
+
+// CloudErrorReporter is an ErrorReporter of Google Cloud Error Reporting.
+type CloudErrorReporter struct {
+	events  *clouderrorreporting.ProjectsEventsService
+	project string
+	service *clouderrorreporting.ServiceContext
+}
+
+// NewCloudErrorReporter reports errors to project as those of version of
+// service, by which Error Reporting groups them.
+func NewCloudErrorReporter(ctx context.Context, project, service, version string) (*CloudErrorReporter, error) {
+	svc, err := clouderrorreporting.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudErrorReporter{
+		events:  svc.Projects.Events,
+		project: "projects/" + project,
+		service: &clouderrorreporting.ServiceContext{Service: service, Version: version},
+	}, nil
+}
+
+func (c *CloudErrorReporter) Report(ctx context.Context, ev ErrorEvent) error {
+	_, err := c.events.Report(c.project, &clouderrorreporting.ReportedErrorEvent{
+		EventTime:      ev.Time.UTC().Format(time.RFC3339Nano),
+		Message:        ev.Message,
+		ServiceContext: c.service,
+		Context: &clouderrorreporting.ErrorContext{
+			HttpRequest: &clouderrorreporting.HttpRequestContext{
+				Method:             ev.Method,
+				Url:                ev.URL,
+				UserAgent:          ev.UserAgent,
+				RemoteIp:           ev.RemoteIP,
+				ResponseStatusCode: int64(ev.Status),
+			},
+		},
+	}).Context(ctx).Do()
+	return err
+}
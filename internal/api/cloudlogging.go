@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cloudTraceHeader is set by Google's load balancers and Cloud Run as
+// TRACE_ID/SPAN_ID;o=OPTIONS, with a decimal span ID.
+const cloudTraceHeader = "X-Cloud-Trace-Context"
+
+// Keys of the LogEntry fields Cloud Logging reads from structured logs.
+const (
+	logTraceKey        = "logging.googleapis.com/trace"
+	logSpanIDKey       = "logging.googleapis.com/spanId"
+	logTraceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// gcpAttrs returns the attributes of the access log entry of r in the
+// shape of a Cloud Logging LogEntry, so that the console shows it as a
+// request and groups it with the other entries of its trace.
+func (l *accessLog) gcpAttrs(r *http.Request, rec *statusRecorder, duration time.Duration, ip string) []any {
+	attrs := []any{
+		"request_id", RequestIDFromContext(r.Context()),
+		slog.Group("httpRequest",
+			"requestMethod", r.Method,
+			"requestUrl", r.URL.RequestURI(),
+			"status", rec.status,
+			"responseSize", strconv.FormatInt(rec.bytes, 10),
+			"userAgent", r.UserAgent(),
+			"remoteIp", ip,
+			"referer", r.Referer(),
+			"latency", strconv.FormatFloat(duration.Seconds(), 'f', 9, 64)+"s",
+			"protocol", r.Proto,
+		),
+	}
+	if cn := ClientCommonName(r); cn != "" {
+		attrs = append(attrs, "client_cn", cn)
+	}
+	traceID, spanID, sampled := requestTrace(r)
+	if traceID == "" || l.project == "" {
+		return attrs
+	}
+	attrs = append(attrs,
+		logTraceKey, "projects/"+l.project+"/traces/"+traceID,
+		logTraceSampledKey, sampled,
+	)
+	if spanID != "" {
+		attrs = append(attrs, logSpanIDKey, spanID)
+	}
+	return attrs
+}
+
+// requestTrace returns the trace r belongs to, from X-Cloud-Trace-Context or
+// else from the span started by withTracing, and the ID of the span as 16 hex
+// digits, if known.
+func requestTrace(r *http.Request) (traceID, spanID string, sampled bool) {
+	if traceID, spanID, sampled, ok := parseCloudTrace(r.Header.Get(cloudTraceHeader)); ok {
+		return traceID, spanID, sampled
+	}
+	sc := trace.SpanContextFromContext(r.Context())
+	if !sc.IsValid() {
+		return "", "", false
+	}
+	return sc.TraceID().String(), sc.SpanID().String(), sc.IsSampled()
+}
+
+func parseCloudTrace(h string) (traceID, spanID string, sampled, ok bool) {
+	h, options, _ := strings.Cut(h, ";")
+	traceID, span, _ := strings.Cut(h, "/")
+	if _, err := trace.TraceIDFromHex(traceID); err != nil {
+		return "", "", false, false
+	}
+	if id, err := strconv.ParseUint(span, 10, 64); err == nil && id != 0 {
+		spanID = fmt.Sprintf("%016x", id)
+	}
+	return traceID, spanID, options == "o=1", true
+}
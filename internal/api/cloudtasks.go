@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
+	"cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	"google.golang.org/api/idtoken"
+)
+
+// CloudTasksQueue is a TaskQueue that creates a Cloud Tasks HTTP task per
+// AnalysisTask, authenticated with an OIDC token of a service account.
+type CloudTasksQueue struct {
+	client         *cloudtasks.Client
+	queue          string
+	handlerURL     string
+	serviceAccount string
+}
+
+// NewCloudTasksQueue returns a queue adding tasks to queue, of the form
+// projects/P/locations/L/queues/Q, that POST to handlerURL, the full URL of
+// /tasks/analyze, as serviceAccount.
+func NewCloudTasksQueue(ctx context.Context, queue, handlerURL, serviceAccount string) (*CloudTasksQueue, error) {
+	client, err := cloudtasks.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudTasksQueue{client: client, queue: queue, handlerURL: handlerURL, serviceAccount: serviceAccount}, nil
+}
+
+func (q *CloudTasksQueue) Enqueue(ctx context.Context, task AnalysisTask) error {
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.CreateTask(ctx, &cloudtaskspb.CreateTaskRequest{
+		Parent: q.queue,
+		Task: &cloudtaskspb.Task{
+			// Naming the task after the job makes retried creations no-ops.
+			Name: q.queue + "/tasks/" + task.JobID,
+			MessageType: &cloudtaskspb.Task_HttpRequest{
+				HttpRequest: &cloudtaskspb.HttpRequest{
+					Url:        q.handlerURL,
+					HttpMethod: cloudtaskspb.HttpMethod_POST,
+					Headers:    map[string]string{"Content-Type": "application/json"},
+					Body:       body,
+					AuthorizationHeader: &cloudtaskspb.HttpRequest_OidcToken{
+						OidcToken: &cloudtaskspb.OidcToken{
+							ServiceAccountEmail: q.serviceAccount,
+							Audience:            q.handlerURL,
+						},
+					},
+				},
+			},
+		},
+	})
+	return err
+}
+
+func (q *CloudTasksQueue) Close() error {
+	return q.client.Close()
+}
+
+// NewCloudTasksVerifier returns an AsyncConfig.Verify accepting requests
+// that carry a Google-signed OIDC token for audience, issued to
+// serviceAccount, as CloudTasksQueue tasks do.
+func NewCloudTasksVerifier(ctx context.Context, audience, serviceAccount string) (func(*http.Request) error, error) {
+	validator, err := idtoken.NewValidator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request) error {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return errors.New("missing bearer token")
+		}
+		payload, err := validator.Validate(r.Context(), token, audience)
+		if err != nil {
+			return err
+		}
+		if email, _ := payload.Claims["email"].(string); email != serviceAccount {
+			return fmt.Errorf("token issued to %q, not the task service account", email)
+		}
+		if verified, _ := payload.Claims["email_verified"].(bool); !verified {
+			return errors.New("token email is not verified")
+		}
+		return nil
+	}, nil
+}
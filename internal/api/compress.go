@@ -0,0 +1,248 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinBytes is the smallest response body worth compressing.
+const gzipMinBytes = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+var errCorruptGzip = errors.New("request body is not valid gzip")
+
+// withDecompression decodes gzip request bodies on the fly, so that handlers
+// and their size limits see the decompressed body. Other content encodings
+// are rejected with 415.
+func withDecompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.ToLower(strings.TrimSpace(strings.Join(r.Header.Values("Content-Encoding"), ","))) {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case "gzip", "x-gzip":
+		default:
+			writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedEncoding,
+				"Content-Encoding must be gzip or identity")
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeDecodeError(w, r, fmt.Errorf("%w: %v", errCorruptGzip, err))
+			return
+		}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		r.Body = &gzipBody{zr: zr, body: r.Body}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gzipBody is a request body decompressed as it is read.
+type gzipBody struct {
+	zr   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	n, err := b.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", errCorruptGzip, err)
+	}
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	b.zr.Close()
+	return b.body.Close()
+}
+
+// withCompression gzips responses for clients that accept it once the body
+// reaches gzipMinBytes. Responses that are already encoded or hold compressed
+// media are sent as they are, and so are streams, which flush before reaching
+// the threshold.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Values("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header values allow gzip.
+func acceptsGzip(values []string) bool {
+	q := 0.0
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "gzip" && coding != "*" {
+				continue
+			}
+			cq := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					cq = f
+				}
+			}
+			// An explicit gzip entry overrides the wildcard.
+			if coding == "gzip" {
+				return cq > 0
+			}
+			q = cq
+		}
+	}
+	return q > 0
+}
+
+// gzipResponseWriter buffers the start of the body until it knows whether
+// compressing it is worthwhile.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+
+	decided bool
+	gz      *gzip.Writer // nil unless compressing
+	buf     bytes.Buffer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+	if status < http.StatusOK {
+		// Informational responses go out right away.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if !w.decided {
+		if !w.compressible() {
+			w.passThrough()
+		} else {
+			w.buf.Write(p)
+			if w.buf.Len() < gzipMinBytes {
+				return len(p), nil
+			}
+			w.startGzip()
+			_, err := w.gz.Write(w.buf.Bytes())
+			w.buf.Reset()
+			return len(p), err
+		}
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far. A response flushed before it was
+// worth compressing is a stream and is sent uncompressed.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.passThrough()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// hijacking and deadlines.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressible reports whether the response, as described by its status and
+// headers so far, may be compressed.
+func (w *gzipResponseWriter) compressible() bool {
+	switch w.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mt, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	mt = strings.TrimSpace(mt)
+	switch {
+	case mt == "text/event-stream",
+		strings.HasPrefix(mt, "image/") && mt != "image/svg+xml",
+		strings.HasPrefix(mt, "audio/"),
+		strings.HasPrefix(mt, "video/"),
+		mt == "application/gzip", mt == "application/zip", mt == "application/octet-stream":
+		return false
+	}
+	return true
+}
+
+// passThrough sends the status and whatever is buffered uncompressed and
+// writes the rest of the response straight through.
+func (w *gzipResponseWriter) passThrough() {
+	w.decided = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *gzipResponseWriter) startGzip() {
+	w.decided = true
+	h := w.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+// close finishes the response: a body that stayed below the threshold is
+// sent uncompressed, a compressed one gets its gzip trailer.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			// Nothing was written, e.g. after a hijack.
+			return
+		}
+		w.passThrough()
+		return
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
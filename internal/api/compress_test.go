@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipped returns data compressed with gzip.
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompression(t *testing.T) {
+	cfg := testConfig()
+	h := newTestServer(t, cfg).Handler()
+
+	valid := gzipped(t, `{"text": "I love this"}`)
+	// A bomb fits the limit compressed, but is 16 MiB of text once
+	// decompressed.
+	bomb := gzipped(t, `{"text": "`+strings.Repeat("a", 16<<20)+`"}`)
+	if int64(len(bomb)) >= cfg.MaxBodyBytes {
+		t.Fatalf("the bomb is %d bytes compressed, over the limit of %d", len(bomb), cfg.MaxBodyBytes)
+	}
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+		wantCode   string
+	}{
+		{"gzip", "gzip", valid, http.StatusOK, ""},
+		{"x-gzip", "x-gzip", valid, http.StatusOK, ""},
+		{"identity", "identity", []byte(`{"text": "I love this"}`), http.StatusOK, ""},
+		{"not gzip", "gzip", []byte(`{"text": "I love this"}`), http.StatusBadRequest, codeInvalidRequest},
+		{"truncated", "gzip", valid[:len(valid)-12], http.StatusBadRequest, codeInvalidRequest},
+		{"corrupt checksum", "gzip", append(bytes.Clone(valid[:len(valid)-8]), 0, 0, 0, 0, 0, 0, 0, 0), http.StatusBadRequest, codeInvalidRequest},
+		{"bomb", "gzip", bomb, http.StatusRequestEntityTooLarge, codeBodyTooLarge},
+		{"unsupported", "br", valid, http.StatusUnsupportedMediaType, codeUnsupportedEncoding},
+		{"several encodings", "gzip, gzip", valid, http.StatusUnsupportedMediaType, codeUnsupportedEncoding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/analyze", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Content-Encoding", tt.encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, w); code != tt.wantCode {
+					t.Errorf("code = %q, want %q", code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"gzip"}, true},
+		{[]string{"deflate, GZIP"}, true},
+		{[]string{"br", "gzip;q=0.5"}, true},
+		{[]string{"*"}, true},
+		{[]string{"gzip;q=0"}, false},
+		// An explicit gzip entry overrides the wildcard.
+		{[]string{"*, gzip;q=0"}, false},
+		{[]string{"gzip;q=0, *"}, false},
+		{[]string{"*;q=0"}, false},
+		{[]string{"identity, br"}, false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.values); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %t, want %t", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+	send := func(method, target, body, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(requestIDHeader, "compression-test")
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	var items []string
+	for range 50 {
+		items = append(items, `{"text": "I love it. This is awful. The sky is blue."}`)
+	}
+	batch := `{"items": [` + strings.Join(items, ", ") + `]}`
+	plain := send(http.MethodPost, "/v1/analyze/batch", batch, "")
+	if plain.Code != http.StatusOK || plain.Body.Len() < gzipMinBytes {
+		t.Fatalf("batch: status %d, %d bytes, want 200 and at least %d", plain.Code, plain.Body.Len(), gzipMinBytes)
+	}
+	if ce := plain.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("batch without Accept-Encoding: Content-Encoding = %q, want none", ce)
+	}
+
+	w := send(http.MethodPost, "/v1/analyze/batch", batch, "gzip, deflate")
+	if ce := w.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("batch: Content-Encoding = %q, want gzip", ce)
+	}
+	if vary := w.Header().Values("Vary"); !strings.Contains(strings.Join(vary, ","), "Accept-Encoding") {
+		t.Errorf("batch: Vary = %q, want Accept-Encoding", vary)
+	}
+	if w.Body.Len() >= plain.Body.Len() {
+		t.Errorf("batch: %d bytes compressed, want fewer than %d", w.Body.Len(), plain.Body.Len())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if !bytes.Equal(body, plain.Body.Bytes()) {
+		t.Errorf("batch: decompressed body %s, want %s", body, plain.Body)
+	}
+
+	w = send(http.MethodGet, "/v1/healthcheck", "", "gzip")
+	if w.Code != http.StatusOK || w.Body.Len() >= gzipMinBytes {
+		t.Fatalf("healthcheck: status %d, %d bytes, want a small 200", w.Code, w.Body.Len())
+	}
+	if ce := w.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("healthcheck: Content-Encoding = %q, want none", ce)
+	}
+	if vary := w.Header().Values("Vary"); !strings.Contains(strings.Join(vary, ","), "Accept-Encoding") {
+		t.Errorf("healthcheck: Vary = %q, want Accept-Encoding", vary)
+	}
+}
+
+// TestCompressionSkipped checks the large responses that are sent as they
+// are although the client accepts gzip.
+func TestCompressionSkipped(t *testing.T) {
+	large := strings.Repeat("data ", gzipMinBytes)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"event stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(large))
+		}},
+		{"flushed early", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ndjsonMediaType)
+			w.Write([]byte("{}\n"))
+			http.NewResponseController(w).Flush()
+			w.Write([]byte(large))
+		}},
+		{"already encoded", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte(large))
+		}},
+		{"compressed media", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(large))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			withCompression(tt.handler).ServeHTTP(w, r)
+
+			if ce := w.Header().Get("Content-Encoding"); ce == "gzip" {
+				t.Error("Content-Encoding = gzip, want the response sent as is")
+			}
+			if !strings.HasSuffix(w.Body.String(), large) {
+				t.Errorf("body of %d bytes, want the one written", w.Body.Len())
+			}
+		})
+	}
+}
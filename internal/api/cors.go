@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSMaxAge is how long browsers may cache a preflight response unless
+// CORSConfig.MaxAge says otherwise.
+const DefaultCORSMaxAge = 10 * time.Minute
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	defaultCORSHeaders = []string{"Content-Type", apiKeyHeader, requestIDHeader}
+)
+
+// CORSConfig controls which browser origins may call the API. With no allowed
+// origins CORS is disabled and no CORS headers are ever written. Any origin is
+// allowed only when AllowedOrigins is exactly ["*"].
+type CORSConfig struct {
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders default to the methods and headers
+	// the API uses.
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+type corsPolicy struct {
+	allowAll bool
+	origins  map[string]bool
+	methods  string
+	headers  string
+	maxAge   time.Duration
+}
+
+func newCORSPolicy(cfg CORSConfig) (corsPolicy, error) {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	maxAge := cfg.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultCORSMaxAge
+	}
+
+	c := corsPolicy{
+		origins: make(map[string]bool),
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(headers, ", "),
+		maxAge:  maxAge,
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if len(cfg.AllowedOrigins) > 1 {
+				return corsPolicy{}, errors.New(`CORS: "*" cannot be combined with other allowed origins`)
+			}
+			c.allowAll = true
+			continue
+		}
+		c.origins[origin] = true
+	}
+	return c, nil
+}
+
+func (c corsPolicy) allowed(origin string) bool {
+	return c.allowAll || c.origins[origin]
+}
+
+// handle adds CORS headers to responses for allowed origins and answers
+// preflight requests itself. Requests from other origins are served without
+// CORS headers, leaving it to the browser to block them.
+func (c corsPolicy) handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin != "" && c.allowed(origin) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if c.allowAll {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", c.methods)
+				h.Set("Access-Control-Allow-Headers", c.headers)
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.maxAge.Seconds())))
+			} else {
+				h.Set("Access-Control-Expose-Headers", requestIDHeader)
+			}
+		}
+
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCSVColumn is the column analyzed when ?column is not given.
+const defaultCSVColumn = "text"
+
+// csvResultColumns are appended to every row of the returned CSV.
+var csvResultColumns = []string{"sentiment", "sentiment_score", "magnitude", "error"}
+
+type csvRow struct {
+	record []string
+	err    error
+	result []string
+}
+
+// analyzeCSVHandler analyzes one column of an uploaded CSV, sent either as
+// the text/csv body or as the "file" part of a multipart form, and streams
+// the CSV back with csvResultColumns appended. Rows are analyzed with at
+// most s.batchWorkers calls in flight but written in input order. A row that
+// cannot be parsed or analyzed is written with only the error column set
+// instead of failing the whole file.
+func (s *Server) analyzeCSVHandler(w http.ResponseWriter, r *http.Request) {
+	column := r.URL.Query().Get("column")
+	if column == "" {
+		column = defaultCSVColumn
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	defer r.Body.Close()
+
+	body, filename, err := csvBody(r)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if body == nil {
+		writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia,
+			"Content-Type must be text/csv or multipart/form-data")
+		return
+	}
+
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, errCorruptGzip):
+		writeDecodeError(w, r, err)
+		return
+	case errors.Is(err, io.EOF):
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "the CSV is empty")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid CSV header: "+err.Error())
+		return
+	}
+	col := -1
+	for i, name := range header {
+		if strings.TrimSpace(name) == column {
+			col = i
+			break
+		}
+	}
+	if col < 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("the CSV has no %q column", column))
+		return
+	}
+
+	ctx := r.Context()
+	rows := s.analyzeCSVRows(ctx, cr, col, len(header))
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+csvResultFilename(filename)+`"`)
+	cw := csv.NewWriter(w)
+	cw.Write(append(header, csvResultColumns...))
+
+	rc := http.NewResponseController(w)
+	for row := range rows {
+		record := row.record
+		for len(record) < len(header) {
+			record = append(record, "")
+		}
+		cw.Write(append(record, row.result...))
+		// Flush whenever no result is ready yet, so that the client sees
+		// progress without a flush per row.
+		if len(rows) == 0 {
+			cw.Flush()
+			rc.Flush()
+		}
+	}
+	if ctx.Err() != nil {
+		// The client went away; the remaining rows were dropped.
+		return
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		s.log.Warn("failed to write CSV response",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+	}
+}
+
+// analyzeCSVRows reads the remaining records from cr and returns them in
+// order, with the result of the analysis of column col, on the returned
+// channel. The rows queued in the worker pool bound memory use regardless of
+// file size. Rows are expected to have width fields, like the header.
+func (s *Server) analyzeCSVRows(ctx context.Context, cr *csv.Reader, col, width int) <-chan *csvRow {
+	rows := make(chan *csvRow)
+	go func() {
+		defer close(rows)
+		for {
+			record, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			row := &csvRow{record: record, err: err}
+			if !send(ctx, rows, row) {
+				return
+			}
+			var parseErr *csv.ParseError
+			if err != nil && !errors.As(err, &parseErr) {
+				// The body can't be read any further.
+				return
+			}
+		}
+	}()
+	return mapOrdered(ctx, s.batchWorkers, rows, func(ctx context.Context, row *csvRow) *csvRow {
+		row.result = s.analyzeCSVRow(ctx, row, col, width)
+		return row
+	})
+}
+
+func (s *Server) analyzeCSVRow(ctx context.Context, row *csvRow, col, width int) []string {
+	if row.err != nil {
+		return csvError(row.err)
+	}
+	if len(row.record) != width {
+		return csvError(fmt.Errorf("the row has %d fields, the header has %d", len(row.record), width))
+	}
+
+	text := row.record[col]
+	if err := s.validateText(text); err != nil {
+		return csvError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	resp, _, err := s.analyzeCached(ctx, SentimentRequest{Text: &text})
+	if err != nil {
+		s.log.Error("failed to analyze CSV row",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+		return csvError(err)
+	}
+	return []string{
+		resp.Sentiment,
+		strconv.FormatFloat(resp.SentimentScore, 'f', -1, 64),
+		strconv.FormatFloat(resp.Magnitude, 'f', -1, 64),
+		"",
+	}
+}
+
+func csvError(err error) []string {
+	return []string{"", "", "", err.Error()}
+}
+
+// csvBody returns the CSV sent in r and the uploaded file name, if any. It
+// returns a nil reader when r carries neither a text/csv body nor a
+// multipart form with a "file" part.
+func csvBody(r *http.Request) (io.Reader, string, error) {
+	switch mediaType(r) {
+	case "text/csv", "application/csv":
+		return r.Body, "", nil
+	case "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", err
+		}
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, "", errors.New(`the form must contain a "file" part`)
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if part.FormName() == fileFormField {
+				return part, part.FileName(), nil
+			}
+			part.Close()
+		}
+	default:
+		return nil, "", nil
+	}
+}
+
+// csvResultFilename derives the name of the downloaded CSV from the name of
+// the uploaded one.
+func csvResultFilename(uploaded string) string {
+	name := strings.TrimSuffix(uploaded, ".csv")
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "sentiment"
+	}
+	return name + "-sentiment.csv"
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postCSV sends body to /v1/analyze/csv with contentType.
+func postCSV(h http.Handler, target, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// readCSV parses the CSV of w.
+func readCSV(t *testing.T, w *httptest.ResponseRecorder) [][]string {
+	t.Helper()
+	cr := csv.NewReader(bytes.NewReader(w.Body.Bytes()))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		t.Fatalf("parse the CSV %q: %v", w.Body, err)
+	}
+	return records
+}
+
+func TestAnalyzeCSV(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	body := "id,review,stars\r\n" +
+		"1,I love it,5\r\n" +
+		// Quoted, with a comma, quotes and a newline.
+		"2,\"Awful, \"\"truly\"\" awful.\nNever again\",1\r\n" +
+		"3,\"\",3\r\n" +
+		"4,too,many,fields\r\n" +
+		"5,The sky is blue,3\r\n"
+	w := postCSV(h, "/v1/analyze/csv?column=review", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/csv", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="sentiment-sentiment.csv"` {
+		t.Errorf("Content-Disposition = %q, want an attachment", cd)
+	}
+
+	records := readCSV(t, w)
+	want := [][]string{
+		{"id", "review", "stars", "sentiment", "sentiment_score", "magnitude", "error"},
+		{"1", "I love it", "5", "positive", "1", "1", ""},
+		// The fields come back as they were sent.
+		{"2", "Awful, \"truly\" awful.\nNever again", "1", "negative", "0.5", "2", ""},
+		{"3", "", "3", "", "", "", "*"},
+		{"4", "too", "many", "fields", "", "", "", "*"},
+		{"5", "The sky is blue", "3", "neutral", "0", "0", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("%d records, want %d:\n%s", len(records), len(want), w.Body)
+	}
+	for i, record := range records {
+		if len(record) != len(want[i]) {
+			t.Errorf("record %d = %q, want %q", i, record, want[i])
+			continue
+		}
+		for j := range record {
+			// * is any error message.
+			if want[i][j] == "*" && record[j] != "" {
+				continue
+			}
+			if record[j] != want[i][j] {
+				t.Errorf("record %d = %q, want %q", i, record, want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestAnalyzeCSVMalformedRow(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	// A bare quote in an unquoted field does not stop the rows after it.
+	w := postCSV(h, "/v1/analyze/csv", "text/csv", "text\nI love it\nbad \"quote\nThis is awful\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	records := readCSV(t, w)
+	if len(records) != 4 {
+		t.Fatalf("records %q, want the header and 3 rows", records)
+	}
+	if records[1][1] != "positive" || records[3][1] != "negative" {
+		t.Errorf("records %q, want the rows around the malformed one analyzed", records)
+	}
+	if last := records[2][len(records[2])-1]; !strings.Contains(last, "quote") {
+		t.Errorf("malformed row %q, want a parse error in the error column", records[2])
+	}
+}
+
+func TestAnalyzeCSVOrder(t *testing.T) {
+	cfg := testConfig()
+	cfg.BatchConcurrency = 8
+	h := newTestServer(t, cfg).Handler()
+
+	var b strings.Builder
+	b.WriteString("n,text\n")
+	const rows = 200
+	for i := range rows {
+		text := "I love it"
+		if i%3 == 0 {
+			text = "This is awful"
+		}
+		fmt.Fprintf(&b, "%d,%s\n", i, text)
+	}
+	records := readCSV(t, postCSV(h, "/v1/analyze/csv", "text/csv", b.String()))
+	if len(records) != rows+1 {
+		t.Fatalf("%d records, want %d", len(records), rows+1)
+	}
+	for i, record := range records[1:] {
+		want := "positive"
+		if i%3 == 0 {
+			want = "negative"
+		}
+		if record[0] != fmt.Sprint(i) || record[2] != want {
+			t.Fatalf("record %d = %q, want row %d, %s", i+1, record, i, want)
+		}
+	}
+}
+
+func TestAnalyzeCSVUpload(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("note", "ignored")
+	fw, err := mw.CreateFormFile(fileFormField, `reviews "q1".csv`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("text\nI love it\n"))
+	mw.Close()
+
+	w := postCSV(h, "/v1/analyze/csv", mw.FormDataContentType(), body.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="reviews _q1_-sentiment.csv"` {
+		t.Errorf("Content-Disposition = %q, want the uploaded name, sanitized", cd)
+	}
+	if records := readCSV(t, w); len(records) != 2 || records[1][1] != "positive" {
+		t.Errorf("records %q, want the row analyzed", records)
+	}
+}
+
+func TestAnalyzeCSVErrors(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("other", "text\nhi\n")
+	mw.Close()
+
+	tests := []struct {
+		name, target, contentType, body string
+		wantStatus                      int
+		wantCode                        string
+	}{
+		{"empty", "/v1/analyze/csv", "text/csv", "", http.StatusBadRequest, codeInvalidRequest},
+		{"no such column", "/v1/analyze/csv?column=review", "text/csv", "text\nhi\n", http.StatusBadRequest, codeInvalidRequest},
+		{"invalid header", "/v1/analyze/csv", "text/csv", "te\"xt\nhi\n", http.StatusBadRequest, codeInvalidRequest},
+		{"form without file", "/v1/analyze/csv", mw.FormDataContentType(), form.String(), http.StatusBadRequest, codeInvalidRequest},
+		{"JSON", "/v1/analyze/csv", "application/json", `{"text": "hi"}`, http.StatusUnsupportedMediaType, codeUnsupportedMedia},
+	}
+	for _, tt := range tests {
+		w := postCSV(h, tt.target, tt.contentType, tt.body)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d; body %s", tt.name, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		if code := errorCode(t, w); code != tt.wantCode {
+			t.Errorf("%s: code = %q, want %q", tt.name, code, tt.wantCode)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	errInvalidUTF8  = errors.New("body is not valid UTF-8 text")
+	errTrailingData = errors.New("unexpected data after the JSON value")
+)
+
+// decodeJSON decodes the JSON request body into v, reading at most
+// s.maxBodyBytes bytes. Unless s.lenientJSON, the body is decoded with
+// unmarshalStrict.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	return s.decodeJSONBody(w, r, v, !s.lenientJSON)
+}
+
+func (s *Server) decodeJSONBody(w http.ResponseWriter, r *http.Request, v any, strict bool) error {
+	_, span := tracer.Start(r.Context(), "decode.json")
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	defer r.Body.Close()
+
+	var err error
+	if strict {
+		var body []byte
+		if body, err = io.ReadAll(r.Body); err == nil {
+			err = unmarshalStrict(body, v)
+		}
+	} else {
+		err = json.NewDecoder(r.Body).Decode(v)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// unmarshalJSON decodes data into v, with unmarshalStrict unless
+// s.lenientJSON.
+func (s *Server) unmarshalJSON(data []byte, v any) error {
+	if s.lenientJSON {
+		return json.Unmarshal(data, v)
+	}
+	return unmarshalStrict(data, v)
+}
+
+// unmarshalStrict is json.Unmarshal rejecting the fields v does not have,
+// fields repeated within an object and anything but whitespace after the
+// value, so that misspelled fields are reported rather than ignored.
+func unmarshalStrict(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	value := data[:d.InputOffset()]
+	if len(bytes.TrimSpace(data[len(value):])) > 0 {
+		return errTrailingData
+	}
+	if key, ok := repeatedKey(value, reflect.TypeOf(v)); ok {
+		return fmt.Errorf("json: field %q is repeated", key)
+	}
+	return nil
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// repeatedKey returns the first key found twice in the same object of the
+// JSON value data, which must be valid and decode into a value of type t.
+// The keys of objects decoded into structs are compared ignoring case, as
+// encoding/json matches them to fields, so that "text" and "Text" are
+// repeats; those of maps and of values t leaves untyped must match exactly.
+func repeatedKey(data []byte, t reflect.Type) (string, bool) {
+	key, _ := repeatedKeyIn(json.NewDecoder(bytes.NewReader(data)), t)
+	return key, key != ""
+}
+
+// repeatedKeyIn reads the next value of d, of type t or nil if untyped, and
+// returns the first key repeated in it.
+func repeatedKeyIn(d *json.Decoder, t reflect.Type) (string, error) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && reflect.PointerTo(t).Implements(unmarshalerType) {
+		t = nil
+	}
+	tok, err := d.Token()
+	if err != nil {
+		return "", err
+	}
+	switch tok {
+	case json.Delim('{'):
+		isStruct := t != nil && t.Kind() == reflect.Struct
+		var keys []string
+		for d.More() {
+			tok, err := d.Token()
+			if err != nil {
+				return "", err
+			}
+			key := tok.(string)
+			for _, k := range keys {
+				if k == key || isStruct && strings.EqualFold(k, key) {
+					return key, nil
+				}
+			}
+			keys = append(keys, key)
+
+			var elem reflect.Type
+			switch {
+			case isStruct:
+				elem = fieldType(t, key)
+			case t != nil && t.Kind() == reflect.Map:
+				elem = t.Elem()
+			}
+			if key, err := repeatedKeyIn(d, elem); key != "" || err != nil {
+				return key, err
+			}
+		}
+	case json.Delim('['):
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for d.More() {
+			if key, err := repeatedKeyIn(d, elem); key != "" || err != nil {
+				return key, err
+			}
+		}
+	default:
+		return "", nil
+	}
+	_, err = d.Token() // the closing delimiter
+	return "", err
+}
+
+// fieldType returns the type of the field of the struct type t that
+// encoding/json decodes key into, or nil if there is none.
+func fieldType(t reflect.Type, key string) reflect.Type {
+	var folded reflect.Type
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous && f.Type.Kind() == reflect.Struct {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		if name == key {
+			return f.Type
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = f.Type
+		}
+	}
+	return folded
+}
+
+// readText reads the request body as UTF-8 text, reading at most
+// s.maxBodyBytes bytes.
+func (s *Server) readText(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(body) {
+		return "", errInvalidUTF8
+	}
+	return string(body), nil
+}
+
+// mediaType returns the media type of the request body without parameters
+// such as charset, or "" when Content-Type is missing or malformed.
+func mediaType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pad returns body followed by spaces up to n bytes.
+func pad(body string, n int) string {
+	return body + strings.Repeat(" ", n-len(body))
+}
+
+func TestBodyLimit(t *testing.T) {
+	const limit = 256
+	cfg := testConfig()
+	cfg.MaxBodyBytes = limit
+	h := newTestServer(t, cfg).Handler()
+
+	tests := []struct {
+		name, target, contentType, body string
+	}{
+		{"analyze", "/v1/analyze", "application/json", `{"text": "I love this"}`},
+		{"analyze text", "/v1/analyze", "text/plain", "I love this"},
+		{"batch", "/v1/analyze/batch", "application/json", `{"texts": ["I love this", "I hate this"]}`},
+		{"aggregate", "/v1/analyze/aggregate", "application/json", `{"texts": ["I love this", "I hate this"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send := func(body string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(body))
+				r.Header.Set("Content-Type", tt.contentType)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				return w
+			}
+
+			if w := send(pad(tt.body, limit)); w.Code != http.StatusOK {
+				t.Errorf("body of %d bytes: status = %d, want 200: %s", limit, w.Code, w.Body)
+			}
+
+			w := send(pad(tt.body, limit+1))
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("body of %d bytes: status = %d, want 413", limit+1, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", ct)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body.String(), err)
+			}
+			if resp.Error.Code != codeBodyTooLarge || resp.Error.Message == "" || resp.Error.RequestID == "" {
+				t.Errorf("error = %+v, want %q with a message and a request ID", resp.Error, codeBodyTooLarge)
+			}
+		})
+	}
+}
+
+// TestBodyLimitChunked checks the limit of a body sent without
+// Content-Length, which is only known to be too large once read.
+func TestBodyLimitChunked(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBodyBytes = 256
+	ts := httptest.NewServer(newTestServer(t, cfg).Handler())
+	defer ts.Close()
+
+	// A reader that is not a *strings.Reader hides the length of the body.
+	body := io.MultiReader(strings.NewReader(pad(`{"text": "I love this"}`, 4<<10)))
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/analyze", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ContentLength != 0 {
+		t.Fatalf("request with Content-Length %d, want it chunked", req.ContentLength)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", resp.StatusCode)
+	}
+	var e ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Error.Code != codeBodyTooLarge {
+		t.Errorf("code = %q, want %q", e.Error.Code, codeBodyTooLarge)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	strict := newTestServer(t, testConfig()).Handler()
+	cfg := testConfig()
+	cfg.LenientJSON = true
+	lenient := newTestServer(t, cfg).Handler()
+
+	tests := []struct {
+		name, target, body string
+		// wantStrict is the status in strict mode, and wantField the
+		// field its error names; the lenient mode accepts every body.
+		wantStrict int
+		wantField  string
+	}{
+		{"valid", "/v1/analyze", `{"text": "I love this", "language": "en"}`, http.StatusOK, ""},
+		{"field of another case", "/v1/analyze", `{"Text": "I love this"}`, http.StatusOK, ""},
+		{"trailing whitespace", "/v1/analyze", "{\"text\": \"I love this\"}\n\t ", http.StatusOK, ""},
+		{"misspelled field", "/v1/analyze", `{"text": "I love this", "langauge": "en"}`, http.StatusBadRequest, "langauge"},
+		{"extra field", "/v1/analyze", `{"text": "I love this", "lang": "pl"}`, http.StatusBadRequest, "lang"},
+		{"repeated field", "/v1/analyze", `{"text": "I love this", "text": "I hate this"}`, http.StatusBadRequest, "text"},
+		{"repeated field of another case", "/v1/analyze", `{"text": "I love this", "Text": "I hate this"}`, http.StatusBadRequest, "Text"},
+		{"repeated field in an item", "/v1/analyze/batch", `{"items": [{"id": "a", "text": "good", "ID": "b"}]}`, http.StatusBadRequest, "ID"},
+		{"repeated ID", "/v1/analyze/batch", `{"items": {"a": "good", "a": "bad"}}`, http.StatusBadRequest, "a"},
+		// IDs are map keys, which differ by case.
+		{"IDs of another case", "/v1/analyze/batch", `{"items": {"a": "good", "A": "bad"}}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(strict, http.MethodPost, tt.target, tt.body)
+			if w.Code != tt.wantStrict {
+				t.Fatalf("strict: status = %d, want %d; body %s", w.Code, tt.wantStrict, w.Body)
+			}
+			if tt.wantField != "" {
+				var resp ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decode %q: %v", w.Body.String(), err)
+				}
+				if resp.Error.Code != codeInvalidRequest || !strings.Contains(resp.Error.Message, `"`+tt.wantField+`"`) {
+					t.Errorf("strict: error %+v, want %s naming %q", resp.Error, codeInvalidRequest, tt.wantField)
+				}
+			}
+			if w := serve(lenient, http.MethodPost, tt.target, tt.body); w.Code != http.StatusOK {
+				t.Errorf("lenient: status = %d, want 200; body %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	w := serve(strict, http.MethodPost, "/v1/analyze", `{"text": "I love this"} {"text": "I hate this"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), errTrailingData.Error()) {
+		t.Errorf("trailing data: status %d, body %s, want 400 about the trailing data", w.Code, w.Body)
+	}
+}
+
+func TestRepeatedKey(t *testing.T) {
+	type item struct {
+		Name  string            `json:"name"`
+		Tags  map[string]string `json:"tags"`
+		Extra json.RawMessage   `json:"extra"`
+		Items []item            `json:"items"`
+	}
+	tests := []struct {
+		data, want string
+	}{
+		{`{"name": "a", "tags": {"k": "v", "K": "v"}}`, ""},
+		{`{"name": "a", "NAME": "b"}`, "NAME"},
+		{`{"tags": {"k": "v", "k": "w"}}`, "k"},
+		{`{"extra": {"x": 1, "X": 2}}`, ""},
+		{`{"extra": {"x": 1, "x": 2}}`, "x"},
+		{`{"items": [{"name": "a"}, {"name": "b", "Name": "c"}]}`, "Name"},
+		{`{"items": [{"tags": {"k": "v"}}, {"tags": {"k": "v", "K": "w"}}]}`, ""},
+	}
+	for _, tt := range tests {
+		got, _ := repeatedKey([]byte(tt.data), reflect.TypeFor[*item]())
+		if got != tt.want {
+			t.Errorf("repeatedKey(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// endpoint is a route of the API together with its documentation. The same
+// table registers the handlers and builds the /docs spec.
+type endpoint struct {
+	path    string
+	handler http.Handler
+	// protected endpoints require an API key and are rate limited.
+	protected bool
+	// unmetered protected endpoints are not counted against quotas.
+	unmetered bool
+	// admin endpoints require an admin API key or the admin credentials.
+	admin bool
+	// negotiated endpoints respond in the type chosen by withNegotiation.
+	negotiated bool
+	// idempotent endpoints honor Idempotency-Key on POST.
+	idempotent bool
+	// dryRun endpoints honor dry_run; the other protected endpoints reject
+	// it.
+	dryRun bool
+	ops    []operation
+}
+
+type operation struct {
+	method      string
+	summary     string
+	description string
+	consumes    []string
+	produces    []string
+	params      []param
+	// body, when non-nil, is a value of the JSON request body type.
+	body      any
+	responses []response
+	// models are values of further types mentioned in the description, such
+	// as streamed lines or WebSocket frames, to be listed in definitions.
+	models []any
+}
+
+type param struct {
+	name        string
+	in          string
+	typ         string
+	description string
+	required    bool
+	enum        []string
+	def         any
+	maxLength   int
+}
+
+type response struct {
+	status      int
+	description string
+	// body, when non-nil, is a value of the JSON response body type.
+	body    any
+	file    bool
+	headers []responseHeader
+}
+
+type responseHeader struct {
+	name        string
+	description string
+}
+
+func errorResponse(status int, description string) response {
+	return response{status: status, description: description, body: ErrorResponse{}}
+}
+
+// Responses shared by several operations. The responses of the middleware of
+// protected and negotiated endpoints are documented automatically.
+var (
+	badRequest          = errorResponse(http.StatusBadRequest, "Bad Request")
+	methodNotAllowed    = response{status: http.StatusMethodNotAllowed, description: "Method Not Allowed", body: ErrorResponse{}, headers: []responseHeader{{"Allow", "The methods of the path"}}}
+	textTooLarge        = errorResponse(http.StatusRequestEntityTooLarge, "Text or request body exceeds the configured size limit")
+	bodyTooLarge        = errorResponse(http.StatusRequestEntityTooLarge, "Request body exceeds the configured size limit")
+	upstreamFailed      = errorResponse(http.StatusInternalServerError, "Language API error")
+	upstreamUnavailable = errorResponse(http.StatusServiceUnavailable, "Language API unavailable: the circuit breaker is open or too many calls are in flight; see the Retry-After header")
+	upstreamTimeout     = errorResponse(http.StatusGatewayTimeout, "Language API timeout")
+
+	unauthorized        = errorResponse(http.StatusUnauthorized, "Missing or invalid API key, ID token or request signature")
+	accountForbidden    = errorResponse(http.StatusForbidden, "The service account of the ID token or the client address is not allowed")
+	rateLimited         = errorResponse(http.StatusTooManyRequests, "Rate limit exceeded, or the daily quota of the API key is exhausted; see the Retry-After header")
+	notAcceptable       = errorResponse(http.StatusNotAcceptable, "Accept allows neither application/json nor application/xml")
+	idempotencyConflict = errorResponse(http.StatusConflict, "Idempotency-Key was already used with a different request body")
+	adminUnauthorized   = response{status: http.StatusUnauthorized, description: "Missing or invalid admin API key or credentials", body: ErrorResponse{}, headers: []responseHeader{{"WWW-Authenticate", "The Basic challenge, when admin credentials are configured"}}}
+	adminDisabled       = errorResponse(http.StatusNotFound, "No admin API keys or credentials are configured")
+	addressForbidden    = errorResponse(http.StatusForbidden, "The client address is not allowed")
+
+	debugForbidden = errorResponse(http.StatusForbidden, "debug was requested but is not enabled for this client")
+
+	cacheHeader = responseHeader{"X-Cache", "HIT when served from the result cache, MISS otherwise; absent when caching is disabled"}
+
+	quotaHeaders = []responseHeader{
+		{quotaRemainingHeader, "Requests left in the daily quota of the API key; absent without a request quota"},
+		{quotaRemainingCharsHeader, "Characters left in the daily quota of the API key; absent without a character quota"},
+	}
+
+	idempotencyKeyParam = param{name: idempotencyKeyHeader, in: "header", typ: "string", maxLength: maxIdempotencyKeyLength, description: "Repeating a request with the same key and body returns the stored response, with Idempotent-Replay: true, instead of analyzing the text again"}
+	includeMetaParam    = param{name: "include_meta", in: "query", typ: "boolean", description: "Add the meta object with the input size and processing times"}
+	dryRunParams        = []param{
+		{name: "dry_run", in: "query", typ: "boolean", description: "Validate the request, authentication and rate limits without analyzing the text: the response has the usual shape with dry_run true and zero scores, and is not counted against quotas"},
+		{name: dryRunHeader, in: "header", typ: "boolean", description: "Same as dry_run"},
+	}
+	debugParam = param{name: "debug", in: "query", typ: "boolean", description: "Attach the raw Language API response as raw and bypass the cache; requires DEBUG_RESPONSES or a key in DEBUG_API_KEYS"}
+)
+
+// lazyDoc is a document rendered on first use.
+type lazyDoc struct {
+	once sync.Once
+	body []byte
+	err  error
+}
+
+// writeDoc writes doc, rendering it first if needed.
+func (s *Server) writeDoc(w http.ResponseWriter, r *http.Request, doc *lazyDoc, contentType string, render func() ([]byte, error)) {
+	doc.once.Do(func() { doc.body, doc.err = render() })
+	if doc.err != nil {
+		s.log.Error("failed to build the API docs",
+			"request_id", RequestIDFromContext(r.Context()), "error", doc.err.Error())
+		writeError(w, r, http.StatusInternalServerError, codeInternalError, "failed to build the API docs")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc.body)
+}
+
+// docsHandler serves the Swagger 2.0 description of s.endpoints.
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeDoc(w, r, &s.swaggerDoc, "application/json", func() ([]byte, error) {
+		return json.MarshalIndent(swaggerSpec(s.endpoints()), "", "\t")
+	})
+}
+
+// swaggerSpec builds a Swagger 2.0 document describing endpoints. Request and
+// response schemas are derived from the Go types of the bodies.
+func swaggerSpec(endpoints []endpoint) map[string]any {
+	b := newSchemaBuilder("#/definitions/")
+	paths := make(map[string]any)
+	for _, ep := range endpoints {
+		item := make(map[string]any)
+		for _, op := range ep.ops {
+			item[strings.ToLower(op.method)] = b.operation(op, ep)
+		}
+		paths[ep.path] = item
+	}
+
+	return map[string]any{
+		"swagger":             "2.0",
+		"info":                apiInfo(),
+		"basePath":            "/",
+		"securityDefinitions": map[string]any{"ApiKeyAuth": apiKeyScheme(), "BasicAuth": basicAuthScheme(false), "IDTokenAuth": idTokenScheme(false), "SignatureAuth": signatureScheme()},
+		"paths":               paths,
+		"definitions":         b.definitions,
+	}
+}
+
+// apiInfo and apiKeyScheme are shared by the Swagger 2.0 and OpenAPI 3
+// documents.
+func apiInfo() map[string]any {
+	return map[string]any{
+		"title":       "Sentiment Analysis API",
+		"description": "A simple API to analyze the sentiment of a text. The /v1 endpoints are also served without the prefix; those paths are deprecated. Request bodies may be sent gzip-compressed with Content-Encoding: gzip.",
+		"version":     "1.0.0",
+	}
+}
+
+func apiKeyScheme() map[string]any {
+	return map[string]any{
+		"type":        "apiKey",
+		"in":          "header",
+		"name":        apiKeyHeader,
+		"description": "Required only when the server is configured with API keys",
+	}
+}
+
+// basicAuthScheme describes the admin credentials in the Swagger 2.0 or,
+// with openAPI, the OpenAPI 3 syntax.
+func basicAuthScheme(openAPI bool) map[string]any {
+	out := map[string]any{
+		"type":        "basic",
+		"description": "The admin credentials, accepted by the admin endpoints only when configured",
+	}
+	if openAPI {
+		out["type"], out["scheme"] = "http", "basic"
+	}
+	return out
+}
+
+// idTokenScheme describes the ID tokens of service accounts like
+// basicAuthScheme. Swagger 2.0 has no bearer scheme, so it is described as
+// the Authorization header.
+func idTokenScheme(openAPI bool) map[string]any {
+	if openAPI {
+		return map[string]any{
+			"type":         "http",
+			"scheme":       "bearer",
+			"bearerFormat": "JWT",
+			"description":  idTokenSchemeDescription,
+		}
+	}
+	return map[string]any{
+		"type":        "apiKey",
+		"in":          "header",
+		"name":        "Authorization",
+		"description": "Bearer and " + idTokenSchemeDescription,
+	}
+}
+
+const idTokenSchemeDescription = "a Google-signed ID token of an allowed service account; accepted only when the server is configured for them"
+
+func signatureScheme() map[string]any {
+	return map[string]any{
+		"type":        "apiKey",
+		"in":          "header",
+		"name":        requestSignatureHeader,
+		"description": "sha256=<hex> of the HMAC-SHA256, under a signing secret, of the method, the path, the query parameters sorted by key and URL-encoded, the " + requestTimestampHeader + " header and the request body before any Content-Encoding, each but the body followed by a newline; the timestamp is a Unix time in seconds and must be within SIGNATURE_MAX_SKEW of the server's clock, and each signature is accepted once. Accepted only when the server is configured with signing secrets",
+	}
+}
+
+// security returns the security requirements of ep, each of the schemes it
+// accepts being enough.
+func (ep endpoint) security() []any {
+	out := []any{map[string]any{"ApiKeyAuth": []string{}}}
+	if ep.admin {
+		out = append(out, map[string]any{"BasicAuth": []string{}})
+	} else {
+		out = append(out, map[string]any{"IDTokenAuth": []string{}}, map[string]any{"SignatureAuth": []string{}})
+	}
+	return out
+}
+
+// allResponses returns the responses of op, including those added by the
+// middleware of ep.
+func (op operation) allResponses(ep endpoint) []response {
+	out := op.responses[:len(op.responses):len(op.responses)]
+	if ep.protected && !ep.unmetered {
+		out = slices.Clone(out)
+		for i, res := range out {
+			out[i].headers = append(res.headers[:len(res.headers):len(res.headers)], quotaHeaders...)
+		}
+	}
+	if ep.protected {
+		out = append(out, unauthorized, rateLimited)
+		if !slices.ContainsFunc(out, func(r response) bool { return r.status == http.StatusForbidden }) {
+			out = append(out, accountForbidden)
+		}
+	}
+	if ep.admin {
+		out = append(out, adminUnauthorized, addressForbidden, adminDisabled)
+	}
+	if ep.negotiated {
+		out = append(out, notAcceptable)
+	}
+	if ep.idempotent && op.method == http.MethodPost {
+		out = append(out, idempotencyConflict)
+	}
+	return out
+}
+
+// allParams returns the parameters of op, including those read by the
+// middleware of ep.
+func (op operation) allParams(ep endpoint) []param {
+	out := op.params[:len(op.params):len(op.params)]
+	if ep.idempotent && op.method == http.MethodPost {
+		out = append(out, idempotencyKeyParam)
+	}
+	if ep.dryRun {
+		out = append(out, dryRunParams...)
+	}
+	return out
+}
+
+// responseTypes returns the media types op responds with.
+func (op operation) responseTypes(ep endpoint) []string {
+	if ep.negotiated {
+		return negotiatedTypes
+	}
+	return op.produces
+}
+
+func (b *schemaBuilder) operation(op operation, ep endpoint) map[string]any {
+	out := map[string]any{"summary": op.summary}
+	if op.description != "" {
+		out["description"] = op.description
+	}
+	if len(op.consumes) > 0 {
+		out["consumes"] = op.consumes
+	}
+	if produces := op.responseTypes(ep); len(produces) > 0 {
+		out["produces"] = produces
+	}
+
+	params := make([]any, 0, len(op.params)+2)
+	for _, p := range op.allParams(ep) {
+		params = append(params, p.swagger())
+	}
+	if op.body != nil {
+		params = append(params, map[string]any{
+			"name":   "body",
+			"in":     "body",
+			"schema": b.schemaOf(op.body),
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if ep.protected || ep.admin {
+		out["security"] = ep.security()
+	}
+	responses := op.allResponses(ep)
+	rs := make(map[string]any, len(responses))
+	for _, r := range responses {
+		rs[strconv.Itoa(r.status)] = b.response(r)
+	}
+	out["responses"] = rs
+
+	for _, m := range op.models {
+		b.schemaOf(m)
+	}
+	return out
+}
+
+func (b *schemaBuilder) response(r response) map[string]any {
+	out := map[string]any{"description": r.description}
+	switch {
+	case r.file:
+		out["schema"] = map[string]any{"type": "file"}
+	case r.body != nil:
+		out["schema"] = b.schemaOf(r.body)
+	}
+	if len(r.headers) > 0 {
+		hs := make(map[string]any, len(r.headers))
+		for _, h := range r.headers {
+			hs[h.name] = map[string]any{"type": "string", "description": h.description}
+		}
+		out["headers"] = hs
+	}
+	return out
+}
+
+func (p param) swagger() map[string]any {
+	out := map[string]any{"name": p.name, "in": p.in, "type": p.typ}
+	if p.description != "" {
+		out["description"] = p.description
+	}
+	if p.required {
+		out["required"] = true
+	}
+	if len(p.enum) > 0 {
+		out["enum"] = p.enum
+	}
+	if p.def != nil {
+		out["default"] = p.def
+	}
+	if p.maxLength > 0 {
+		out["maxLength"] = p.maxLength
+	}
+	return out
+}
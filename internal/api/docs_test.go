@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-openapi/loads"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+)
+
+// TestDocsValidSwagger validates the document served at /docs against the
+// Swagger 2.0 schema, and checks that it describes every registered
+// endpoint and method.
+func TestDocsValidSwagger(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	w := serve(s.Handler(), http.MethodGet, "/docs", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	doc, err := loads.Analyzed(json.RawMessage(w.Body.Bytes()), "2.0")
+	if err != nil {
+		t.Fatalf("load document: %v", err)
+	}
+	if err := validate.Spec(doc, strfmt.Default); err != nil {
+		t.Fatalf("invalid Swagger 2.0 document: %v", err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	for _, ep := range s.endpoints() {
+		item, ok := spec.Paths[ep.path]
+		if !ok {
+			t.Errorf("%s is not documented", ep.path)
+			continue
+		}
+		for _, op := range ep.ops {
+			if _, ok := item[strings.ToLower(op.method)]; !ok {
+				t.Errorf("%s %s is not documented", op.method, ep.path)
+			}
+		}
+	}
+	if got, want := len(spec.Paths), len(s.endpoints()); got != want {
+		t.Errorf("%d documented paths, want %d, one per endpoint", got, want)
+	}
+}
+
+// TestDocsValidOpenAPI validates the document served at /docs/openapi.json,
+// as JSON and as YAML, against the OpenAPI 3.0 schema, and checks that it
+// describes the same endpoints and methods as /docs.
+func TestDocsValidOpenAPI(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	h := s.Handler()
+
+	for _, tt := range []struct{ target, contentType string }{
+		{"/docs/openapi.json", "application/json"},
+		{"/docs/openapi.json?format=json", "application/json"},
+		{"/docs/openapi.json?format=yaml", "application/yaml"},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serve(h, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.contentType)
+			}
+
+			doc, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+			if err != nil {
+				t.Fatalf("load document: %v", err)
+			}
+			if err := doc.Validate(context.Background()); err != nil {
+				t.Fatalf("invalid OpenAPI 3.0 document: %v", err)
+			}
+			if !strings.HasPrefix(doc.OpenAPI, "3.0.") {
+				t.Errorf("openapi = %q, want 3.0", doc.OpenAPI)
+			}
+
+			for _, ep := range s.endpoints() {
+				item := doc.Paths.Find(ep.path)
+				if item == nil {
+					t.Errorf("%s is not documented", ep.path)
+					continue
+				}
+				for _, op := range ep.ops {
+					if item.GetOperation(op.method) == nil {
+						t.Errorf("%s %s is not documented", op.method, ep.path)
+					}
+				}
+			}
+			if got, want := doc.Paths.Len(), len(s.endpoints()); got != want {
+				t.Errorf("%d documented paths, want %d, one per endpoint", got, want)
+			}
+			// The error envelope and the auth schemes are components.
+			if doc.Components.Schemas["ErrorResponse"] == nil {
+				t.Errorf("schemas %v, want ErrorResponse", slices.Sorted(maps.Keys(doc.Components.Schemas)))
+			}
+			if doc.Components.SecuritySchemes["ApiKeyAuth"] == nil {
+				t.Error("no ApiKeyAuth security scheme")
+			}
+		})
+	}
+
+	w := serve(h, http.MethodGet, "/docs/openapi.json?format=xml", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("format=xml: status = %d, want 400", w.Code)
+	} else if code := errorCode(t, w); code != codeInvalidRequest {
+		t.Errorf("format=xml: code = %q, want %q", code, codeInvalidRequest)
+	}
+}
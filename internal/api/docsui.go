@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// swaggerUIFiles holds the Swagger UI 4.15.5 distribution files the page
+// needs, along with index.html and swagger-initializer.js which configure it
+// to load /docs.
+//
+//go:embed swaggerui
+var swaggerUIFiles embed.FS
+
+const swaggerUIPath = "/docs/ui/"
+
+// swaggerUIETags maps each file of the UI to an ETag derived from its content.
+var swaggerUIETags = sync.OnceValue(func() map[string]string {
+	tags := make(map[string]string)
+	fs.WalkDir(swaggerUIFiles, "swaggerui", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := swaggerUIFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		h := fnv.New64a()
+		h.Write(b)
+		tags[strings.TrimPrefix(name, "swaggerui/")] = fmt.Sprintf(`"%x"`, h.Sum64())
+		return nil
+	})
+	return tags
+})
+
+// docsUIRedirectHandler redirects /docs/ui to /docs/ui/. The Location is
+// relative so that it also works when the service is mounted behind a path
+// prefix.
+func docsUIRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", "ui/")
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// docsUIHandler serves the Swagger UI. The page and its initializer are
+// revalidated on every load; the Swagger UI assets may be cached for a day.
+func docsUIHandler(w http.ResponseWriter, r *http.Request) {
+	_, name, _ := strings.Cut(r.URL.Path, swaggerUIPath)
+	if name == "" {
+		name = "index.html"
+	}
+	etag, ok := swaggerUIETags()[name]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, codeNotFound, r.URL.Path+" not found")
+		return
+	}
+	b, err := swaggerUIFiles.ReadFile(path.Join("swaggerui", name))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, r.URL.Path+" not found")
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", mime.TypeByExtension(path.Ext(name)))
+	h.Set("ETag", etag)
+	switch name {
+	case "index.html", "swagger-initializer.js":
+		h.Set("Cache-Control", "no-cache")
+	default:
+		h.Set("Cache-Control", "public, max-age=86400")
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const dryRunHeader = "X-Dry-Run"
+
+type dryRunKey struct{}
+
+// isDryRun reports whether the request of ctx asked for a dry run.
+func isDryRun(ctx context.Context) bool {
+	dry, _ := ctx.Value(dryRunKey{}).(bool)
+	return dry
+}
+
+// withDryRun reads ?dry_run=true or X-Dry-Run: true. A dry run goes through
+// validation, authentication and rate limiting like any request, but its
+// texts are answered by dryRunResponse instead of being analyzed, and it is
+// not counted against quotas. Endpoints that cannot be dry run reject it
+// rather than call the Language API. It wraps the middleware of protect, so
+// that they see the flag.
+func (s *Server) withDryRun(supported bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("dry_run")
+		name := "dry_run"
+		if v == "" {
+			v, name = r.Header.Get(dryRunHeader), dryRunHeader
+		}
+		if v == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		dry, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, name+" must be true or false, got "+strconv.Quote(v))
+			return
+		}
+		if !dry {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !supported {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "dry runs are not supported on "+r.URL.Path)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dryRunKey{}, true)))
+	})
+}
+
+// dryRunResponse is the stand-in result of req in a dry run: a neutral text
+// with zero scores, with every field req asks for, so that it has the shape
+// of a real response.
+func (s *Server) dryRunResponse(ctx context.Context, req SentimentRequest) SentimentResponse {
+	resp := SentimentResponse{
+		Language:         req.Language,
+		LanguageDetected: req.Language == "",
+		DryRun:           true,
+	}
+	s.label(ctx, &resp, req.Granularity)
+	if req.IncludeSentences {
+		resp.Sentences = []SentenceSentiment{}
+	}
+	return resp
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAnalyzeDryRunShape(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	tests := []struct {
+		name    string
+		body    string
+		present []string
+		absent  []string
+	}{
+		{"plain", `{"text": "great"}`, []string{"sentiment", "score", "dry_run"}, []string{"sentences", "entities"}},
+		{"sentences", `{"text": "great", "include_sentences": true}`, []string{"sentences"}, []string{"entities"}},
+		{"entities", `{"text": "great", "include_entities": true}`, []string{"entities"}, []string{"sentences", "warning"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, http.MethodPost, "/analyze?dry_run=true", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			for _, name := range tt.present {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("%s is missing from %s", name, w.Body)
+				}
+			}
+			for _, name := range tt.absent {
+				if _, ok := fields[name]; ok {
+					t.Errorf("%s is present in %s", name, w.Body)
+				}
+			}
+			for _, name := range []string{"sentences", "entities"} {
+				if v, ok := fields[name]; ok && string(v) != "[]" {
+					t.Errorf("%s = %s, want an empty array", name, v)
+				}
+			}
+			if string(fields["dry_run"]) != "true" {
+				t.Errorf("dry_run = %s, want true", fields["dry_run"])
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+type EntitiesRequest struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+	// Encoding is the unit of the offsets of the response: "utf8" (the
+	// default) for bytes, "utf16" for UTF-16 code units or "utf32" for code
+	// points.
+	Encoding string `json:"encoding,omitempty" enum:"utf8,utf16,utf32" default:"utf8" doc:"Unit of every begin_offset of the response: utf8 counts bytes, utf16 UTF-16 code units, as JavaScript strings do, and utf32 code points"`
+}
+
+type EntitiesResponse struct {
+	Entities []EntitySentiment `json:"entities"`
+}
+
+type EntitySentiment struct {
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Salience  float32         `json:"salience"`
+	Score     float32         `json:"score"`
+	Magnitude float32         `json:"magnitude"`
+	Mentions  []EntityMention `json:"mentions"`
+}
+
+// maxSalientEntities is the number of entities attached to a
+// SentimentResponse with include_entities.
+const maxSalientEntities = 5
+
+type SalientEntity struct {
+	Name     string  `json:"name" xml:"name"`
+	Type     string  `json:"type" xml:"type"`
+	Salience float32 `json:"salience" xml:"salience" doc:"Importance of the entity to the text, from 0 to 1"`
+}
+
+// entitiesResult is the outcome of salientEntities.
+type entitiesResult struct {
+	entities []SalientEntity
+	err      error
+}
+
+// EntityMention is a single occurrence of an entity in the text. BeginOffset
+// is in the unit of the encoding of the request, by default a byte offset
+// into the UTF-8 encoded input.
+type EntityMention struct {
+	Text        string  `json:"text"`
+	Type        string  `json:"type"`
+	BeginOffset int32   `json:"begin_offset"`
+	Score       float32 `json:"score"`
+	Magnitude   float32 `json:"magnitude"`
+}
+
+func (s *Server) analyzeEntitiesHandler(w http.ResponseWriter, r *http.Request) {
+	var req EntitiesRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if err := s.validateText(req.Text); err != nil {
+		writeTextError(w, r, err)
+		return
+	}
+
+	lang, err := normalizeLanguage(req.Language)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	req.Language = lang
+	if _, err := encodingType(req.Encoding); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, err := s.analyzeEntities(ctx, req)
+	if err != nil {
+		s.writeUpstreamError(w, r, err, "analyze entity sentiment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) analyzeEntities(ctx context.Context, req EntitiesRequest) (EntitiesResponse, error) {
+	encoding, err := encodingType(req.Encoding)
+	if err != nil {
+		return EntitiesResponse{}, err
+	}
+	s.countAnalyzed(ctx, req.Text)
+	resp, err := s.lang.AnalyzeEntitySentiment(ctx, &languagepb.AnalyzeEntitySentimentRequest{
+		Document: &languagepb.Document{
+			Source: &languagepb.Document_Content{
+				Content: req.Text,
+			},
+			Type:     languagepb.Document_PLAIN_TEXT,
+			Language: req.Language,
+		},
+		EncodingType: encoding,
+	})
+	if err != nil {
+		return EntitiesResponse{}, err
+	}
+
+	out := EntitiesResponse{
+		Entities: make([]EntitySentiment, 0, len(resp.Entities)),
+	}
+	for _, entity := range resp.Entities {
+		mentions := make([]EntityMention, 0, len(entity.Mentions))
+		for _, mention := range entity.Mentions {
+			mentions = append(mentions, EntityMention{
+				Text:        mention.GetText().GetContent(),
+				Type:        mention.GetType().String(),
+				BeginOffset: mention.GetText().GetBeginOffset(),
+				Score:       mention.GetSentiment().GetScore(),
+				Magnitude:   mention.GetSentiment().GetMagnitude(),
+			})
+		}
+
+		out.Entities = append(out.Entities, EntitySentiment{
+			Name:      entity.GetName(),
+			Type:      entity.GetType().String(),
+			Salience:  entity.GetSalience(),
+			Score:     entity.GetSentiment().GetScore(),
+			Magnitude: entity.GetSentiment().GetMagnitude(),
+			Mentions:  mentions,
+		})
+	}
+
+	return out, nil
+}
+
+// encodingType maps the encoding field to a languagepb.EncodingType.
+func encodingType(name string) (languagepb.EncodingType, error) {
+	switch name {
+	case "", "utf8":
+		return languagepb.EncodingType_UTF8, nil
+	case "utf16":
+		return languagepb.EncodingType_UTF16, nil
+	case "utf32":
+		return languagepb.EncodingType_UTF32, nil
+	default:
+		return 0, fmt.Errorf("unsupported encoding %q: must be utf8, utf16 or utf32", name)
+	}
+}
+
+// salientEntities returns the most salient entities of the text of req. The
+// text is not counted again, being analyzed for its sentiment as well.
+func (s *Server) salientEntities(ctx context.Context, req SentimentRequest) ([]SalientEntity, error) {
+	docType := languagepb.Document_PLAIN_TEXT
+	if req.DocumentType == "html" {
+		docType = languagepb.Document_HTML
+	}
+	resp, err := s.lang.AnalyzeEntities(ctx, &languagepb.AnalyzeEntitiesRequest{
+		Document: &languagepb.Document{
+			Source: &languagepb.Document_Content{
+				Content: *req.Text,
+			},
+			Type:     docType,
+			Language: req.Language,
+		},
+		EncodingType: languagepb.EncodingType_UTF8,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entities := slices.Clone(resp.GetEntities())
+	slices.SortStableFunc(entities, func(a, b *languagepb.Entity) int {
+		return cmp.Compare(b.GetSalience(), a.GetSalience())
+	})
+	out := make([]SalientEntity, 0, min(len(entities), maxSalientEntities))
+	for _, entity := range entities[:min(len(entities), maxSalientEntities)] {
+		out = append(out, SalientEntity{
+			Name:     entity.GetName(),
+			Type:     entity.GetType().String(),
+			Salience: entity.GetSalience(),
+		})
+	}
+	return out, nil
+}
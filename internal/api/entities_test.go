@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+// offsetLanguage is a Language API taking each word of a text for a token
+// and a mention of an entity, at the offset the Language API would give in
+// the requested encoding.
+type offsetLanguage struct {
+	stubLanguage
+}
+
+// words returns the words of text with their offsets in the unit of
+// encoding.
+func (offsetLanguage) words(text string, encoding languagepb.EncodingType) []*languagepb.TextSpan {
+	var spans []*languagepb.TextSpan
+	var offset int32
+	for i, word := range strings.Split(text, " ") {
+		if i > 0 {
+			offset++
+		}
+		spans = append(spans, &languagepb.TextSpan{Content: word, BeginOffset: offset})
+		switch encoding {
+		case languagepb.EncodingType_UTF8:
+			offset += int32(len(word))
+		case languagepb.EncodingType_UTF16:
+			offset += int32(len(utf16.Encode([]rune(word))))
+		case languagepb.EncodingType_UTF32:
+			offset += int32(utf8.RuneCountInString(word))
+		default:
+			// NONE: the Language API leaves the offsets out.
+			return nil
+		}
+	}
+	return spans
+}
+
+func (l offsetLanguage) AnalyzeEntitySentiment(_ context.Context, req *languagepb.AnalyzeEntitySentimentRequest) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	var resp languagepb.AnalyzeEntitySentimentResponse
+	for _, span := range l.words(req.GetDocument().GetContent(), req.GetEncodingType()) {
+		resp.Entities = append(resp.Entities, &languagepb.Entity{
+			Name:     span.Content,
+			Mentions: []*languagepb.EntityMention{{Text: span}},
+		})
+	}
+	return &resp, nil
+}
+
+func (l offsetLanguage) AnalyzeSyntax(_ context.Context, req *languagepb.AnalyzeSyntaxRequest) (*languagepb.AnalyzeSyntaxResponse, error) {
+	var resp languagepb.AnalyzeSyntaxResponse
+	for _, span := range l.words(req.GetDocument().GetContent(), req.GetEncodingType()) {
+		resp.Tokens = append(resp.Tokens, &languagepb.Token{Text: span})
+	}
+	return &resp, nil
+}
+
+func TestEncoding(t *testing.T) {
+	s, err := NewServer(testConfig(), sentiment.Fake{}, offsetLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	// The emoji is 4 bytes, 2 UTF-16 code units and 1 code point; each
+	// Polish letter with a diacritic 2 bytes and 1 code unit or point.
+	const text = "😀 Zażółć gęślą"
+	tests := []struct {
+		encoding string
+		want     []int32
+	}{
+		{"", []int32{0, 5, 16}},
+		{"utf8", []int32{0, 5, 16}},
+		{"utf16", []int32{0, 3, 10}},
+		{"utf32", []int32{0, 2, 9}},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(EntitiesRequest{Text: text, Encoding: tt.encoding})
+
+		w := serve(h, http.MethodPost, "/v1/analyze/entities", string(body))
+		if w.Code != http.StatusOK {
+			t.Fatalf("entities, encoding %q: status = %d, want 200; body %s", tt.encoding, w.Code, w.Body)
+		}
+		var entities EntitiesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &entities); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		var got []int32
+		for _, e := range entities.Entities {
+			for _, m := range e.Mentions {
+				got = append(got, m.BeginOffset)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("entities, encoding %q: offsets %v, want %v", tt.encoding, got, tt.want)
+		}
+
+		w = serve(h, http.MethodPost, "/v1/analyze/syntax", string(body))
+		if w.Code != http.StatusOK {
+			t.Fatalf("syntax, encoding %q: status = %d, want 200; body %s", tt.encoding, w.Code, w.Body)
+		}
+		var syntax SyntaxResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &syntax); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		got = got[:0]
+		for _, token := range syntax.Tokens {
+			got = append(got, token.BeginOffset)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("syntax, encoding %q: offsets %v, want %v", tt.encoding, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"/v1/analyze/entities", "/v1/analyze/syntax"} {
+		w := serve(h, http.MethodPost, path, `{"text": "I love it", "encoding": "utf-16"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s with encoding utf-16: status = %d, want 400", path, w.Code)
+			continue
+		}
+		if code := errorCode(t, w); code != codeInvalidRequest {
+			t.Errorf("%s with encoding utf-16: code = %q, want %q", path, code, codeInvalidRequest)
+		}
+	}
+}
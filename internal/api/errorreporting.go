@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// errorReportQueueSize bounds the events waiting to be sent; further
+	// events are dropped.
+	errorReportQueueSize = 100
+	// Events beyond errorReportRate per second, after a burst of
+	// errorReportBurst, are dropped, so that an outage does not turn into
+	// a flood of identical reports.
+	errorReportRate  = 1
+	errorReportBurst = 10
+	// errorReportTimeout bounds a single ErrorReporter.Report.
+	errorReportTimeout = 10 * time.Second
+)
+
+// ErrorEvent is a failed request as reported to an ErrorReporter.
+type ErrorEvent struct {
+	Time time.Time
+	// Message is the error followed by the stack trace of the goroutine
+	// that failed, in the format of runtime/debug.Stack.
+	Message   string
+	RequestID string
+	Method    string
+	URL       string
+	Status    int
+	UserAgent string
+	RemoteIP  string
+}
+
+// ErrorReporter sends failed requests to an error tracker.
+// CloudErrorReporter implements it.
+type ErrorReporter interface {
+	Report(ctx context.Context, ev ErrorEvent) error
+}
+
+// errorReporter sends the events of failed requests in the background, at a
+// bounded rate. A nil *errorReporter reports nothing.
+type errorReporter struct {
+	reporter ErrorReporter
+	log      Logger
+	metrics  *Metrics
+	limiter  *rate.Limiter
+	trusted  int
+	events   chan ErrorEvent
+	done     chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// SetErrorReporter reports every request that fails with a 5xx status other
+// than 503, or that panics, to reporter. It must be called before serving
+// requests.
+func (s *Server) SetErrorReporter(reporter ErrorReporter) {
+	e := &errorReporter{
+		reporter: reporter,
+		log:      s.log,
+		metrics:  s.metrics,
+		limiter:  rate.NewLimiter(errorReportRate, errorReportBurst),
+		trusted:  s.trustedHops,
+		events:   make(chan ErrorEvent, errorReportQueueSize),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	s.reporter = e
+}
+
+func (e *errorReporter) run() {
+	defer close(e.done)
+	for ev := range e.events {
+		ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+		err := e.reporter.Report(ctx, ev)
+		cancel()
+		if err != nil {
+			e.metrics.observeErrorReport("error")
+			e.log.Warn("failed to report an error",
+				"request_id", ev.RequestID, "error", err.Error())
+			continue
+		}
+		e.metrics.observeErrorReport("ok")
+	}
+}
+
+type failureKey struct{}
+
+// failure is the first error a request failed with, recorded for the
+// errorReporter.
+type failure struct {
+	mu      sync.Mutex
+	message string
+}
+
+// noteFailure records message, with the request ID and followed by the stack
+// of the caller of the function named skip, as the error the request of ctx
+// failed with, unless one was recorded already.
+func noteFailure(ctx context.Context, message, skip string) {
+	f, ok := ctx.Value(failureKey{}).(*failure)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.message == "" {
+		f.message = fmt.Sprintf("%s [request_id %s]\n%s", message, RequestIDFromContext(ctx), chopStack(debug.Stack(), skip))
+	}
+}
+
+// chopStack removes from stack, as returned by runtime/debug.Stack, the
+// frames up to and including the last one of the function fn, named with or
+// without its package, so that the report points at the code that failed
+// rather than at the reporting code.
+func chopStack(stack []byte, fn string) []byte {
+	lines := bytes.SplitAfter(stack, []byte("\n"))
+	cut := -1
+	// lines[0] is the goroutine header; each frame is a function line
+	// followed by a file line.
+	for i := 1; i+1 < len(lines); i += 2 {
+		name := lines[i]
+		if j := bytes.LastIndexByte(name, '('); j >= 0 {
+			name = name[:j]
+		}
+		if string(name) == fn || bytes.HasSuffix(name, []byte("."+fn)) {
+			cut = i + 2
+		}
+	}
+	if cut < 0 {
+		return stack
+	}
+	return bytes.Join(append(lines[:1:1], lines[cut:]...), nil)
+}
+
+// report wraps next so that a request that noted a failure is queued for
+// reporting, without blocking, once it is served.
+func (e *errorReporter) report(next http.Handler) http.Handler {
+	if e == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := &failure{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), failureKey{}, f)))
+
+		f.mu.Lock()
+		message := f.message
+		f.mu.Unlock()
+		if message == "" {
+			return
+		}
+		e.enqueue(ErrorEvent{
+			Time:      time.Now(),
+			Message:   message,
+			RequestID: RequestIDFromContext(r.Context()),
+			Method:    r.Method,
+			URL:       r.URL.RequestURI(),
+			Status:    rec.status,
+			UserAgent: r.UserAgent(),
+			RemoteIP:  clientIP(r, e.trusted),
+		})
+	})
+}
+
+func (e *errorReporter) enqueue(ev ErrorEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped || !e.limiter.Allow() {
+		e.metrics.observeErrorReport("dropped")
+		return
+	}
+	select {
+	case e.events <- ev:
+	default:
+		e.metrics.observeErrorReport("dropped")
+	}
+}
+
+// close stops accepting events and waits until the queued ones are sent or
+// ctx is done.
+func (e *errorReporter) close(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.stopped {
+		e.stopped = true
+		close(e.events)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeReporter is an ErrorReporter keeping the events it is given. It blocks
+// until release is closed when release is set.
+type fakeReporter struct {
+	release chan struct{}
+
+	mu     sync.Mutex
+	events []ErrorEvent
+}
+
+func (f *fakeReporter) Report(_ context.Context, ev ErrorEvent) error {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, ev)
+	return nil
+}
+
+func (f *fakeReporter) reported() []ErrorEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ErrorEvent(nil), f.events...)
+}
+
+// newReportingServer returns a test server reporting to reporter. Its
+// analyzer panics on "panic", times out on "slow", is overloaded on "busy"
+// and fails on "fail".
+func newReportingServer(t *testing.T, reporter ErrorReporter) *Server {
+	t.Helper()
+	analyzer := analyzerFunc(func(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+		switch doc.Text {
+		case "panic":
+			panic("analyzer exploded")
+		case "slow":
+			return sentiment.Result{}, status.Error(codes.DeadlineExceeded, "deadline exceeded")
+		case "busy":
+			return sentiment.Result{}, &sentiment.OverloadedError{RetryAfter: time.Second}
+		case "fail":
+			return sentiment.Result{}, status.Error(codes.Internal, "backend error")
+		}
+		return sentiment.Fake{}.Analyze(ctx, doc)
+	})
+	s, err := NewServer(testConfig(), analyzer, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	s.SetErrorReporter(reporter)
+	return s
+}
+
+func TestErrorReporting(t *testing.T) {
+	reporter := &fakeReporter{}
+	s := newReportingServer(t, reporter)
+	h := s.Handler()
+
+	tests := []struct {
+		text       string
+		wantStatus int
+		reported   bool
+	}{
+		{"I love it", http.StatusOK, false},
+		{"", http.StatusBadRequest, false},
+		{"busy", http.StatusServiceUnavailable, false},
+		{"fail", http.StatusInternalServerError, true},
+		{"slow", http.StatusGatewayTimeout, true},
+		{"panic", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(`{"text": "`+tt.text+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(requestIDHeader, "req-"+tt.text)
+		r.Header.Set("User-Agent", "reporting-test")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q: status = %d, want %d", tt.text, w.Code, tt.wantStatus)
+		}
+	}
+	// Close waits for the queued events to be sent.
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	byID := make(map[string]ErrorEvent)
+	for _, ev := range reporter.reported() {
+		if _, ok := byID[ev.RequestID]; ok {
+			t.Errorf("request %s reported more than once", ev.RequestID)
+		}
+		byID[ev.RequestID] = ev
+	}
+	for _, tt := range tests {
+		ev, ok := byID["req-"+tt.text]
+		if ok != tt.reported {
+			t.Errorf("%q: reported %t, want %t", tt.text, ok, tt.reported)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if ev.Status != tt.wantStatus || ev.Method != http.MethodPost || ev.URL != "/v1/analyze" || ev.UserAgent != "reporting-test" || ev.RemoteIP == "" {
+			t.Errorf("%q: event %+v, want the request", tt.text, ev)
+		}
+		if !strings.Contains(ev.Message, "[request_id req-"+tt.text+"]\n") {
+			t.Errorf("%q: message %q, want the request ID", tt.text, ev.Message)
+		}
+		if strings.Contains(ev.Message, "noteFailure") {
+			t.Errorf("%q: message %q, want the stack cut at the code that failed", tt.text, ev.Message)
+		}
+	}
+	// The stack of a panic starts where it was raised.
+	if ev := byID["req-panic"]; !strings.Contains(ev.Message, "panic: analyzer exploded") || !strings.Contains(ev.Message, "newReportingServer") {
+		t.Errorf("panic reported as %q, want the panic and the stack of the analyzer", ev.Message)
+	}
+}
+
+// TestErrorReportingRate checks that a reporter that does not answer holds
+// up no request, and that the events beyond the burst are dropped.
+func TestErrorReportingRate(t *testing.T) {
+	reporter := &fakeReporter{release: make(chan struct{})}
+	s := newReportingServer(t, reporter)
+	h := s.Handler()
+	const requests = 3 * errorReportBurst
+	for range requests {
+		start := time.Now()
+		if w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "fail"}`); w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", w.Code)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("request took %v with the reporter blocked", d)
+		}
+	}
+	close(reporter.release)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The limiter may have allowed one more event meanwhile.
+	n := len(reporter.reported())
+	if n < errorReportBurst || n > errorReportBurst+1 {
+		t.Errorf("%d events reported, want %d or one more", n, errorReportBurst)
+	}
+	body := serve(h, http.MethodGet, "/metrics", "").Body.String()
+	for _, want := range []string{
+		`sentiment_api_error_reports_total{result="ok"} ` + strconv.Itoa(n),
+		`sentiment_api_error_reports_total{result="dropped"} ` + strconv.Itoa(requests-n),
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("the metrics lack the series\n\t%s", want)
+		}
+	}
+}
+
+func TestChopStack(t *testing.T) {
+	stack := "goroutine 1 [running]:\n" +
+		"runtime/debug.Stack()\n\t/go/src/runtime/debug/stack.go:26 +0x5e\n" +
+		"example.com/api.noteFailure(...)\n\t/src/api/errorreporting.go:118 +0x1\n" +
+		"example.com/api.writeError(...)\n\t/src/api/errors.go:56 +0x2\n" +
+		"example.com/api.(*Server).analyzeHandler(0xc0001)\n\t/src/api/analyze.go:40 +0x3\n"
+	want := "goroutine 1 [running]:\n" +
+		"example.com/api.(*Server).analyzeHandler(0xc0001)\n\t/src/api/analyze.go:40 +0x3\n"
+	if got := string(chopStack([]byte(stack), "writeError")); got != want {
+		t.Errorf("chopStack at writeError =\n%s\nwant\n%s", got, want)
+	}
+	if got := string(chopStack([]byte(stack), "missing")); got != stack {
+		t.Errorf("chopStack at a missing function =\n%s\nwant the stack unchanged", got)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes carried in ErrorDetail.Code.
+const (
+	codeInvalidRequest      = "invalid_request"
+	codeMissingText         = "missing_text"
+	codeEmptyText           = "empty_text"
+	codeTextTooLarge        = "text_too_large"
+	codeBodyTooLarge        = "body_too_large"
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeUnsupportedMedia    = "unsupported_media_type"
+	codeUnsupportedEncoding = "unsupported_encoding"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeRateLimited         = "rate_limited"
+	codeQuotaExhausted      = "quota_exhausted"
+	codeTextTooShort        = "text_too_short"
+	codeUpstreamTimeout     = "upstream_timeout"
+	codeUpstreamError       = "upstream_error"
+	codeUnavailable         = "unavailable"
+	codeURLNotAllowed       = "url_not_allowed"
+	codeFetchFailed         = "fetch_failed"
+	codeInvalidFeed         = "invalid_feed"
+	codeBinaryFile          = "binary_file"
+	codeNotFound            = "not_found"
+	codeNotAcceptable       = "not_acceptable"
+	codeIdempotencyConflict = "idempotency_conflict"
+	codeInternalError       = "internal_error"
+)
+
+type ErrorResponse struct {
+	XMLName xml.Name    `json:"-" xml:"error_response"`
+	Error   ErrorDetail `json:"error" xml:"error"`
+}
+
+type ErrorDetail struct {
+	Code      string `json:"code" xml:"code"`
+	Message   string `json:"message" xml:"message"`
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty"`
+}
+
+// writeError writes an ErrorResponse with the given status, in the
+// negotiated response type.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if status >= 500 && status != http.StatusServiceUnavailable {
+		noteFailure(r.Context(), message, "writeError")
+	}
+	writeResponse(w, r, status, ErrorResponse{
+		Error: ErrorDetail{
+			Code:      code,
+			Message:   message,
+			RequestID: RequestIDFromContext(r.Context()),
+		},
+	})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
+
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+			fmt.Sprintf("request body exceeds the limit of %d bytes", maxBytesErr.Limit))
+		return
+	}
+	if errors.Is(err, errInvalidUTF8) || errors.Is(err, errCorruptGzip) {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
+}
+
+// setRetryAfter tells the client to wait delay, rounded up to whole seconds,
+// before retrying.
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+}
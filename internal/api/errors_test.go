@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// failingAnalyzer fails every analysis with err.
+type failingAnalyzer struct{ err error }
+
+func (a failingAnalyzer) Analyze(context.Context, sentiment.Document) (sentiment.Result, error) {
+	return sentiment.Result{}, a.err
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   func(*Config)
+		analyzer sentiment.Analyzer
+		method   string
+		target   string
+		body     string
+		header   http.Header
+		// before is the number of identical requests sent first.
+		before     int
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "malformed JSON", method: http.MethodPost, target: "/v1/analyze", body: `{"text": `, wantStatus: http.StatusBadRequest, wantCode: codeInvalidRequest},
+		{name: "missing text", method: http.MethodPost, target: "/v1/analyze", body: `{}`, wantStatus: http.StatusBadRequest, wantCode: codeMissingText},
+		{name: "empty text", method: http.MethodPost, target: "/v1/analyze", body: `{"text": "  "}`, wantStatus: http.StatusBadRequest, wantCode: codeEmptyText},
+		{name: "text too large", method: http.MethodPost, target: "/v1/analyze", body: `{"text": "` + strings.Repeat("a ", 600) + `"}`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: codeTextTooLarge},
+		{name: "body too large", config: func(c *Config) { c.MaxBodyBytes = 16 }, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "a long enough text"}`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: codeBodyTooLarge},
+		{name: "method not allowed", method: http.MethodDelete, target: "/v1/analyze", wantStatus: http.StatusMethodNotAllowed, wantCode: codeMethodNotAllowed},
+		{name: "unsupported media type", method: http.MethodPost, target: "/v1/analyze", body: "text", header: http.Header{"Content-Type": {"image/png"}}, wantStatus: http.StatusUnsupportedMediaType, wantCode: codeUnsupportedMedia},
+		{name: "unsupported encoding", method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, header: http.Header{"Content-Encoding": {"compress"}}, wantStatus: http.StatusUnsupportedMediaType, wantCode: codeUnsupportedEncoding},
+		{name: "not found", method: http.MethodGet, target: "/v1/nothing", wantStatus: http.StatusNotFound, wantCode: codeNotFound},
+		{name: "not acceptable", method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, header: http.Header{"Accept": {"image/png"}}, wantStatus: http.StatusNotAcceptable, wantCode: codeNotAcceptable},
+		{name: "unauthorized", config: func(c *Config) { c.APIKeys = []string{"k"} }, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, wantStatus: http.StatusUnauthorized, wantCode: codeUnauthorized},
+		{name: "forbidden", config: func(c *Config) { c.APIIPFilter = IPFilterConfig{Deny: []string{"192.0.2.0/24"}} }, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, wantStatus: http.StatusForbidden, wantCode: codeForbidden},
+		{name: "rate limited", config: func(c *Config) { c.RateLimit = RateLimitConfig{RPS: 0.001, Burst: 1} }, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, before: 1, wantStatus: http.StatusTooManyRequests, wantCode: codeRateLimited},
+		{name: "upstream error", analyzer: failingAnalyzer{errors.New("boom")}, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, wantStatus: http.StatusInternalServerError, wantCode: codeUpstreamError},
+		{name: "upstream timeout", analyzer: failingAnalyzer{context.DeadlineExceeded}, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, wantStatus: http.StatusGatewayTimeout, wantCode: codeUpstreamTimeout},
+		{name: "circuit open", analyzer: failingAnalyzer{&sentiment.CircuitOpenError{RetryAfter: time.Second}}, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, wantStatus: http.StatusServiceUnavailable, wantCode: codeUnavailable},
+		{name: "overloaded", analyzer: failingAnalyzer{&sentiment.OverloadedError{RetryAfter: time.Second}}, method: http.MethodPost, target: "/v1/analyze", body: `{"text": "hi"}`, wantStatus: http.StatusServiceUnavailable, wantCode: codeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			if tt.config != nil {
+				tt.config(&cfg)
+			}
+			analyzer := tt.analyzer
+			if analyzer == nil {
+				analyzer = sentiment.Fake{}
+			}
+			s, err := NewServer(cfg, analyzer, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			h := s.Handler()
+
+			var w *httptest.ResponseRecorder
+			for range tt.before + 1 {
+				r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+				if tt.body != "" {
+					r.Header.Set("Content-Type", "application/json")
+				}
+				for name, values := range tt.header {
+					r.Header[name] = values
+				}
+				w = httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", ct)
+			}
+			var resp ErrorResponse
+			dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body.String(), err)
+			}
+			if resp.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Error.Code, tt.wantCode)
+			}
+			if resp.Error.Message == "" {
+				t.Error("empty message")
+			}
+			if resp.Error.RequestID == "" || resp.Error.RequestID != w.Header().Get("X-Request-ID") {
+				t.Errorf("request_id = %q, want the X-Request-ID header %q", resp.Error.RequestID, w.Header().Get("X-Request-ID"))
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Defaults for the corresponding ExportConfig fields.
+const (
+	DefaultExportBatchSize     = 500
+	DefaultExportFlushInterval = 10 * time.Second
+	DefaultExportMaxBuffered   = 10000
+)
+
+const (
+	// exportInsertTimeout bounds a single EventInserter.Insert.
+	exportInsertTimeout = 30 * time.Second
+	// A failed batch is retried up to exportMaxAttempts times in all, after
+	// a random delay of up to exportRetryBaseDelay·2ⁿ, capped at
+	// exportRetryMaxDelay, before retry n.
+	exportMaxAttempts    = 5
+	exportRetryBaseDelay = time.Second
+	exportRetryMaxDelay  = time.Minute
+)
+
+// AnalysisEvent is one sentiment analysis as exported for analytics.
+type AnalysisEvent struct {
+	Timestamp time.Time
+	// TextHash is the hex SHA-256 of the text.
+	TextHash  string
+	Sentiment string
+	Score     float64
+	Magnitude float64
+	Language  string
+	// LatencyMS is the time spent analyzing, 0 for cached results.
+	LatencyMS float64
+	Cached    bool
+	// APIKeyID identifies the API key of the request without revealing it;
+	// empty when authentication is disabled.
+	APIKeyID string
+}
+
+// EventInserter writes batches of events to an analytics sink.
+type EventInserter interface {
+	Insert(ctx context.Context, events []AnalysisEvent) error
+}
+
+// ExportConfig sets how events are batched for an EventInserter.
+type ExportConfig struct {
+	// BatchSize is the number of buffered events that triggers a flush, and
+	// the largest batch inserted.
+	BatchSize int
+	// FlushInterval is how often buffered events are flushed regardless of
+	// BatchSize.
+	FlushInterval time.Duration
+	// MaxBuffered bounds the events waiting to be inserted, for instance
+	// while the sink is failing; further events are dropped.
+	MaxBuffered int
+}
+
+// eventExporter buffers events and inserts them in batches in the
+// background, retrying failed batches.
+type eventExporter struct {
+	inserter EventInserter
+	cfg      ExportConfig
+	log      Logger
+	metrics  *Metrics
+	flush    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	buf     []AnalysisEvent
+	stopped bool
+}
+
+// SetEventExporter exports an AnalysisEvent for every sentiment analysis
+// served to inserter. It must be called before serving requests.
+func (s *Server) SetEventExporter(inserter EventInserter, cfg ExportConfig) {
+	e := &eventExporter{
+		inserter: inserter,
+		cfg:      cfg,
+		log:      s.log,
+		metrics:  s.metrics,
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	s.exporter = e
+}
+
+func (e *eventExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			e.flushAll()
+			return
+		}
+		e.flushAll()
+	}
+}
+
+// enqueue buffers ev without blocking.
+func (e *eventExporter) enqueue(ev AnalysisEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped || len(e.buf) >= e.cfg.MaxBuffered {
+		e.metrics.observeEventExport("dropped", 1)
+		return
+	}
+	e.buf = append(e.buf, ev)
+	if len(e.buf) >= e.cfg.BatchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flushAll inserts the buffered events in batches of at most BatchSize.
+func (e *eventExporter) flushAll() {
+	for {
+		e.mu.Lock()
+		n := min(len(e.buf), e.cfg.BatchSize)
+		batch := e.buf[:n:n]
+		e.buf = e.buf[n:]
+		e.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		e.insert(batch)
+	}
+}
+
+// insert inserts batch, retrying with backoff. A batch that still fails
+// after exportMaxAttempts is dropped.
+func (e *eventExporter) insert(batch []AnalysisEvent) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), exportInsertTimeout)
+		err := e.inserter.Insert(ctx, batch)
+		cancel()
+		if err == nil {
+			e.metrics.observeEventExport("ok", len(batch))
+			return
+		}
+		if attempt >= exportMaxAttempts {
+			e.metrics.observeEventExport("error", len(batch))
+			e.log.Error("failed to export analysis events, dropping them",
+				"events", len(batch), "attempts", attempt, "error", err.Error())
+			return
+		}
+		delay := exportRetryDelay(attempt)
+		e.log.Warn("failed to export analysis events, retrying",
+			"events", len(batch), "attempt", attempt, "retry_in", delay.String(), "error", err.Error())
+		time.Sleep(delay)
+	}
+}
+
+// exportRetryDelay returns the wait before the retry following attempt,
+// with full jitter.
+func exportRetryDelay(attempt int) time.Duration {
+	backoff := exportRetryBaseDelay
+	for i := 1; i < attempt && backoff < exportRetryMaxDelay; i++ {
+		backoff *= 2
+	}
+	return rand.N(min(backoff, exportRetryMaxDelay) + 1)
+}
+
+// close stops accepting events and waits until the buffered ones are
+// exported or ctx is done.
+func (e *eventExporter) close(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.stopped {
+		e.stopped = true
+		close(e.stop)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// captureInserter is an EventInserter keeping the batches it is given. It
+// fails the first failures calls, and blocks until release is closed when
+// release is set.
+type captureInserter struct {
+	release chan struct{}
+
+	mu       sync.Mutex
+	failures int
+	batches  [][]AnalysisEvent
+	inserted chan struct{}
+}
+
+func newCaptureInserter() *captureInserter {
+	return &captureInserter{inserted: make(chan struct{}, 100)}
+}
+
+func (c *captureInserter) Insert(_ context.Context, events []AnalysisEvent) error {
+	if c.release != nil {
+		<-c.release
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("sink unavailable")
+	}
+	c.batches = append(c.batches, events)
+	c.inserted <- struct{}{}
+	return nil
+}
+
+// wait waits for the next batch to be inserted.
+func (c *captureInserter) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.inserted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch inserted")
+	}
+}
+
+func (c *captureInserter) sizes() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []int
+	for _, b := range c.batches {
+		out = append(out, len(b))
+	}
+	return out
+}
+
+func (c *captureInserter) events() []AnalysisEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []AnalysisEvent
+	for _, b := range c.batches {
+		out = append(out, b...)
+	}
+	return out
+}
+
+// newExportServer returns a test server with a cache and an API key,
+// exporting its events to inserter.
+func newExportServer(t *testing.T, inserter EventInserter, cfg ExportConfig) *Server {
+	t.Helper()
+	scfg := testConfig()
+	scfg.APIKeys = []string{"key"}
+	s, err := NewServer(scfg, sentiment.Fake{}, stubLanguage{}, NewLRUCache(10, time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	s.SetEventExporter(inserter, cfg)
+	return s
+}
+
+// analyzeWithKey analyzes text with the API key of newExportServer.
+func analyzeWithKey(t *testing.T, h http.Handler, text string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(`{"text": "`+text+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(apiKeyHeader, "key")
+	w := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("request took %v", d)
+	}
+}
+
+func TestExportBatches(t *testing.T) {
+	inserter := newCaptureInserter()
+	s := newExportServer(t, inserter, ExportConfig{BatchSize: 3, FlushInterval: time.Hour, MaxBuffered: 100})
+	h := s.Handler()
+
+	// Full batches are flushed right away.
+	for range 3 {
+		analyzeWithKey(t, h, "I love it")
+	}
+	inserter.wait(t)
+	for range 4 {
+		analyzeWithKey(t, h, "This is awful")
+	}
+	inserter.wait(t)
+	// The rest is flushed on Close.
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if sizes := inserter.sizes(); len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("batches of %v, want 3, 3 and 1", sizes)
+	}
+
+	events := inserter.events()
+	first := events[0]
+	sum := sha256.Sum256([]byte("I love it"))
+	if first.TextHash != hex.EncodeToString(sum[:]) || first.Sentiment != "positive" || first.Score <= 0 || first.Magnitude <= 0 {
+		t.Errorf("first event %+v, want the positive analysis of its text", first)
+	}
+	if first.Cached || first.LatencyMS <= 0 {
+		t.Errorf("first event: cached %t, latency %vms, want an analysis that took time", first.Cached, first.LatencyMS)
+	}
+	if first.APIKeyID != apiKeyID("key") {
+		t.Errorf("API key ID %q, want %q", first.APIKeyID, apiKeyID("key"))
+	}
+	if time.Since(first.Timestamp) > time.Minute {
+		t.Errorf("timestamp %v, want the time of the request", first.Timestamp)
+	}
+	// Repeated texts come from the cache.
+	if second := events[1]; !second.Cached || second.LatencyMS != 0 {
+		t.Errorf("second event: cached %t, latency %vms, want a cached result", second.Cached, second.LatencyMS)
+	}
+}
+
+func TestExportInterval(t *testing.T) {
+	inserter := newCaptureInserter()
+	s := newExportServer(t, inserter, ExportConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond, MaxBuffered: 100})
+	analyzeWithKey(t, s.Handler(), "I love it")
+	inserter.wait(t)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if sizes := inserter.sizes(); len(sizes) != 1 || sizes[0] != 1 {
+		t.Errorf("batches of %v, want one event flushed on the interval", sizes)
+	}
+}
+
+func TestExportRetry(t *testing.T) {
+	inserter := newCaptureInserter()
+	inserter.failures = 1
+	s := newExportServer(t, inserter, ExportConfig{BatchSize: 1, FlushInterval: time.Hour, MaxBuffered: 100})
+	h := s.Handler()
+	analyzeWithKey(t, h, "I love it")
+	inserter.wait(t)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if sizes := inserter.sizes(); len(sizes) != 1 {
+		t.Errorf("batches of %v, want the failed one inserted once retried", sizes)
+	}
+	want := `sentiment_api_event_exports_total{result="ok"} 1`
+	if body := serve(h, http.MethodGet, "/metrics", "").Body.String(); !strings.Contains(body, want+"\n") {
+		t.Errorf("the metrics lack the series\n\t%s", want)
+	}
+}
+
+// TestExportBlocked checks that a sink that does not answer holds up no
+// request, and that the events beyond MaxBuffered are dropped.
+func TestExportBlocked(t *testing.T) {
+	inserter := newCaptureInserter()
+	inserter.release = make(chan struct{})
+	s := newExportServer(t, inserter, ExportConfig{BatchSize: 1, FlushInterval: time.Hour, MaxBuffered: 2})
+	h := s.Handler()
+	for range 10 {
+		analyzeWithKey(t, h, "I love it")
+	}
+	close(inserter.release)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// One event was being inserted; two more were buffered, at most.
+	if n := len(inserter.events()); n < 2 || n > 3 {
+		t.Errorf("%d events inserted, want 2 or 3", n)
+	}
+	body := serve(h, http.MethodGet, "/metrics", "").Body.String()
+	if !strings.Contains(body, `sentiment_api_event_exports_total{result="dropped"} 7`+"\n") &&
+		!strings.Contains(body, `sentiment_api_event_exports_total{result="dropped"} 8`+"\n") {
+		t.Errorf("the metrics lack the 7 or 8 dropped events:\n%s", body)
+	}
+}
+
+func TestExportRetryDelay(t *testing.T) {
+	for attempt, ceiling := range map[int]time.Duration{
+		1:  exportRetryBaseDelay,
+		2:  2 * exportRetryBaseDelay,
+		3:  4 * exportRetryBaseDelay,
+		20: exportRetryMaxDelay,
+	} {
+		for range 100 {
+			if d := exportRetryDelay(attempt); d < 0 || d > ceiling {
+				t.Fatalf("exportRetryDelay(%d) = %v, want at most %v", attempt, d, ceiling)
+			}
+		}
+	}
+}
+
+func TestBigQueryRow(t *testing.T) {
+	message, err := analysisEventDescriptor()
+	if err != nil {
+		t.Fatalf("analysisEventDescriptor: %v", err)
+	}
+	if got, want := message.Fields().Len(), len(AnalysisEventSchema); got != want {
+		t.Errorf("%d fields, want one per column, %d", got, want)
+	}
+	b := &BigQueryInserter{message: message}
+
+	ts := time.Date(2026, 10, 1, 12, 0, 0, 500_000, time.UTC)
+	row, err := proto.Marshal(b.row(AnalysisEvent{
+		Timestamp: ts,
+		TextHash:  "hash",
+		Sentiment: "negative",
+		Score:     -0.5,
+		Magnitude: 1.5,
+		LatencyMS: 12.5,
+		Cached:    true,
+	}))
+	if err != nil {
+		t.Fatalf("marshal the row: %v", err)
+	}
+	msg := dynamicpb.NewMessage(message)
+	if err := proto.Unmarshal(row, msg); err != nil {
+		t.Fatalf("unmarshal the row: %v", err)
+	}
+	get := func(name string) any {
+		fd := message.Fields().ByName(protoreflect.Name(name))
+		if !msg.Has(fd) {
+			return nil
+		}
+		return msg.Get(fd).Interface()
+	}
+	for name, want := range map[string]any{
+		"timestamp":  ts.UnixMicro(),
+		"text_hash":  "hash",
+		"sentiment":  "negative",
+		"score":      -0.5,
+		"magnitude":  1.5,
+		"latency_ms": 12.5,
+		"cached":     true,
+		// Left null.
+		"language":   nil,
+		"api_key_id": nil,
+	} {
+		if got := get(name); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// DefaultFeedMaxEntries is the number of entries of a feed analyzed unless
+// configured otherwise.
+const DefaultFeedMaxEntries = 50
+
+// feedMediaTypes are the media types feeds are accepted with, as servers are
+// far from consistent about them.
+var feedMediaTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/rdf+xml",
+	"application/xml",
+	"text/xml",
+}
+
+// feedError is a feed that could not be parsed.
+type feedError struct {
+	err error
+}
+
+func (e *feedError) Error() string {
+	return "the feed could not be parsed: " + e.err.Error()
+}
+
+func (e *feedError) Unwrap() error {
+	return e.err
+}
+
+type FeedRequest struct {
+	URL string `json:"url" required:"true" format:"uri"`
+}
+
+type FeedResponse struct {
+	Title string `json:"title"`
+	// FinalURL is the URL of the feed, after redirects.
+	FinalURL string `json:"final_url" doc:"URL of the feed, after redirects"`
+	// TotalEntries counts the entries of the feed, including those beyond
+	// the configured maximum that were not analyzed.
+	TotalEntries int               `json:"total_entries" doc:"Entries in the feed, including those beyond the configured maximum, which are not analyzed"`
+	Entries      []FeedEntryResult `json:"entries" doc:"The first entries of the feed, in feed order"`
+	Aggregate    AggregateResponse `json:"aggregate" doc:"Statistics of the entries; errors are identified by their index in entries"`
+}
+
+// FeedEntryResult is the outcome for one entry, whose title and
+// description are analyzed together.
+type FeedEntryResult struct {
+	ID        string `json:"id,omitempty" doc:"guid of an RSS item or id of an Atom entry"`
+	Title     string `json:"title"`
+	Link      string `json:"link,omitempty"`
+	Published string `json:"published,omitempty" doc:"Publication date as given in the feed"`
+	BatchResult
+}
+
+// feed is an RSS or Atom feed reduced to what is analyzed.
+type feed struct {
+	title   string
+	entries []feedEntry
+}
+
+type feedEntry struct {
+	id, title, link, published string
+	// text is the title and description, without markup.
+	text string
+}
+
+// rssFeed is an RSS 2.0 or 0.9x document, whose items are inside the
+// channel, or an RSS 1.0 one, whose items follow it.
+type rssFeed struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomFeed struct {
+	Title   atomText    `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     atomText   `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+// atomText is a text construct, whose content is either text, escaped HTML
+// or, with type xhtml, inline XHTML.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// html returns the content of t as HTML.
+func (t atomText) html() string {
+	if t.Type == "xhtml" {
+		return t.Inner
+	}
+	return t.Text
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+func (s *Server) analyzeFeedHandler(w http.ResponseWriter, r *http.Request) {
+	var req FeedRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid url: "+err.Error())
+		return
+	}
+	if err := checkFetchURL(u); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeURLNotAllowed, err.Error())
+		return
+	}
+
+	f, finalURL, err := s.fetchFeed(r.Context(), u)
+	var feedErr *feedError
+	switch {
+	case errors.As(err, &feedErr):
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidFeed, err.Error())
+		return
+	case err != nil:
+		s.writeFetchError(w, r, err)
+		return
+	}
+
+	entries := f.entries[:min(len(f.entries), s.feedMaxEntries)]
+	texts := make([]string, len(entries))
+	for i, e := range entries {
+		texts[i] = truncateText(e.text, s.maxTextBytes)
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	results := s.analyzeBatch(ctx, RequestIDFromContext(r.Context()), texts)
+	resp := FeedResponse{
+		Title:        f.title,
+		FinalURL:     finalURL,
+		TotalEntries: len(f.entries),
+		Entries:      make([]FeedEntryResult, len(entries)),
+		Aggregate:    aggregate(results),
+	}
+	for i, e := range entries {
+		resp.Entries[i] = FeedEntryResult{
+			ID:          e.id,
+			Title:       e.title,
+			Link:        e.link,
+			Published:   e.published,
+			BatchResult: results[i],
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// fetchFeed fetches and parses the feed at u, returning it with its URL
+// after redirects.
+func (s *Server) fetchFeed(ctx context.Context, u *url.URL) (feed, string, error) {
+	ctx, span := tracer.Start(ctx, "fetch.feed")
+	f, finalURL, err := s.doFetchFeed(ctx, u)
+	endSpan(span, err)
+	return f, finalURL, err
+}
+
+func (s *Server) doFetchFeed(ctx context.Context, u *url.URL) (feed, string, error) {
+	page, err := s.fetchBody(ctx, u, strings.Join(feedMediaTypes, ", "))
+	if err != nil {
+		return feed{}, page.url, err
+	}
+	if !slices.Contains(feedMediaTypes, page.mediaType) {
+		return feed{}, page.url, fmt.Errorf("%w %q: only RSS and Atom feeds can be analyzed", errUnsupportedPage, page.mediaType)
+	}
+	f, err := parseFeed(page.body)
+	return f, page.url, err
+}
+
+// parseFeed parses an RSS 0.9x, 1.0 or 2.0 or an Atom document. Errors are
+// *feedError.
+func parseFeed(body []byte) (feed, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charset.NewReaderLabel
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return feed{}, &feedError{err}
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "rss", "RDF":
+			var doc rssFeed
+			if err := d.DecodeElement(&doc, &start); err != nil {
+				return feed{}, &feedError{err}
+			}
+			return doc.feed(), nil
+		case "feed":
+			var doc atomFeed
+			if err := d.DecodeElement(&doc, &start); err != nil {
+				return feed{}, &feedError{err}
+			}
+			return doc.feed(), nil
+		default:
+			return feed{}, &feedError{fmt.Errorf("the root element is <%s>, not <rss> or <feed>", start.Name.Local)}
+		}
+	}
+}
+
+func (doc rssFeed) feed() feed {
+	f := feed{title: htmlText(doc.Channel.Title)}
+	for _, item := range append(doc.Channel.Items, doc.Items...) {
+		f.entries = append(f.entries, newFeedEntry(item.GUID, item.Title, item.Link, cmp.Or(item.PubDate, item.Date), item.Description))
+	}
+	return f
+}
+
+func (doc atomFeed) feed() feed {
+	f := feed{title: htmlText(doc.Title.html())}
+	for _, entry := range doc.Entries {
+		var link string
+		for _, l := range entry.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = l.Href
+				break
+			}
+		}
+		f.entries = append(f.entries, newFeedEntry(entry.ID, entry.Title.html(), link, cmp.Or(entry.Published, entry.Updated), cmp.Or(entry.Summary.html(), entry.Content.html())))
+	}
+	return f
+}
+
+// newFeedEntry returns the entry with the given fields, whose title and
+// description may contain markup.
+func newFeedEntry(id, title, link, published, description string) feedEntry {
+	e := feedEntry{
+		id:        strings.TrimSpace(id),
+		title:     htmlText(title),
+		link:      strings.TrimSpace(link),
+		published: strings.TrimSpace(published),
+	}
+	e.text = e.title
+	if d := htmlText(description); d != "" {
+		e.text = strings.TrimSpace(e.text + "\n\n" + d)
+	}
+	return e
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"unicode/utf8"
+)
+
+// fileFormField is the multipart form field carrying the uploaded files.
+const fileFormField = "file"
+
+var (
+	errBinaryFile   = errors.New("file is not UTF-8 text")
+	errFileTooLarge = errors.New("file is too large")
+)
+
+// FileResult is the outcome for one uploaded file. When analysis fails only
+// Error is set besides the file name and size.
+type FileResult struct {
+	Filename string `json:"filename"`
+	Bytes    int    `json:"bytes"`
+	*SentimentResponse
+	Error string `json:"error,omitempty"`
+}
+
+type uploadedFile struct {
+	name string
+	// size is the number of bytes read, which stops just past the limit
+	// for files that are too large.
+	size int
+	text string
+	err  error
+}
+
+// analyzeFileHandler analyzes the text files uploaded as multipart/form-data
+// in "file" parts. A single file gets a single FileResult and errors are
+// reported with the usual status codes; several files get an array of
+// results, each with its own error.
+func (s *Server) analyzeFileHandler(w http.ResponseWriter, r *http.Request) {
+	if mt := mediaType(r); mt != "multipart/form-data" {
+		writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia,
+			"Content-Type must be multipart/form-data, got "+mt)
+		return
+	}
+
+	files, err := s.readFiles(w, r)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if len(files) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, `the form must contain at least one "file" part`)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	if len(files) == 1 {
+		f := files[0]
+		switch {
+		case errors.Is(f.err, errBinaryFile):
+			writeError(w, r, http.StatusUnprocessableEntity, codeBinaryFile, f.err.Error())
+			return
+		case errors.Is(f.err, errFileTooLarge):
+			writeError(w, r, http.StatusRequestEntityTooLarge, codeTextTooLarge, f.err.Error())
+			return
+		}
+		if err := s.validateText(f.text); err != nil {
+			writeTextError(w, r, err)
+			return
+		}
+
+		resp, _, err := s.analyzeCached(ctx, SentimentRequest{Text: &f.text})
+		if err != nil {
+			s.writeUpstreamError(w, r, err, "analyze sentiment")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(FileResult{Filename: f.name, Bytes: f.size, SentimentResponse: &resp})
+		return
+	}
+
+	results := make([]FileResult, len(files))
+	var texts []string
+	var indexes []int
+	for i, f := range files {
+		results[i] = FileResult{Filename: f.name, Bytes: f.size}
+		if f.err != nil {
+			results[i].Error = f.err.Error()
+			continue
+		}
+		texts = append(texts, f.text)
+		indexes = append(indexes, i)
+	}
+	if len(texts) > 0 {
+		for j, res := range s.analyzeBatch(ctx, RequestIDFromContext(r.Context()), texts) {
+			results[indexes[j]].SentimentResponse = res.SentimentResponse
+			results[indexes[j]].Error = res.Error
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// readFiles reads every "file" part of the multipart body, which is limited
+// to s.maxBodyBytes in total. Problems with an individual file are recorded
+// on it rather than returned.
+func (s *Server) readFiles(w http.ResponseWriter, r *http.Request) ([]uploadedFile, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	defer r.Body.Close()
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []uploadedFile
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != fileFormField {
+			part.Close()
+			continue
+		}
+
+		f, err := s.readFile(part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+}
+
+func (s *Server) readFile(part *multipart.Part) (uploadedFile, error) {
+	f := uploadedFile{name: part.FileName()}
+
+	data, err := io.ReadAll(io.LimitReader(part, int64(s.maxFileBytes)+1))
+	if err != nil {
+		return f, err
+	}
+	f.size = len(data)
+	if len(data) > s.maxFileBytes {
+		// Drain the rest of the part so that the next one can be read.
+		if _, err := io.Copy(io.Discard, part); err != nil {
+			return f, err
+		}
+		f.err = fmt.Errorf("%w: exceeds the limit of %d bytes", errFileTooLarge, s.maxFileBytes)
+		return f, nil
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		f.err = errBinaryFile
+		return f, nil
+	}
+	f.text = string(data)
+	return f, nil
+}
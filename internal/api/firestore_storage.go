@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+)
+
+// DefaultFirestoreCollection is the collection FirestoreStorage writes to.
+const DefaultFirestoreCollection = "analyses"
+
+// FirestoreStorage is a Storage that adds one document per analysis to a
+// Firestore collection.
+type FirestoreStorage struct {
+	client     *firestore.Client
+	collection string
+}
+
+// NewFirestoreStorage connects to Firestore in projectID, or in the project
+// of the default credentials when projectID is empty.
+func NewFirestoreStorage(ctx context.Context, projectID, collection string) (*FirestoreStorage, error) {
+	if projectID == "" {
+		projectID = firestore.DetectProjectID
+	}
+	client, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreStorage{client: client, collection: collection}, nil
+}
+
+func (f *FirestoreStorage) Save(ctx context.Context, rec AnalysisRecord) error {
+	_, _, err := f.client.Collection(f.collection).Add(ctx, rec)
+	return err
+}
+
+// List queries the collection. Filtering on both the score and the time
+// range, or on the sentiment with either, needs a composite index on the
+// fields involved, timestamp and the document ID.
+func (f *FirestoreStorage) List(ctx context.Context, q HistoryQuery) ([]AnalysisRecord, error) {
+	query := f.client.Collection(f.collection).Query
+	if q.Sentiment != "" {
+		query = query.Where("sentiment", "==", q.Sentiment)
+	}
+	if q.MinScore != nil {
+		query = query.Where("score", ">=", *q.MinScore)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("timestamp", ">=", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("timestamp", "<", q.Until)
+	}
+	query = query.OrderBy("timestamp", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+	if q.After != nil {
+		query = query.StartAfter(q.After.Timestamp, q.After.ID)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AnalysisRecord, 0, len(docs))
+	for _, doc := range docs {
+		var rec AnalysisRecord
+		if err := doc.DataTo(&rec); err != nil {
+			return nil, fmt.Errorf("document %s: %w", doc.Ref.ID, err)
+		}
+		rec.ID = doc.Ref.ID
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func (f *FirestoreStorage) Close() error {
+	return f.client.Close()
+}
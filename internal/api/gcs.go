@@ -0,0 +1,467 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Defaults for the corresponding GCSConfig fields.
+const (
+	DefaultGCSConcurrency  = 8
+	DefaultGCSOutputPrefix = "sentiment-results/"
+)
+
+const (
+	// maxRunningGCSJobs bounds the bucket jobs a server runs at once.
+	maxRunningGCSJobs = 4
+	// gcsJobTTL is how long the status of a finished job is kept.
+	gcsJobTTL = 24 * time.Hour
+)
+
+// ObjectInfo describes an object of a bucket.
+type ObjectInfo struct {
+	Name        string
+	ContentType string
+	Size        int64
+}
+
+// ObjectStore reads and writes the objects of buckets. GCSObjectStore
+// implements it.
+type ObjectStore interface {
+	// List calls fn with every object of bucket whose name starts with
+	// prefix, stopping at the first error returned by fn.
+	List(ctx context.Context, bucket, prefix string, fn func(ObjectInfo) error) error
+	Open(ctx context.Context, bucket, name string) (io.ReadCloser, error)
+	// Create returns a writer to a new object, which is only written once
+	// the writer is closed without error. Cancelling ctx abandons it.
+	Create(ctx context.Context, bucket, name, contentType string) io.WriteCloser
+}
+
+// GCSConfig enables POST /analyze/gcs.
+type GCSConfig struct {
+	// Buckets are the buckets whose objects may be analyzed.
+	Buckets []string
+	// OutputBucket is where the results of a job are written; the analyzed
+	// bucket when empty.
+	OutputBucket string
+	// OutputPrefix is prepended to the name of the results object of a job,
+	// <job ID>.json or .csv. Objects under it are not analyzed.
+	OutputPrefix string
+	// Concurrency is the number of objects of a job analyzed at once.
+	Concurrency int
+}
+
+// GCSRequest is the body of POST /analyze/gcs.
+type GCSRequest struct {
+	Bucket string `json:"bucket" required:"true"`
+	Prefix string `json:"prefix,omitempty" doc:"Analyze only the objects whose name starts with this prefix"`
+	Format string `json:"format,omitempty" enum:"json,csv" default:"json" doc:"Format of the results object"`
+}
+
+// GCSJob is the status of a bucket job.
+type GCSJob struct {
+	JobID      string     `json:"job_id"`
+	Status     string     `json:"status" enum:"running,done,failed"`
+	Bucket     string     `json:"bucket"`
+	Prefix     string     `json:"prefix,omitempty"`
+	Output     string     `json:"output" doc:"gs:// URL of the results object, written once the job is done"`
+	Processed  int        `json:"processed" doc:"Objects analyzed"`
+	Failed     int        `json:"failed" doc:"Objects that could not be read or analyzed"`
+	Skipped    int        `json:"skipped" doc:"Objects skipped because they are not UTF-8 text"`
+	Error      string     `json:"error,omitempty" doc:"Why the job failed"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// GCSObjectResult is the entry of an analyzed or failed object in the
+// results object of a job. The CSV format has the columns object, sentiment,
+// sentiment_score, magnitude and error.
+type GCSObjectResult struct {
+	Object string `json:"object"`
+	*SentimentResponse
+	Error string `json:"error,omitempty"`
+}
+
+type gcsJob struct {
+	status   GCSJob
+	apiKeyID string
+}
+
+// gcsJobs holds the status of the jobs of the server.
+type gcsJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*gcsJob
+}
+
+// start registers job unless maxRunningGCSJobs are running already. It
+// forgets the jobs that finished over gcsJobTTL ago.
+func (j *gcsJobs) start(job *gcsJob) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	running := 0
+	for id, other := range j.jobs {
+		switch {
+		case other.status.FinishedAt == nil:
+			running++
+		case time.Since(*other.status.FinishedAt) > gcsJobTTL:
+			delete(j.jobs, id)
+		}
+	}
+	if running >= maxRunningGCSJobs {
+		return false
+	}
+	if j.jobs == nil {
+		j.jobs = make(map[string]*gcsJob)
+	}
+	j.jobs[job.status.JobID] = job
+	return true
+}
+
+// get returns the status of the job id started with the API key apiKeyID.
+func (j *gcsJobs) get(id, apiKeyID string) (GCSJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok || job.apiKeyID != apiKeyID {
+		return GCSJob{}, false
+	}
+	return job.status, true
+}
+
+func (j *gcsJobs) update(job *gcsJob, fn func(*GCSJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&job.status)
+}
+
+// SetObjectStore enables POST /analyze/gcs on the buckets of cfg. It must be
+// called before serving requests.
+func (s *Server) SetObjectStore(store ObjectStore, cfg GCSConfig) {
+	s.objects = store
+	s.gcs = cfg
+}
+
+// analyzeGCSHandler serves /analyze/gcs: POST starts a job analyzing the
+// objects of a bucket in the background and GET returns its status.
+func (s *Server) analyzeGCSHandler(w http.ResponseWriter, r *http.Request) {
+	if s.objects == nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "bucket analysis is disabled")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		id := r.URL.Query().Get("job_id")
+		if id == "" {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "the job_id query parameter is required")
+			return
+		}
+		status, ok := s.gcsJobs.get(id, apiKeyIDFromContext(r.Context()))
+		if !ok {
+			writeError(w, r, http.StatusNotFound, codeNotFound, "no such job")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	var req GCSRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	switch req.Format {
+	case "":
+		req.Format = "json"
+	case "json", "csv":
+	default:
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unsupported format %q: must be json or csv", req.Format))
+		return
+	}
+	if req.Bucket == "" {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "bucket is required")
+		return
+	}
+	if !slices.Contains(s.gcs.Buckets, req.Bucket) {
+		writeError(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("bucket %q may not be analyzed", req.Bucket))
+		return
+	}
+
+	outBucket := s.gcs.OutputBucket
+	if outBucket == "" {
+		outBucket = req.Bucket
+	}
+	job := &gcsJob{
+		status: GCSJob{
+			JobID:     newRequestID(),
+			Status:    "running",
+			Bucket:    req.Bucket,
+			Prefix:    req.Prefix,
+			StartedAt: time.Now().UTC(),
+		},
+		apiKeyID: apiKeyIDFromContext(r.Context()),
+	}
+	outName := s.gcs.OutputPrefix + job.status.JobID + "." + req.Format
+	job.status.Output = "gs://" + outBucket + "/" + outName
+	if !s.gcsJobs.start(job) {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "too many bucket jobs are running, retry later")
+		return
+	}
+	s.log.Info("started bucket job",
+		"request_id", RequestIDFromContext(r.Context()), "job_id", job.status.JobID,
+		"bucket", req.Bucket, "prefix", req.Prefix, "output", job.status.Output)
+
+	status := job.status
+
+	// The job outlives the request but not the server.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	go func() {
+		select {
+		case <-s.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		s.runGCSJob(ctx, job, req, outBucket, outName)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// gcsOutcome is the result of analyzing one object.
+type gcsOutcome struct {
+	result  GCSObjectResult
+	skipped bool
+}
+
+// runGCSJob analyzes the objects of the job with s.gcs.Concurrency at once
+// and streams the results, in completion order, to outName in outBucket.
+func (s *Server) runGCSJob(ctx context.Context, job *gcsJob, req GCSRequest, outBucket, outName string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The texts analyzed after the request returned count as well.
+	defer flushQuotaCharge(ctx)
+
+	contentType := "application/json"
+	if req.Format == "csv" {
+		contentType = "text/csv; charset=utf-8"
+	}
+	out := newGCSResultWriter(s.objects.Create(ctx, outBucket, outName, contentType), req.Format)
+
+	objects := make(chan ObjectInfo)
+	var listErr error
+	go func() {
+		defer close(objects)
+		listErr = s.objects.List(ctx, req.Bucket, req.Prefix, func(obj ObjectInfo) error {
+			if strings.HasSuffix(obj.Name, "/") ||
+				(outBucket == req.Bucket && strings.HasPrefix(obj.Name, s.gcs.OutputPrefix)) {
+				// Folder placeholders and earlier results.
+				return nil
+			}
+			select {
+			case objects <- obj:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	outcomes := mapUnordered(ctx, s.gcs.Concurrency, objects, func(ctx context.Context, obj ObjectInfo) gcsOutcome {
+		return s.analyzeObject(ctx, job.status.JobID, req.Bucket, obj)
+	})
+
+	var writeErr error
+	for o := range outcomes {
+		s.gcsJobs.update(job, func(st *GCSJob) {
+			switch {
+			case o.skipped:
+				st.Skipped++
+			case o.result.Error != "":
+				st.Failed++
+			default:
+				st.Processed++
+			}
+		})
+		if o.skipped || writeErr != nil {
+			continue
+		}
+		if writeErr = out.write(o.result); writeErr != nil {
+			// Stop listing and analyzing; the outcomes in flight are
+			// dropped.
+			cancel()
+		}
+	}
+
+	// Returning without closing out abandons the results object.
+	var err error
+	switch {
+	case writeErr != nil:
+		err = fmt.Errorf("write results: %w", writeErr)
+	case ctx.Err() != nil:
+		err = errors.New("the server shut down before the job was done")
+	case listErr != nil:
+		err = fmt.Errorf("list objects: %w", listErr)
+	default:
+		if err = out.close(); err != nil {
+			err = fmt.Errorf("write results: %w", err)
+		}
+	}
+
+	s.gcsJobs.update(job, func(st *GCSJob) {
+		now := time.Now().UTC()
+		st.FinishedAt = &now
+		st.Status = "done"
+		if err != nil {
+			st.Status = "failed"
+			st.Error = err.Error()
+		}
+	})
+	status, _ := s.gcsJobs.get(job.status.JobID, job.apiKeyID)
+	if err != nil {
+		s.log.Error("bucket job failed",
+			"job_id", status.JobID, "processed", status.Processed, "failed", status.Failed,
+			"skipped", status.Skipped, "error", err.Error())
+		return
+	}
+	s.log.Info("bucket job done",
+		"job_id", status.JobID, "processed", status.Processed, "failed", status.Failed,
+		"skipped", status.Skipped, "output", status.Output)
+}
+
+// analyzeObject reads obj and analyzes its text. Objects with a content type
+// other than text/* or application/octet-stream, or whose content is not
+// UTF-8 text, are skipped.
+func (s *Server) analyzeObject(ctx context.Context, jobID, bucket string, obj ObjectInfo) gcsOutcome {
+	res := GCSObjectResult{Object: obj.Name}
+	if !textContentType(obj.ContentType) {
+		return gcsOutcome{result: res, skipped: true}
+	}
+	// Texts longer than that are rejected by validation anyway.
+	limit := s.maxTextBytes * s.maxChunks
+	if obj.Size > int64(limit) {
+		res.Error = fmt.Sprintf("%s: %d bytes exceeds the limit of %d bytes", errTextTooLarge, obj.Size, limit)
+		return gcsOutcome{result: res}
+	}
+
+	rc, err := s.objects.Open(ctx, bucket, obj.Name)
+	if err != nil {
+		res.Error = "failed to read the object: " + err.Error()
+		return gcsOutcome{result: res}
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, int64(limit)+1))
+	rc.Close()
+	if err != nil {
+		res.Error = "failed to read the object: " + err.Error()
+		return gcsOutcome{result: res}
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return gcsOutcome{result: res, skipped: true}
+	}
+
+	text := string(data)
+	req := SentimentRequest{Text: &text}
+	if err := s.validateSentimentRequest(&req); err != nil {
+		res.Error = err.Error()
+		return gcsOutcome{result: res}
+	}
+	actx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	resp, _, err := s.analyzeCached(actx, req)
+	if err != nil {
+		s.log.Error("failed to analyze object",
+			"job_id", jobID, "object", obj.Name, "error", err.Error())
+		res.Error = "failed to analyze sentiment"
+		return gcsOutcome{result: res}
+	}
+	res.SentimentResponse = &resp
+	return gcsOutcome{result: res}
+}
+
+// textContentType reports whether objects of content type ct may hold text.
+func textContentType(ct string) bool {
+	mt, _, _ := strings.Cut(ct, ";")
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	return mt == "" || mt == "application/octet-stream" || strings.HasPrefix(mt, "text/")
+}
+
+// gcsResultWriter writes the results object of a job, as a JSON array or
+// as CSV.
+type gcsResultWriter struct {
+	w     io.WriteCloser
+	csv   *csv.Writer
+	count int
+}
+
+func newGCSResultWriter(w io.WriteCloser, format string) *gcsResultWriter {
+	rw := &gcsResultWriter{w: w}
+	if format == "csv" {
+		rw.csv = csv.NewWriter(w)
+	}
+	return rw
+}
+
+func (rw *gcsResultWriter) write(res GCSObjectResult) error {
+	rw.count++
+	if rw.csv != nil {
+		if rw.count == 1 {
+			rw.csv.Write(append([]string{"object"}, csvResultColumns...))
+		}
+		record := []string{res.Object, "", "", "", res.Error}
+		if res.SentimentResponse != nil {
+			record[1] = res.Sentiment
+			record[2] = strconv.FormatFloat(res.SentimentScore, 'f', -1, 64)
+			record[3] = strconv.FormatFloat(res.Magnitude, 'f', -1, 64)
+		}
+		rw.csv.Write(record)
+		return rw.csv.Error()
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if rw.count == 1 {
+		sep = "[\n"
+	}
+	_, err = io.WriteString(rw.w, sep+string(data))
+	return err
+}
+
+// close completes the results and writes the object.
+func (rw *gcsResultWriter) close() error {
+	if rw.csv != nil {
+		if rw.count == 0 {
+			rw.csv.Write(append([]string{"object"}, csvResultColumns...))
+		}
+		rw.csv.Flush()
+		if err := rw.csv.Error(); err != nil {
+			return err
+		}
+	} else {
+		end := "\n]\n"
+		if rw.count == 0 {
+			end = "[]\n"
+		}
+		if _, err := io.WriteString(rw.w, end); err != nil {
+			return err
+		}
+	}
+	return rw.w.Close()
+}
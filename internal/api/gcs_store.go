@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// gcsListPageSize is the number of objects listed per request.
+const gcsListPageSize = 1000
+
+// GCSObjectStore is an ObjectStore of Cloud Storage buckets.
+type GCSObjectStore struct {
+	client *gcs.Client
+}
+
+func NewGCSObjectStore(ctx context.Context) (*GCSObjectStore, error) {
+	client, err := gcs.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSObjectStore{client: client}, nil
+}
+
+// List lists the objects a page at a time, so that buckets of any size are
+// listed in constant memory.
+func (g *GCSObjectStore) List(ctx context.Context, bucket, prefix string, fn func(ObjectInfo) error) error {
+	q := &gcs.Query{Prefix: prefix}
+	if err := q.SetAttrSelection([]string{"Name", "ContentType", "Size"}); err != nil {
+		return err
+	}
+	it := g.client.Bucket(bucket).Objects(ctx, q)
+	it.PageInfo().MaxSize = gcsListPageSize
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ObjectInfo{Name: attrs.Name, ContentType: attrs.ContentType, Size: attrs.Size}); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *GCSObjectStore) Open(ctx context.Context, bucket, name string) (io.ReadCloser, error) {
+	return g.client.Bucket(bucket).Object(name).NewReader(ctx)
+}
+
+func (g *GCSObjectStore) Create(ctx context.Context, bucket, name, contentType string) io.WriteCloser {
+	w := g.client.Bucket(bucket).Object(name).NewWriter(ctx)
+	w.ContentType = contentType
+	return w
+}
+
+func (g *GCSObjectStore) Close() error {
+	return g.client.Close()
+}
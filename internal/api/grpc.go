@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sentimentv1 "github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/pb/sentiment/v1"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer returns a gRPC server exposing sentiment.v1.SentimentService. It
+// shares the analyzer, cache, validation rules, API keys and metrics of the
+// HTTP API; keys are sent in the x-api-key metadata entry, and ID tokens in
+// the authorization one.
+func (s *Server) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.grpcUnaryInterceptor),
+		grpc.ChainStreamInterceptor(s.grpcStreamInterceptor),
+	)
+	sentimentv1.RegisterSentimentServiceServer(srv, &grpcService{s: s})
+	reflection.Register(srv)
+	return srv
+}
+
+func (s *Server) grpcUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx = grpcRequestContext(ctx)
+	var resp any
+	ctx, err := s.grpcAuthenticate(ctx)
+	if err == nil {
+		ctx, err = s.grpcAdmit(ctx, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+	}
+	if err == nil {
+		resp, err = handler(ctx, req)
+		flushQuotaCharge(ctx)
+	}
+	s.metrics.observeGRPC(info.FullMethod, time.Since(start), err)
+	return resp, err
+}
+
+func (s *Server) grpcStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, err := s.grpcAuthenticate(grpcRequestContext(ss.Context()))
+	if err == nil {
+		ctx, err = s.grpcAdmit(ctx, ss.SetHeader)
+	}
+	if err == nil {
+		err = handler(srv, &grpcStream{ServerStream: ss, ctx: ctx})
+		flushQuotaCharge(ctx)
+	}
+	s.metrics.observeGRPC(info.FullMethod, time.Since(start), err)
+	return err
+}
+
+// grpcRequestContext attaches a request ID to ctx, reusing a valid
+// x-request-id metadata entry supplied by the caller.
+func grpcRequestContext(ctx context.Context) context.Context {
+	id := newRequestID()
+	if ids := metadata.ValueFromIncomingContext(ctx, requestIDMetadata); len(ids) > 0 && validRequestID(ids[0]) {
+		id = ids[0]
+	}
+	return contextWithRequestID(ctx, id)
+}
+
+// grpcAuthenticate is the gRPC counterpart of Server.authenticate. It returns
+// ctx with the apiKeyID of the caller attached.
+func (s *Server) grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	key := strings.ToLower(apiKeyHeader)
+	keys := metadata.ValueFromIncomingContext(ctx, key)
+	accepted := s.settings.Load().keys
+	if s.idTokens != nil && (len(keys) == 0 || !accepted.enabled()) {
+		return s.grpcAuthenticateToken(ctx)
+	}
+	if !accepted.enabled() {
+		return ctx, nil
+	}
+	if len(keys) == 0 {
+		return ctx, status.Error(codes.Unauthenticated, "missing "+key+" metadata")
+	}
+	if !accepted.valid(keys[0]) {
+		return ctx, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	return context.WithValue(ctx, apiKeyIDKey{}, apiKeyID(keys[0])), nil
+}
+
+// grpcAuthenticateToken authenticates the ID token in the authorization
+// metadata entry.
+func (s *Server) grpcAuthenticateToken(ctx context.Context) (context.Context, error) {
+	var token string
+	if auth := metadata.ValueFromIncomingContext(ctx, "authorization"); len(auth) > 0 {
+		token, _ = strings.CutPrefix(auth[0], "Bearer ")
+	}
+	if token == "" {
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token in the authorization metadata")
+	}
+	email, code, err := s.idTokens.authenticate(ctx, token)
+	switch {
+	case code == http.StatusForbidden:
+		return ctx, status.Error(codes.PermissionDenied, "the service account is not allowed")
+	case err != nil:
+		return ctx, status.Error(codes.Unauthenticated, "invalid ID token")
+	}
+	return context.WithValue(ctx, apiKeyIDKey{}, email), nil
+}
+
+// grpcAdmit is the gRPC counterpart of quotas.enforce. The remaining quotas
+// are sent with setHeader, in the x-quota-remaining and
+// x-quota-remaining-chars header metadata entries.
+func (s *Server) grpcAdmit(ctx context.Context, setHeader func(metadata.MD) error) (context.Context, error) {
+	if s.quotas == nil {
+		return ctx, nil
+	}
+	ctx, st, err := s.quotas.admit(ctx)
+	md := metadata.MD{}
+	st.setHeaders(func(name, value string) { md.Set(name, value) })
+	if len(md) > 0 {
+		setHeader(md)
+	}
+	if err != nil {
+		return ctx, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return ctx, nil
+}
+
+// grpcStream replaces the context of a server stream.
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+type grpcService struct {
+	sentimentv1.UnimplementedSentimentServiceServer
+	s *Server
+}
+
+func (g *grpcService) Analyze(ctx context.Context, in *sentimentv1.AnalyzeRequest) (*sentimentv1.AnalyzeResponse, error) {
+	return g.s.analyzeGRPC(ctx, in)
+}
+
+// AnalyzeStream analyzes every request received on the stream with at most
+// s.batchWorkers in flight. Responses are sent in completion order, each
+// carrying the ID of its request; a failed item does not end the stream.
+func (g *grpcService) AnalyzeStream(stream sentimentv1.SentimentService_AnalyzeStreamServer) error {
+	ctx := stream.Context()
+	sem := make(chan struct{}, g.s.batchWorkers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var (
+		mu      sync.Mutex
+		sendErr error
+	)
+	send := func(resp *sentimentv1.AnalyzeStreamResponse) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sendErr == nil {
+			sendErr = stream.Send(resp)
+		}
+	}
+
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			out := &sentimentv1.AnalyzeStreamResponse{Id: in.GetId()}
+			resp, err := g.s.analyzeGRPC(ctx, in.GetRequest())
+			if err != nil {
+				st := status.Convert(err)
+				out.Result = &sentimentv1.AnalyzeStreamResponse_Error{Error: &sentimentv1.Error{
+					Code:    st.Code().String(),
+					Message: st.Message(),
+				}}
+			} else {
+				out.Result = &sentimentv1.AnalyzeStreamResponse_Response{Response: resp}
+			}
+			send(out)
+		}()
+	}
+
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	return sendErr
+}
+
+// analyzeGRPC validates and analyzes one request under the same rules as
+// POST /analyze, returning errors as gRPC statuses.
+func (s *Server) analyzeGRPC(ctx context.Context, in *sentimentv1.AnalyzeRequest) (*sentimentv1.AnalyzeResponse, error) {
+	text := in.GetText()
+	req := SentimentRequest{
+		Text:             &text,
+		Language:         in.GetLanguage(),
+		IncludeSentences: in.GetIncludeSentences(),
+		DocumentType:     grpcDocumentType(in.GetDocumentType()),
+	}
+	if err := s.validateSentimentRequest(&req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	resp, _, err := s.analyzeCached(ctx, req)
+	if err != nil {
+		return nil, s.grpcUpstreamError(ctx, err)
+	}
+
+	// The messages keep the float fields they were published with.
+	out := &sentimentv1.AnalyzeResponse{
+		Sentiment:        resp.Sentiment,
+		Score:            float32(resp.Score),
+		SentimentScore:   float32(resp.SentimentScore),
+		Magnitude:        float32(resp.Magnitude),
+		Language:         resp.Language,
+		LanguageDetected: resp.LanguageDetected,
+		Provider:         resp.Provider,
+	}
+	for _, sentence := range resp.Sentences {
+		out.Sentences = append(out.Sentences, &sentimentv1.SentenceSentiment{
+			Text:      sentence.Text,
+			Score:     float32(sentence.Score),
+			Magnitude: float32(sentence.Magnitude),
+		})
+	}
+	return out, nil
+}
+
+// grpcUpstreamError is the gRPC counterpart of writeUpstreamError.
+func (s *Server) grpcUpstreamError(ctx context.Context, err error) error {
+	id := RequestIDFromContext(ctx)
+	var (
+		openErr       *sentiment.CircuitOpenError
+		overloadedErr *sentiment.OverloadedError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request cancelled")
+	case errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded:
+		s.log.Warn("upstream call timed out", "request_id", id, "action", "analyze sentiment", "error", err.Error())
+		return status.Error(codes.DeadlineExceeded, "the Language API did not respond in time")
+	case errors.As(err, &openErr):
+		s.log.Warn("upstream call rejected by the circuit breaker", "request_id", id, "action", "analyze sentiment")
+		return status.Error(codes.Unavailable, "the Language API is unavailable, retry later")
+	case errors.As(err, &overloadedErr):
+		s.log.Warn("upstream call rejected: too many calls in flight", "request_id", id, "action", "analyze sentiment")
+		return status.Error(codes.Unavailable, "too many requests are being analyzed, retry later")
+	default:
+		s.log.Error("upstream call failed", "request_id", id, "action", "analyze sentiment", "error", err.Error())
+		return status.Error(codes.Internal, "failed to analyze sentiment")
+	}
+}
+
+// grpcDocumentType maps a DocumentType onto the document_type names of the
+// HTTP API. Unknown values map onto a name documentType rejects.
+func grpcDocumentType(t sentimentv1.DocumentType) string {
+	switch t {
+	case sentimentv1.DocumentType_DOCUMENT_TYPE_UNSPECIFIED:
+		return ""
+	case sentimentv1.DocumentType_DOCUMENT_TYPE_PLAIN_TEXT:
+		return "plain_text"
+	case sentimentv1.DocumentType_DOCUMENT_TYPE_HTML:
+		return "html"
+	default:
+		return t.String()
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The healthcheck runs every check with deepHealthTimeout and its report is
+// reused for deepHealthTTL, so that frequent probes don't multiply upstream
+// calls.
+const (
+	deepHealthTimeout = 5 * time.Second
+	deepHealthTTL     = 30 * time.Second
+)
+
+// Health statuses reported by the healthcheck. A failed optional check
+// degrades the service, a failed required check makes it unavailable.
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+)
+
+// HealthCheck probes one dependency, returning an error if it is unusable.
+type HealthCheck func(ctx context.Context) error
+
+// HealthReport is the body of GET /healthcheck.
+type HealthReport struct {
+	Status        string                 `json:"status" enum:"ok,degraded,unavailable"`
+	UptimeSeconds int64                  `json:"uptime_seconds"`
+	CheckedAt     time.Time              `json:"checked_at"`
+	Checks        map[string]CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Status    string    `json:"status" enum:"ok,unavailable"`
+	Required  bool      `json:"required" doc:"Whether the service is unavailable without the dependency, rather than degraded"`
+	CheckedAt time.Time `json:"checked_at"`
+	LatencyMS int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type healthChecks struct {
+	mu     sync.Mutex
+	checks map[string]registeredCheck
+	report *HealthReport
+}
+
+type registeredCheck struct {
+	check    HealthCheck
+	required bool
+}
+
+// AddHealthCheck registers check under name as a required dependency: the
+// healthcheck reports 503 when it fails.
+func (s *Server) AddHealthCheck(name string, check HealthCheck) {
+	s.addHealthCheck(name, registeredCheck{check: check, required: true})
+}
+
+// AddOptionalHealthCheck registers check under name as an optional
+// dependency: the healthcheck reports the service as degraded, still with
+// 200, when it fails.
+func (s *Server) AddOptionalHealthCheck(name string, check HealthCheck) {
+	s.addHealthCheck(name, registeredCheck{check: check})
+}
+
+func (s *Server) addHealthCheck(name string, c registeredCheck) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	if s.health.checks == nil {
+		s.health.checks = make(map[string]registeredCheck)
+	}
+	s.health.checks[name] = c
+	s.health.report = nil
+}
+
+// healthcheckHandler reports the status of the service and of its
+// dependencies, with 503 if a required one fails. With ?plain=true it only
+// reports 200 with an empty body as long as the process serves requests,
+// for probes that must not depend on anything else.
+func (s *Server) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("plain") == "true" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	report := s.deepHealth(r.Context())
+	report.UptimeSeconds = int64(time.Since(s.metrics.started).Seconds())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == healthUnavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// deepHealth returns the latest report, running the checks if it is older
+// than deepHealthTTL. Concurrent callers wait for a single run.
+func (s *Server) deepHealth(ctx context.Context) HealthReport {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	if s.health.report != nil && time.Since(s.health.report.CheckedAt) < deepHealthTTL {
+		return *s.health.report
+	}
+
+	// The result is shared with other callers, so it must not depend on
+	// this request being cancelled.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deepHealthTimeout)
+	defer cancel()
+
+	report := HealthReport{
+		Status:    healthOK,
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]CheckResult, len(s.health.checks)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range s.health.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.check(ctx)
+			result := CheckResult{
+				Status:    healthOK,
+				Required:  c.required,
+				CheckedAt: start,
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = healthUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			switch {
+			case err == nil:
+			case c.required:
+				report.Status = healthUnavailable
+			case report.Status == healthOK:
+				report.Status = healthDegraded
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.health.report = &report
+	return report
+}
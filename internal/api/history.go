@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultHistoryPreviewBytes is how much of each text GET /history returns
+// by default.
+const DefaultHistoryPreviewBytes = 200
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type HistoryResponse struct {
+	Items []HistoryItem `json:"items"`
+	// NextCursor is set only when more items match.
+	NextCursor string `json:"next_cursor,omitempty" doc:"Pass as cursor to get the next page; absent on the last page"`
+}
+
+type HistoryItem struct {
+	ID        string    `json:"id"`
+	TextHash  string    `json:"text_hash" doc:"Hex SHA-256 of the full text"`
+	Text      string    `json:"text" doc:"Start of the text, truncated to the configured preview length"`
+	Sentiment string    `json:"sentiment"`
+	Score     float64   `json:"score"`
+	Magnitude float64   `json:"magnitude"`
+	Language  string    `json:"language,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// historyHandler serves GET /history, the stored analyses newest first.
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "history is disabled: no storage is configured")
+		return
+	}
+
+	q, err := historyQueryFromRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	limit := q.Limit
+	// One more than asked tells whether there is a next page.
+	q.Limit++
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	records, err := s.storage.storage.List(ctx, q)
+	if err != nil {
+		s.log.Error("failed to list analysis records",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "failed to read the history")
+		return
+	}
+
+	resp := HistoryResponse{Items: make([]HistoryItem, 0, min(len(records), limit))}
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[limit-1]
+		resp.NextCursor = encodeHistoryCursor(HistoryCursor{Timestamp: last.Timestamp, ID: last.ID})
+	}
+	for _, rec := range records {
+		resp.Items = append(resp.Items, HistoryItem{
+			ID:        rec.ID,
+			TextHash:  rec.TextHash,
+			Text:      truncateText(rec.Text, s.previewBytes),
+			Sentiment: rec.Sentiment,
+			Score:     rec.Score,
+			Magnitude: rec.Magnitude,
+			Language:  rec.Language,
+			Timestamp: rec.Timestamp,
+			RequestID: rec.RequestID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func historyQueryFromRequest(r *http.Request) (HistoryQuery, error) {
+	values := r.URL.Query()
+	q := HistoryQuery{Limit: defaultHistoryLimit}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return q, fmt.Errorf("limit must be an integer between 1 and %d", maxHistoryLimit)
+		}
+		q.Limit = n
+	}
+	if v := values.Get("cursor"); v != "" {
+		c, err := decodeHistoryCursor(v)
+		if err != nil {
+			return q, err
+		}
+		q.After = &c
+	}
+	switch v := values.Get("sentiment"); v {
+	case "", "positive", "negative", "neutral":
+		q.Sentiment = v
+	default:
+		return q, fmt.Errorf("sentiment must be positive, negative or neutral, got %q", v)
+	}
+	if v := values.Get("min_score"); v != "" {
+		score, err := strconv.ParseFloat(v, 64)
+		if err != nil || score < -1 || score > 1 {
+			return q, errors.New("min_score must be a number between -1 and 1")
+		}
+		q.MinScore = &score
+	}
+
+	var err error
+	if q.Since, err = timeQuery(values.Get("since"), "since"); err != nil {
+		return q, err
+	}
+	if q.Until, err = timeQuery(values.Get("until"), "until"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func timeQuery(v, name string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp, got %q", name, v)
+	}
+	return t, nil
+}
+
+// Cursors are opaque to clients: the URL-safe base64 of a JSON HistoryCursor.
+func encodeHistoryCursor(c HistoryCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeHistoryCursor(v string) (HistoryCursor, error) {
+	var c HistoryCursor
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.Timestamp.IsZero() || c.ID == "" {
+		return HistoryCursor{}, errInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// newHistoryServer returns a test server listing the records of storage,
+// with previews of previewBytes.
+func newHistoryServer(t *testing.T, storage Storage, previewBytes int) *Server {
+	t.Helper()
+	cfg := testConfig()
+	cfg.HistoryPreviewBytes = previewBytes
+	s, err := NewServer(cfg, sentiment.Fake{}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	s.SetStorage(storage, DefaultStorageQueueSize)
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+// getHistory serves GET target and decodes the HistoryResponse.
+func getHistory(t *testing.T, h http.Handler, target string) HistoryResponse {
+	t.Helper()
+	w := serve(h, http.MethodGet, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, want 200; body %s", target, w.Code, w.Body)
+	}
+	var resp HistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: decode %s: %v", target, w.Body, err)
+	}
+	return resp
+}
+
+// historyTexts returns the text of each item, which the tests use as
+// names.
+func historyTexts(items []HistoryItem) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Text)
+	}
+	return out
+}
+
+// seedHistory saves records a to g, one a minute from base, with e and f at
+// the same time.
+func seedHistory(t *testing.T, storage *MemoryStorage, base time.Time) {
+	t.Helper()
+	for i, rec := range []struct {
+		sentiment string
+		score     float64
+		minute    int
+	}{
+		{"positive", 0.9, 0},
+		{"negative", -0.8, 1},
+		{"neutral", 0, 2},
+		{"positive", 0.4, 3},
+		{"positive", 0.7, 4},
+		{"negative", -0.2, 4},
+		{"positive", 0.6, 5},
+	} {
+		err := storage.Save(context.Background(), AnalysisRecord{
+			Text:      string(rune('a' + i)),
+			Sentiment: rec.sentiment,
+			Score:     rec.score,
+			Timestamp: base.Add(time.Duration(rec.minute) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHistoryPagination(t *testing.T) {
+	storage := NewMemoryStorage()
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	seedHistory(t, storage, base)
+	h := newHistoryServer(t, storage, DefaultHistoryPreviewBytes).Handler()
+
+	var got []string
+	target := "/v1/history?limit=3"
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("more than 3 pages of 3 for 7 records: %q so far", got)
+		}
+		resp := getHistory(t, h, target)
+		got = append(got, historyTexts(resp.Items)...)
+		if resp.NextCursor == "" {
+			if len(resp.Items) != 1 {
+				t.Errorf("last page %q, want the one record left", historyTexts(resp.Items))
+			}
+			break
+		}
+		if len(resp.Items) != 3 {
+			t.Errorf("page %q with a next cursor, want 3 items", historyTexts(resp.Items))
+		}
+		if pages == 0 {
+			// A record saved meanwhile does not shift the next pages.
+			storage.Save(context.Background(), AnalysisRecord{Text: "new", Timestamp: base.Add(time.Hour)})
+		}
+		target = "/v1/history?limit=3&cursor=" + resp.NextCursor
+	}
+	// Newest first; of e and f, saved at the same time, the later one first.
+	if want := "gfedcba"; strings.Join(got, "") != want {
+		t.Errorf("items %q, want %q", got, want)
+	}
+
+	// A page that is exactly the last one has no next cursor.
+	if resp := getHistory(t, h, "/v1/history?limit=8"); resp.NextCursor != "" || len(resp.Items) != 8 {
+		t.Errorf("8 of 8 records: %d items, next cursor %q, want all and none", len(resp.Items), resp.NextCursor)
+	}
+	// The default limit.
+	if resp := getHistory(t, h, "/v1/history"); len(resp.Items) != 8 || resp.Items[0].Text != "new" {
+		t.Errorf("default limit: items %q, want all 8, newest first", historyTexts(resp.Items))
+	}
+}
+
+func TestHistoryFilters(t *testing.T) {
+	storage := NewMemoryStorage()
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	seedHistory(t, storage, base)
+	h := newHistoryServer(t, storage, DefaultHistoryPreviewBytes).Handler()
+
+	at := func(minute int) string {
+		return url.QueryEscape(base.Add(time.Duration(minute) * time.Minute).Format(time.RFC3339))
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"sentiment=positive", "geda"},
+		{"sentiment=negative", "fb"},
+		{"min_score=0.6", "gea"},
+		{"min_score=-0.2", "gfedca"},
+		{"sentiment=positive&min_score=0.5", "gea"},
+		// since is inclusive, until exclusive.
+		{"since=" + at(1) + "&until=" + at(4), "dcb"},
+		{"since=" + at(4), "gfe"},
+		{"until=" + at(1), "a"},
+		{"sentiment=negative&since=" + at(2), "f"},
+		{"sentiment=neutral&min_score=0.1", ""},
+	}
+	for _, tt := range tests {
+		resp := getHistory(t, h, "/v1/history?"+tt.query)
+		if got := strings.Join(historyTexts(resp.Items), ""); got != tt.want {
+			t.Errorf("%s: items %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	// Filters hold across pages.
+	resp := getHistory(t, h, "/v1/history?sentiment=positive&limit=2")
+	resp = getHistory(t, h, "/v1/history?sentiment=positive&limit=2&cursor="+resp.NextCursor)
+	if got := strings.Join(historyTexts(resp.Items), ""); got != "da" || resp.NextCursor != "" {
+		t.Errorf("second page of positive items %q, next cursor %q, want da and none", got, resp.NextCursor)
+	}
+}
+
+func TestHistoryPreview(t *testing.T) {
+	storage := NewMemoryStorage()
+	text := "Zażółć gęślą jaźń, I love it"
+	storage.Save(context.Background(), AnalysisRecord{Text: text, TextHash: "hash", Sentiment: "positive", Language: "pl", RequestID: "req", Timestamp: time.Now()})
+	// 3 bytes would cut ż in two: the preview stops before it.
+	h := newHistoryServer(t, storage, 3).Handler()
+
+	resp := getHistory(t, h, "/v1/history")
+	if len(resp.Items) != 1 {
+		t.Fatalf("items %+v, want one", resp.Items)
+	}
+	item := resp.Items[0]
+	if item.Text != "Za" {
+		t.Errorf("preview %q, want Za", item.Text)
+	}
+	if item.ID == "" || item.TextHash != "hash" || item.Language != "pl" || item.RequestID != "req" || item.Sentiment != "positive" {
+		t.Errorf("item %+v, want the fields of the record", item)
+	}
+}
+
+func TestHistoryErrors(t *testing.T) {
+	storage := NewMemoryStorage()
+	seedHistory(t, storage, time.Now())
+	h := newHistoryServer(t, storage, DefaultHistoryPreviewBytes).Handler()
+
+	cursor := func(v string) string { return base64.RawURLEncoding.EncodeToString([]byte(v)) }
+	for _, query := range []string{
+		"cursor=not-base64!",
+		"cursor=" + cursor("not JSON"),
+		"cursor=" + cursor(`{"t": "2026-10-01T12:00:00Z"}`),
+		"cursor=" + cursor(`{"id": "1"}`),
+		"limit=0",
+		"limit=201",
+		"limit=ten",
+		"sentiment=happy",
+		"min_score=2",
+		"min_score=high",
+		"since=yesterday",
+		"until=2026-10-01",
+	} {
+		w := serve(h, http.MethodGet, "/v1/history?"+query, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+			continue
+		}
+		if code := errorCode(t, w); code != codeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", query, code, codeInvalidRequest)
+		}
+	}
+
+	// Without storage there is no history.
+	h = newTestServer(t, testConfig()).Handler()
+	if w := serve(h, http.MethodGet, "/v1/history", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without storage: status = %d, want 404", w.Code)
+	}
+}
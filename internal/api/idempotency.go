@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotentReplayHeader  = "Idempotent-Replay"
+	maxIdempotencyKeyLength = 255
+)
+
+// DefaultIdempotencyTTL is how long responses to requests with an
+// Idempotency-Key are kept by default.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyStore keeps the responses of requests made with an
+// Idempotency-Key. As with Cache, failures are treated as misses.
+type IdempotencyStore interface {
+	Get(ctx context.Context, key string) (StoredResponse, bool, error)
+	Set(ctx context.Context, key string, resp StoredResponse) error
+}
+
+// StoredResponse is a response recorded for replay, along with a digest of
+// the request body that produced it.
+type StoredResponse struct {
+	BodyDigest string
+	Status     int
+	Header     http.Header
+	Body       []byte
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps responses in
+// memory for ttl.
+type MemoryIdempotencyStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	resp    StoredResponse
+	expires time.Time
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]idempotencyEntry),
+	}
+}
+
+func (m *MemoryIdempotencyStore) Get(_ context.Context, key string) (StoredResponse, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || !m.now().Before(entry.expires) {
+		return StoredResponse{}, false, nil
+	}
+	return entry.resp, true, nil
+}
+
+func (m *MemoryIdempotencyStore) Set(_ context.Context, key string, resp StoredResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	// Drop expired entries at most once per ttl.
+	if now.Sub(m.lastSweep) >= m.ttl {
+		for k, entry := range m.entries {
+			if !now.Before(entry.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.entries[key] = idempotencyEntry{resp: resp, expires: now.Add(m.ttl)}
+	return nil
+}
+
+// SetIdempotencyStore replaces the store of responses to requests with an
+// Idempotency-Key. A nil store disables Idempotency-Key support.
+func (s *Server) SetIdempotencyStore(store IdempotencyStore) {
+	s.idempotency.store = store
+}
+
+// idempotency coalesces concurrent requests with the same Idempotency-Key.
+type idempotency struct {
+	store IdempotencyStore
+
+	mu      sync.Mutex
+	flights map[string]*idempotencyFlight
+}
+
+type idempotencyFlight struct {
+	done chan struct{}
+	resp StoredResponse
+	ok   bool // whether resp was recorded
+}
+
+// withIdempotency replays the stored response to a POST repeating the
+// Idempotency-Key and body of an earlier one, with Idempotent-Replay: true.
+// Reusing a key with another body is a 409. Requests with the same key that
+// arrive while the first is in flight wait for its response. Responses with
+// a 5xx status are not stored, so those requests may be retried.
+func (s *Server) withIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		// A dry run must not be replayed for the real request.
+		if s.idempotency.store == nil || key == "" || r.Method != http.MethodPost || isDryRun(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, idempotencyKeyHeader+" is too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+		r.Body.Close()
+		if err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		digest := sha256.Sum256(body)
+		bodyDigest := hex.EncodeToString(digest[:])
+		storeKey := idempotencyStoreKey(r, key)
+
+		ctx := r.Context()
+		for {
+			if resp, ok := s.lookupIdempotent(ctx, storeKey); ok {
+				replayIdempotent(w, r, resp, bodyDigest)
+				return
+			}
+
+			im := &s.idempotency
+			im.mu.Lock()
+			if f, ok := im.flights[storeKey]; ok {
+				im.mu.Unlock()
+				select {
+				case <-f.done:
+				case <-ctx.Done():
+					writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "request canceled while waiting for a request with the same "+idempotencyKeyHeader)
+					return
+				}
+				if f.ok {
+					replayIdempotent(w, r, f.resp, bodyDigest)
+					return
+				}
+				// The first request failed; try again as if it never came.
+				continue
+			}
+			f := &idempotencyFlight{done: make(chan struct{})}
+			if im.flights == nil {
+				im.flights = make(map[string]*idempotencyFlight)
+			}
+			im.flights[storeKey] = f
+			im.mu.Unlock()
+
+			rec := &idempotencyRecorder{ResponseWriter: w, before: w.Header().Clone()}
+			func() {
+				defer func() {
+					im.mu.Lock()
+					delete(im.flights, storeKey)
+					im.mu.Unlock()
+					close(f.done)
+				}()
+				next.ServeHTTP(rec, r)
+				if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+					return
+				}
+				f.resp = StoredResponse{BodyDigest: bodyDigest, Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+				f.ok = true
+				if err := s.idempotency.store.Set(ctx, storeKey, f.resp); err != nil {
+					s.log.Warn("failed to store idempotent response",
+						"request_id", RequestIDFromContext(ctx), "error", err.Error())
+				}
+			}()
+			return
+		}
+	})
+}
+
+func (s *Server) lookupIdempotent(ctx context.Context, storeKey string) (StoredResponse, bool) {
+	resp, ok, err := s.idempotency.store.Get(ctx, storeKey)
+	if err != nil {
+		s.log.Warn("idempotency store lookup failed",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+	}
+	return resp, ok
+}
+
+// idempotencyStoreKey scopes key to the caller's API key and the path, so
+// that clients cannot replay each other's responses.
+func idempotencyStoreKey(r *http.Request, key string) string {
+	h := sha256.New()
+	h.Write([]byte(r.Header.Get(apiKeyHeader)))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replayIdempotent(w http.ResponseWriter, r *http.Request, resp StoredResponse, bodyDigest string) {
+	if resp.BodyDigest != bodyDigest {
+		writeError(w, r, http.StatusConflict, codeIdempotencyConflict,
+			idempotencyKeyHeader+" was already used with a different request body")
+		return
+	}
+	h := w.Header()
+	for name, values := range resp.Header {
+		h[name] = slices.Clone(values)
+	}
+	h.Set(idempotentReplayHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// idempotencyRecorder copies the response it passes through. Only the
+// headers the handler set are recorded, not those of outer middleware.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	before http.Header
+
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if r.status == 0 && status >= http.StatusOK {
+		r.status = status
+		r.header = make(http.Header)
+		for name, values := range r.Header() {
+			if !slices.Equal(values, r.before[name]) {
+				r.header[name] = slices.Clone(values)
+			}
+		}
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"google.golang.org/api/idtoken"
+)
+
+// IDTokenValidator validates Google-signed ID tokens. *idtoken.Validator
+// implements it, caching Google's public keys for as long as their
+// Cache-Control header allows and fetching them again once they expire.
+type IDTokenValidator interface {
+	Validate(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+}
+
+// IDTokenConfig configures the authentication of callers with Google-signed
+// ID tokens, such as those Cloud Run services obtain for their service
+// account, sent as Authorization: Bearer.
+type IDTokenConfig struct {
+	Validator IDTokenValidator
+	// Audience is the audience the tokens must be issued for, usually the
+	// URL of the service.
+	Audience string
+	// ServiceAccounts are the emails of the service accounts allowed to call
+	// the protected endpoints; tokens of any other account are rejected with
+	// 403.
+	ServiceAccounts []string
+}
+
+type idTokenAuth struct {
+	cfg IDTokenConfig
+}
+
+// SetIDTokenAuth makes the protected endpoints, and the gRPC API, accept the
+// ID tokens of cfg.ServiceAccounts. With API keys configured as well either
+// is accepted. It must be called before Handler and GRPCServer.
+func (s *Server) SetIDTokenAuth(cfg IDTokenConfig) {
+	s.idTokens = &idTokenAuth{cfg: cfg}
+}
+
+// authenticate returns the email of the service account token was issued
+// to. A token that is not valid for the audience is reported with 401, one
+// of a service account that is not allowed with 403.
+func (a *idTokenAuth) authenticate(ctx context.Context, token string) (email string, status int, err error) {
+	payload, err := a.cfg.Validator.Validate(ctx, token, a.cfg.Audience)
+	if err != nil {
+		return "", http.StatusUnauthorized, err
+	}
+	email, _ = payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); email == "" || !verified {
+		return "", http.StatusUnauthorized, errors.New("token email is missing or not verified")
+	}
+	if !slices.Contains(a.cfg.ServiceAccounts, email) {
+		return "", http.StatusForbidden, fmt.Errorf("service account %s is not allowed", email)
+	}
+	return email, http.StatusOK, nil
+}
+
+// authenticateToken lets r through to next if token is the ID token of an
+// allowed service account, whose email takes the place of the apiKeyID of
+// the request.
+func (s *Server) authenticateToken(w http.ResponseWriter, r *http.Request, token string, next http.HandlerFunc) {
+	email, status, err := s.idTokens.authenticate(r.Context(), token)
+	if err != nil {
+		s.log.Warn("rejected ID token", "request_id", RequestIDFromContext(r.Context()), "error", err.Error())
+		if status == http.StatusForbidden {
+			writeError(w, r, status, codeForbidden, "the service account is not allowed")
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, r, status, codeUnauthorized, "invalid ID token")
+		return
+	}
+	next(w, r.WithContext(context.WithValue(r.Context(), apiKeyIDKey{}, email)))
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// IPFilterConfig restricts the client addresses a group of endpoints accepts.
+// Both lists hold CIDR prefixes, such as 10.0.0.0/8 or 2001:db8::/32, or
+// single addresses. A client in Deny is rejected; otherwise, when Allow is
+// non-empty, only the clients in it are accepted. Clients are identified as
+// the rate limiter identifies them, by their address behind
+// Config.TrustedProxyHops proxies.
+type IPFilterConfig struct {
+	Allow []string
+	Deny  []string
+}
+
+// ipFilter enforces an IPFilterConfig on the endpoints of group, which
+// labels the metrics.
+type ipFilter struct {
+	group       string
+	allow       []netip.Prefix
+	deny        []netip.Prefix
+	trustedHops int
+	metrics     *Metrics
+}
+
+// newIPFilter returns the filter of cfg, or nil when both lists are empty.
+func newIPFilter(group string, cfg IPFilterConfig, trustedHops int, metrics *Metrics) (*ipFilter, error) {
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 {
+		return nil, nil
+	}
+	f := &ipFilter{group: group, trustedHops: trustedHops, metrics: metrics}
+	var err error
+	if f.allow, err = parsePrefixes(cfg.Allow); err != nil {
+		return nil, fmt.Errorf("%s IP allowlist: %w", group, err)
+	}
+	if f.deny, err = parsePrefixes(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("%s IP denylist: %w", group, err)
+	}
+	return f, nil
+}
+
+// parsePrefixes parses CIDR prefixes, taking a bare address as the prefix of
+// that address alone.
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%q is neither a CIDR prefix nor an address", entry)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// allowed reports whether ip may reach the endpoints. An IPv4-mapped IPv6
+// address is matched as the IPv4 address it carries.
+func (f *ipFilter) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter rejects requests from clients that are not allowed with 403. A nil
+// filter lets every request through.
+func (f *ipFilter) filter(next http.HandlerFunc) http.HandlerFunc {
+	if f == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, f.trustedHops)
+		if !f.allowed(ip) {
+			f.metrics.observeBlockedRequest(f.group)
+			writeError(w, r, http.StatusForbidden, codeForbidden, "requests from "+ip+" are not allowed")
+			return
+		}
+		next(w, r)
+	}
+}
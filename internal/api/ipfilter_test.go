@@ -0,0 +1,186 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+func TestIPFilterAllowed(t *testing.T) {
+	f, err := newIPFilter("api", IPFilterConfig{
+		Allow: []string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.7"},
+		Deny:  []string{"10.1.0.0/16", "2001:db8:bad::/48"},
+	}, 0, NewMetrics())
+	if err != nil {
+		t.Fatalf("newIPFilter: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.1", true},
+		{"10.255.255.255", true},
+		{"11.0.0.1", false},
+		// Deny is evaluated first, inside an allowed prefix.
+		{"10.1.2.3", false},
+		{"10.2.0.1", true},
+		// A bare address is a prefix of that address alone.
+		{"192.0.2.7", true},
+		{"192.0.2.8", false},
+		{"2001:db8::1", true},
+		{"2001:db8:1:2::3", true},
+		{"2001:db9::1", false},
+		{"2001:db8:bad::1", false},
+		{"2001:db8:bad:ffff::1", false},
+		{"::1", false},
+		// An IPv4-mapped IPv6 address is matched as IPv4.
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:10.1.0.1", false},
+		{"not an address", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := f.allowed(tt.ip); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilterDenyOnly(t *testing.T) {
+	f, err := newIPFilter("api", IPFilterConfig{Deny: []string{"203.0.113.0/24", "2001:db8::/32"}}, 0, NewMetrics())
+	if err != nil {
+		t.Fatalf("newIPFilter: %v", err)
+	}
+	for ip, want := range map[string]bool{
+		"203.0.113.9":  false,
+		"203.0.114.9":  true,
+		"2001:db8::1":  false,
+		"2001:db9::1":  true,
+		"198.51.100.1": true,
+	} {
+		if got := f.allowed(ip); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestNewIPFilter(t *testing.T) {
+	if f, err := newIPFilter("api", IPFilterConfig{}, 0, NewMetrics()); f != nil || err != nil {
+		t.Errorf("newIPFilter without lists = %v, %v, want no filter", f, err)
+	}
+	for _, cfg := range []IPFilterConfig{
+		{Allow: []string{"10.0.0.0/33"}},
+		{Deny: []string{"example.com"}},
+		{Allow: []string{"2001:db8::/129"}},
+	} {
+		if _, err := newIPFilter("api", cfg, 0, NewMetrics()); err == nil {
+			t.Errorf("newIPFilter(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestIPFilterForwarded(t *testing.T) {
+	tests := []struct {
+		name       string
+		hops       int
+		remoteAddr string
+		xff        []string
+		wantStatus int
+	}{
+		{"direct IPv4", 0, "10.0.0.5:1234", nil, http.StatusOK},
+		{"direct IPv6", 0, "[2001:db8::5]:1234", nil, http.StatusOK},
+		{"direct outside", 0, "198.51.100.1:1234", nil, http.StatusForbidden},
+		// Without a trusted proxy, the header is the client's own claim.
+		{"spoofed without proxy", 0, "198.51.100.1:1234", []string{"10.0.0.5"}, http.StatusForbidden},
+		{"spoofed denied without proxy", 0, "10.0.0.5:1234", []string{"10.1.0.1"}, http.StatusOK},
+		// Behind one proxy, the client is the entry it appended.
+		{"behind proxy", 1, "10.9.9.9:1234", []string{"10.0.0.5"}, http.StatusOK},
+		{"behind proxy IPv6", 1, "10.9.9.9:1234", []string{"2001:db8::5"}, http.StatusOK},
+		{"behind proxy outside", 1, "10.9.9.9:1234", []string{"198.51.100.1"}, http.StatusForbidden},
+		{"behind proxy denied", 1, "10.9.9.9:1234", []string{"10.1.0.1"}, http.StatusForbidden},
+		// Entries left of it were sent by the client and are ignored.
+		{"spoofed behind proxy", 1, "10.9.9.9:1234", []string{"10.0.0.5, 198.51.100.1"}, http.StatusForbidden},
+		{"spoofed header behind proxy", 1, "10.9.9.9:1234", []string{"10.0.0.5", "198.51.100.1"}, http.StatusForbidden},
+		{"spoofed denial behind proxy", 1, "10.9.9.9:1234", []string{"10.1.0.1, 10.0.0.5"}, http.StatusOK},
+		{"behind two proxies", 2, "10.9.9.9:1234", []string{"198.51.100.1, 10.0.0.5, 10.9.9.8"}, http.StatusOK},
+		// Without an entry from the proxy, the peer is the client.
+		{"proxy without header", 1, "198.51.100.1:1234", nil, http.StatusForbidden},
+		{"proxy with invalid entry", 1, "198.51.100.1:1234", []string{"10.0.0.5, unknown"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.TrustedProxyHops = tt.hops
+			cfg.APIIPFilter = IPFilterConfig{Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.1.0.0/16"}}
+			h := newTestServer(t, cfg).Handler()
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(`{"text": "hi"}`))
+			r.Header.Set("Content-Type", "application/json")
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				if code := errorCode(t, w); code != codeForbidden {
+					t.Errorf("code = %q, want %q", code, codeForbidden)
+				}
+			}
+		})
+	}
+}
+
+func TestIPFilterGroups(t *testing.T) {
+	cfg := testConfig()
+	cfg.AdminAPIKeys = []string{"admin-key"}
+	cfg.AdminIPFilter = IPFilterConfig{Allow: []string{"10.0.0.0/8"}}
+	m := NewMetrics()
+	s, err := NewServer(cfg, sentiment.Fake{}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), m)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	request := func(method, target, remoteAddr, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		r.Header.Set(apiKeyHeader, "admin-key")
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request(http.MethodGet, "/stats", "10.0.0.5:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("admin from an allowed client: status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	w := request(http.MethodGet, "/stats", "198.51.100.1:1234", "")
+	if w.Code != http.StatusForbidden || errorCode(t, w) != codeForbidden {
+		t.Errorf("admin from another client: status = %d, body %s, want 403 %s", w.Code, w.Body, codeForbidden)
+	}
+	// The admin filter leaves the API alone.
+	if w := request(http.MethodPost, "/v1/analyze", "198.51.100.1:1234", `{"text": "hi"}`); w.Code != http.StatusOK {
+		t.Errorf("API from a client outside the admin list: status = %d, want 200; body %s", w.Code, w.Body)
+	}
+
+	body := serve(h, http.MethodGet, "/metrics", "").Body.String()
+	if want := `sentiment_api_blocked_requests_total{group="admin"} 1` + "\n"; !strings.Contains(body, want) {
+		t.Errorf("the metrics lack the series\n\t%s", want)
+	}
+	if strings.Contains(body, `blocked_requests_total{group="api"}`) {
+		t.Error("the admin block was counted for the api group")
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sentimentLanguages lists the languages the Natural Language API supports
+// for sentiment analysis, keyed by lower-cased code.
+var sentimentLanguages = map[string]string{
+	"ar":      "ar",
+	"de":      "de",
+	"en":      "en",
+	"es":      "es",
+	"fr":      "fr",
+	"id":      "id",
+	"it":      "it",
+	"ja":      "ja",
+	"ko":      "ko",
+	"nl":      "nl",
+	"pl":      "pl",
+	"pt":      "pt",
+	"th":      "th",
+	"tr":      "tr",
+	"vi":      "vi",
+	"zh":      "zh",
+	"zh-hant": "zh-Hant",
+}
+
+// normalizeLanguage validates a client-supplied language code and returns it
+// in the form the Language API expects. An empty code is returned unchanged so
+// that the API auto-detects the language.
+func normalizeLanguage(code string) (string, error) {
+	if code == "" {
+		return "", nil
+	}
+	canonical, ok := sentimentLanguages[strings.ToLower(code)]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q", code)
+	}
+	return canonical, nil
+}
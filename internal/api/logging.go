@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of the access log.
+const (
+	AccessLogJSON   = "json"
+	AccessLogCommon = "common"
+	AccessLogGCP    = "gcp"
+)
+
+// AccessLogConfig controls the line logged for every request.
+type AccessLogConfig struct {
+	// Format is AccessLogJSON, the default, to log an entry through the
+	// Logger of the server, AccessLogGCP to log it with the httpRequest and
+	// trace fields of Cloud Logging, or AccessLogCommon to write lines in the
+	// Combined Log Format, followed by the duration and the request ID, to
+	// Output.
+	Format string
+	Output io.Writer
+	// ProjectID is the project of the traces AccessLogGCP entries refer to;
+	// without it they refer to none.
+	ProjectID string
+	// Exclude are the paths not logged, such as /livez or /metrics. A path
+	// also matches the same path under /v1.
+	Exclude []string
+}
+
+// Logger is the subset of *slog.Logger used by the server, so that tests can
+// substitute an implementation that records entries.
+type Logger interface {
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// statusRecorder captures the status code written by a handler, which is
+// 200 unless the handler sets another one before writing the body, and the
+// size of the body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	bytes       int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	// Informational responses precede the actual one, and net/http ignores
+	// every call once the header is written.
+	if !rec.wroteHeader && status >= 200 {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Hijack lets WebSocket upgrades through the middleware.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so that
+// streaming handlers can flush through the middleware.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+type accessLog struct {
+	format  string
+	exclude map[string]bool
+	project string
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func newAccessLog(cfg AccessLogConfig) (*accessLog, error) {
+	l := &accessLog{format: cfg.Format, exclude: make(map[string]bool), project: cfg.ProjectID, out: cfg.Output}
+	switch l.format {
+	case "":
+		l.format = AccessLogJSON
+	case AccessLogJSON, AccessLogGCP:
+	case AccessLogCommon:
+		if l.out == nil {
+			return nil, fmt.Errorf("the %s access log format needs an output", AccessLogCommon)
+		}
+	default:
+		return nil, fmt.Errorf("unknown access log format %q: must be %s, %s or %s", cfg.Format, AccessLogJSON, AccessLogGCP, AccessLogCommon)
+	}
+	for _, p := range cfg.Exclude {
+		l.exclude[p] = true
+	}
+	return l, nil
+}
+
+func (l *accessLog) excluded(path string) bool {
+	return l.exclude[path] || l.exclude[strings.TrimPrefix(path, legacyVersion)]
+}
+
+// withLogging emits one access log entry per request.
+func (s *Server) withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.accessLog.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		ip := clientIP(r, s.trustedHops)
+		switch s.accessLog.format {
+		case AccessLogCommon:
+			s.accessLog.writeCommon(r, rec, start, duration, ip)
+			return
+		case AccessLogGCP:
+			s.log.Info("request", s.accessLog.gcpAttrs(r, rec, duration, ip)...)
+			return
+		}
+		attrs := []any{
+			"request_id", RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", duration.Milliseconds(),
+			"client_ip", ip,
+			"user_agent", r.UserAgent(),
+		}
+		if cn := ClientCommonName(r); cn != "" {
+			attrs = append(attrs, "client_cn", cn)
+		}
+		s.log.Info("request", attrs...)
+	})
+}
+
+// writeCommon writes the Combined Log Format line of r, with the duration
+// in milliseconds and the request ID appended.
+func (l *accessLog) writeCommon(r *http.Request, rec *statusRecorder, start time.Time, duration time.Duration, ip string) {
+	size := "-"
+	if rec.bytes > 0 {
+		size = strconv.FormatInt(rec.bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %q %d %s %q %q %d %s\n",
+		ip,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.URL.RequestURI()+" "+r.Proto,
+		rec.status,
+		size,
+		orDash(r.Referer()),
+		orDash(r.UserAgent()),
+		duration.Milliseconds(),
+		RequestIDFromContext(r.Context()),
+	)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, line)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
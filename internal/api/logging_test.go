@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// logEntry is an entry recorded by a recordLogger.
+type logEntry struct {
+	level, msg string
+	attrs      map[string]any
+}
+
+// recordLogger is a Logger recording its entries.
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) record(level, msg string, args []any) {
+	e := logEntry{level: level, msg: msg, attrs: make(map[string]any)}
+	for i := 0; i+1 < len(args); i += 2 {
+		e.attrs[args[i].(string)] = args[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+}
+
+func (l *recordLogger) Info(msg string, args ...any)  { l.record("INFO", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.record("WARN", msg, args) }
+func (l *recordLogger) Error(msg string, args ...any) { l.record("ERROR", msg, args) }
+
+// requests returns the access log entries.
+func (l *recordLogger) requests() []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var entries []logEntry
+	for _, e := range l.entries {
+		if e.msg == "request" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestAccessLog(t *testing.T) {
+	var logs recordLogger
+	s, err := NewServer(testConfig(), sentiment.Fake{}, stubLanguage{}, nil, &logs, NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(`{"text": "I love it"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", "test-agent")
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	id := w.Header().Get(requestIDHeader)
+	if !uuidV7.MatchString(id) {
+		t.Fatalf("X-Request-ID = %q, want a UUIDv7", id)
+	}
+
+	entries := logs.requests()
+	if len(entries) != 1 {
+		t.Fatalf("%d access log entries, want 1", len(entries))
+	}
+	e := entries[0]
+	for name, want := range map[string]any{
+		"request_id": id,
+		"method":     http.MethodPost,
+		"path":       "/v1/analyze",
+		"status":     http.StatusOK,
+		"bytes":      int64(w.Body.Len()),
+		"client_ip":  "192.0.2.1",
+		"user_agent": "test-agent",
+	} {
+		if got := e.attrs[name]; got != want {
+			t.Errorf("%s = %v (%T), want %v (%T)", name, got, got, want, want)
+		}
+	}
+	if ms, ok := e.attrs["duration_ms"].(int64); !ok || ms < 0 {
+		t.Errorf("duration_ms = %v, want a number of milliseconds", e.attrs["duration_ms"])
+	}
+	if e.level != "INFO" {
+		t.Errorf("level = %s, want INFO", e.level)
+	}
+
+	// Errors carry the status and the ID in the log and the body.
+	w = serve(h, http.MethodPost, "/v1/analyze", `{}`)
+	entries = logs.requests()
+	if got := entries[len(entries)-1].attrs["status"]; got != http.StatusBadRequest {
+		t.Errorf("status of the error = %v, want 400", got)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", w.Body, err)
+	}
+	if id := w.Header().Get(requestIDHeader); resp.Error.RequestID != id || entries[len(entries)-1].attrs["request_id"] != id {
+		t.Errorf("error request_id %q, logged %v, want the header %q", resp.Error.RequestID, entries[len(entries)-1].attrs["request_id"], id)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var logs recordLogger
+	s, err := NewServer(testConfig(), sentiment.Fake{}, stubLanguage{}, nil, &logs, NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	tests := []struct {
+		name, id string
+		reused   bool
+	}{
+		{"valid", "trace-42/abc:DEF", true},
+		{"longest", strings.Repeat("a", maxRequestIDBytes), true},
+		{"too long", strings.Repeat("a", maxRequestIDBytes+1), false},
+		{"space", "two words", false},
+		{"control character", "id\x01", false},
+		{"not ASCII", "żółw", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/livez", nil)
+		if tt.id != "" {
+			r.Header.Set(requestIDHeader, tt.id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		got := w.Header().Get(requestIDHeader)
+		if tt.reused && got != tt.id {
+			t.Errorf("%s: X-Request-ID = %q, want %q reused", tt.name, got, tt.id)
+		} else if !tt.reused && !uuidV7.MatchString(got) {
+			t.Errorf("%s: X-Request-ID = %q, want a new UUIDv7", tt.name, got)
+		}
+		entries := logs.requests()
+		if logged := entries[len(entries)-1].attrs["request_id"]; logged != got {
+			t.Errorf("%s: logged request_id %v, want %q", tt.name, logged, got)
+		}
+	}
+
+	seen := make(map[string]bool)
+	prev := ""
+	for range 1000 {
+		id := newRequestID()
+		if seen[id] {
+			t.Fatalf("newRequestID repeated %s", id)
+		}
+		seen[id] = true
+		// The timestamp leads, to the millisecond.
+		if id[:13] < prev {
+			t.Fatalf("newRequestID %s sorts before %s", id, prev)
+		}
+		prev = id[:13]
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	var out bytes.Buffer
+	cfg := testConfig()
+	cfg.AccessLog = AccessLogConfig{Format: AccessLogCommon, Output: &out, Exclude: []string{"/livez"}}
+	var logs recordLogger
+	s, err := NewServer(cfg, sentiment.Fake{}, stubLanguage{}, nil, &logs, NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/analyze?text=great", nil)
+	r.Header.Set(requestIDHeader, "req-1")
+	r.Header.Set("User-Agent", "curl/8")
+	r.RemoteAddr = "192.0.2.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	// Excluded, with the version prefix or not.
+	serve(h, http.MethodGet, "/livez", "")
+	serve(h, http.MethodGet, "/v1/livez", "")
+
+	line := regexp.MustCompile(`^192\.0\.2\.1 - - \[[^]]+\] "GET /v1/analyze\?text=great HTTP/1\.1" 200 \d+ "-" "curl/8" \d+ req-1\n$`)
+	if !line.MatchString(out.String()) {
+		t.Errorf("access log:\n%s\nwant one Combined Log Format line with the duration and request ID", out.String())
+	}
+	if entries := logs.requests(); len(entries) != 0 {
+		t.Errorf("%d entries logged through the Logger in the common format", len(entries))
+	}
+
+	for _, cfg := range []AccessLogConfig{{Format: AccessLogCommon}, {Format: "apache"}} {
+		if _, err := newAccessLog(cfg); err == nil {
+			t.Errorf("newAccessLog(%+v) succeeded", cfg)
+		}
+	}
+}
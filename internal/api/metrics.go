@@ -0,0 +1,281 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "sentiment_api"
+
+// Metrics holds the Prometheus collectors exported on /metrics. They are
+// registered on a dedicated registry rather than the global default one.
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	upstreamDuration *prometheus.HistogramVec
+	upstreamErrors   *prometheus.CounterVec
+	upstreamInFlight prometheus.Gauge
+	upstreamQueued   prometheus.Gauge
+	breakerState     *prometheus.GaugeVec
+	grpcRequests     *prometheus.CounterVec
+	grpcDuration     *prometheus.HistogramVec
+	storageWrites    *prometheus.CounterVec
+	eventExports     *prometheus.CounterVec
+	pubsubMessages   *prometheus.CounterVec
+	cacheLookups     *prometheus.CounterVec
+	analyzedChars    prometheus.Counter
+	buildInfo        *prometheus.GaugeVec
+	errorReports     *prometheus.CounterVec
+	blockedRequests  *prometheus.CounterVec
+	slowRequests     *prometheus.CounterVec
+	httpInFlight     prometheus.Gauge
+	shedRequests     prometheus.Counter
+
+	started time.Time
+	// day is the snapshot of the counters at the start of the current day,
+	// for Stats.
+	dayMu    sync.Mutex
+	day      statsSnapshot
+	dayStart time.Time
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route and status code.",
+		}, []string{"path", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent handling HTTP requests, by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"path"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "language_api_request_duration_seconds",
+			Help:      "Latency of Natural Language API calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "language_api_errors_total",
+			Help:      "Failed Natural Language API calls, by method and gRPC code.",
+		}, []string{"method", "code"}),
+		upstreamInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "language_api_in_flight_calls",
+			Help:      "Natural Language API calls in progress.",
+		}),
+		upstreamQueued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "language_api_queued_calls",
+			Help:      "Natural Language API calls waiting for the concurrency limit.",
+		}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "language_api_circuit_breaker_state",
+			Help:      "State of the Language API circuit breaker: 1 for the current state, 0 for the others.",
+		}, []string{"state"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_requests_total",
+			Help:      "gRPC calls handled, by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Time spent handling gRPC calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		storageWrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "storage_writes_total",
+			Help:      "Analysis records handed to the storage, by result: ok, error, or dropped when the queue was full.",
+		}, []string{"result"}),
+		eventExports: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_exports_total",
+			Help:      "Analysis events handed to the exporter, by result: ok, error once retries are exhausted, or dropped when the buffer was full.",
+		}, []string{"result"}),
+		pubsubMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pubsub_messages_total",
+			Help:      "Pub/Sub messages processed by the worker, by result: ok, invalid, failed, or nacked for redelivery.",
+		}, []string{"result"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_lookups_total",
+			Help:      "Result cache lookups, by result: hit or miss.",
+		}, []string{"result"}),
+		analyzedChars: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "analyzed_characters_total",
+			Help:      "Characters of the texts submitted for analysis.",
+		}),
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "build_info",
+			Help:      "Always 1, labeled with the version, commit and Go version of the running build.",
+		}, []string{"version", "commit", "go_version"}),
+		errorReports: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "error_reports_total",
+			Help:      "Failed requests handed to the error reporter, by result: ok, error, or dropped when over the rate limit or the queue was full.",
+		}, []string{"result"}),
+		blockedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "blocked_requests_total",
+			Help:      "Requests rejected because of the client address, by endpoint group: api or admin.",
+		}, []string{"group"}),
+		slowRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "slow_requests_total",
+			Help:      "HTTP requests that took longer than the slow request threshold, by route.",
+		}, []string{"path"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_in_flight_requests",
+			Help:      "HTTP requests being served under the in-flight limit.",
+		}),
+		shedRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_shed_requests_total",
+			Help:      "HTTP requests rejected with 503 because the in-flight limit was reached.",
+		}),
+		started: time.Now(),
+	}
+	m.ObserveBreakerState(sentiment.StateClosed)
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.upstreamDuration,
+		m.upstreamErrors,
+		m.upstreamInFlight,
+		m.upstreamQueued,
+		m.breakerState,
+		m.grpcRequests,
+		m.grpcDuration,
+		m.storageWrites,
+		m.eventExports,
+		m.pubsubMessages,
+		m.cacheLookups,
+		m.analyzedChars,
+		m.buildInfo,
+		m.errorReports,
+		m.blockedRequests,
+		m.slowRequests,
+		m.httpInFlight,
+		m.shedRequests,
+	)
+	m.startDay(m.started)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveCall records the outcome of a Language API call to method. It
+// implements sentiment.Observer.
+func (m *Metrics) ObserveCall(method string, duration time.Duration, err error) {
+	m.upstreamDuration.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil {
+		m.upstreamErrors.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
+
+// ObserveBreakerState records the current state of the circuit breaker.
+func (m *Metrics) ObserveBreakerState(state sentiment.BreakerState) {
+	for _, st := range sentiment.BreakerStates {
+		v := 0.0
+		if st == state {
+			v = 1
+		}
+		m.breakerState.WithLabelValues(st.String()).Set(v)
+	}
+}
+
+// ObserveLimiter records the number of Language API calls in flight and
+// waiting for a slot. It is meant as the onChange of sentiment.NewLimiter.
+func (m *Metrics) ObserveLimiter(inFlight, queued int) {
+	m.upstreamInFlight.Set(float64(inFlight))
+	m.upstreamQueued.Set(float64(queued))
+}
+
+// observeGRPC records a gRPC call to method, the full method name.
+func (m *Metrics) observeGRPC(method string, duration time.Duration, err error) {
+	m.grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	m.grpcDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+func (m *Metrics) observeStorageWrite(result string) {
+	m.storageWrites.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) observePubSubMessage(result string) {
+	m.pubsubMessages.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) observeBuildInfo(info BuildInfo) {
+	m.buildInfo.Reset()
+	m.buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+}
+
+func (m *Metrics) observeErrorReport(result string) {
+	m.errorReports.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) observeBlockedRequest(group string) {
+	m.blockedRequests.WithLabelValues(group).Inc()
+}
+
+func (m *Metrics) observeSlowRequest(path string) {
+	m.slowRequests.WithLabelValues(path).Inc()
+}
+
+func (m *Metrics) observeShedRequest() {
+	m.shedRequests.Inc()
+}
+
+func (m *Metrics) observeCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) observeEventExport(result string, events int) {
+	m.eventExports.WithLabelValues(result).Add(float64(events))
+}
+
+// withMetrics instruments every request served by next. Requests are labeled
+// with the ServeMux pattern they matched, as recorded by withMatchedRoute.
+func (m *Metrics) withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		path := routePattern(r.Context())
+		m.requests.WithLabelValues(path, strconv.Itoa(rec.status)).Inc()
+		m.requestDuration.WithLabelValues(path).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// fakeLanguageService is a Language API answering AnalyzeSentiment with a
+// positive score, or with InvalidArgument for the text "fail".
+type fakeLanguageService struct {
+	languagepb.UnimplementedLanguageServiceServer
+}
+
+func (fakeLanguageService) AnalyzeSentiment(_ context.Context, req *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	if req.GetDocument().GetContent() == "fail" {
+		return nil, status.Error(codes.InvalidArgument, "unsupported document")
+	}
+	return &languagepb.AnalyzeSentimentResponse{
+		DocumentSentiment: &languagepb.Sentiment{Score: 0.8, Magnitude: 0.8},
+		Language:          "en",
+	}, nil
+}
+
+// newLanguageClient returns a Client of a fakeLanguageService, reporting to
+// m.
+func newLanguageClient(t *testing.T, m *Metrics) *sentiment.Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	languagepb.RegisterLanguageServiceServer(srv, fakeLanguageService{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c := sentiment.NewClient(m, sentiment.RetryPolicy{},
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	s, err := NewServer(testConfig(), newLanguageClient(t, m), stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), m)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	if w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "I love this"}`); w.Code != http.StatusOK {
+		t.Fatalf("analyze: status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "fail"}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("analyze of a rejected text: status = %d, want 500: %s", w.Code, w.Body)
+	}
+	serve(h, http.MethodGet, "/v1/nothing", "")
+
+	w := serve(h, http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics: status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		// Requests by route and status.
+		`sentiment_api_http_requests_total{path="/v1/analyze",status="200"} 1`,
+		`sentiment_api_http_requests_total{path="/v1/analyze",status="500"} 1`,
+		// Unknown paths share one label.
+		`sentiment_api_http_requests_total{path="unmatched",status="404"} 1`,
+		// The latency of the handler, by route.
+		`sentiment_api_http_request_duration_seconds_count{path="/v1/analyze"} 2`,
+		`sentiment_api_http_request_duration_seconds_bucket{path="/v1/analyze",le="+Inf"} 2`,
+		// The latency of the Language API, by method.
+		`sentiment_api_language_api_request_duration_seconds_count{method="AnalyzeSentiment"} 2`,
+		// Its errors, by method and gRPC code.
+		`sentiment_api_language_api_errors_total{code="InvalidArgument",method="AnalyzeSentiment"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("the metrics lack the series\n\t%s", want)
+		}
+	}
+	if strings.Contains(body, `code="OK"`) {
+		t.Error("successful Language API calls are counted as errors")
+	}
+}
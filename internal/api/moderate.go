@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	languagev2pb "cloud.google.com/go/language/apiv2/languagepb"
+)
+
+type ModerateRequest struct {
+	Text string `json:"text"`
+}
+
+type ModerateResponse struct {
+	Categories []Category `json:"categories"`
+}
+
+func (s *Server) moderateHandler(w http.ResponseWriter, r *http.Request) {
+	var threshold float64
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 32)
+		if err != nil || t < 0 || t > 1 {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "threshold must be a number between 0 and 1")
+			return
+		}
+		threshold = t
+	}
+
+	var req ModerateRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if err := s.validateText(req.Text); err != nil {
+		writeTextError(w, r, err)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, err := s.moderate(ctx, req, float32(threshold))
+	if err != nil {
+		s.writeUpstreamError(w, r, err, "moderate text")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// moderate returns the moderation categories whose confidence is at least
+// threshold.
+func (s *Server) moderate(ctx context.Context, req ModerateRequest, threshold float32) (ModerateResponse, error) {
+	s.countAnalyzed(ctx, req.Text)
+	resp, err := s.lang.ModerateText(ctx, &languagev2pb.ModerateTextRequest{
+		Document: &languagev2pb.Document{
+			Source: &languagev2pb.Document_Content{
+				Content: req.Text,
+			},
+			Type: languagev2pb.Document_PLAIN_TEXT,
+		},
+	})
+	if err != nil {
+		return ModerateResponse{}, err
+	}
+
+	out := ModerateResponse{
+		Categories: make([]Category, 0, len(resp.ModerationCategories)),
+	}
+	for _, category := range resp.ModerationCategories {
+		if category.GetConfidence() < threshold {
+			continue
+		}
+		out.Categories = append(out.Categories, Category{
+			Name:       category.GetName(),
+			Confidence: category.GetConfidence(),
+		})
+	}
+
+	return out, nil
+}
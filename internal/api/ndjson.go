@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const ndjsonMediaType = "application/x-ndjson"
+
+// NDJSONItem is one line of an NDJSON batch request.
+type NDJSONItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// NDJSONResult is one line of an NDJSON batch response. Lines that could not
+// be parsed are reported with an empty ID and their line number in Error.
+type NDJSONResult struct {
+	ID string `json:"id" doc:"ID of the input line; empty for lines that could not be parsed"`
+	BatchResult
+}
+
+// ndjsonLine is a line of an NDJSON batch request, or the error it could not
+// be read with.
+type ndjsonLine struct {
+	item NDJSONItem
+	err  string
+}
+
+// analyzeBatchNDJSON serves /analyze/batch for application/x-ndjson bodies.
+// Lines are analyzed as they arrive with at most s.batchWorkers calls in
+// flight and a result line is streamed back as soon as each completes, so
+// results may be out of order. Only the lines in flight are held in memory;
+// the overall body size is not limited, but each line must fit in
+// maxBodyBytes.
+func (s *Server) analyzeBatchNDJSON(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// Keep reading the body after the response has started. HTTP/2, h2c
+	// included, always allows it and reports the call as unsupported.
+	rc.EnableFullDuplex()
+
+	ctx := r.Context()
+	requestID := RequestIDFromContext(ctx)
+	lines := make(chan ndjsonLine)
+	// The body must not be read once the handler returns.
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		defer close(lines)
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, int(s.maxBodyBytes))
+		for n := 1; scanner.Scan(); n++ {
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+
+			var line ndjsonLine
+			if err := s.unmarshalJSON(data, &line.item); err != nil {
+				line = ndjsonLine{err: fmt.Sprintf("line %d: invalid JSON: %v", n, err)}
+			}
+			if !send(ctx, lines, line) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			send(ctx, lines, ndjsonLine{err: "failed to read the request body: " + err.Error()})
+		}
+	}()
+	results := mapUnordered(ctx, s.batchWorkers, lines, func(ctx context.Context, line ndjsonLine) NDJSONResult {
+		if line.err != "" {
+			return NDJSONResult{BatchResult: BatchResult{Status: http.StatusBadRequest, Error: line.err}}
+		}
+		ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+		return NDJSONResult{ID: line.item.ID, BatchResult: s.analyzeBatchItem(ctx, requestID, "id", line.item.ID, line.item.Text)}
+	})
+
+	w.Header().Set("Content-Type", ndjsonMediaType)
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for result := range results {
+		enc.Encode(result)
+		if len(results) == 0 {
+			rc.Flush()
+		}
+	}
+	<-read
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// postNDJSON sends body to /v1/analyze/batch as NDJSON and returns the
+// result lines, by ID.
+func postNDJSON(t *testing.T, h http.Handler, body string) (*httptest.ResponseRecorder, []NDJSONResult) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", ndjsonMediaType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var results []NDJSONResult
+	sc := bufio.NewScanner(bytes.NewReader(w.Body.Bytes()))
+	for sc.Scan() {
+		var res NDJSONResult
+		if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+			t.Fatalf("result line %q: %v", sc.Text(), err)
+		}
+		results = append(results, res)
+	}
+	return w, results
+}
+
+func TestAnalyzeBatchNDJSON(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	body := `{"id": "a", "text": "I love it"}` + "\n" +
+		"\n" +
+		`{"id": "b", "text": "This is awful"}` + "\r\n" +
+		`{"id": "c", "text": ` + "\n" +
+		`{"id": "d", "text": "  "}` + "\n" +
+		`  {"id": "e", "text": "The sky is blue"}  ` // no final newline
+	w, results := postNDJSON(t, h, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ndjsonMediaType {
+		t.Errorf("Content-Type = %q, want %s", ct, ndjsonMediaType)
+	}
+
+	byID := make(map[string]NDJSONResult)
+	for _, res := range results {
+		if _, dup := byID[res.ID]; dup {
+			t.Errorf("two results for ID %q", res.ID)
+		}
+		byID[res.ID] = res
+	}
+	if len(results) != 5 {
+		t.Fatalf("%d result lines, want one per non-blank line:\n%s", len(results), w.Body)
+	}
+	for id, want := range map[string]string{"a": "positive", "b": "negative", "e": "neutral"} {
+		res := byID[id]
+		if res.Status != http.StatusOK || res.SentimentResponse == nil || res.Sentiment != want {
+			t.Errorf("result of %s = %+v, want 200 %s", id, res, want)
+		}
+	}
+	if res := byID["d"]; res.Status != http.StatusBadRequest || res.Error == "" {
+		t.Errorf("result of the empty text = %+v, want 400 with an error", res)
+	}
+	// The line that is not JSON has no ID but its number.
+	if res := byID[""]; res.Status != http.StatusBadRequest || !strings.Contains(res.Error, "line 4") {
+		t.Errorf("result of the invalid line = %+v, want 400 naming line 4", res)
+	}
+}
+
+// streamWriter is a ResponseWriter counting the lines written, safe to read
+// while the handler writes.
+type streamWriter struct {
+	header http.Header
+	lines  atomic.Int64
+	mu     sync.Mutex
+	body   bytes.Buffer
+}
+
+func (w *streamWriter) Header() http.Header { return w.header }
+func (w *streamWriter) WriteHeader(int)     {}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines.Add(int64(bytes.Count(p, []byte("\n"))))
+	return w.body.Write(p)
+}
+
+// TestAnalyzeBatchNDJSONStream streams 10k lines and checks that the server
+// answers them as it reads them, never reading far ahead of the results it
+// wrote, so that memory use does not grow with the size of the batch.
+func TestAnalyzeBatchNDJSONStream(t *testing.T) {
+	const lines = 10_000
+	// Lines the server may read before writing their results: those in the
+	// buffer of the scanner, in the pool, and queued for the response.
+	const maxAhead = 200
+	cfg := testConfig()
+	cfg.BatchConcurrency = 8
+	h := newTestServer(t, cfg).Handler()
+
+	pr, pw := io.Pipe()
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze/batch", pr)
+	r.Header.Set("Content-Type", ndjsonMediaType)
+	w := &streamWriter{header: make(http.Header)}
+
+	var ahead atomic.Int64
+	go func() {
+		defer pw.Close()
+		for i := range lines {
+			ahead.Store(max(ahead.Load(), int64(i)-w.lines.Load()))
+			if _, err := fmt.Fprintf(pw, `{"id": "%d", "text": "I love it"}`+"\n", i); err != nil {
+				return
+			}
+		}
+	}()
+	h.ServeHTTP(w, r)
+
+	if got := w.lines.Load(); got != lines {
+		t.Fatalf("%d result lines, want %d", got, lines)
+	}
+	if got := ahead.Load(); got > maxAhead {
+		t.Errorf("the server read %d lines ahead of its results, want at most %d", got, maxAhead)
+	}
+	seen := make([]bool, lines)
+	sc := bufio.NewScanner(&w.body)
+	for sc.Scan() {
+		var res NDJSONResult
+		if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+			t.Fatalf("result line %q: %v", sc.Text(), err)
+		}
+		var i int
+		if _, err := fmt.Sscan(res.ID, &i); err != nil || i < 0 || i >= lines || seen[i] || res.Status != http.StatusOK {
+			t.Fatalf("unexpected result line %q", sc.Text())
+		}
+		seen[i] = true
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonMediaType = "application/json"
+	xmlMediaType  = "application/xml"
+)
+
+// negotiatedTypes are the response types of negotiated endpoints, the
+// default first.
+var negotiatedTypes = []string{jsonMediaType, xmlMediaType}
+
+type responseTypeKey struct{}
+
+// withNegotiation picks the response type of next from the Accept header
+// among negotiatedTypes, and rejects requests accepting none of them with
+// 406. The choice applies to error responses as well.
+func withNegotiation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		mt := negotiate(r.Header.Values("Accept"), negotiatedTypes)
+		if mt == "" {
+			writeError(w, r, http.StatusNotAcceptable, codeNotAcceptable,
+				"Accept must allow one of "+strings.Join(negotiatedTypes, ", "))
+			return
+		}
+		ctx := context.WithValue(r.Context(), responseTypeKey{}, mt)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// negotiate returns the offer preferred by the Accept header values, or ""
+// if none is acceptable. Without an Accept header the first offer is chosen.
+// Among equally preferred offers the earlier one wins.
+func negotiate(accept []string, offers []string) string {
+	if len(accept) == 0 {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := acceptQuality(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality the Accept header values give to
+// mediaType. The most specific matching range applies.
+func acceptQuality(accept []string, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			var s int
+			switch {
+			case mt == mediaType:
+				s = 2
+			case mt == typ+"/*":
+				s = 1
+			case mt == "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+
+			specificity, q = s, 1
+			if v, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
+
+// responseType returns the response type negotiated for the request, which
+// is JSON for endpoints without negotiation.
+func responseType(r *http.Request) string {
+	if mt, ok := r.Context().Value(responseTypeKey{}).(string); ok {
+		return mt
+	}
+	return jsonMediaType
+}
+
+// writeResponse encodes v with status in the negotiated response type.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v any) {
+	mt := responseType(r)
+	w.Header().Set("Content-Type", mt)
+	w.WriteHeader(status)
+	if mt == xmlMediaType {
+		w.Write([]byte(xml.Header))
+		xml.NewEncoder(w).Encode(v)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   string
+	}{
+		{nil, jsonMediaType},
+		{[]string{"application/json"}, jsonMediaType},
+		{[]string{"application/xml"}, xmlMediaType},
+		{[]string{"*/*"}, jsonMediaType},
+		{[]string{"application/*"}, jsonMediaType},
+		{[]string{"text/html, application/xml;q=0.9, */*;q=0.8"}, xmlMediaType},
+		{[]string{"application/json;q=0.5, application/xml"}, xmlMediaType},
+		// Equally preferred: the default wins.
+		{[]string{"application/xml, application/json"}, jsonMediaType},
+		// Split across several header values.
+		{[]string{"application/json;q=0.1", "application/xml;q=0.2"}, xmlMediaType},
+		// The most specific range applies, even when it is less preferred.
+		{[]string{"application/json;q=0, */*"}, xmlMediaType},
+		{[]string{"text/html"}, ""},
+		{[]string{"application/xml;q=0, application/json;q=0"}, ""},
+		// Invalid ranges and qualities are skipped.
+		{[]string{"not a type, application/xml;q=2"}, xmlMediaType},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept, negotiatedTypes); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeNegotiation(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+	send := func(accept, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	check := func(name string, w *httptest.ResponseRecorder, wantStatus int, wantType string) {
+		t.Helper()
+		if w.Code != wantStatus {
+			t.Errorf("%s: status = %d, want %d; body %s", name, w.Code, wantStatus, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != wantType {
+			t.Errorf("%s: Content-Type = %q, want %s", name, ct, wantType)
+		}
+		if vary := w.Header().Values("Vary"); !strings.Contains(strings.Join(vary, ","), "Accept") {
+			t.Errorf("%s: Vary = %q, want Accept", name, vary)
+		}
+	}
+
+	w := send("", `{"text": "I love it"}`)
+	check("no Accept", w, http.StatusOK, jsonMediaType)
+	var resp SentimentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Sentiment != "positive" {
+		t.Errorf("no Accept: body %s, want a positive JSON response", w.Body)
+	}
+
+	w = send("application/xml", `{"text": "I love it. This is awful."}`)
+	check("XML", w, http.StatusOK, xmlMediaType)
+	if !strings.HasPrefix(w.Body.String(), xml.Header) {
+		t.Errorf("XML: body %q, want an XML declaration first", w.Body)
+	}
+	resp = SentimentResponse{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("XML: decode %s: %v", w.Body, err)
+	}
+	if resp.XMLName.Local != "sentiment_response" || resp.Sentiment != "neutral" || resp.Magnitude == 0 {
+		t.Errorf("XML: response %+v, want a neutral sentiment_response with a magnitude", resp)
+	}
+
+	// Errors are encoded in the negotiated type too.
+	w = send("application/xml", `{"text": ""}`)
+	check("XML error", w, http.StatusBadRequest, xmlMediaType)
+	var e ErrorResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("XML error: decode %s: %v", w.Body, err)
+	}
+	if e.XMLName.Local != "error_response" || e.Error.Code != codeEmptyText || e.Error.RequestID == "" {
+		t.Errorf("XML error: %+v, want an error_response with code %s and a request ID", e, codeEmptyText)
+	}
+
+	w = send("text/html", `{"text": "I love it"}`)
+	check("unsupported", w, http.StatusNotAcceptable, jsonMediaType)
+	if code := errorCode(t, w); code != codeNotAcceptable {
+		t.Errorf("unsupported: code = %q, want %q", code, codeNotAcceptable)
+	}
+	for _, mt := range negotiatedTypes {
+		if !strings.Contains(w.Body.String(), mt) {
+			t.Errorf("unsupported: body %s, want the supported type %s listed", w.Body, mt)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIHandler serves the OpenAPI 3.0 description of s.endpoints, as JSON
+// or, with format=yaml, as YAML.
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		s.writeDoc(w, r, &s.openAPIJSON, "application/json", func() ([]byte, error) {
+			return json.MarshalIndent(openAPISpec(s.endpoints()), "", "\t")
+		})
+	case "yaml":
+		s.writeDoc(w, r, &s.openAPIYAML, "application/yaml", func() ([]byte, error) {
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(openAPISpec(s.endpoints())); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), enc.Close()
+		})
+	default:
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("format must be json or yaml, got %q", format))
+	}
+}
+
+// openAPISpec builds an OpenAPI 3.0 document describing endpoints.
+func openAPISpec(endpoints []endpoint) map[string]any {
+	b := newSchemaBuilder("#/components/schemas/")
+	paths := make(map[string]any)
+	for _, ep := range endpoints {
+		item := make(map[string]any)
+		for _, op := range ep.ops {
+			item[strings.ToLower(op.method)] = b.openAPIOperation(op, ep)
+		}
+		paths[ep.path] = item
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    apiInfo(),
+		"servers": []any{map[string]any{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":         b.definitions,
+			"securitySchemes": map[string]any{"ApiKeyAuth": apiKeyScheme(), "BasicAuth": basicAuthScheme(true), "IDTokenAuth": idTokenScheme(true), "SignatureAuth": signatureScheme()},
+		},
+	}
+}
+
+func (b *schemaBuilder) openAPIOperation(op operation, ep endpoint) map[string]any {
+	out := map[string]any{"summary": op.summary}
+	if op.description != "" {
+		out["description"] = op.description
+	}
+
+	var params []any
+	form := map[string]any{"type": "object", "properties": map[string]any{}}
+	var formRequired []string
+	for _, p := range op.allParams(ep) {
+		if p.in == "formData" {
+			s := p.schema()
+			if p.description != "" {
+				s["description"] = p.description
+			}
+			form["properties"].(map[string]any)[p.name] = s
+			if p.required {
+				formRequired = append(formRequired, p.name)
+			}
+			continue
+		}
+		param := map[string]any{"name": p.name, "in": p.in, "schema": p.schema()}
+		if p.description != "" {
+			param["description"] = p.description
+		}
+		if p.required {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+	if len(formRequired) > 0 {
+		form["required"] = formRequired
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	consumes := op.consumes
+	if len(consumes) == 0 && op.body != nil {
+		consumes = []string{"application/json"}
+	}
+	content := make(map[string]any)
+	for _, mt := range consumes {
+		switch {
+		case mt == "application/json" && op.body != nil:
+			content[mt] = map[string]any{"schema": b.schemaOf(op.body)}
+		case mt == "multipart/form-data":
+			content[mt] = map[string]any{"schema": form}
+		default:
+			content[mt] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+	}
+	if len(content) > 0 {
+		out["requestBody"] = map[string]any{"required": true, "content": content}
+	}
+
+	if ep.protected || ep.admin {
+		out["security"] = ep.security()
+	}
+	// Errors are reported as JSON unless the response type is negotiated.
+	produces, errorTypes := op.responseTypes(ep), []string{"application/json"}
+	if ep.negotiated {
+		errorTypes = negotiatedTypes
+	}
+	responses := op.allResponses(ep)
+	rs := make(map[string]any, len(responses))
+	for _, r := range responses {
+		types := produces
+		if _, isError := r.body.(ErrorResponse); isError {
+			types = errorTypes
+		}
+		rs[strconv.Itoa(r.status)] = b.openAPIResponse(r, types)
+	}
+	out["responses"] = rs
+
+	for _, m := range op.models {
+		b.schemaOf(m)
+	}
+	return out
+}
+
+func (b *schemaBuilder) openAPIResponse(r response, produces []string) map[string]any {
+	out := map[string]any{"description": r.description}
+
+	if r.file || r.body != nil {
+		if len(produces) == 0 {
+			produces = []string{"application/json"}
+		}
+		content := make(map[string]any)
+		for _, mt := range produces {
+			switch {
+			case r.file:
+				content[mt] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+			case mt == jsonMediaType || mt == xmlMediaType:
+				content[mt] = map[string]any{"schema": b.schemaOf(r.body)}
+			default:
+				content[mt] = map[string]any{"schema": map[string]any{"type": "string"}}
+			}
+		}
+		out["content"] = content
+	}
+
+	if len(r.headers) > 0 {
+		hs := make(map[string]any, len(r.headers))
+		for _, h := range r.headers {
+			hs[h.name] = map[string]any{"description": h.description, "schema": map[string]any{"type": "string"}}
+		}
+		out["headers"] = hs
+	}
+	return out
+}
+
+// schema returns the OpenAPI 3 schema of a parameter.
+func (p param) schema() map[string]any {
+	s := map[string]any{"type": p.typ}
+	if p.typ == "file" {
+		s = map[string]any{"type": "string", "format": "binary"}
+	}
+	if len(p.enum) > 0 {
+		s["enum"] = p.enum
+	}
+	if p.def != nil {
+		s["default"] = p.def
+	}
+	if p.maxLength > 0 {
+		s["maxLength"] = p.maxLength
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// The worker pools of the batch endpoints run fn for every item on a fixed
+// number of goroutines. Once ctx is done no further item is started, and fn
+// is expected to return soon. The results channel of a pool is closed only
+// after every one of its goroutines has returned.
+
+// mapOrdered sends the result of fn for every item received from in on the
+// returned channel, in the order of in, with at most workers calls at once.
+// The channel is closed once in is closed and every result is sent, or once
+// ctx is done, in which case the remaining results are dropped.
+func mapOrdered[T, R any](ctx context.Context, workers int, in <-chan T, fn func(context.Context, T) R) <-chan R {
+	type job struct {
+		item   T
+		result chan R
+	}
+	out := make(chan R, workers)
+	// pending holds the result of every job started, in order, so that a
+	// slow item holds back at most workers results behind it.
+	pending := make(chan chan R, workers)
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+	wg.Add(workers + 1)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.result <- fn(ctx, j.item)
+			}
+		}()
+	}
+
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		defer close(jobs)
+		for {
+			item, ok := receive(ctx, in)
+			if !ok {
+				return
+			}
+			j := job{item: item, result: make(chan R, 1)}
+			if !send(ctx, pending, j.result) || !send(ctx, jobs, j) {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		defer wg.Wait()
+		for result := range pending {
+			r, ok := receive(ctx, result)
+			if !ok || !send(ctx, out, r) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// mapUnordered is like mapOrdered but sends each result as soon as it is
+// ready.
+func mapUnordered[T, R any](ctx context.Context, workers int, in <-chan T, fn func(context.Context, T) R) <-chan R {
+	out := make(chan R, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for {
+				item, ok := receive(ctx, in)
+				if !ok || !send(ctx, out, fn(ctx, item)) {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// mapSlice returns the results of fn for items, called with the index of
+// each, in order, with at most workers calls at once. If ctx is done before
+// every item is started, only the results of the items before the first one
+// dropped are returned.
+func mapSlice[T, R any](ctx context.Context, workers int, items []T, fn func(ctx context.Context, i int, item T) R) []R {
+	indices := make(chan int)
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		defer close(indices)
+		for i := range items {
+			if !send(ctx, indices, i) {
+				return
+			}
+		}
+	}()
+
+	results := make([]R, 0, len(items))
+	for r := range mapOrdered(ctx, min(workers, len(items)), indices, func(ctx context.Context, i int) R {
+		return fn(ctx, i, items[i])
+	}) {
+		results = append(results, r)
+	}
+	<-fed
+	return results
+}
+
+// receive returns the next value of ch, or false once ch is closed or ctx is
+// done.
+func receive[T any](ctx context.Context, ch <-chan T) (T, bool) {
+	select {
+	case v, ok := <-ch:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// send sends v on ch and reports whether it did before ctx was done.
+func send[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain fails the package if a test leaves goroutines behind, such as
+// workers of a pool that missed the end of their context.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		// Started on import by the Google Cloud client libraries.
+		goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"),
+		// Left by a stopped Pub/Sub subscriber until its next server check, up
+		// to 10 seconds later.
+		goleak.IgnoreTopFunction("cloud.google.com/go/pubsub/v2.(*messageIterator).streamKeepAliveHandler"),
+	)
+}
+
+func TestMapSlice(t *testing.T) {
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	got := mapSlice(context.Background(), 8, items, func(_ context.Context, i, item int) int {
+		// Later items finish first.
+		time.Sleep(time.Duration(len(items)-i) * time.Microsecond)
+		return item * 2
+	})
+	want := make([]int, len(items))
+	for i := range want {
+		want[i] = i * 2
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("mapSlice = %v, want %v", got, want)
+	}
+}
+
+func TestMapUnordered(t *testing.T) {
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := range 100 {
+			in <- i
+		}
+	}()
+	var got []int
+	for r := range mapUnordered(context.Background(), 8, in, func(_ context.Context, i int) int { return i }) {
+		got = append(got, r)
+	}
+	slices.Sort(got)
+	if len(got) != 100 || got[0] != 0 || got[99] != 99 {
+		t.Errorf("mapUnordered returned %d results, want each of 0 to 99 once", len(got))
+	}
+}
+
+// TestMapOrderedCanceled stops reading the results halfway: every goroutine
+// of the pool must still return once the context is canceled, which TestMain
+// checks.
+func TestMapOrderedCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; ; i++ {
+			if !send(ctx, in, i) {
+				return
+			}
+		}
+	}()
+
+	out := mapOrdered(ctx, 4, in, func(ctx context.Context, i int) int { return i })
+	for i := range 10 {
+		if r := <-out; r != i {
+			t.Fatalf("result %d = %d", i, r)
+		}
+	}
+	cancel()
+	for range out {
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	items := make([]int, 1000)
+	work := func(_ context.Context, _, item int) int { return item * item }
+	for _, workers := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("mapSlice/workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				mapSlice(context.Background(), workers, items, work)
+			}
+		})
+		b.Run(fmt.Sprintf("mapUnordered/workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				in := make(chan int)
+				go func() {
+					defer close(in)
+					for i := range items {
+						in <- i
+					}
+				}()
+				for range mapUnordered(context.Background(), workers, in, func(_ context.Context, i int) int { return i * i }) {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"unicode/utf8"
+
+	"cloud.google.com/go/pubsub/v2"
+)
+
+// DefaultPubSubConcurrency is how many messages a PubSubWorker analyzes at
+// once by default.
+const DefaultPubSubConcurrency = 10
+
+const (
+	// contentTypeAttribute, set to application/json, marks a message whose
+	// payload is a SentimentRequest rather than the text itself.
+	contentTypeAttribute = "content_type"
+	// sourceMessageIDAttribute carries the ID of the analyzed message on its
+	// result.
+	sourceMessageIDAttribute = "source_message_id"
+)
+
+// PubSubConfig holds the settings of a PubSubWorker.
+type PubSubConfig struct {
+	// Concurrency is the number of messages analyzed at once.
+	Concurrency int
+	// OrderingKeys publishes each result with the ordering key of the
+	// message it answers.
+	OrderingKeys bool
+}
+
+// PubSubWorker analyzes the messages of a subscription and publishes a
+// BatchResult for each to a topic. The result carries the attributes of the
+// message along with source_message_id.
+//
+// A message is acked once its result is published. Messages that cannot be
+// analyzed as they are, such as empty texts, get a result with the error and
+// are acked as well; transient failures are nacked for redelivery.
+type PubSubWorker struct {
+	s            *Server
+	sub          *pubsub.Subscriber
+	pub          *pubsub.Publisher
+	orderingKeys bool
+}
+
+// NewPubSubWorker returns a worker receiving from subscription and
+// publishing to topic, both names or IDs in the project of client.
+func (s *Server) NewPubSubWorker(client *pubsub.Client, subscription, topic string, cfg PubSubConfig) *PubSubWorker {
+	sub := client.Subscriber(subscription)
+	sub.ReceiveSettings.MaxOutstandingMessages = cfg.Concurrency
+	pub := client.Publisher(topic)
+	pub.EnableMessageOrdering = cfg.OrderingKeys
+	return &PubSubWorker{s: s, sub: sub, pub: pub, orderingKeys: cfg.OrderingKeys}
+}
+
+// Run processes messages until ctx is done, then waits for the messages in
+// flight and their results to be published.
+func (w *PubSubWorker) Run(ctx context.Context) error {
+	defer w.pub.Stop()
+	return w.sub.Receive(ctx, w.handle)
+}
+
+func (w *PubSubWorker) handle(ctx context.Context, msg *pubsub.Message) {
+	s := w.s
+	// The message ID stands in for a request ID in logs and storage.
+	ctx = contextWithRequestID(ctx, msg.ID)
+
+	var result BatchResult
+	req, err := pubsubRequest(msg)
+	if err == nil {
+		err = s.validateSentimentRequest(&req)
+	}
+	if err != nil {
+		s.metrics.observePubSubMessage("invalid")
+		result.Status = http.StatusBadRequest
+		result.Error = err.Error()
+	} else {
+		actx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+		resp, _, err := s.analyzeCached(actx, req)
+		cancel()
+		switch {
+		case err == nil:
+			s.metrics.observePubSubMessage("ok")
+			result.Status = http.StatusOK
+			result.SentimentResponse = &resp
+		case retryableError(err):
+			s.metrics.observePubSubMessage("nacked")
+			s.log.Warn("failed to analyze message, nacking it",
+				"request_id", msg.ID, "error", err.Error())
+			msg.Nack()
+			return
+		default:
+			s.metrics.observePubSubMessage("failed")
+			s.log.Error("failed to analyze message",
+				"request_id", msg.ID, "error", err.Error())
+			result.Status = upstreamStatus(err)
+			result.Error = "failed to analyze sentiment"
+		}
+	}
+
+	// A result is published even if the worker is stopping meanwhile.
+	pctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.requestTimeout)
+	defer cancel()
+	if err := w.publish(pctx, msg, result); err != nil {
+		s.log.Warn("failed to publish result, nacking the message",
+			"request_id", msg.ID, "error", err.Error())
+		msg.Nack()
+		return
+	}
+	msg.Ack()
+}
+
+func (w *PubSubWorker) publish(ctx context.Context, msg *pubsub.Message, result BatchResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	attrs := maps.Clone(msg.Attributes)
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	delete(attrs, contentTypeAttribute)
+	attrs[sourceMessageIDAttribute] = msg.ID
+
+	out := &pubsub.Message{Data: data, Attributes: attrs}
+	if w.orderingKeys {
+		out.OrderingKey = msg.OrderingKey
+	}
+	if _, err := w.pub.Publish(ctx, out).Get(ctx); err != nil {
+		if out.OrderingKey != "" {
+			// Publishing stops for a key after a failure until resumed.
+			w.pub.ResumePublish(out.OrderingKey)
+		}
+		return err
+	}
+	return nil
+}
+
+// pubsubRequest reads the SentimentRequest of msg: its JSON payload when the
+// content_type attribute is application/json, its text otherwise.
+func pubsubRequest(msg *pubsub.Message) (SentimentRequest, error) {
+	var req SentimentRequest
+	if msg.Attributes[contentTypeAttribute] == "application/json" {
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return req, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+		return req, nil
+	}
+	if !utf8.Valid(msg.Data) {
+		return req, errors.New("payload is not valid UTF-8 text")
+	}
+	text := string(msg.Data)
+	req.Text = &text
+	return req, nil
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/v2/pstest"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	pubsubProject = "projects/test"
+	inputTopic    = pubsubProject + "/topics/texts"
+	outputTopic   = pubsubProject + "/topics/results"
+)
+
+// newPubSubClient returns a client of a fake Pub/Sub server with the topics
+// inputTopic and outputTopic, and a subscription "texts" to the former.
+func newPubSubClient(t *testing.T) (*pstest.Server, *pubsub.Client) {
+	t.Helper()
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+	conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "test", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	for _, topic := range []string{inputTopic, outputTopic} {
+		if _, err := client.TopicAdminClient.CreateTopic(ctx, &pubsubpb.Topic{Name: topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = client.SubscriptionAdminClient.CreateSubscription(ctx, &pubsubpb.Subscription{
+		Name:               pubsubProject + "/subscriptions/texts",
+		Topic:              inputTopic,
+		AckDeadlineSeconds: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+func TestPubSubWorker(t *testing.T) {
+	for _, orderingKeys := range []bool{false, true} {
+		name := "without ordering keys"
+		if orderingKeys {
+			name = "with ordering keys"
+		}
+		t.Run(name, func(t *testing.T) {
+			testPubSubWorker(t, orderingKeys)
+		})
+	}
+}
+
+func testPubSubWorker(t *testing.T, orderingKeys bool) {
+	srv, client := newPubSubClient(t)
+
+	// "flaky" fails with a transient error once, "rejected" for good, which
+	// is answered as /analyze would.
+	var flaky atomic.Int32
+	analyzer := analyzerFunc(func(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+		switch doc.Text {
+		case "flaky":
+			if flaky.Add(1) == 1 {
+				return sentiment.Result{}, status.Error(codes.Unavailable, "try again")
+			}
+		case "rejected":
+			return sentiment.Result{}, status.Error(codes.InvalidArgument, "unsupported document")
+		}
+		return sentiment.Fake{}.Analyze(ctx, doc)
+	})
+	s, err := NewServer(testConfig(), analyzer, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	inputs := map[string]struct {
+		data        string
+		attrs       map[string]string
+		orderingKey string
+		wantStatus  int
+		wantLabel   string
+	}{
+		"text":     {"I love it", map[string]string{"source": "reviews"}, "user-1", http.StatusOK, "positive"},
+		"json":     {`{"text": "This is awful", "language": "en"}`, map[string]string{contentTypeAttribute: "application/json"}, "user-1", http.StatusOK, "negative"},
+		"empty":    {"", nil, "", http.StatusBadRequest, ""},
+		"binary":   {"\xff\xfe", nil, "", http.StatusBadRequest, ""},
+		"bad JSON": {`{"text":`, map[string]string{contentTypeAttribute: "application/json"}, "", http.StatusBadRequest, ""},
+		"rejected": {"rejected", nil, "", http.StatusInternalServerError, ""},
+		"flaky":    {"flaky", nil, "user-2", http.StatusOK, "neutral"},
+	}
+	names := make(map[string]string) // by message ID
+	for name, in := range inputs {
+		names[srv.PublishOrdered(inputTopic, []byte(in.data), in.attrs, in.orderingKey)] = name
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.NewPubSubWorker(client, "texts", "results", PubSubConfig{Concurrency: 4, OrderingKeys: orderingKeys}).Run(ctx)
+	}()
+
+	// Wait for a result per input and every input acked.
+	var results []*pstest.Message
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		results = results[:0]
+		acked := 0
+		for _, m := range srv.Messages() {
+			switch {
+			case m.Topic == outputTopic:
+				results = append(results, m)
+			case m.Acks > 0:
+				acked++
+			}
+		}
+		if len(results) >= len(inputs) && acked == len(inputs) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d results and %d inputs acked, want %d of each", len(results), acked, len(inputs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(results) != len(inputs) {
+		t.Errorf("%d results, want one per input, %d", len(results), len(inputs))
+	}
+	for _, m := range results {
+		id := m.Attributes[sourceMessageIDAttribute]
+		name, ok := names[id]
+		if !ok {
+			t.Errorf("result with source_message_id %q, want one of the inputs", id)
+			continue
+		}
+		in := inputs[name]
+		var result BatchResult
+		if err := json.Unmarshal(m.Data, &result); err != nil {
+			t.Errorf("%s: decode %s: %v", name, m.Data, err)
+			continue
+		}
+		if result.Status != in.wantStatus {
+			t.Errorf("%s: status %d, want %d; result %s", name, result.Status, in.wantStatus, m.Data)
+		}
+		if in.wantLabel != "" && (result.SentimentResponse == nil || result.Sentiment != in.wantLabel) {
+			t.Errorf("%s: result %s, want %s", name, m.Data, in.wantLabel)
+		}
+		if in.wantStatus != http.StatusOK && result.Error == "" {
+			t.Errorf("%s: result %s, want an error", name, m.Data)
+		}
+		// The attributes are passed through, but for content_type.
+		if _, ok := m.Attributes[contentTypeAttribute]; ok {
+			t.Errorf("%s: attributes %v, want content_type left out", name, m.Attributes)
+		}
+		for k, v := range in.attrs {
+			if k != contentTypeAttribute && m.Attributes[k] != v {
+				t.Errorf("%s: attribute %s = %q, want %q", name, k, m.Attributes[k], v)
+			}
+		}
+		wantKey := ""
+		if orderingKeys {
+			wantKey = in.orderingKey
+		}
+		if m.OrderingKey != wantKey {
+			t.Errorf("%s: ordering key %q, want %q", name, m.OrderingKey, wantKey)
+		}
+	}
+
+	// The transient failure was nacked and redelivered.
+	for id, name := range names {
+		m := srv.Message(id)
+		if name == "flaky" && m.Deliveries < 2 {
+			t.Errorf("flaky: %d deliveries, want a redelivery after the nack", m.Deliveries)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	quotaRemainingHeader      = "X-Quota-Remaining"
+	quotaRemainingCharsHeader = "X-Quota-Remaining-Chars"
+)
+
+// QuotaLimits are the daily quotas of an API key. Zero means unlimited.
+type QuotaLimits struct {
+	Requests int64
+	Chars    int64
+}
+
+// QuotaConfig enables usage accounting and quotas per API key.
+type QuotaConfig struct {
+	Counter QuotaCounter
+	// Default applies to the keys without an entry in Keys.
+	Default QuotaLimits
+	// Keys are the quotas of individual keys, by API key ID: the hex of the
+	// first 8 bytes of the SHA-256 of the key.
+	Keys map[string]QuotaLimits
+	// ResetOffset is the time of day, in UTC, at which the usage is reset.
+	ResetOffset time.Duration
+}
+
+// QuotaUsage is what an API key used in a quota period.
+type QuotaUsage struct {
+	Requests int64
+	// Chars is the number of characters submitted for analysis.
+	Chars int64
+}
+
+// QuotaCounter stores the usage of API keys per quota period.
+// MemoryQuotaCounter and RedisQuotaCounter implement it.
+type QuotaCounter interface {
+	// Add adds requests and chars to the usage of key in the period starting
+	// at period and returns the new totals.
+	Add(ctx context.Context, key string, period time.Time, requests, chars int64) (QuotaUsage, error)
+}
+
+// MemoryQuotaCounter is a QuotaCounter for a single instance. It only keeps
+// the latest period.
+type MemoryQuotaCounter struct {
+	mu     sync.Mutex
+	period time.Time
+	usage  map[string]QuotaUsage
+}
+
+func NewMemoryQuotaCounter() *MemoryQuotaCounter {
+	return &MemoryQuotaCounter{usage: make(map[string]QuotaUsage)}
+}
+
+func (c *MemoryQuotaCounter) Add(_ context.Context, key string, period time.Time, requests, chars int64) (QuotaUsage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case period.After(c.period):
+		c.period = period
+		clear(c.usage)
+	case period.Before(c.period):
+		// Late usage of a period that is over.
+		return QuotaUsage{}, nil
+	}
+	u := c.usage[key]
+	u.Requests += requests
+	u.Chars += chars
+	c.usage[key] = u
+	return u, nil
+}
+
+// QuotaStatus is the usage and quotas of an API key in the current period.
+type QuotaStatus struct {
+	APIKeyID      string    `json:"api_key_id"`
+	PeriodStart   time.Time `json:"period_start"`
+	ResetsAt      time.Time `json:"resets_at"`
+	Requests      int64     `json:"requests" doc:"Requests made in the period"`
+	Chars         int64     `json:"chars" doc:"Characters submitted for analysis in the period"`
+	RequestsQuota int64     `json:"requests_quota,omitempty" doc:"Daily request quota; absent when unlimited"`
+	CharsQuota    int64     `json:"chars_quota,omitempty" doc:"Daily character quota; absent when unlimited"`
+}
+
+type quotaChargeKey struct{}
+
+// quotaCharge collects the characters analyzed for a request until they are
+// added to the usage of its API key.
+type quotaCharge struct {
+	q      *quotas
+	key    string
+	period time.Time
+	chars  atomic.Int64
+}
+
+// chargeChars counts the characters of text against the quota of the
+// request of ctx, if any.
+func chargeChars(ctx context.Context, text string) {
+	if c, ok := ctx.Value(quotaChargeKey{}).(*quotaCharge); ok {
+		c.chars.Add(int64(utf8.RuneCountInString(text)))
+	}
+}
+
+// countAnalyzed counts the characters of text as submitted for analysis, in
+// the metrics and against the quota of the request of ctx.
+func (s *Server) countAnalyzed(ctx context.Context, text string) {
+	s.metrics.analyzedChars.Add(float64(utf8.RuneCountInString(text)))
+	noteTextSize(ctx, text)
+	chargeChars(ctx, text)
+}
+
+// flushQuotaCharge adds the characters charged so far through ctx to the
+// usage. Work that outlives its request, such as bucket jobs, calls it once
+// done.
+func flushQuotaCharge(ctx context.Context) {
+	c, ok := ctx.Value(quotaChargeKey{}).(*quotaCharge)
+	if !ok {
+		return
+	}
+	n := c.chars.Swap(0)
+	if n == 0 {
+		return
+	}
+	if _, err := c.q.cfg.Counter.Add(context.WithoutCancel(ctx), c.key, c.period, 0, n); err != nil {
+		c.q.log.Warn("failed to count the characters against the quota",
+			"request_id", RequestIDFromContext(ctx), "chars", n, "error", err.Error())
+	}
+}
+
+// quotas enforces QuotaConfig. A nil *quotas enforces nothing.
+type quotas struct {
+	cfg QuotaConfig
+	log Logger
+	now func() time.Time
+}
+
+// SetQuotas enables usage accounting and quotas. Quotas apply to API keys,
+// so authentication must be enabled. It must be called before serving
+// requests.
+func (s *Server) SetQuotas(cfg QuotaConfig) {
+	s.quotas = &quotas{cfg: cfg, log: s.log, now: time.Now}
+}
+
+func (q *quotas) limits(key string) QuotaLimits {
+	if l, ok := q.cfg.Keys[key]; ok {
+		return l
+	}
+	return q.cfg.Default
+}
+
+// period returns the quota period that now falls in.
+func (q *quotas) period(now time.Time) (start, end time.Time) {
+	t := now.UTC().Add(-q.cfg.ResetOffset)
+	start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(q.cfg.ResetOffset)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// admit counts a request of the API key of ctx. It returns ctx with the
+// quotaCharge of the request attached, the quota status and the error to
+// reject the request with, if the quota is exhausted. A failing counter
+// admits every request. Dry runs are checked against the quota but not
+// counted.
+func (q *quotas) admit(ctx context.Context) (context.Context, QuotaStatus, error) {
+	key := apiKeyIDFromContext(ctx)
+	start, end := q.period(q.now())
+	st := QuotaStatus{APIKeyID: key, PeriodStart: start, ResetsAt: end}
+	requests := int64(1)
+	if isDryRun(ctx) {
+		requests = 0
+	}
+	usage, err := q.cfg.Counter.Add(ctx, key, start, requests, 0)
+	if err != nil {
+		q.log.Warn("failed to count the request against the quota, admitting it",
+			"request_id", RequestIDFromContext(ctx), "error", err.Error())
+		return ctx, st, nil
+	}
+	limits := q.limits(key)
+	st.Requests, st.Chars = usage.Requests, usage.Chars
+	st.RequestsQuota, st.CharsQuota = limits.Requests, limits.Chars
+	switch {
+	case limits.Requests > 0 && usage.Requests > limits.Requests:
+		return ctx, st, fmt.Errorf("daily quota of %d requests exhausted, resets at %s", limits.Requests, end.Format(time.RFC3339))
+	case limits.Chars > 0 && usage.Chars >= limits.Chars:
+		return ctx, st, fmt.Errorf("daily quota of %d characters exhausted, resets at %s", limits.Chars, end.Format(time.RFC3339))
+	}
+	charge := &quotaCharge{q: q, key: key, period: start}
+	return context.WithValue(ctx, quotaChargeKey{}, charge), st, nil
+}
+
+// setHeaders sets the remaining quotas of st with set. Unlimited quotas have
+// no header.
+func (st QuotaStatus) setHeaders(set func(name, value string)) {
+	if st.RequestsQuota > 0 {
+		set(quotaRemainingHeader, strconv.FormatInt(max(0, st.RequestsQuota-st.Requests), 10))
+	}
+	if st.CharsQuota > 0 {
+		set(quotaRemainingCharsHeader, strconv.FormatInt(max(0, st.CharsQuota-st.Chars), 10))
+	}
+}
+
+// enforce counts every request against the quota of its API key, which
+// require must have authenticated, and rejects it with 429 once the quota is
+// exhausted. Every response carries the remaining quota.
+func (q *quotas) enforce(next http.HandlerFunc) http.HandlerFunc {
+	if q == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, st, err := q.admit(r.Context())
+		st.setHeaders(w.Header().Set)
+		if err != nil {
+			setRetryAfter(w, st.ResetsAt.Sub(q.now()))
+			writeError(w, r, http.StatusTooManyRequests, codeQuotaExhausted, err.Error())
+			return
+		}
+		defer flushQuotaCharge(ctx)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// usageHandler serves GET /usage, the quota status of the API key of the
+// request.
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) {
+	if s.quotas == nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "usage accounting is disabled")
+		return
+	}
+	start, end := s.quotas.period(s.quotas.now())
+	key := apiKeyIDFromContext(r.Context())
+	limits := s.quotas.limits(key)
+	usage, err := s.quotas.cfg.Counter.Add(r.Context(), key, start, 0, 0)
+	if err != nil {
+		s.log.Error("failed to read the quota usage",
+			"request_id", RequestIDFromContext(r.Context()), "error", err.Error())
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "the usage could not be read")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QuotaStatus{
+		APIKeyID:      key,
+		PeriodStart:   start,
+		ResetsAt:      end,
+		Requests:      usage.Requests,
+		Chars:         usage.Chars,
+		RequestsQuota: limits.Requests,
+		CharsQuota:    limits.Chars,
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Buckets that have not been used for rateLimitIdleTTL are dropped; the sweep
+// runs at most once per rateLimitSweepInterval.
+const (
+	rateLimitIdleTTL       = 10 * time.Minute
+	rateLimitSweepInterval = time.Minute
+)
+
+// rateLimiter is a per-client token bucket limiter. A zero rate disables it.
+// The rate and burst of a request are those of its settings, which Reload
+// replaces; buckets pick up the new ones on their next request.
+type rateLimiter struct {
+	limits      func(ctx context.Context) rateLimits
+	trustedHops int
+	now         func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type rateLimits struct {
+	rate  rate.Limit
+	burst int
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimitConfig configures per-client rate limiting. A zero RPS disables it.
+type RateLimitConfig struct {
+	// RPS is the sustained number of requests per second allowed per client.
+	RPS float64
+	// Burst is the number of requests a client may make at once. It
+	// defaults to RPS rounded up, and at least 1.
+	Burst int
+}
+
+// newRateLimiter returns a rateLimiter applying the limits returned for the
+// context of each request.
+func newRateLimiter(limits func(ctx context.Context) rateLimits, trustedHops int) *rateLimiter {
+	return &rateLimiter{
+		limits:      limits,
+		trustedHops: trustedHops,
+		now:         time.Now,
+		buckets:     make(map[string]*bucket),
+	}
+}
+
+func newRateLimits(cfg RateLimitConfig) rateLimits {
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = max(1, int(math.Ceil(cfg.RPS)))
+	}
+	return rateLimits{rate: rate.Limit(cfg.RPS), burst: burst}
+}
+
+// reserve takes a token for key under limits and returns how long the caller
+// has to wait before it is available. A zero delay means the request may
+// proceed.
+func (l *rateLimiter) reserve(key string, limits rateLimits) time.Duration {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) >= rateLimitIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(limits.rate, limits.burst)}
+		l.buckets[key] = b
+	} else if b.limiter.Limit() != limits.rate || b.limiter.Burst() != limits.burst {
+		b.limiter.SetLimitAt(now, limits.rate)
+		b.limiter.SetBurstAt(now, limits.burst)
+	}
+	b.lastSeen = now
+
+	res := b.limiter.ReserveN(now, 1)
+	delay := res.DelayFrom(now)
+	if delay > 0 {
+		res.CancelAt(now)
+	}
+	return delay
+}
+
+// limit rejects requests from clients that have exhausted their bucket with
+// 429 and a Retry-After header. Clients are told apart by rateLimitKey.
+func (l *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limits := l.limits(r.Context())
+		if limits.rate <= 0 {
+			next(w, r)
+			return
+		}
+		if delay := l.reserve(rateLimitKey(r, l.trustedHops), limits); delay > 0 {
+			setRetryAfter(w, delay)
+			writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded, retry later")
+			return
+		}
+		next(w, r)
+	}
+}
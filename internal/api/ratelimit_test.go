@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter returns a rateLimiter applying limits on a clock that
+// only moves when told to.
+func newTestRateLimiter(limits *rateLimits) (*rateLimiter, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newRateLimiter(func(context.Context) rateLimits { return *limits }, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiterBucket(t *testing.T) {
+	limits := newRateLimits(RateLimitConfig{RPS: 2, Burst: 3})
+	l, now := newTestRateLimiter(&limits)
+
+	for i := range 3 {
+		if delay := l.reserve("a", limits); delay != 0 {
+			t.Fatalf("request %d of the burst delayed by %s", i+1, delay)
+		}
+	}
+	if delay := l.reserve("a", limits); delay != 500*time.Millisecond {
+		t.Errorf("request beyond the burst: delay %s, want 500ms for the next token", delay)
+	}
+	// A rejected request takes no token.
+	if delay := l.reserve("a", limits); delay != 500*time.Millisecond {
+		t.Errorf("retry right away: delay %s, want 500ms", delay)
+	}
+	if delay := l.reserve("b", limits); delay != 0 {
+		t.Errorf("other client delayed by %s, want its own bucket", delay)
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if delay := l.reserve("a", limits); delay != 0 {
+		t.Errorf("after refill: delay %s, want 0", delay)
+	}
+	if delay := l.reserve("a", limits); delay == 0 {
+		t.Error("second request after a single refill was not delayed")
+	}
+}
+
+func TestRateLimiterNewLimits(t *testing.T) {
+	limits := newRateLimits(RateLimitConfig{RPS: 1})
+	l, _ := newTestRateLimiter(&limits)
+
+	if delay := l.reserve("a", limits); delay != 0 {
+		t.Fatalf("first request delayed by %s", delay)
+	}
+	if delay := l.reserve("a", limits); delay != time.Second {
+		t.Fatalf("second request: delay %s, want 1s", delay)
+	}
+	// A bucket picks up new limits on its next request.
+	limits = newRateLimits(RateLimitConfig{RPS: 10, Burst: 1})
+	if delay := l.reserve("a", limits); delay > 100*time.Millisecond {
+		t.Errorf("after raising the rate: delay %s, want at most 100ms", delay)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limits := newRateLimits(RateLimitConfig{RPS: 1})
+	l, now := newTestRateLimiter(&limits)
+
+	l.reserve("idle", limits)
+	*now = now.Add(rateLimitIdleTTL / 2)
+	l.reserve("active", limits)
+	*now = now.Add(rateLimitIdleTTL / 2)
+	l.reserve("active", limits)
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket kept past rateLimitIdleTTL")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket dropped")
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	limits := newRateLimits(RateLimitConfig{RPS: 1})
+	l, _ := newTestRateLimiter(&limits)
+	h := l.limit(func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/analyze", nil))
+		return w
+	}
+	if w := request(); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", w.Code)
+	}
+	w := request()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if code := errorCode(t, w); code != codeRateLimited {
+		t.Errorf("error code = %q, want %q", code, codeRateLimited)
+	}
+
+	// A zero rate disables the limit.
+	limits = newRateLimits(RateLimitConfig{})
+	for i := range 5 {
+		if w := request(); w.Code != http.StatusOK {
+			t.Fatalf("request %d without a limit: status %d, want 200", i+1, w.Code)
+		}
+	}
+}
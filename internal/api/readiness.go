@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Readiness tracks whether the server should receive traffic. It starts not
+// ready, becomes ready once MarkReady is called and stops being ready for
+// good once MarkDraining is called. It is safe for concurrent use.
+type Readiness struct {
+	mu       sync.Mutex
+	started  bool
+	ready    bool
+	draining bool
+}
+
+// MarkReady reports that startup has completed. The server only becomes
+// ready if draining has not begun.
+func (r *Readiness) MarkReady() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = true
+	if !r.draining {
+		r.ready = true
+	}
+}
+
+// MarkDraining reports that shutdown has begun.
+func (r *Readiness) MarkDraining() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ready = false
+	r.draining = true
+}
+
+// Ready reports whether the server should receive traffic.
+func (r *Readiness) Ready() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ready
+}
+
+// Started reports whether startup has completed, even if the server is
+// draining since.
+func (r *Readiness) Started() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.started
+}
+
+// Readiness returns the component consulted by /startupz and /readyz.
+func (s *Server) Readiness() *Readiness {
+	return &s.readiness
+}
+
+// livezHandler reports 200 as long as the process serves requests.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// readyzHandler reports 200 while the server is ready for traffic and 503
+// during startup and shutdown.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.readiness.Ready() {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "the server is not ready")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// startupzHandler reports 503 until startup has completed and 200 from then
+// on, so that a startup probe does not restart a draining server.
+func (s *Server) startupzHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.readiness.Started() {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "the server is starting up")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
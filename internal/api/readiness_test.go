@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	var r Readiness
+	check := func(step string, started, ready bool) {
+		t.Helper()
+		if r.Started() != started || r.Ready() != ready {
+			t.Errorf("%s: started %t, ready %t, want %t and %t", step, r.Started(), r.Ready(), started, ready)
+		}
+	}
+
+	check("new", false, false)
+	r.MarkReady()
+	check("after MarkReady", true, true)
+	r.MarkReady()
+	check("after MarkReady again", true, true)
+	r.MarkDraining()
+	check("after MarkDraining", true, false)
+	// Draining is for good.
+	r.MarkReady()
+	check("after MarkReady while draining", true, false)
+}
+
+func TestReadinessDrainingBeforeReady(t *testing.T) {
+	var r Readiness
+	r.MarkDraining()
+	r.MarkReady()
+	if r.Ready() {
+		t.Error("ready after MarkReady once draining began")
+	}
+	if !r.Started() {
+		t.Error("not started after MarkReady")
+	}
+}
+
+func TestReadinessConcurrent(t *testing.T) {
+	var r Readiness
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				r.MarkReady()
+				r.Ready()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				r.Started()
+				r.Ready()
+			}
+		}()
+	}
+	r.MarkDraining()
+	wg.Wait()
+	if r.Ready() {
+		t.Error("ready after MarkDraining, whatever the concurrent MarkReady calls")
+	}
+}
+
+func TestProbes(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	h := s.Handler()
+
+	probe := func(step string, livez, startupz, readyz int) {
+		t.Helper()
+		for _, p := range []struct {
+			path string
+			want int
+		}{{"/livez", livez}, {"/startupz", startupz}, {"/readyz", readyz}} {
+			w := serve(h, http.MethodGet, p.path, "")
+			if w.Code != p.want {
+				t.Errorf("%s: %s status = %d, want %d", step, p.path, w.Code, p.want)
+				continue
+			}
+			if w.Code == http.StatusServiceUnavailable {
+				if code := errorCode(t, w); code != codeUnavailable {
+					t.Errorf("%s: %s code = %q, want %q", step, p.path, code, codeUnavailable)
+				}
+			}
+		}
+	}
+
+	probe("starting", http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	s.Readiness().MarkReady()
+	probe("ready", http.StatusOK, http.StatusOK, http.StatusOK)
+	s.Readiness().MarkDraining()
+	probe("draining", http.StatusOK, http.StatusOK, http.StatusServiceUnavailable)
+
+	// The probes are not versioned.
+	if w := serve(h, http.MethodGet, "/v1/readyz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("/v1/readyz: status = %d, want 404", w.Code)
+	}
+}
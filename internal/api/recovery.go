@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// withRecovery turns a panic in next into a logged stack trace and a 500
+// response, so that one faulty handler cannot take down the connection or the
+// process.
+func (s *Server) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			s.log.Error("panic while handling request",
+				"request_id", RequestIDFromContext(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", v,
+				"stack", string(debug.Stack()),
+			)
+			noteFailure(r.Context(), fmt.Sprintf("panic: %v", v), "panic")
+			writeError(w, r, http.StatusInternalServerError, codeInternalError, "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisKeyPrefix namespaces the keys written by RedisCache.
+const DefaultRedisKeyPrefix = "sentiment:"
+
+// RedisCache shares analysis results between instances through Redis. Short
+// timeouts keep an unreachable Redis from holding up requests.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func NewRedisCache(addr, prefix string, ttl time.Duration) *RedisCache {
+	return &RedisCache{
+		client: newRedisClient(addr),
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func newRedisClient(addr string) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:         addr,
+		DialTimeout:  time.Second,
+		ReadTimeout:  500 * time.Millisecond,
+		WriteTimeout: 500 * time.Millisecond,
+	})
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (SentimentResponse, bool, error) {
+	data, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return SentimentResponse{}, false, nil
+	}
+	if err != nil {
+		return SentimentResponse{}, false, err
+	}
+
+	var resp SentimentResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return SentimentResponse{}, false, err
+	}
+	return resp, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, resp SentimentResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.prefix+key, data, c.ttl).Err()
+}
+
+// Ping checks that Redis is reachable. It can be registered as a HealthCheck.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
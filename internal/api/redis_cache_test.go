@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisCache(mr.Addr(), "test:", time.Minute)
+	t.Cleanup(func() { c.Close() })
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "key"); ok || err != nil {
+		t.Fatalf("Get before Set: ok %t, error %v; want a miss", ok, err)
+	}
+	if err := c.Set(ctx, "key", SentimentResponse{Score: 0.5, Sentiment: "positive"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	resp, ok, err := c.Get(ctx, "key")
+	if !ok || err != nil {
+		t.Fatalf("Get after Set: ok %t, error %v; want a hit", ok, err)
+	}
+	if resp.Score != 0.5 || resp.Sentiment != "positive" {
+		t.Errorf("Get = %+v, want the stored response", resp)
+	}
+	if ttl := mr.TTL("test:key"); ttl != time.Minute {
+		t.Errorf("TTL = %s, want 1m", ttl)
+	}
+
+	mr.FastForward(time.Minute)
+	if _, ok, err := c.Get(ctx, "key"); ok || err != nil {
+		t.Errorf("Get after the TTL: ok %t, error %v; want a miss", ok, err)
+	}
+}
+
+// TestAnalyzeRedisCache checks /analyze with a Redis cache: results are
+// cached until the TTL, and an unreachable Redis only costs the cache.
+func TestAnalyzeRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisCache(mr.Addr(), DefaultRedisKeyPrefix, time.Minute)
+	t.Cleanup(func() { c.Close() })
+	s := newTestServer(t, testConfig())
+	s.cache = c
+	h := s.Handler()
+
+	const body = `{"text": "I love it"}`
+	xCache := func(step string) string {
+		t.Helper()
+		w := serve(h, http.MethodPost, "/analyze", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200; body %s", step, w.Code, w.Body)
+		}
+		return w.Header().Get("X-Cache")
+	}
+
+	if got := xCache("first request"); got != "MISS" {
+		t.Errorf("first request: X-Cache = %q, want MISS", got)
+	}
+	if got := xCache("second request"); got != "HIT" {
+		t.Errorf("second request: X-Cache = %q, want HIT", got)
+	}
+	mr.FastForward(time.Minute)
+	if got := xCache("after the TTL"); got != "MISS" {
+		t.Errorf("after the TTL: X-Cache = %q, want MISS", got)
+	}
+
+	mr.Close()
+	if got := xCache("with Redis down"); got != "MISS" {
+		t.Errorf("with Redis down: X-Cache = %q, want MISS", got)
+	}
+}
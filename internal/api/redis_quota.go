@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisQuotaRetention is how long the usage of a period is kept in Redis
+// after it starts.
+const redisQuotaRetention = 48 * time.Hour
+
+// RedisQuotaCounter is a QuotaCounter shared by instances through Redis. The
+// usage of a key in a period is a hash with the fields requests and chars.
+type RedisQuotaCounter struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisQuotaCounter(addr, prefix string) *RedisQuotaCounter {
+	return &RedisQuotaCounter{client: newRedisClient(addr), prefix: prefix}
+}
+
+func (c *RedisQuotaCounter) Add(ctx context.Context, key string, period time.Time, requests, chars int64) (QuotaUsage, error) {
+	k := c.prefix + "quota:" + key + ":" + strconv.FormatInt(period.Unix(), 10)
+	pipe := c.client.TxPipeline()
+	reqs := pipe.HIncrBy(ctx, k, "requests", requests)
+	chs := pipe.HIncrBy(ctx, k, "chars", chars)
+	pipe.ExpireAt(ctx, k, period.Add(redisQuotaRetention))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return QuotaUsage{}, err
+	}
+	return QuotaUsage{Requests: reqs.Val(), Chars: chs.Val()}, nil
+}
+
+// Ping checks that Redis is reachable. It can be registered as a HealthCheck.
+func (c *RedisQuotaCounter) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *RedisQuotaCounter) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ReloadableConfig is the subset of Config a running Server applies with
+// Reload. The other settings take a restart.
+type ReloadableConfig struct {
+	APIKeys              []string
+	DebugAPIKeys         []string
+	AdminAPIKeys         []string
+	RateLimit            RateLimitConfig
+	NeutralBand          float64
+	SlowRequestThreshold time.Duration
+}
+
+// Reloadable returns the subset of cfg that Reload applies.
+func (cfg Config) Reloadable() ReloadableConfig {
+	return ReloadableConfig{
+		APIKeys:              cfg.APIKeys,
+		DebugAPIKeys:         cfg.DebugAPIKeys,
+		AdminAPIKeys:         cfg.AdminAPIKeys,
+		RateLimit:            cfg.RateLimit,
+		NeutralBand:          cfg.NeutralBand,
+		SlowRequestThreshold: cfg.SlowRequestThreshold,
+	}
+}
+
+// settings are the reloadable settings in effect. Reload replaces them as a
+// whole, and every HTTP request keeps the version current when it arrived,
+// so that it never sees part of a reload.
+type settings struct {
+	keys        apiKeys
+	debugKeys   apiKeys
+	adminKeys   apiKeys
+	rateLimit   rateLimits
+	neutralBand float64
+	slowRequest time.Duration
+}
+
+func newSettings(cfg ReloadableConfig) *settings {
+	return &settings{
+		keys:        newAPIKeys(cfg.APIKeys),
+		debugKeys:   newAPIKeys(cfg.DebugAPIKeys),
+		adminKeys:   newAPIKeys(cfg.AdminAPIKeys),
+		rateLimit:   newRateLimits(cfg.RateLimit),
+		neutralBand: cfg.NeutralBand,
+		slowRequest: cmp.Or(cfg.SlowRequestThreshold, DefaultSlowRequestThreshold),
+	}
+}
+
+type settingsKey struct{}
+
+// withSettings attaches the current settings to the request, for
+// settingsFor.
+func (s *Server) withSettings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), settingsKey{}, s.settings.Load())))
+	})
+}
+
+// settingsFor returns the settings of the request of ctx, or the current
+// ones outside of HTTP requests.
+func (s *Server) settingsFor(ctx context.Context) *settings {
+	if st, ok := ctx.Value(settingsKey{}).(*settings); ok {
+		return st
+	}
+	return s.settings.Load()
+}
+
+// Reload applies cfg to the running server. Like SetAPIKeys, it cannot
+// enable or disable API key or admin authentication, which are decided by
+// the settings the server was created with, and then changes nothing.
+func (s *Server) Reload(cfg ReloadableConfig) error {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	if (len(cfg.APIKeys) > 0) != s.settings.Load().keys.enabled() {
+		return errors.New("reloading cannot enable or disable API key authentication")
+	}
+	if (len(cfg.AdminAPIKeys) > 0 || s.adminAuth != nil) != s.adminEnabled() {
+		return errors.New("reloading cannot enable or disable the admin endpoints")
+	}
+	s.settings.Store(newSettings(cfg))
+	return nil
+}
+
+// Reloader reads the configuration again and applies what it can to the
+// server, usually with Reload. It returns the settings that changed but
+// take a restart, which it leaves as they are.
+type Reloader func(ctx context.Context) (rejected []string, err error)
+
+// SetReloader enables POST /admin/reload, which calls reload.
+func (s *Server) SetReloader(reload Reloader) {
+	s.reloader = reload
+}
+
+// ReloadResult is the response of POST /admin/reload.
+type ReloadResult struct {
+	Rejected []string `json:"rejected" doc:"Settings that changed but take a restart, and were left as they are"`
+}
+
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if s.reloader == nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "reloading is not enabled")
+		return
+	}
+	rejected, err := s.reloader(r.Context())
+	if err != nil {
+		s.log.Warn("failed to reload the configuration, keeping the current one",
+			"request_id", RequestIDFromContext(r.Context()), "error", err.Error())
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReloadResult{Rejected: append([]string{}, rejected...)})
+}
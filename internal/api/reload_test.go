@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadRelabelsCachedResults(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	s.cache = NewLRUCache(10, time.Hour)
+	h := s.Handler()
+
+	// The fake analyzer scores this 1/3, with a magnitude of 3.
+	const body = `{"text": "good good bad"}`
+	label := func() string {
+		t.Helper()
+		w := serve(h, http.MethodPost, "/analyze", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+		}
+		var resp SentimentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp.Sentiment
+	}
+
+	if got := label(); got != "positive" {
+		t.Fatalf("sentiment = %q before the reload, want positive", got)
+	}
+	cfg := testConfig()
+	cfg.NeutralBand = 0.5
+	if err := s.Reload(cfg.Reloadable()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := label(); got != "neutral" {
+		t.Errorf("sentiment = %q after widening the neutral band, want neutral", got)
+	}
+}
+
+// TestReloadDuringTraffic is meant for -race: requests must only ever see the
+// settings of one version or the other.
+func TestReloadDuringTraffic(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	s.cache = NewLRUCache(10, time.Hour)
+	h := s.Handler()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := serve(h, http.MethodPost, "/analyze", `{"text": "good good bad"}`)
+				if w.Code != http.StatusOK {
+					t.Errorf("status = %d, want 200; body %s", w.Code, w.Body)
+					return
+				}
+				var resp SentimentResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Errorf("decode response: %v", err)
+					return
+				}
+				if resp.Sentiment != "positive" && resp.Sentiment != "neutral" {
+					t.Errorf("sentiment = %q, want positive or neutral", resp.Sentiment)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range 200 {
+		cfg := testConfig()
+		if i%2 == 0 {
+			cfg.NeutralBand = 0.5
+		}
+		cfg.RateLimit = RateLimitConfig{RPS: float64(1_000_000 + i)}
+		cfg.SlowRequestThreshold = time.Duration(i+1) * time.Second
+		if err := s.Reload(cfg.Reloadable()); err != nil {
+			t.Errorf("Reload: %v", err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
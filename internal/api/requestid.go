@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	requestIDHeader   = "X-Request-ID"
+	maxRequestIDBytes = 128
+)
+
+// requestIDMetadata is the gRPC metadata key the request ID is sent to the
+// Language API and read from gRPC callers under.
+var requestIDMetadata = strings.ToLower(requestIDHeader)
+
+type requestIDKey struct{}
+
+// withRequestID assigns every request an identifier that is echoed in the
+// X-Request-ID response header, quoted in error responses and attached to log
+// entries, error reports and the Language API calls made for the request. A
+// valid X-Request-ID supplied by the caller is reused.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(contextWithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id, supplied by a caller, may be reused: it
+// must be reasonably sized and made of printable ASCII characters other
+// than space, so that it can be logged as is and sent as gRPC metadata.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDBytes {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a UUIDv7, whose leading timestamp makes IDs sort by
+// the time they were issued.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16|uint64(binary.BigEndian.Uint16(b[6:8])))
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// contextWithRequestID returns ctx carrying id, both for RequestIDFromContext
+// and as outgoing gRPC metadata, so that the Language API calls made with ctx
+// carry it to the audit logs of the project.
+func contextWithRequestID(ctx context.Context, id string) context.Context {
+	ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, id)
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to, or ""
+// outside of a request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
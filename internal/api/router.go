@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// router dispatches requests by path, then by method. Unlike a bare
+// ServeMux, it answers unknown paths and methods with an ErrorResponse, the
+// latter with an Allow header. HEAD is routed to the GET handler of a path.
+type router struct {
+	mux   *http.ServeMux
+	paths map[string]methodRoutes
+}
+
+// methodRoutes holds the handlers of one path, by method.
+type methodRoutes map[string]http.Handler
+
+func newRouter() *router {
+	return &router{mux: http.NewServeMux(), paths: make(map[string]methodRoutes)}
+}
+
+// handle routes the requests with method to path, a ServeMux pattern without
+// a method, to h.
+func (rt *router) handle(method, path string, h http.Handler) {
+	routes, ok := rt.paths[path]
+	if !ok {
+		routes = make(methodRoutes)
+		rt.paths[path] = routes
+		rt.mux.Handle(path, routes)
+	}
+	routes[method] = h
+}
+
+// handleEndpoint routes every operation of ep to h.
+func (rt *router) handleEndpoint(ep endpoint, h http.Handler) {
+	for _, op := range ep.ops {
+		rt.handle(op.method, ep.path, h)
+	}
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Unknown paths are not routed to a "/" pattern so that they are labeled
+	// as unmatched in the metrics.
+	_, pattern := rt.mux.Handler(r)
+	if m, ok := r.Context().Value(matchedRouteKey{}).(*matchedRoute); ok {
+		m.pattern = pattern
+	}
+	if pattern == "" {
+		writeNotFound(w, r)
+		return
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+type matchedRouteKey struct{}
+
+// matchedRoute holds the pattern the router matched for a request. The mux
+// records it in r.Pattern, but only of the request it is given: middleware
+// deriving a request with a new context, as most do, does not see it.
+type matchedRoute struct {
+	pattern string
+}
+
+// withMatchedRoute lets the handlers around next read the pattern the
+// router matches with routePattern.
+func withMatchedRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), matchedRouteKey{}, &matchedRoute{})))
+	})
+}
+
+// routePattern returns the pattern the router matched for the request of
+// ctx, once served, or "unmatched". Requests are labeled with it rather than
+// their path to keep label cardinality bounded.
+func routePattern(ctx context.Context) string {
+	if m, ok := ctx.Value(matchedRouteKey{}).(*matchedRoute); ok && m.pattern != "" {
+		return m.pattern
+	}
+	return "unmatched"
+}
+
+func (routes methodRoutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := routes[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		h, ok = routes[http.MethodGet]
+	}
+	if !ok {
+		w.Header().Set("Allow", routes.allow())
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// allow lists the methods of routes for the Allow header.
+func (routes methodRoutes) allow() string {
+	methods := slices.Collect(maps.Keys(routes))
+	if routes[http.MethodGet] != nil && routes[http.MethodHead] == nil {
+		methods = append(methods, http.MethodHead)
+	}
+	slices.Sort(methods)
+	return strings.Join(methods, ", ")
+}
+
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, codeNotFound, "no endpoint at "+r.URL.Path)
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	rt := newRouter()
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	rt.handle(http.MethodGet, "/both", handler("get"))
+	rt.handle(http.MethodPost, "/both", handler("post"))
+	rt.handle(http.MethodPost, "/post", handler("post"))
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantCode   string
+		wantAllow  string
+	}{
+		{"GET", http.MethodGet, "/both", http.StatusOK, "get", "", ""},
+		{"POST", http.MethodPost, "/both", http.StatusOK, "post", "", ""},
+		{"HEAD routed to GET", http.MethodHead, "/both", http.StatusOK, "get", "", ""},
+		{"OPTIONS", http.MethodOptions, "/both", http.StatusMethodNotAllowed, "", codeMethodNotAllowed, "GET, HEAD, POST"},
+		{"other method", http.MethodDelete, "/both", http.StatusMethodNotAllowed, "", codeMethodNotAllowed, "GET, HEAD, POST"},
+		{"HEAD without GET", http.MethodHead, "/post", http.StatusMethodNotAllowed, "", codeMethodNotAllowed, "POST"},
+		{"GET without GET", http.MethodGet, "/post", http.StatusMethodNotAllowed, "", codeMethodNotAllowed, "POST"},
+		{"unknown path", http.MethodGet, "/unknown", http.StatusNotFound, "", codeNotFound, ""},
+		{"unknown subpath", http.MethodPost, "/post/more", http.StatusNotFound, "", codeNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(rt, tt.method, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", allow, tt.wantAllow)
+			}
+			if tt.wantCode == "" {
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+				}
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if code := errorCode(t, w); code != tt.wantCode {
+				t.Errorf("error code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// TestRoutesMethods checks HEAD and OPTIONS on every endpoint of the server:
+// HEAD is served by the GET handler where there is one, and the other
+// methods are rejected with an Allow header listing the documented ones.
+func TestRoutesMethods(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	h := s.Handler()
+
+	for _, ep := range s.endpoints() {
+		var allow []string
+		for _, op := range ep.ops {
+			allow = append(allow, op.method)
+		}
+		hasGet := slices.Contains(allow, http.MethodGet)
+		if hasGet && !slices.Contains(allow, http.MethodHead) {
+			allow = append(allow, http.MethodHead)
+		}
+		slices.Sort(allow)
+		wantAllow := strings.Join(allow, ", ")
+
+		t.Run(ep.path, func(t *testing.T) {
+			w := serve(h, http.MethodHead, ep.path, "")
+			switch {
+			case hasGet && w.Code == http.StatusMethodNotAllowed:
+				t.Errorf("HEAD: status = %d, want the response of GET; body %s", w.Code, w.Body)
+			case !hasGet && w.Code != http.StatusMethodNotAllowed:
+				t.Errorf("HEAD: status = %d, want 405", w.Code)
+			case !hasGet && w.Header().Get("Allow") != wantAllow:
+				t.Errorf("HEAD: Allow = %q, want %q", w.Header().Get("Allow"), wantAllow)
+			}
+
+			w = serve(h, http.MethodOptions, ep.path, "")
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("OPTIONS: status = %d, want 405", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != wantAllow {
+				t.Errorf("OPTIONS: Allow = %q, want %q", allow, wantAllow)
+			}
+			if code := errorCode(t, w); code != codeMethodNotAllowed {
+				t.Errorf("OPTIONS: error code = %q, want %q", code, codeMethodNotAllowed)
+			}
+		})
+	}
+}
+
+// TestLegacyPaths checks that the unprefixed paths of version 1 answer as
+// their /v1 counterparts do, flagged as deprecated.
+func TestLegacyPaths(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	tests := []struct {
+		method, path, body string
+		// ignore lists the fields of the JSON bodies that may differ between
+		// two requests.
+		ignore []string
+	}{
+		{http.MethodPost, "/analyze", `{"text": "I love it. This is awful."}`, nil},
+		{http.MethodGet, "/analyze?text=I+love+it", "", nil},
+		{http.MethodPost, "/analyze/batch", `{"items": [{"text": "I love it"}, {"text": ""}]}`, nil},
+		{http.MethodPost, "/analyze", `{"text": ""}`, nil},
+		{http.MethodGet, "/healthcheck", "", []string{"uptime_seconds"}},
+		{http.MethodGet, "/docs", "", nil},
+		{http.MethodGet, "/docs/openapi.json", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			// The same request ID, for identical error responses.
+			send := func(target string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(tt.method, target, strings.NewReader(tt.body))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set(requestIDHeader, "legacy-test")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				return w
+			}
+			v1, legacy := send("/v1"+tt.path), send(tt.path)
+
+			if legacy.Code != v1.Code {
+				t.Errorf("status = %d, want %d as under /v1", legacy.Code, v1.Code)
+			}
+			if ct := legacy.Header().Get("Content-Type"); ct != v1.Header().Get("Content-Type") {
+				t.Errorf("Content-Type = %q, want %q as under /v1", ct, v1.Header().Get("Content-Type"))
+			}
+			if got, want := jsonWithout(t, legacy.Body.Bytes(), tt.ignore), jsonWithout(t, v1.Body.Bytes(), tt.ignore); got != want {
+				t.Errorf("body = %s, want that of /v1 %s", got, want)
+			}
+
+			if dep := legacy.Header().Get("Deprecation"); dep != legacyDeprecation {
+				t.Errorf("Deprecation = %q, want %q", dep, legacyDeprecation)
+			}
+			path, _, _ := strings.Cut(tt.path, "?")
+			if link := legacy.Header().Get("Link"); link != "</v1"+path+`>; rel="successor-version"` {
+				t.Errorf("Link = %q, want the /v1 path as successor", link)
+			}
+			if dep := v1.Header().Get("Deprecation"); dep != "" {
+				t.Errorf("/v1: Deprecation = %q, want none", dep)
+			}
+		})
+	}
+
+	// Only version 1 has legacy paths, and the unversioned ones have no
+	// prefixed counterpart.
+	for _, target := range []string{"/v2/analyze", "/v1/livez", "/v1/metrics"} {
+		if w := serve(h, http.MethodGet, target, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", target, w.Code)
+		}
+	}
+}
+
+// jsonWithout returns the JSON document b, re-encoded without the top-level
+// fields ignore.
+func jsonWithout(t *testing.T, b []byte, ignore []string) string {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	for _, field := range ignore {
+		delete(doc, field)
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
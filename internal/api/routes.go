@@ -0,0 +1,708 @@
+package api
+
+import "net/http"
+
+// apiVersion is a version of the API: a table of endpoints mounted under a
+// path prefix. Versions are served by the same Server and so share its
+// analyzer, cache and middleware; a new version lists the handlers it
+// changes alongside the ones it keeps.
+type apiVersion struct {
+	prefix    string
+	endpoints []endpoint
+}
+
+// legacyVersion is also served, deprecated, at the unprefixed paths it
+// replaced.
+const legacyVersion = "/v1"
+
+// legacyDeprecation is the Deprecation header value of the unprefixed paths:
+// the date they were deprecated, 2026-10-14, as an RFC 9745 timestamp.
+const legacyDeprecation = "@1791936000"
+
+func (s *Server) apiVersions() []apiVersion {
+	return []apiVersion{
+		{prefix: "/v1", endpoints: s.v1Endpoints()},
+	}
+}
+
+func (s *Server) routes(rt *router) {
+	for _, ep := range s.endpoints() {
+		rt.handleEndpoint(ep, s.endpointHandler(ep))
+	}
+
+	for _, v := range s.apiVersions() {
+		if v.prefix != legacyVersion {
+			continue
+		}
+		for _, ep := range v.endpoints {
+			h := s.endpointHandler(ep)
+			rt.handleEndpoint(ep, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Deprecation", legacyDeprecation)
+				w.Header().Add("Link", "<"+v.prefix+r.URL.Path+`>; rel="successor-version"`)
+				h.ServeHTTP(w, r)
+			}))
+		}
+	}
+}
+
+func (s *Server) endpointHandler(ep endpoint) http.Handler {
+	h := ep.handler
+	if ep.idempotent {
+		h = s.withIdempotency(h)
+	}
+	switch {
+	case ep.protected && ep.unmetered:
+		h = s.apiIPs.filter(s.limiter.limit(s.authenticate(h.ServeHTTP)))
+	case ep.protected:
+		h = s.withDryRun(ep.dryRun, s.protect(h.ServeHTTP))
+	case ep.admin:
+		h = s.requireAdmin(h.ServeHTTP)
+	}
+	if ep.negotiated {
+		h = withNegotiation(h)
+	}
+	return h
+}
+
+// endpoints returns every documented endpoint at the path it is served on:
+// those of each API version under its prefix, then the unversioned ones.
+func (s *Server) endpoints() []endpoint {
+	var out []endpoint
+	for _, v := range s.apiVersions() {
+		for _, ep := range v.endpoints {
+			ep.path = v.prefix + ep.path
+			out = append(out, ep)
+		}
+	}
+	return append(out, s.opsEndpoints()...)
+}
+
+// v1Endpoints lists the endpoints of version 1 of the API along with their
+// documentation.
+func (s *Server) v1Endpoints() []endpoint {
+	jsonMedia := []string{"application/json"}
+
+	return []endpoint{
+		{
+			path:       "/analyze",
+			handler:    http.HandlerFunc(s.analyzeHandler),
+			protected:  true,
+			dryRun:     true,
+			negotiated: true,
+			idempotent: true,
+			ops: []operation{
+				{
+					method:      http.MethodPost,
+					summary:     "Analyze the sentiment of a text",
+					description: "Analyze the sentiment of a text. With Content-Type text/plain the raw body is the text, and the other fields may be passed as query parameters.",
+					consumes:    []string{"application/json", "text/plain"},
+					produces:    jsonMedia,
+					params:      []param{includeMetaParam, debugParam},
+					body:        SentimentRequest{},
+					responses: []response{
+						{status: http.StatusOK, description: "Success", body: SentimentResponse{}, headers: []responseHeader{cacheHeader}},
+						badRequest,
+						debugForbidden,
+						methodNotAllowed,
+						textTooLarge,
+						errorResponse(http.StatusUnsupportedMediaType, "Content-Type is neither application/json nor text/plain"),
+						upstreamFailed,
+						upstreamUnavailable,
+						upstreamTimeout,
+					},
+				},
+				{
+					method:      http.MethodGet,
+					summary:     "Analyze the sentiment of a short text",
+					description: "Same as POST /analyze with the fields passed as query parameters. The text is limited to 2000 bytes; use POST for longer texts.",
+					produces:    jsonMedia,
+					params: []param{
+						{name: "text", in: "query", typ: "string", required: true, maxLength: maxQueryTextBytes},
+						{name: "language", in: "query", typ: "string", description: "ISO-639-1 language code; detected automatically when omitted"},
+						{name: "include_sentences", in: "query", typ: "boolean"},
+						{name: "include_entities", in: "query", typ: "boolean"},
+						{name: "document_type", in: "query", typ: "string", enum: []string{"plain_text", "html"}, def: "plain_text"},
+						{name: "granularity", in: "query", typ: "string", enum: []string{"coarse", "fine"}, def: "coarse"},
+						includeMetaParam,
+						debugParam,
+					},
+					responses: []response{
+						{status: http.StatusOK, description: "Success", body: SentimentResponse{}, headers: []responseHeader{cacheHeader}},
+						badRequest,
+						debugForbidden,
+						errorResponse(http.StatusRequestEntityTooLarge, "Text exceeds the query parameter or configured size limit"),
+						upstreamFailed,
+						upstreamUnavailable,
+						upstreamTimeout,
+					},
+				},
+			},
+		},
+		{
+			path:      "/analyze/batch",
+			handler:   http.HandlerFunc(s.analyzeBatchHandler),
+			protected: true,
+			dryRun:    true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of several texts",
+				description: "Analyze the sentiment of several texts concurrently, given as texts or, with IDs, as items. Results are returned in input order, each with its own status code and error, or by ID when items is an object mapping IDs to texts, followed by the count of those that succeeded and failed; the response is 200 even if some or all of them failed. A JSON batch holds at most the configured number of texts, 1000 by default. With Content-Type application/x-ndjson the body is one NDJSONItem per line and one NDJSONResult line is streamed back per input as soon as it completes, so results may be out of order.",
+				consumes:    []string{"application/json", ndjsonMediaType},
+				produces:    []string{"application/json", ndjsonMediaType},
+				body:        BatchRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success, possibly partial", body: BatchResponse{}},
+					badRequest,
+					methodNotAllowed,
+					bodyTooLarge,
+				},
+				models: []any{BatchItem{}, NDJSONItem{}, NDJSONResult{}},
+			}},
+		},
+		{
+			path:      "/analyze/aggregate",
+			handler:   http.HandlerFunc(s.analyzeAggregateHandler),
+			protected: true,
+			dryRun:    true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Summarize the sentiment of a set of texts",
+				description: "Analyze the sentiment of several texts, as /analyze/batch does, and return only their statistics: the count per label, the mean and median score, a histogram of the scores, the total magnitude and the indexes of the most positive and most negative texts. Texts that fail are listed with their errors and left out of the statistics.",
+				body:        AggregateRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success, possibly partial", body: AggregateResponse{}},
+					badRequest,
+					methodNotAllowed,
+					bodyTooLarge,
+				},
+			}},
+		},
+		{
+			path:      "/analyze/csv",
+			handler:   http.HandlerFunc(s.analyzeCSVHandler),
+			protected: true,
+			dryRun:    true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of every row of a CSV",
+				description: "Upload a CSV with a header row, either as a text/csv body or as the file part of a multipart form. The CSV is streamed back as a download with sentiment, sentiment_score, magnitude and error columns appended to every row, in input order. Rows that cannot be parsed or analyzed are kept, with only the error column set.",
+				consumes:    []string{"text/csv", "multipart/form-data"},
+				produces:    []string{"text/csv"},
+				params: []param{
+					{name: "column", in: "query", typ: "string", def: defaultCSVColumn, description: "Header of the column holding the text to analyze"},
+					{name: fileFormField, in: "formData", typ: "file", description: "The CSV, when uploaded as a multipart form"},
+				},
+				responses: []response{
+					{
+						status:      http.StatusOK,
+						description: "The CSV with the sentiment columns appended",
+						file:        true,
+						headers:     []responseHeader{{"Content-Disposition", "attachment, with a file name derived from the uploaded one"}},
+					},
+					errorResponse(http.StatusBadRequest, "Bad Request: empty CSV, malformed header or missing column"),
+					methodNotAllowed,
+					bodyTooLarge,
+					errorResponse(http.StatusUnsupportedMediaType, "Content-Type is neither text/csv nor multipart/form-data"),
+				},
+			}},
+		},
+		{
+			path:      "/analyze/file",
+			handler:   http.HandlerFunc(s.analyzeFileHandler),
+			protected: true,
+			dryRun:    true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of uploaded text files",
+				description: "Upload one or more UTF-8 text files as multipart/form-data, each in a part named file. A single file gets a single FileResult and failures are reported with the status codes below; several files get an array of FileResult, each carrying its own error.",
+				consumes:    []string{"multipart/form-data"},
+				produces:    jsonMedia,
+				params: []param{
+					{name: fileFormField, in: "formData", typ: "file", required: true},
+				},
+				responses: []response{
+					{status: http.StatusOK, description: "Success: a FileResult for a single file, an array of FileResult for several", body: FileResult{}},
+					badRequest,
+					methodNotAllowed,
+					errorResponse(http.StatusRequestEntityTooLarge, "File, text or request body exceeds the configured size limit"),
+					errorResponse(http.StatusUnsupportedMediaType, "Content-Type is not multipart/form-data"),
+					errorResponse(http.StatusUnprocessableEntity, "The file is not UTF-8 text"),
+					upstreamFailed,
+					upstreamUnavailable,
+					upstreamTimeout,
+				},
+			}},
+		},
+		{
+			path:      "/analyze/entities",
+			handler:   http.HandlerFunc(s.analyzeEntitiesHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of each entity in a text",
+				description: "Detect entities in a text and return the sentiment expressed towards each, with every mention and its offset. Offsets count bytes of UTF-8 by default; encoding utf16 counts UTF-16 code units, as JavaScript strings do, and utf32 code points.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        EntitiesRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: EntitiesResponse{}},
+					badRequest,
+					methodNotAllowed,
+					textTooLarge,
+					upstreamFailed,
+					upstreamTimeout,
+				},
+			}},
+		},
+		{
+			path:      "/analyze/syntax",
+			handler:   http.HandlerFunc(s.analyzeSyntaxHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the syntax of a text",
+				description: "Split a text into tokens with lemma, part-of-speech tag and dependency edge. At most 1000 tokens are returned; longer documents are truncated and flagged as such. Offsets count bytes of UTF-8 by default; encoding utf16 counts UTF-16 code units and utf32 code points.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        SyntaxRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: SyntaxResponse{}},
+					badRequest,
+					methodNotAllowed,
+					textTooLarge,
+					upstreamFailed,
+					upstreamTimeout,
+				},
+			}},
+		},
+		{
+			path:      "/analyze/url",
+			handler:   http.HandlerFunc(s.analyzeURLHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of a web page",
+				description: "Fetch a public http or https URL, extract the text of the page and analyze its sentiment. Pages are fetched with a 10 second timeout, at most 2 MiB is read and the extracted text is truncated to the configured text size limit.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        URLRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: URLResponse{}},
+					errorResponse(http.StatusBadRequest, "Bad Request, or the URL is not allowed: only http and https URLs of public addresses can be fetched"),
+					methodNotAllowed,
+					errorResponse(http.StatusUnprocessableEntity, "The page is not HTML or plain text, or contains no text"),
+					upstreamFailed,
+					errorResponse(http.StatusBadGateway, "The page could not be fetched; the message carries the upstream status"),
+					upstreamUnavailable,
+					upstreamTimeout,
+				},
+			}},
+		},
+		{
+			path:      "/analyze/urls",
+			handler:   http.HandlerFunc(s.analyzeURLsHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of several web pages",
+				description: "Fetch and analyze several URLs as /analyze/url does, a few at once. A URL given more than once is fetched once. The whole request is bounded by the configured deadline, 30 seconds by default: the URLs not analyzed by then fail with 504 while the others keep their results. Every result carries the status code the URL would have been answered with on its own, the status code of the fetch and the redirects followed.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        URLsRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success, possibly partial", body: URLsResponse{}},
+					errorResponse(http.StatusBadRequest, "Bad Request"),
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:      "/analyze/feed",
+			handler:   http.HandlerFunc(s.analyzeFeedHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of the entries of a feed",
+				description: "Fetch a public RSS or Atom feed, under the same restrictions as /analyze/url, and analyze the title and description of each of its first entries, up to the configured maximum, as /analyze/batch does. Returns the result of every entry, each with its own status code and error, and their statistics as /analyze/aggregate does.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        FeedRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success, possibly partial", body: FeedResponse{}},
+					errorResponse(http.StatusBadRequest, "Bad Request, or the URL is not allowed: only http and https URLs of public addresses can be fetched"),
+					methodNotAllowed,
+					errorResponse(http.StatusUnprocessableEntity, "The document is not an RSS or Atom feed, or could not be parsed; the message carries the details"),
+					errorResponse(http.StatusBadGateway, "The feed could not be fetched; the message carries the upstream status"),
+				},
+			}},
+		},
+		{
+			path:      "/analyze/async",
+			handler:   http.HandlerFunc(s.analyzeAsyncHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Analyze the sentiment of a text asynchronously",
+				description: "Queue the analysis of a text and return its job ID right away. Once analyzed, an AsyncResult is POSTed to callback_url with the job ID in X-Job-ID and the HMAC-SHA256 of the body under the callback secret in X-Signature-256, as sha256=<hex>. Callbacks are retried with backoff until they get a 2xx response.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        AsyncRequest{},
+				responses: []response{
+					{status: http.StatusAccepted, description: "Queued", body: AsyncResponse{}},
+					errorResponse(http.StatusBadRequest, "Bad Request, or the callback URL is not an http or https URL"),
+					errorResponse(http.StatusNotFound, "Asynchronous analysis is not enabled"),
+					methodNotAllowed,
+					textTooLarge,
+					errorResponse(http.StatusServiceUnavailable, "The task queue is unavailable"),
+				},
+				models: []any{AsyncResult{}},
+			}},
+		},
+		{
+			path:      "/analyze/gcs",
+			handler:   http.HandlerFunc(s.analyzeGCSHandler),
+			protected: true,
+			ops: []operation{
+				{
+					method:      http.MethodPost,
+					summary:     "Analyze the sentiment of the objects of a bucket",
+					description: "Start a job analyzing the sentiment of every Cloud Storage object of a bucket whose name starts with prefix, and return its status right away. Objects are analyzed concurrently and one GCSObjectResult per analyzed or failed object is written, in completion order, to the results object named by output, as a JSON array or as CSV. Objects that are not UTF-8 text are skipped. Jobs run on the instance that started them and are cancelled when it shuts down.",
+					consumes:    jsonMedia,
+					produces:    jsonMedia,
+					body:        GCSRequest{},
+					responses: []response{
+						{status: http.StatusAccepted, description: "Started", body: GCSJob{}},
+						badRequest,
+						errorResponse(http.StatusForbidden, "The bucket may not be analyzed"),
+						errorResponse(http.StatusNotFound, "Bucket analysis is not enabled"),
+						methodNotAllowed,
+						errorResponse(http.StatusServiceUnavailable, "Too many jobs are running"),
+					},
+					models: []any{GCSObjectResult{}},
+				},
+				{
+					method:      http.MethodGet,
+					summary:     "Get the status of a bucket job",
+					description: "Return the progress of a job started with POST /analyze/gcs by the same API key. Jobs are kept for 24 hours after they finish.",
+					produces:    jsonMedia,
+					params: []param{
+						{name: "job_id", in: "query", typ: "string", required: true},
+					},
+					responses: []response{
+						{status: http.StatusOK, description: "Success", body: GCSJob{}},
+						badRequest,
+						errorResponse(http.StatusNotFound, "No such job, or bucket analysis is not enabled"),
+					},
+				},
+			},
+		},
+		{
+			path:      "/classify",
+			handler:   http.HandlerFunc(s.classifyHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Classify a text into content categories",
+				description: "Classify a text into content categories. The text must contain at least 20 words.",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				body:        ClassifyRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: ClassifyResponse{}},
+					badRequest,
+					methodNotAllowed,
+					textTooLarge,
+					errorResponse(http.StatusUnprocessableEntity, "Text too short to classify"),
+					upstreamFailed,
+					upstreamTimeout,
+				},
+			}},
+		},
+		{
+			path:      "/moderate",
+			handler:   http.HandlerFunc(s.moderateHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Moderate a text",
+				description: "Return the moderation categories (toxic, insult, profanity, ...) detected in a text with their confidence",
+				consumes:    jsonMedia,
+				produces:    jsonMedia,
+				params: []param{
+					{name: "threshold", in: "query", typ: "number", description: "Omit categories whose confidence is below this value (0-1)"},
+				},
+				body: ModerateRequest{},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: ModerateResponse{}},
+					badRequest,
+					methodNotAllowed,
+					textTooLarge,
+					upstreamFailed,
+					upstreamTimeout,
+				},
+			}},
+		},
+		{
+			path:      "/history",
+			handler:   http.HandlerFunc(s.historyHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "List stored analyses",
+				description: "List the stored sentiment analyses, newest first, when storage is enabled. Pages are chained by passing next_cursor back as cursor with the same filters.",
+				produces:    jsonMedia,
+				params: []param{
+					{name: "limit", in: "query", typ: "integer", def: defaultHistoryLimit, description: "Number of items per page, at most 200"},
+					{name: "cursor", in: "query", typ: "string", description: "next_cursor of the previous page"},
+					{name: "sentiment", in: "query", typ: "string", enum: []string{"positive", "negative", "neutral"}},
+					{name: "min_score", in: "query", typ: "number", description: "Omit analyses whose score is below this value (-1 to 1)"},
+					{name: "since", in: "query", typ: "string", description: "Omit analyses made before this RFC 3339 timestamp"},
+					{name: "until", in: "query", typ: "string", description: "Omit analyses made at or after this RFC 3339 timestamp"},
+				},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: HistoryResponse{}},
+					errorResponse(http.StatusBadRequest, "Bad Request: invalid cursor or filter"),
+					errorResponse(http.StatusNotFound, "Storage is not enabled"),
+					methodNotAllowed,
+					errorResponse(http.StatusServiceUnavailable, "The storage could not be read"),
+				},
+			}},
+		},
+		{
+			path:      "/usage",
+			handler:   http.HandlerFunc(s.usageHandler),
+			protected: true,
+			unmetered: true,
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Get the usage and quotas of the API key",
+				description: "Return the requests made and characters submitted for analysis with the API key of the request since the last daily reset, along with its quotas. Usage accounting must be enabled. Requests to this endpoint are not counted.",
+				produces:    jsonMedia,
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: QuotaStatus{}},
+					errorResponse(http.StatusNotFound, "Usage accounting is not enabled"),
+					methodNotAllowed,
+					errorResponse(http.StatusServiceUnavailable, "The usage could not be read"),
+				},
+			}},
+		},
+		{
+			path:      "/ws",
+			handler:   http.HandlerFunc(s.wsHandler),
+			protected: true,
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Analyze sentiment over a WebSocket",
+				description: "Upgrades to a WebSocket. The client sends WSMessage JSON frames and receives a WSResult frame for each, in completion order; up to 8 messages per connection are analyzed concurrently. The server pings every 30 seconds and closes the connection with status 1001 when shutting down.",
+				responses: []response{
+					{status: http.StatusSwitchingProtocols, description: "Switching Protocols"},
+					{status: http.StatusBadRequest, description: "Not a valid WebSocket upgrade request"},
+					{status: http.StatusForbidden, description: "Origin not allowed"},
+				},
+				models: []any{WSMessage{}, WSResult{}},
+			}},
+		},
+		{
+			path:    "/healthcheck",
+			handler: http.HandlerFunc(s.healthcheckHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Healthcheck",
+				description: "Healthcheck. Reports the uptime and the status of the Language API and other dependencies, which are probed at most every 30 seconds. The status is degraded when an optional dependency fails, and unavailable when a required one does. With plain=true nothing is probed and the body is empty.",
+				produces:    jsonMedia,
+				params: []param{
+					{name: "plain", in: "query", typ: "boolean", description: "Only report that the process serves requests, with an empty body"},
+				},
+				responses: []response{
+					{status: http.StatusOK, description: "Success; every required dependency is healthy, and the body is empty with plain=true", body: HealthReport{}},
+					{status: http.StatusServiceUnavailable, description: "A required dependency is unhealthy", body: HealthReport{}},
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/docs",
+			handler: http.HandlerFunc(s.docsHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "API documentation",
+				description: "This Swagger 2.0 document",
+				produces:    jsonMedia,
+				responses: []response{
+					{status: http.StatusOK, description: "Success"},
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/docs/openapi.json",
+			handler: http.HandlerFunc(s.openAPIHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "OpenAPI 3.0 documentation",
+				description: "The OpenAPI 3.0 counterpart of /docs, built from the same description of the endpoints",
+				produces:    []string{"application/json", "application/yaml"},
+				params: []param{
+					{name: "format", in: "query", typ: "string", enum: []string{"json", "yaml"}, def: "json"},
+				},
+				responses: []response{
+					{status: http.StatusOK, description: "Success"},
+					errorResponse(http.StatusBadRequest, "Unknown format"),
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/docs/ui",
+			handler: http.HandlerFunc(docsUIRedirectHandler),
+			ops: []operation{{
+				method:  http.MethodGet,
+				summary: "Redirect to the Swagger UI",
+				responses: []response{
+					{status: http.StatusMovedPermanently, description: "Redirect to /docs/ui/"},
+				},
+			}},
+		},
+		{
+			path:    swaggerUIPath,
+			handler: http.HandlerFunc(docsUIHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Interactive API documentation",
+				description: "Swagger UI for /docs, with requests sent to the same host and path prefix the page is served from",
+				produces:    []string{"text/html"},
+				responses: []response{
+					{status: http.StatusOK, description: "The Swagger UI page or one of its assets"},
+					errorResponse(http.StatusNotFound, "No such asset"),
+					methodNotAllowed,
+				},
+			}},
+		},
+	}
+}
+
+// opsEndpoints lists the endpoints meant for the platform rather than API
+// clients. They are not versioned.
+func (s *Server) opsEndpoints() []endpoint {
+	return []endpoint{
+		{
+			path:    "/livez",
+			handler: http.HandlerFunc(livezHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Liveness probe",
+				description: "Returns 200 as long as the process is running",
+				responses: []response{
+					{status: http.StatusOK, description: "Alive"},
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/startupz",
+			handler: http.HandlerFunc(s.startupzHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Startup probe",
+				description: "Returns 503 until the Language API client is initialized and 200 from then on, including during graceful shutdown",
+				produces:    []string{"application/json"},
+				responses: []response{
+					{status: http.StatusOK, description: "Started"},
+					errorResponse(http.StatusServiceUnavailable, "Starting up"),
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/readyz",
+			handler: http.HandlerFunc(s.readyzHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Readiness probe",
+				description: "Returns 200 once the Language API client is initialized, and 503 again once graceful shutdown begins",
+				produces:    []string{"application/json"},
+				responses: []response{
+					{status: http.StatusOK, description: "Ready to receive traffic"},
+					errorResponse(http.StatusServiceUnavailable, "Starting up or shutting down"),
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/version",
+			handler: http.HandlerFunc(s.versionHandler),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Build information",
+				description: "The version, commit and build time of the running binary",
+				produces:    []string{"application/json"},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: BuildInfo{}},
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/tasks/analyze",
+			handler: http.HandlerFunc(s.taskHandler),
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Run an asynchronous analysis",
+				description: "Invoked by Cloud Tasks, with an OIDC token, for each job queued by /analyze/async. Any other status than 2xx makes the queue retry the task.",
+				consumes:    []string{"application/json"},
+				body:        AnalysisTask{},
+				responses: []response{
+					{status: http.StatusNoContent, description: "Done, or dropped because it can never succeed"},
+					errorResponse(http.StatusForbidden, "Not invoked by the task queue"),
+					methodNotAllowed,
+					errorResponse(http.StatusBadGateway, "The callback failed"),
+					errorResponse(http.StatusServiceUnavailable, "The analysis failed transiently"),
+				},
+			}},
+		},
+		{
+			path:    "/stats",
+			handler: http.HandlerFunc(s.statsHandler),
+			admin:   true,
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Usage statistics",
+				description: "Aggregate counters of the HTTP API since the process started and for the current day, read from the same counters as /metrics. Requires a key in ADMIN_API_KEYS or the ADMIN_USERNAME credentials.",
+				produces:    []string{"application/json"},
+				responses: []response{
+					{status: http.StatusOK, description: "Success", body: Stats{}},
+					methodNotAllowed,
+				},
+			}},
+		},
+		{
+			path:    "/admin/reload",
+			handler: http.HandlerFunc(s.reloadHandler),
+			admin:   true,
+			ops: []operation{{
+				method:      http.MethodPost,
+				summary:     "Reload the configuration",
+				description: "Reads the configuration file and the environment again, as on SIGHUP, and applies the API keys, rate limits, thresholds and log level. Changes to the other settings take a restart and are listed in rejected. Requires a key in ADMIN_API_KEYS or the ADMIN_USERNAME credentials.",
+				produces:    []string{"application/json"},
+				responses: []response{
+					{status: http.StatusOK, description: "Reloaded", body: ReloadResult{}},
+					methodNotAllowed,
+					errorResponse(http.StatusUnprocessableEntity, "The new configuration is invalid; the current one is kept"),
+				},
+			}},
+		},
+		{
+			path:    "/metrics",
+			handler: s.metrics.Handler(),
+			ops: []operation{{
+				method:      http.MethodGet,
+				summary:     "Prometheus metrics",
+				description: "Metrics in the Prometheus text exposition format",
+				produces:    []string{"text/plain"},
+				responses: []response{
+					{status: http.StatusOK, description: "Success"},
+				},
+			}},
+		},
+	}
+}
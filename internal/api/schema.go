@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaBuilder derives JSON schemas from the Go types of request and
+// response bodies. Named struct types are collected in definitions and
+// referenced with $ref, under refPrefix: #/definitions/ in Swagger 2.0,
+// #/components/schemas/ in OpenAPI 3.
+type schemaBuilder struct {
+	refPrefix   string
+	definitions map[string]any
+}
+
+func newSchemaBuilder(refPrefix string) *schemaBuilder {
+	return &schemaBuilder{refPrefix: refPrefix, definitions: make(map[string]any)}
+}
+
+// schemaOf returns the schema of the JSON encoding of v's type.
+func (b *schemaBuilder) schemaOf(v any) map[string]any {
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[json.RawMessage]():
+		// Any JSON value.
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.definitions[t.Name()]; !ok {
+			// Reserve the name first so that recursive types terminate.
+			b.definitions[t.Name()] = nil
+			b.definitions[t.Name()] = b.object(t)
+		}
+		return map[string]any{"$ref": b.refPrefix + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object describes a struct the way encoding/json encodes it, with the fields
+// of embedded structs promoted. The doc, enum, format and default field tags
+// add the matching schema keywords and required:"true" marks a field as
+// required.
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	var required []string
+	b.fields(t, props, &required)
+
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := b.schema(f.Type)
+		if doc := f.Tag.Get("doc"); doc != "" {
+			if _, ok := s["$ref"]; ok {
+				// Keywords next to $ref are ignored.
+				s = map[string]any{"allOf": []any{s}}
+			}
+			s["description"] = doc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			s["enum"] = strings.Split(enum, ",")
+		}
+		if format := f.Tag.Get("format"); format != "" {
+			s["format"] = format
+		}
+		if def := f.Tag.Get("default"); def != "" {
+			s["default"] = def
+		}
+		props[name] = s
+		if f.Tag.Get("required") == "true" {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SecurityHeadersConfig holds the values of the security headers set on
+// every response. An empty value leaves its header out.
+type SecurityHeadersConfig struct {
+	// FrameOptions is the X-Frame-Options header.
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header.
+	ReferrerPolicy string
+	// DocsCSP is the Content-Security-Policy header of the Swagger UI
+	// pages. The other responses are not meant to be rendered and get
+	// none.
+	DocsCSP string
+	// HSTS is the Strict-Transport-Security header, only set on requests
+	// received over TLS, or over HTTPS by the first of Config.TrustedProxyHops
+	// proxies according to X-Forwarded-Proto.
+	HSTS string
+}
+
+// DefaultSecurityHeaders returns the headers set unless configured otherwise.
+// The Swagger UI loads its scripts and stylesheet from the same origin but
+// sets inline styles and uses data: images, which the policy allows.
+func DefaultSecurityHeaders() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		FrameOptions:   "DENY",
+		ReferrerPolicy: "no-referrer",
+		DocsCSP:        "default-src 'none'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self' data:; connect-src 'self'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'",
+		HSTS:           "max-age=63072000; includeSubDomains",
+	}
+}
+
+type securityHeaders struct {
+	SecurityHeadersConfig
+	trustedHops int
+}
+
+// handle sets the security headers before next writes the response, so that
+// they are on error responses as well.
+func (sh securityHeaders) handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if sh.FrameOptions != "" {
+			h.Set("X-Frame-Options", sh.FrameOptions)
+		}
+		if sh.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", sh.ReferrerPolicy)
+		}
+		if sh.DocsCSP != "" && isDocsUIPath(r.URL.Path) {
+			h.Set("Content-Security-Policy", sh.DocsCSP)
+		}
+		if sh.HSTS != "" && sh.https(r) {
+			h.Set("Strict-Transport-Security", sh.HSTS)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// https reports whether the client sent r over HTTPS. X-Forwarded-Proto is
+// only trusted behind a proxy, which overwrites it.
+func (sh securityHeaders) https(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return sh.trustedHops > 0 && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// isDocsUIPath reports whether path is the Swagger UI page or one of its
+// assets, under the version prefix or not.
+func isDocsUIPath(path string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(path, legacyVersion), strings.TrimSuffix(swaggerUIPath, "/"))
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg := testConfig()
+	cfg.SecurityHeaders = DefaultSecurityHeaders()
+	h := newTestServer(t, cfg).Handler()
+	csp := cfg.SecurityHeaders.DocsCSP
+
+	tests := []struct {
+		name, method, target, body string
+		wantStatus                 int
+		wantCSP                    bool
+	}{
+		{"API", http.MethodPost, "/v1/analyze", `{"text": "hi"}`, http.StatusOK, false},
+		{"API error", http.MethodPost, "/v1/analyze", `{"text": `, http.StatusBadRequest, false},
+		{"unknown path", http.MethodGet, "/v1/nothing", "", http.StatusNotFound, false},
+		{"wrong method", http.MethodDelete, "/v1/analyze", "", http.StatusMethodNotAllowed, false},
+		{"document", http.MethodGet, "/docs", "", http.StatusOK, false},
+		{"UI page", http.MethodGet, "/docs/ui/", "", http.StatusOK, true},
+		{"UI page under the version", http.MethodGet, "/v1/docs/ui/", "", http.StatusOK, true},
+		{"UI asset", http.MethodGet, "/docs/ui/swagger-ui.css", "", http.StatusOK, true},
+		{"UI redirect", http.MethodGet, "/docs/ui", "", http.StatusMovedPermanently, true},
+		{"UI missing asset", http.MethodGet, "/docs/ui/missing.js", "", http.StatusNotFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			for name, want := range map[string]string{
+				"X-Content-Type-Options": "nosniff",
+				"X-Frame-Options":        "DENY",
+				"Referrer-Policy":        "no-referrer",
+			} {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			got := w.Header().Get("Content-Security-Policy")
+			if tt.wantCSP && got != csp {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, csp)
+			} else if !tt.wantCSP && got != "" {
+				t.Errorf("Content-Security-Policy = %q, want none", got)
+			}
+			// Not over HTTPS.
+			if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+				t.Errorf("Strict-Transport-Security = %q over HTTP", got)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersHSTS(t *testing.T) {
+	tests := []struct {
+		name  string
+		hops  int
+		tls   bool
+		proto string
+		want  bool
+	}{
+		{"HTTP", 0, false, "", false},
+		{"TLS", 0, true, "", true},
+		// Without a proxy, X-Forwarded-Proto is the client's own claim.
+		{"forwarded without proxy", 0, false, "https", false},
+		{"forwarded HTTPS", 1, false, "https", true},
+		{"forwarded HTTPS upper case", 1, false, "HTTPS", true},
+		{"forwarded HTTP", 1, false, "http", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.SecurityHeaders = DefaultSecurityHeaders()
+			cfg.TrustedProxyHops = tt.hops
+			h := newTestServer(t, cfg).Handler()
+
+			r := httptest.NewRequest(http.MethodGet, "/livez", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			got := w.Header().Get("Strict-Transport-Security")
+			if tt.want && got != cfg.SecurityHeaders.HSTS {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, cfg.SecurityHeaders.HSTS)
+			} else if !tt.want && got != "" {
+				t.Errorf("Strict-Transport-Security = %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersConfigured(t *testing.T) {
+	cfg := testConfig()
+	cfg.SecurityHeaders = SecurityHeadersConfig{
+		FrameOptions: "SAMEORIGIN",
+		DocsCSP:      "default-src 'self'",
+	}
+	h := newTestServer(t, cfg).Handler()
+
+	w := serve(h, http.MethodGet, "/docs/ui/", "")
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "SAMEORIGIN",
+		"Content-Security-Policy": "default-src 'self'",
+		// Empty values leave their headers out.
+		"Referrer-Policy": "",
+	}
+	for name, v := range want {
+		if got := w.Header().Get(name); got != v {
+			t.Errorf("%s = %q, want %q", name, got, v)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/docs/ui/", nil)
+	r.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q, want none when not configured", got)
+	}
+}
+
+// TestDocsCSPSwaggerUI checks that the default policy lets the Swagger UI
+// page load: it has no inline scripts, and everything it references is from
+// its own origin.
+func TestDocsCSPSwaggerUI(t *testing.T) {
+	csp := DefaultSecurityHeaders().DocsCSP
+	for _, directive := range []string{"script-src 'self'", "style-src 'self' 'unsafe-inline'", "img-src 'self' data:", "connect-src 'self'"} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("the policy %q lacks %q", csp, directive)
+		}
+	}
+
+	w := serve(newTestServer(t, testConfig()).Handler(), http.MethodGet, "/docs/ui/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	page := w.Body.String()
+	if regexp.MustCompile(`<script[^>]*>\s*[^<\s]`).MatchString(page) {
+		t.Error("the page has an inline script, which script-src 'self' blocks")
+	}
+	if regexp.MustCompile(`\son\w+=`).MatchString(page) {
+		t.Error("the page has an inline event handler, which script-src 'self' blocks")
+	}
+	for _, m := range regexp.MustCompile(`(?:src|href)="([^"]+)"`).FindAllStringSubmatch(page, -1) {
+		if strings.Contains(m[1], "://") || strings.HasPrefix(m[1], "//") {
+			t.Errorf("the page loads %s from another origin", m[1])
+		}
+	}
+}
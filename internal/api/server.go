@@ -0,0 +1,302 @@
+// Package api implements the HTTP interface of the Sentiment Analysis API.
+package api
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	languagev2pb "cloud.google.com/go/language/apiv2/languagepb"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+// Defaults for the corresponding Config fields.
+const (
+	DefaultRequestTimeout = 10 * time.Second
+	DefaultMaxTextBytes   = 10000 // the Language API's practical per-document limit
+	DefaultMaxBodyBytes   = 1 << 20
+	DefaultMaxFileBytes   = DefaultMaxTextBytes
+	DefaultMaxChunks      = 10
+	// DefaultBatchConcurrency is also used when Config.BatchConcurrency is
+	// 0.
+	DefaultBatchConcurrency = 8
+)
+
+// Language is the subset of the Natural Language API used by the handlers
+// other than sentiment analysis. *sentiment.Client implements it.
+type Language interface {
+	AnalyzeEntities(ctx context.Context, req *languagepb.AnalyzeEntitiesRequest) (*languagepb.AnalyzeEntitiesResponse, error)
+	AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest) (*languagepb.AnalyzeEntitySentimentResponse, error)
+	AnalyzeSyntax(ctx context.Context, req *languagepb.AnalyzeSyntaxRequest) (*languagepb.AnalyzeSyntaxResponse, error)
+	ClassifyText(ctx context.Context, req *languagepb.ClassifyTextRequest) (*languagepb.ClassifyTextResponse, error)
+	ModerateText(ctx context.Context, req *languagev2pb.ModerateTextRequest) (*languagev2pb.ModerateTextResponse, error)
+}
+
+// Config holds the settings of a Server.
+type Config struct {
+	// RequestTimeout bounds the Language API calls made for one request.
+	RequestTimeout time.Duration
+	// MaxTextBytes is the largest text accepted for analysis.
+	MaxTextBytes int
+	// MaxChunks is the largest number of chunks of at most MaxTextBytes a
+	// text is split into for sentiment analysis; larger texts are rejected.
+	// 1 disables chunking.
+	MaxChunks int
+	// MaxBodyBytes is the largest request body accepted.
+	MaxBodyBytes int64
+	// LenientJSON accepts JSON bodies with unknown or repeated fields, or
+	// with data after the JSON value, which are rejected with 400 otherwise.
+	LenientJSON bool
+	// MaxBatchItems is the largest number of texts of a JSON batch.
+	MaxBatchItems int
+	// BatchConcurrency is the number of items of a batch, CSV file, NDJSON
+	// stream or long text analyzed at once for one request.
+	BatchConcurrency int
+	// MaxFileBytes is the largest file accepted by /analyze/file.
+	MaxFileBytes int
+	// FeedMaxEntries is the number of entries of a feed analyzed by
+	// /analyze/feed; the others are ignored.
+	FeedMaxEntries int
+	// URLsTimeout bounds the fetching and analysis of all the pages of one
+	// /analyze/urls request.
+	URLsTimeout time.Duration
+	// TrustedProxyHops is the number of reverse proxies in front of the
+	// server that append to X-Forwarded-For.
+	TrustedProxyHops int
+	// NeutralBand labels every score whose absolute value is below it
+	// neutral, whatever its magnitude. It must be in [0, 1); 0 keeps only the
+	// default thresholds.
+	NeutralBand float64
+	// ScorePrecision is the number of decimal places the scores and
+	// magnitudes of sentiment results are rounded to, 0 for whole numbers;
+	// nil leaves them as computed.
+	ScorePrecision *int
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept in memory; 0 disables Idempotency-Key support
+	// unless a store is set with SetIdempotencyStore.
+	IdempotencyTTL time.Duration
+	// HistoryPreviewBytes is how much of each text GET /history returns.
+	HistoryPreviewBytes int
+	// SlowRequestThreshold is the duration beyond which a request is logged
+	// as slow, with the time spent in the Language API.
+	SlowRequestThreshold time.Duration
+
+	// APIKeys, when non-empty, are the keys accepted in X-API-Key.
+	APIKeys []string
+	// SigningSecrets, when non-empty, are the secrets requests to the
+	// protected endpoints may be signed with instead of carrying an API key;
+	// several may be accepted at once while the secret is rotated.
+	SigningSecrets []string
+	// SignatureMaxSkew is how far the timestamp of a signed request may be
+	// from the time it is received.
+	SignatureMaxSkew time.Duration
+	// DebugAPIKeys are the keys allowed to request debug output with
+	// ?debug=true. When authentication is enabled they must be among
+	// APIKeys as well.
+	DebugAPIKeys []string
+	// Debug lets every client request debug output.
+	Debug bool
+	// AdminAPIKeys are the keys accepted in X-API-Key by the admin
+	// endpoints, such as /stats, which are disabled without them or
+	// AdminAuth.
+	AdminAPIKeys []string
+	// AdminAuth are the Basic credentials accepted by the admin endpoints.
+	AdminAuth BasicAuthConfig
+	// APIIPFilter restricts the clients of the protected endpoints and
+	// AdminIPFilter those of the admin endpoints, including the profiling
+	// endpoints wrapped with ProtectAdmin.
+	APIIPFilter   IPFilterConfig
+	AdminIPFilter IPFilterConfig
+
+	RateLimit       RateLimitConfig
+	LoadShedding    LoadSheddingConfig
+	CORS            CORSConfig
+	AccessLog       AccessLogConfig
+	SecurityHeaders SecurityHeadersConfig
+}
+
+// Server serves the API. Its dependencies are supplied to NewServer so that
+// tests can substitute fakes.
+type Server struct {
+	log      Logger
+	metrics  *Metrics
+	analyzer sentiment.Analyzer
+	lang     Language
+	cache    Cache
+	storage  *storageWriter
+	exporter *eventExporter
+	reporter *errorReporter
+	fetcher  *http.Client
+
+	async     AsyncConfig
+	callbacks *http.Client
+
+	objects ObjectStore
+	gcs     GCSConfig
+	gcsJobs gcsJobs
+
+	requestTimeout time.Duration
+	maxTextBytes   int
+	maxChunks      int
+	maxBodyBytes   int64
+	lenientJSON    bool
+	maxFileBytes   int
+	maxBatchItems  int
+	batchWorkers   int
+	feedMaxEntries int
+	urlsTimeout    time.Duration
+	scorePrecision *int
+	previewBytes   int
+	// settings are replaced by Reload and SetAPIKeys, which settingsMu
+	// serializes.
+	settings   atomic.Pointer[settings]
+	settingsMu sync.Mutex
+	reloader   Reloader
+
+	idTokens    *idTokenAuth
+	signatures  *signedRequests
+	idempotency idempotency
+	debug       bool
+	adminAuth   *basicAuth
+	apiIPs      *ipFilter
+	adminIPs    *ipFilter
+	limiter     *rateLimiter
+	shedder     *loadShedder
+	quotas      *quotas
+	cors        corsPolicy
+	secHeaders  securityHeaders
+	trustedHops int
+	accessLog   *accessLog
+
+	health    healthChecks
+	readiness Readiness
+	build     BuildInfo
+
+	swaggerDoc  lazyDoc
+	openAPIJSON lazyDoc
+	openAPIYAML lazyDoc
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewServer returns a Server using analyzer for sentiment analysis and lang for
+// the other analyses. cache may be nil to disable result caching.
+func NewServer(cfg Config, analyzer sentiment.Analyzer, lang Language, cache Cache, logger Logger, metrics *Metrics) (*Server, error) {
+	cors, err := newCORSPolicy(cfg.CORS)
+	if err != nil {
+		return nil, err
+	}
+	accessLog, err := newAccessLog(cfg.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+	adminAuth, err := newBasicAuth(cfg.AdminAuth)
+	if err != nil {
+		return nil, err
+	}
+	apiIPs, err := newIPFilter("api", cfg.APIIPFilter, cfg.TrustedProxyHops, metrics)
+	if err != nil {
+		return nil, err
+	}
+	adminIPs, err := newIPFilter("admin", cfg.AdminIPFilter, cfg.TrustedProxyHops, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		log:            logger,
+		metrics:        metrics,
+		analyzer:       timedAnalyzer{analyzer},
+		lang:           timedLanguage{lang},
+		cache:          cache,
+		fetcher:        newFetchClient(),
+		requestTimeout: cfg.RequestTimeout,
+		maxTextBytes:   cfg.MaxTextBytes,
+		maxChunks:      cfg.MaxChunks,
+		maxBodyBytes:   cfg.MaxBodyBytes,
+		lenientJSON:    cfg.LenientJSON,
+		maxFileBytes:   cfg.MaxFileBytes,
+		maxBatchItems:  cmp.Or(cfg.MaxBatchItems, DefaultMaxBatchItems),
+		batchWorkers:   cmp.Or(cfg.BatchConcurrency, DefaultBatchConcurrency),
+		feedMaxEntries: cmp.Or(cfg.FeedMaxEntries, DefaultFeedMaxEntries),
+		urlsTimeout:    cmp.Or(cfg.URLsTimeout, DefaultURLsTimeout),
+		scorePrecision: cfg.ScorePrecision,
+		previewBytes:   cfg.HistoryPreviewBytes,
+		signatures:     newSignedRequests(cfg.SigningSecrets, cmp.Or(cfg.SignatureMaxSkew, DefaultSignatureMaxSkew)),
+		debug:          cfg.Debug,
+		adminAuth:      adminAuth,
+		apiIPs:         apiIPs,
+		adminIPs:       adminIPs,
+		shedder:        newLoadShedder(cfg.LoadShedding, metrics),
+		cors:           cors,
+		secHeaders:     securityHeaders{cfg.SecurityHeaders, cfg.TrustedProxyHops},
+		trustedHops:    cfg.TrustedProxyHops,
+		accessLog:      accessLog,
+		shutdown:       make(chan struct{}),
+	}
+	s.settings.Store(newSettings(cfg.Reloadable()))
+	s.limiter = newRateLimiter(func(ctx context.Context) rateLimits {
+		return s.settingsFor(ctx).rateLimit
+	}, cfg.TrustedProxyHops)
+	if cfg.IdempotencyTTL > 0 {
+		s.idempotency.store = NewMemoryIdempotencyStore(cfg.IdempotencyTTL)
+	}
+	return s, nil
+}
+
+// Handler returns the root handler: every route wrapped in the middleware
+// that applies to all requests.
+func (s *Server) Handler() http.Handler {
+	rt := newRouter()
+	s.routes(rt)
+	return s.withMiddleware(rt)
+}
+
+// OpsHandler serves only the endpoints meant for the platform, for processes
+// that do not serve the API, such as Pub/Sub workers.
+func (s *Server) OpsHandler() http.Handler {
+	rt := newRouter()
+	for _, ep := range s.opsEndpoints() {
+		rt.handleEndpoint(ep, s.endpointHandler(ep))
+	}
+	return s.withMiddleware(rt)
+}
+
+func (s *Server) withMiddleware(rt *router) http.Handler {
+	// Middleware is listed innermost first. Recovery is installed twice:
+	// around the routes, so that the logs, metrics and error reports see the
+	// 500 of a panicking handler, and around the middleware, so that a panic
+	// in it is recovered too.
+	var handler http.Handler = rt
+	handler = s.withRecovery(handler)
+	handler = s.reporter.report(handler)
+	handler = withDecompression(handler)
+	handler = withCompression(handler)
+	handler = s.withSlowRequestLog(handler)
+	handler = s.metrics.withMetrics(handler)
+	handler = withMatchedRoute(handler)
+	handler = s.cors.handle(handler)
+	handler = s.secHeaders.handle(handler)
+	handler = s.shedder.limit(handler)
+	handler = s.withLogging(handler)
+	handler = s.withSettings(handler)
+	handler = s.withRecovery(handler)
+	handler = withRequestID(handler)
+	handler = withTracing(handler)
+	return handler
+}
+
+// protect wraps the routes that reach the Language API.
+func (s *Server) protect(h http.HandlerFunc) http.HandlerFunc {
+	return s.apiIPs.filter(s.limiter.limit(s.authenticate(s.quotas.enforce(h))))
+}
+
+// APIKeyAuth reports whether API key authentication is enabled.
+func (s *Server) APIKeyAuth() bool {
+	return s.settings.Load().keys.enabled()
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	languagev2pb "cloud.google.com/go/language/apiv2/languagepb"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+// errNoLanguage is returned by stubLanguage, for tests that do not expect
+// the Language API to be called.
+var errNoLanguage = errors.New("the Language API is not available in tests")
+
+type stubLanguage struct{}
+
+func (stubLanguage) AnalyzeEntities(context.Context, *languagepb.AnalyzeEntitiesRequest) (*languagepb.AnalyzeEntitiesResponse, error) {
+	return nil, errNoLanguage
+}
+
+func (stubLanguage) AnalyzeEntitySentiment(context.Context, *languagepb.AnalyzeEntitySentimentRequest) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	return nil, errNoLanguage
+}
+
+func (stubLanguage) AnalyzeSyntax(context.Context, *languagepb.AnalyzeSyntaxRequest) (*languagepb.AnalyzeSyntaxResponse, error) {
+	return nil, errNoLanguage
+}
+
+func (stubLanguage) ClassifyText(context.Context, *languagepb.ClassifyTextRequest) (*languagepb.ClassifyTextResponse, error) {
+	return nil, errNoLanguage
+}
+
+func (stubLanguage) ModerateText(context.Context, *languagev2pb.ModerateTextRequest) (*languagev2pb.ModerateTextResponse, error) {
+	return nil, errNoLanguage
+}
+
+// testConfig returns the settings of the servers of the tests: texts of up
+// to 1000 bytes, in a single chunk.
+func testConfig() Config {
+	return Config{
+		RequestTimeout: 5 * time.Second,
+		MaxTextBytes:   1000,
+		MaxChunks:      1,
+		MaxBodyBytes:   64 << 10,
+	}
+}
+
+// newTestServer returns a Server analyzing with the fake analyzer, without
+// cache or Language API.
+func newTestServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	s, err := NewServer(cfg, sentiment.Fake{}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s
+}
+
+// serve sends a request to h and returns the recorded response. A non-empty
+// body is sent as JSON.
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// errorCode returns the code of the ErrorResponse in w.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", w.Body.String(), err)
+	}
+	return resp.Error.Code
+}
+
+func TestAnalyze(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantLabel  string
+	}{
+		{"positive", http.MethodPost, "/analyze", `{"text": "I love it, it is great."}`, http.StatusOK, "", "positive"},
+		{"negative", http.MethodPost, "/analyze", `{"text": "This is awful."}`, http.StatusOK, "", "negative"},
+		{"neutral", http.MethodPost, "/analyze", `{"text": "The sky is blue."}`, http.StatusOK, "", "neutral"},
+		{"query", http.MethodGet, "/analyze?text=great", "", http.StatusOK, "", "positive"},
+		{"missing text", http.MethodPost, "/analyze", `{}`, http.StatusBadRequest, codeMissingText, ""},
+		{"empty text", http.MethodPost, "/analyze", `{"text": "  "}`, http.StatusBadRequest, codeEmptyText, ""},
+		{"invalid JSON", http.MethodPost, "/analyze", `{"text":`, http.StatusBadRequest, codeInvalidRequest, ""},
+		{"text too large", http.MethodPost, "/analyze", `{"text": "` + strings.Repeat("a ", 1000) + `"}`, http.StatusRequestEntityTooLarge, codeTextTooLarge, ""},
+		{"invalid language", http.MethodPost, "/analyze", `{"text": "great", "language": "not a language"}`, http.StatusBadRequest, codeInvalidRequest, ""},
+		{"method not allowed", http.MethodPut, "/analyze", `{"text": "great"}`, http.StatusMethodNotAllowed, codeMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, w); code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", code, tt.wantCode)
+				}
+				return
+			}
+			var resp SentimentResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response %q: %v", w.Body, err)
+			}
+			if resp.Sentiment != tt.wantLabel {
+				t.Errorf("sentiment = %q, want %q", resp.Sentiment, tt.wantLabel)
+			}
+			if resp.Provider != sentiment.ProviderFake {
+				t.Errorf("provider = %q, want %q", resp.Provider, sentiment.ProviderFake)
+			}
+		})
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("down") }
+	healthy := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name       string
+		required   HealthCheck
+		optional   HealthCheck
+		wantStatus int
+		wantHealth string
+	}{
+		{"no dependencies", nil, nil, http.StatusOK, healthOK},
+		{"healthy", healthy, healthy, http.StatusOK, healthOK},
+		{"optional dependency down", healthy, failing, http.StatusOK, healthDegraded},
+		{"required dependency down", failing, healthy, http.StatusServiceUnavailable, healthUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig())
+			if tt.required != nil {
+				s.AddHealthCheck("required", tt.required)
+			}
+			if tt.optional != nil {
+				s.AddOptionalHealthCheck("optional", tt.optional)
+			}
+			h := s.Handler()
+
+			w := serve(h, http.MethodGet, "/healthcheck", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var report HealthReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("decode report %q: %v", w.Body, err)
+			}
+			if report.Status != tt.wantHealth {
+				t.Errorf("status = %q, want %q", report.Status, tt.wantHealth)
+			}
+			for name, check := range report.Checks {
+				if check.Required != (name == "required") {
+					t.Errorf("check %s: required = %t", name, check.Required)
+				}
+				if check.CheckedAt.IsZero() {
+					t.Errorf("check %s has no checked_at", name)
+				}
+			}
+
+			// Probes get an empty 200 whatever the dependencies.
+			w = serve(h, http.MethodGet, "/healthcheck?plain=true", "")
+			if w.Code != http.StatusOK || w.Body.Len() != 0 {
+				t.Errorf("plain: status = %d, body %q; want 200 and an empty body", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestDocs(t *testing.T) {
+	h := newTestServer(t, testConfig()).Handler()
+
+	w := serve(h, http.MethodGet, "/docs", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var doc struct {
+		Swagger string         `json:"swagger"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	if doc.Swagger != "2.0" {
+		t.Errorf("swagger = %q, want 2.0", doc.Swagger)
+	}
+	for _, path := range []string{"/v1/analyze", "/v1/healthcheck", "/v1/docs"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("%s is not documented", path)
+		}
+	}
+
+	w = serve(h, http.MethodPost, "/docs", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /docs: status = %d, want 405", w.Code)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	s, err := NewServer(testConfig(), sentiment.Fake{}, stubLanguage{}, nil, slog.New(slog.NewJSONHandler(&logs, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	rt := newRouter()
+	rt.handle(http.MethodGet, "/panic", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+	rt.handle(http.MethodGet, "/ok", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	h := s.withMiddleware(rt)
+
+	w := serve(h, http.MethodGet, "/panic", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if code := errorCode(t, w); code != codeInternalError {
+		t.Errorf("code = %q, want %q", code, codeInternalError)
+	}
+	if !strings.Contains(logs.String(), `"panic":"boom"`) {
+		t.Errorf("panic not logged: %s", logs.String())
+	}
+	// The access log sees the 500 of the recovered handler.
+	if !strings.Contains(logs.String(), `"status":500`) {
+		t.Errorf("access log lacks the 500: %s", logs.String())
+	}
+
+	if w := serve(h, http.MethodGet, "/ok", ""); w.Code != http.StatusNoContent {
+		t.Errorf("after the panic: status = %d, want 204", w.Code)
+	}
+
+	// A Metrics without collectors panics in the middleware, after the
+	// handler, where the inner recovery cannot catch it.
+	logs.Reset()
+	s.metrics = &Metrics{}
+	h = s.withMiddleware(rt)
+	serve(h, http.MethodGet, "/ok", "")
+	if !strings.Contains(logs.String(), "panic while handling request") {
+		t.Errorf("middleware panic not logged: %s", logs.String())
+	}
+}
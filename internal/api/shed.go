@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// shedRetryAfter is the hint given to the requests shed.
+const shedRetryAfter = time.Second
+
+// LoadSheddingConfig bounds the number of requests served at once. A zero
+// MaxInFlight disables it.
+type LoadSheddingConfig struct {
+	// MaxInFlight is the number of requests served at the same time;
+	// requests beyond it are rejected with 503 and a Retry-After header.
+	MaxInFlight int
+	// QueueTimeout is how long a request beyond the limit waits for
+	// another one to finish before it is rejected; 0 rejects it right away.
+	QueueTimeout time.Duration
+}
+
+// shedExempt are the paths served regardless of the limit, so that the
+// platform can still tell an overloaded instance from a dead one.
+var shedExempt = map[string]bool{
+	"/healthcheck": true,
+	"/metrics":     true,
+	"/livez":       true,
+	"/readyz":      true,
+	"/startupz":    true,
+}
+
+// loadShedder enforces a LoadSheddingConfig. A nil *loadShedder lets every
+// request through.
+type loadShedder struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+	metrics      *Metrics
+}
+
+func newLoadShedder(cfg LoadSheddingConfig, metrics *Metrics) *loadShedder {
+	if cfg.MaxInFlight <= 0 {
+		return nil
+	}
+	return &loadShedder{
+		slots:        make(chan struct{}, cfg.MaxInFlight),
+		queueTimeout: cfg.QueueTimeout,
+		metrics:      metrics,
+	}
+}
+
+// acquire takes a slot, waiting up to the queue timeout or until r is
+// cancelled, and reports whether it got one.
+func (l *loadShedder) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// limit rejects the requests beyond the limit with 503, except those to the
+// exempt paths.
+func (l *loadShedder) limit(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shedExempt[strings.TrimPrefix(r.URL.Path, legacyVersion)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !l.acquire(r) {
+			l.metrics.observeShedRequest()
+			setRetryAfter(w, shedRetryAfter)
+			writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "the server is overloaded, retry later")
+			return
+		}
+		l.metrics.httpInFlight.Inc()
+		defer func() {
+			l.metrics.httpInFlight.Dec()
+			<-l.slots
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds the requests to /analyze it serves until release is
+// closed, signalling started for each, and answers the others right away.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/analyze" {
+		return
+	}
+	h.started <- struct{}{}
+	<-h.release
+}
+
+func TestLoadShedderDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	if l := newLoadShedder(LoadSheddingConfig{}, NewMetrics()); l != nil {
+		t.Fatal("newLoadShedder returned a shedder without MaxInFlight")
+	}
+	var l *loadShedder
+	if w := serve(l.limit(next), http.MethodPost, "/analyze", ""); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+}
+
+func TestLoadShedder(t *testing.T) {
+	blocking := newBlockingHandler()
+	h := newLoadShedder(LoadSheddingConfig{MaxInFlight: 1}, NewMetrics()).limit(blocking)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve(h, http.MethodPost, "/analyze", "")
+	}()
+	<-blocking.started
+
+	w := serve(h, http.MethodPost, "/analyze", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("request beyond the limit: status %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if code := errorCode(t, w); code != codeUnavailable {
+		t.Errorf("error code = %q, want %q", code, codeUnavailable)
+	}
+
+	// Probes are served at any load, under the legacy paths as well.
+	for _, path := range []string{"/healthcheck", "/v1/healthcheck", "/livez", "/readyz", "/startupz", "/metrics"} {
+		if w := serve(h, http.MethodGet, path, ""); w.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", path, w.Code)
+		}
+	}
+
+	close(blocking.release)
+	wg.Wait()
+	if w := serve(h, http.MethodPost, "/analyze", ""); w.Code != http.StatusOK {
+		t.Errorf("request after the others finished: status %d, want 200", w.Code)
+	}
+}
+
+func TestLoadShedderQueue(t *testing.T) {
+	blocking := newBlockingHandler()
+	h := newLoadShedder(LoadSheddingConfig{MaxInFlight: 1, QueueTimeout: time.Minute}, NewMetrics()).limit(blocking)
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- serve(h, http.MethodPost, "/analyze", "") }()
+	<-blocking.started
+
+	// The queued request is served as soon as the first one finishes.
+	queued := make(chan *httptest.ResponseRecorder)
+	go func() { queued <- serve(h, http.MethodPost, "/analyze", "") }()
+	select {
+	case w := <-queued:
+		t.Fatalf("queued request answered with %d before a slot was free", w.Code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(blocking.release)
+	if w := <-first; w.Code != http.StatusOK {
+		t.Errorf("first request: status %d, want 200", w.Code)
+	}
+	if w := <-queued; w.Code != http.StatusOK {
+		t.Errorf("queued request: status %d, want 200", w.Code)
+	}
+}
+
+func TestLoadShedderQueueTimeout(t *testing.T) {
+	blocking := newBlockingHandler()
+	h := newLoadShedder(LoadSheddingConfig{MaxInFlight: 1, QueueTimeout: 10 * time.Millisecond}, NewMetrics()).limit(blocking)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(h, http.MethodPost, "/analyze", "")
+	}()
+	<-blocking.started
+
+	if w := serve(h, http.MethodPost, "/analyze", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d after the queue timeout, want 503", w.Code)
+	}
+	close(blocking.release)
+	<-done
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSignatureMaxSkew is the default of Config.SignatureMaxSkew.
+const DefaultSignatureMaxSkew = 5 * time.Minute
+
+// maxSeenSignatures bounds the signatures remembered to reject replays.
+// Beyond it, the oldest are forgotten before their timestamp goes stale.
+const maxSeenSignatures = 100_000
+
+// Headers of signed requests. The signature is the HMAC-SHA256, under one
+// of Config.SigningSecrets, of the method, the path, the canonical query,
+// the timestamp and the request body, each but the body followed by a
+// newline, as sha256=<hex> like the signatures of the callbacks. The
+// canonical query is the query parameters sorted by key and URL-encoded, as
+// by url.Values.Encode. The body is the one decoded from any
+// Content-Encoding, so gzipped requests are signed before compression.
+const (
+	requestSignatureHeader = "X-Signature"
+	// requestTimestampHeader is the Unix time, in seconds, the request was
+	// signed at.
+	requestTimestampHeader = "X-Signature-Timestamp"
+)
+
+// signedRequests verifies the signatures of requests, each of which is
+// accepted once.
+type signedRequests struct {
+	secrets [][]byte
+	maxSkew time.Duration
+	now     func() time.Time
+	maxSeen int
+
+	mu sync.Mutex
+	// seen maps the signatures accepted while their timestamp is fresh to
+	// their element of order, which lists them newest first.
+	order *list.List
+	seen  map[string]*list.Element
+}
+
+type seenSignature struct {
+	sig     string
+	expires time.Time
+}
+
+func newSignedRequests(secrets []string, maxSkew time.Duration) *signedRequests {
+	if len(secrets) == 0 {
+		return nil
+	}
+	sr := &signedRequests{
+		maxSkew: maxSkew,
+		now:     time.Now,
+		maxSeen: maxSeenSignatures,
+		order:   list.New(),
+		seen:    make(map[string]*list.Element),
+	}
+	for _, secret := range secrets {
+		sr.secrets = append(sr.secrets, []byte(secret))
+	}
+	return sr
+}
+
+// verify returns the secret r was signed with. The timestamp is checked
+// first, so that stale requests are rejected without computing any HMAC,
+// and a signature already accepted is rejected as a replay.
+func (sr *signedRequests) verify(r *http.Request, body []byte) ([]byte, error) {
+	ts := r.Header.Get(requestTimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s %q", requestTimestampHeader, ts)
+	}
+	now, signedAt := sr.now(), time.Unix(sec, 0)
+	if skew := now.Sub(signedAt).Abs(); skew > sr.maxSkew {
+		return nil, fmt.Errorf("timestamp is %s off", skew.Round(time.Second))
+	}
+	hexSig, ok := strings.CutPrefix(r.Header.Get(requestSignatureHeader), "sha256=")
+	sig, err := hex.DecodeString(hexSig)
+	if !ok || err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	query := r.URL.Query().Encode()
+	for _, secret := range sr.secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(r.Method + "\n" + r.URL.Path + "\n" + query + "\n" + ts + "\n"))
+		mac.Write(body)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			continue
+		}
+		// Past maxSkew after its timestamp, the request is stale anyway.
+		if !sr.remember(string(sig), now, signedAt.Add(sr.maxSkew)) {
+			return nil, errors.New("signature already used")
+		}
+		return secret, nil
+	}
+	return nil, errors.New("signature mismatch")
+}
+
+// remember records sig as accepted until expires, and reports whether it was
+// not already.
+func (sr *signedRequests) remember(sig string, now, expires time.Time) bool {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if el, ok := sr.seen[sig]; ok && now.Before(el.Value.(*seenSignature).expires) {
+		return false
+	}
+	for el := sr.order.Back(); el != nil; el = sr.order.Back() {
+		oldest := el.Value.(*seenSignature)
+		if now.Before(oldest.expires) && sr.order.Len() < sr.maxSeen {
+			break
+		}
+		sr.order.Remove(el)
+		delete(sr.seen, oldest.sig)
+	}
+	if el, ok := sr.seen[sig]; ok {
+		sr.order.Remove(el)
+	}
+	sr.seen[sig] = sr.order.PushFront(&seenSignature{sig: sig, expires: expires})
+	return true
+}
+
+// authenticateSignature lets r through to next if it is signed. The body is
+// read, at most s.maxBodyBytes of it, before next decodes it, and the
+// apiKeyID of the secret identifies the caller. Every failure is reported
+// with the same message so that it does not tell what to change.
+func (s *Server) authenticateSignature(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	secret, err := s.signatures.verify(r, body)
+	if err != nil {
+		s.log.Warn("rejected request signature", "request_id", RequestIDFromContext(r.Context()), "error", err.Error())
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid request signature")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	next(w, r.WithContext(context.WithValue(r.Context(), apiKeyIDKey{}, apiKeyID(string(secret)))))
+}
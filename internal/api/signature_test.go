@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest returns a request for target, a path with an optional
+// query, signed with secret at signedAt.
+func signedRequest(secret, method, target, body string, signedAt time.Time) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	ts := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + r.URL.Path + "\n" + r.URL.Query().Encode() + "\n" + ts + "\n" + body))
+	r.Header.Set(requestTimestampHeader, ts)
+	r.Header.Set(requestSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestSignedRequestsVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	const body = `{"text": "great"}`
+
+	tests := []struct {
+		name    string
+		r       *http.Request
+		body    string
+		wantErr bool
+	}{
+		{"valid", signedRequest("old", http.MethodPost, "/analyze", body, now), body, false},
+		{"within skew", signedRequest("new", http.MethodPost, "/analyze", body, now.Add(-4*time.Minute)), body, false},
+		{"stale", signedRequest("new", http.MethodPost, "/analyze", body, now.Add(-6*time.Minute)), body, true},
+		{"unknown secret", signedRequest("other", http.MethodPost, "/analyze", body, now), body, true},
+		{"other body", signedRequest("new", http.MethodPost, "/analyze", body, now), `{"text": "awful"}`, true},
+		{"other method", func() *http.Request {
+			r := signedRequest("new", http.MethodPost, "/analyze", body, now)
+			r.Method = http.MethodPut
+			return r
+		}(), body, true},
+		{"other path", func() *http.Request {
+			r := signedRequest("new", http.MethodPost, "/analyze", body, now)
+			r.URL.Path = "/analyze/batch"
+			return r
+		}(), body, true},
+		{"query", signedRequest("new", http.MethodGet, "/analyze?text=great&debug=true", "", now), "", false},
+		{"query in another order", func() *http.Request {
+			r := signedRequest("new", http.MethodGet, "/analyze?text=great&debug=true", "", now)
+			r.URL.RawQuery = "debug=true&text=great"
+			return r
+		}(), "", false},
+		{"tampered query", func() *http.Request {
+			r := signedRequest("new", http.MethodGet, "/analyze?text=great", "", now)
+			r.URL.RawQuery = "text=awful"
+			return r
+		}(), "", true},
+		{"added query parameter", func() *http.Request {
+			r := signedRequest("new", http.MethodPost, "/analyze", body, now)
+			r.URL.RawQuery = "dry_run=true"
+			return r
+		}(), body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := newSignedRequests([]string{"new", "old"}, 5*time.Minute)
+			sr.now = func() time.Time { return now }
+			_, err := sr.verify(tt.r, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verify: error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignedRequestsRejectReplays(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	sr := newSignedRequests([]string{"secret"}, 5*time.Minute)
+	sr.now = func() time.Time { return now }
+	const body = `{"text": "great"}`
+
+	r := signedRequest("secret", http.MethodPost, "/analyze", body, now)
+	if _, err := sr.verify(r, []byte(body)); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := sr.verify(r, []byte(body)); err == nil {
+		t.Fatal("replayed request accepted")
+	}
+	r = signedRequest("secret", http.MethodPost, "/analyze", body, now)
+	if _, err := sr.verify(r, []byte(body)); err != nil {
+		t.Fatalf("request signed at another time: %v", err)
+	}
+}
+
+func TestSignedRequestsBoundSeen(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	sr := newSignedRequests([]string{"secret"}, 5*time.Minute)
+	sr.now = func() time.Time { return now }
+	sr.maxSeen = 3
+
+	for i := range 10 {
+		body := strconv.Itoa(i)
+		if _, err := sr.verify(signedRequest("secret", http.MethodPost, "/analyze", body, now), []byte(body)); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if n := len(sr.seen); n > sr.maxSeen || n != sr.order.Len() {
+			t.Fatalf("after request %d: %d seen, %d in order, want at most %d", i, n, sr.order.Len(), sr.maxSeen)
+		}
+	}
+
+	// Expired signatures are forgotten first.
+	now = now.Add(6 * time.Minute)
+	body := "last"
+	if _, err := sr.verify(signedRequest("secret", http.MethodPost, "/analyze", body, now), []byte(body)); err != nil {
+		t.Fatalf("last request: %v", err)
+	}
+	if n := len(sr.seen); n != 1 {
+		t.Errorf("%d seen after the others expired, want 1", n)
+	}
+}
+
+func TestSignedRequestsThroughServer(t *testing.T) {
+	cfg := testConfig()
+	cfg.SigningSecrets = []string{"secret"}
+	h := newTestServer(t, cfg).Handler()
+	const body = `{"text": "I love it, it is great."}`
+
+	t.Run("gzip", func(t *testing.T) {
+		// The body is signed before it is compressed.
+		r := signedRequest("secret", http.MethodPost, "/v1/analyze", body, time.Now())
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write([]byte(body))
+		zw.Close()
+		r.Body = io.NopCloser(&gz)
+		r.ContentLength = int64(gz.Len())
+		r.Header.Set("Content-Encoding", "gzip")
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200; body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("tampered query", func(t *testing.T) {
+		r := signedRequest("secret", http.MethodGet, "/v1/analyze?text=great", "", time.Now())
+		r.URL.RawQuery = "text=awful"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", w.Code)
+		}
+	})
+}
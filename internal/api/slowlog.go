@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	languagev2pb "cloud.google.com/go/language/apiv2/languagepb"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+// DefaultSlowRequestThreshold is used when Config.SlowRequestThreshold is 0.
+const DefaultSlowRequestThreshold = 5 * time.Second
+
+type requestTimingKey struct{}
+
+// requestTiming accumulates, for the slow request log, the time a request
+// spent waiting for the Language API and the size of the texts it analyzed.
+// Upstream time is wall-clock time during which at least one call was in
+// flight, so that the concurrent calls of a batch are not counted twice and
+// the rest of the request duration is time spent locally.
+type requestTiming struct {
+	mu        sync.Mutex
+	inFlight  int
+	since     time.Time
+	upstream  time.Duration
+	textBytes int
+}
+
+// startUpstream marks the start of a Language API call made for the request
+// of ctx and returns the function marking its end.
+func startUpstream(ctx context.Context) func() {
+	t, ok := ctx.Value(requestTimingKey{}).(*requestTiming)
+	if !ok {
+		return func() {}
+	}
+	t.mu.Lock()
+	if t.inFlight == 0 {
+		t.since = time.Now()
+	}
+	t.inFlight++
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.inFlight--
+		if t.inFlight == 0 {
+			t.upstream += time.Since(t.since)
+		}
+	}
+}
+
+// noteTextSize adds text to the size of the texts analyzed for the request
+// of ctx.
+func noteTextSize(ctx context.Context, text string) {
+	if t, ok := ctx.Value(requestTimingKey{}).(*requestTiming); ok {
+		t.mu.Lock()
+		t.textBytes += len(text)
+		t.mu.Unlock()
+	}
+}
+
+// report returns the upstream time and text size recorded so far. A call
+// still in flight counts until now.
+func (t *requestTiming) report() (time.Duration, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	upstream := t.upstream
+	if t.inFlight > 0 {
+		upstream += time.Since(t.since)
+	}
+	return upstream, t.textBytes
+}
+
+// withSlowRequestLog logs a "slow request" entry for every request that
+// takes longer than the slow request threshold, with the share of the time spent in the
+// Language API, and counts it. Requests are labeled as in withMetrics.
+func (s *Server) withSlowRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		t := &requestTiming{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), requestTimingKey{}, t))
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		if duration <= s.settingsFor(r.Context()).slowRequest {
+			return
+		}
+		s.metrics.observeSlowRequest(routePattern(r.Context()))
+		upstream, textBytes := t.report()
+		s.log.Warn("slow request",
+			"request_id", RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", duration.Milliseconds(),
+			"upstream_ms", upstream.Milliseconds(),
+			"local_ms", (duration - upstream).Milliseconds(),
+			"text_bytes", textBytes,
+		)
+	})
+}
+
+// timedAnalyzer records the time spent in the calls to Analyzer for the slow
+// request log.
+type timedAnalyzer struct {
+	sentiment.Analyzer
+}
+
+func (a timedAnalyzer) Analyze(ctx context.Context, doc sentiment.Document) (sentiment.Result, error) {
+	defer startUpstream(ctx)()
+	return a.Analyzer.Analyze(ctx, doc)
+}
+
+// timedLanguage is the Language counterpart of timedAnalyzer.
+type timedLanguage struct {
+	Language
+}
+
+func (l timedLanguage) AnalyzeEntities(ctx context.Context, req *languagepb.AnalyzeEntitiesRequest) (*languagepb.AnalyzeEntitiesResponse, error) {
+	defer startUpstream(ctx)()
+	return l.Language.AnalyzeEntities(ctx, req)
+}
+
+func (l timedLanguage) AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	defer startUpstream(ctx)()
+	return l.Language.AnalyzeEntitySentiment(ctx, req)
+}
+
+func (l timedLanguage) AnalyzeSyntax(ctx context.Context, req *languagepb.AnalyzeSyntaxRequest) (*languagepb.AnalyzeSyntaxResponse, error) {
+	defer startUpstream(ctx)()
+	return l.Language.AnalyzeSyntax(ctx, req)
+}
+
+func (l timedLanguage) ClassifyText(ctx context.Context, req *languagepb.ClassifyTextRequest) (*languagepb.ClassifyTextResponse, error) {
+	defer startUpstream(ctx)()
+	return l.Language.ClassifyText(ctx, req)
+}
+
+func (l timedLanguage) ModerateText(ctx context.Context, req *languagev2pb.ModerateTextRequest) (*languagev2pb.ModerateTextResponse, error) {
+	defer startUpstream(ctx)()
+	return l.Language.ModerateText(ctx, req)
+}
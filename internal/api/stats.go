@@ -0,0 +1,249 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Stats are the aggregate counters of the HTTP API served by GET /stats.
+// They are read from the Prometheus collectors exported on /metrics, so the
+// two agree.
+type Stats struct {
+	Total StatsPeriod `json:"total" doc:"Since the process started"`
+	Today StatsPeriod `json:"today" doc:"Since midnight UTC, or since the process started if later"`
+}
+
+type StatsPeriod struct {
+	Start          time.Time       `json:"start"`
+	Requests       int64           `json:"requests"`
+	Endpoints      []EndpointStats `json:"endpoints" doc:"Requests by endpoint, sorted by path"`
+	AnalyzedChars  int64           `json:"analyzed_chars" doc:"Characters of the texts submitted for analysis"`
+	CacheHits      int64           `json:"cache_hits"`
+	CacheMisses    int64           `json:"cache_misses"`
+	CacheHitRate   float64         `json:"cache_hit_rate" doc:"Share of the cache lookups that hit; 0 without lookups"`
+	UpstreamErrors int64           `json:"upstream_errors" doc:"Failed Natural Language API calls"`
+	Latency        LatencyStats    `json:"latency"`
+}
+
+type EndpointStats struct {
+	Path     string           `json:"path" doc:"Route pattern, or unmatched"`
+	Requests int64            `json:"requests"`
+	Statuses map[string]int64 `json:"statuses" doc:"Requests by status code"`
+}
+
+// LatencyStats describe the time spent handling HTTP requests. Percentiles
+// are estimated from the buckets of the latency histogram.
+type LatencyStats struct {
+	AverageMS float64 `json:"average_ms"`
+	P50MS     float64 `json:"p50_ms"`
+	P90MS     float64 `json:"p90_ms"`
+	P99MS     float64 `json:"p99_ms"`
+}
+
+// statsSnapshot holds the values of the counters behind Stats at one time.
+type statsSnapshot struct {
+	// requests are keyed by path and status code.
+	requests       map[[2]string]float64
+	duration       histogramSnapshot
+	analyzedChars  float64
+	cacheHits      float64
+	cacheMisses    float64
+	upstreamErrors float64
+}
+
+// histogramSnapshot is a histogram summed over its labels.
+type histogramSnapshot struct {
+	count uint64
+	sum   float64
+	// bounds are the upper bounds of the buckets and counts their
+	// cumulative counts, excluding the +Inf bucket.
+	bounds []float64
+	counts []uint64
+}
+
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.metrics.Stats()
+	if err != nil {
+		s.log.Error("failed to read the metrics",
+			"request_id", RequestIDFromContext(r.Context()), "error", err.Error())
+		writeError(w, r, http.StatusInternalServerError, codeInternalError, "failed to read the metrics")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// Stats returns the aggregate counters since the process started and since
+// the start of the current day.
+func (m *Metrics) Stats() (Stats, error) {
+	now, err := m.snapshot()
+	if err != nil {
+		return Stats{}, err
+	}
+	m.dayMu.Lock()
+	day, dayStart := m.day, m.dayStart
+	m.dayMu.Unlock()
+
+	return Stats{
+		Total: now.period(m.started),
+		Today: now.sub(day).period(dayStart),
+	}, nil
+}
+
+// startDay takes the snapshot the counters of the day starting at now are
+// measured from, and schedules the snapshot of the next day.
+func (m *Metrics) startDay(now time.Time) {
+	// Counting the day from the start of the process is the best that can
+	// be done if the counters cannot be read.
+	snap, _ := m.snapshot()
+	m.dayMu.Lock()
+	m.day, m.dayStart = snap, now
+	m.dayMu.Unlock()
+
+	t := now.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+	time.AfterFunc(time.Until(next), func() { m.startDay(next) })
+}
+
+// snapshot reads the counters behind Stats.
+func (m *Metrics) snapshot() (statsSnapshot, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return statsSnapshot{}, err
+	}
+	snap := statsSnapshot{requests: make(map[[2]string]float64)}
+	for _, f := range families {
+		for _, metric := range f.GetMetric() {
+			labels := labelValues(metric)
+			switch f.GetName() {
+			case metricsNamespace + "_http_requests_total":
+				snap.requests[[2]string{labels["path"], labels["status"]}] += metric.GetCounter().GetValue()
+			case metricsNamespace + "_http_request_duration_seconds":
+				snap.duration.add(metric.GetHistogram())
+			case metricsNamespace + "_language_api_errors_total":
+				snap.upstreamErrors += metric.GetCounter().GetValue()
+			case metricsNamespace + "_analyzed_characters_total":
+				snap.analyzedChars += metric.GetCounter().GetValue()
+			case metricsNamespace + "_cache_lookups_total":
+				if labels["result"] == "hit" {
+					snap.cacheHits += metric.GetCounter().GetValue()
+				} else {
+					snap.cacheMisses += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return snap, nil
+}
+
+func labelValues(metric *dto.Metric) map[string]string {
+	out := make(map[string]string, len(metric.GetLabel()))
+	for _, l := range metric.GetLabel() {
+		out[l.GetName()] = l.GetValue()
+	}
+	return out
+}
+
+func (h *histogramSnapshot) add(hist *dto.Histogram) {
+	// Every path shares the buckets of the histogram.
+	if h.bounds == nil {
+		for _, b := range hist.GetBucket() {
+			h.bounds = append(h.bounds, b.GetUpperBound())
+		}
+		h.counts = make([]uint64, len(h.bounds))
+	}
+	h.count += hist.GetSampleCount()
+	h.sum += hist.GetSampleSum()
+	for i, b := range hist.GetBucket() {
+		h.counts[i] += b.GetCumulativeCount()
+	}
+}
+
+// sub returns the counts of s accumulated since base.
+func (s statsSnapshot) sub(base statsSnapshot) statsSnapshot {
+	out := statsSnapshot{
+		requests:       make(map[[2]string]float64, len(s.requests)),
+		duration:       s.duration,
+		analyzedChars:  s.analyzedChars - base.analyzedChars,
+		cacheHits:      s.cacheHits - base.cacheHits,
+		cacheMisses:    s.cacheMisses - base.cacheMisses,
+		upstreamErrors: s.upstreamErrors - base.upstreamErrors,
+	}
+	for k, n := range s.requests {
+		if n -= base.requests[k]; n > 0 {
+			out.requests[k] = n
+		}
+	}
+	if base.duration.bounds != nil {
+		out.duration.count -= base.duration.count
+		out.duration.sum -= base.duration.sum
+		out.duration.counts = slices.Clone(s.duration.counts)
+		for i := range out.duration.counts {
+			out.duration.counts[i] -= base.duration.counts[i]
+		}
+	}
+	return out
+}
+
+func (s statsSnapshot) period(start time.Time) StatsPeriod {
+	p := StatsPeriod{
+		Start:          start.UTC(),
+		Endpoints:      []EndpointStats{},
+		AnalyzedChars:  int64(s.analyzedChars),
+		CacheHits:      int64(s.cacheHits),
+		CacheMisses:    int64(s.cacheMisses),
+		UpstreamErrors: int64(s.upstreamErrors),
+	}
+	if lookups := s.cacheHits + s.cacheMisses; lookups > 0 {
+		p.CacheHitRate = s.cacheHits / lookups
+	}
+
+	byPath := make(map[string]*EndpointStats)
+	for k, n := range s.requests {
+		path, status := k[0], k[1]
+		ep, ok := byPath[path]
+		if !ok {
+			ep = &EndpointStats{Path: path, Statuses: make(map[string]int64)}
+			byPath[path] = ep
+		}
+		ep.Requests += int64(n)
+		ep.Statuses[status] += int64(n)
+		p.Requests += int64(n)
+	}
+	for _, ep := range byPath {
+		p.Endpoints = append(p.Endpoints, *ep)
+	}
+	slices.SortFunc(p.Endpoints, func(a, b EndpointStats) int { return cmp.Compare(a.Path, b.Path) })
+
+	if h := s.duration; h.count > 0 {
+		p.Latency = LatencyStats{
+			AverageMS: h.sum / float64(h.count) * 1000,
+			P50MS:     h.quantile(0.5) * 1000,
+			P90MS:     h.quantile(0.9) * 1000,
+			P99MS:     h.quantile(0.99) * 1000,
+		}
+	}
+	return p
+}
+
+// quantile estimates the q-quantile of h by linear interpolation within its
+// bucket, as PromQL's histogram_quantile does. Observations beyond the last
+// bucket are reported at its upper bound.
+func (h histogramSnapshot) quantile(q float64) float64 {
+	rank := q * float64(h.count)
+	lower, below := 0.0, 0.0
+	for i, upper := range h.bounds {
+		n := float64(h.counts[i])
+		if n >= rank {
+			return lower + (upper-lower)*(rank-below)/(n-below)
+		}
+		lower, below = upper, n
+	}
+	return lower
+}
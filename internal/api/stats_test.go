@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getStats serves GET /stats with the API key key.
+func getStats(t *testing.T, h http.Handler, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	if key != "" {
+		r.Header.Set(apiKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestStats(t *testing.T) {
+	m := NewMetrics()
+	cfg := testConfig()
+	cfg.AdminAPIKeys = []string{"admin"}
+	s, err := NewServer(cfg, newLanguageClient(t, m), stubLanguage{}, NewLRUCache(10, time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)), m)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := s.Handler()
+
+	read := func() Stats {
+		t.Helper()
+		w := getStats(t, h, "admin")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+		}
+		var stats Stats
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		return stats
+	}
+	before := read()
+	if before.Total.Requests != 0 || len(before.Total.Endpoints) != 0 || before.Total.Latency != (LatencyStats{}) {
+		t.Errorf("stats of a new server %+v, want zeros", before.Total)
+	}
+
+	serve(h, http.MethodPost, "/v1/analyze", `{"text": "I love this"}`)
+	serve(h, http.MethodPost, "/v1/analyze", `{"text": "I love this"}`)
+	// fakeLanguageService rejects "fail".
+	serve(h, http.MethodPost, "/v1/analyze", `{"text": "fail"}`)
+	serve(h, http.MethodGet, "/v1/nothing", "")
+
+	stats := read()
+	total := stats.Total
+	// The first GET /stats is counted as well.
+	if total.Requests != 5 {
+		t.Errorf("requests = %d, want 5", total.Requests)
+	}
+	want := map[string]map[string]int64{
+		"/v1/analyze": {"200": 2, "500": 1},
+		"/stats":      {"200": 1},
+		"unmatched":   {"404": 1},
+	}
+	if len(total.Endpoints) != len(want) {
+		t.Errorf("endpoints %+v, want %d", total.Endpoints, len(want))
+	}
+	for i, ep := range total.Endpoints {
+		if i > 0 && total.Endpoints[i-1].Path >= ep.Path {
+			t.Errorf("endpoints %+v, want them sorted by path", total.Endpoints)
+		}
+		var sum int64
+		for status, n := range ep.Statuses {
+			sum += n
+			if want[ep.Path][status] != n {
+				t.Errorf("%s: %d requests with status %s, want %d", ep.Path, n, status, want[ep.Path][status])
+			}
+		}
+		if ep.Requests != sum {
+			t.Errorf("%s: %d requests, want the sum of the statuses %d", ep.Path, ep.Requests, sum)
+		}
+	}
+	if total.CacheHits != 1 || total.CacheMisses != 2 || math.Abs(total.CacheHitRate-1.0/3) > 1e-9 {
+		t.Errorf("cache hits %d, misses %d, rate %v, want 1, 2 and 1/3", total.CacheHits, total.CacheMisses, total.CacheHitRate)
+	}
+	if total.UpstreamErrors != 1 {
+		t.Errorf("upstream errors = %d, want 1", total.UpstreamErrors)
+	}
+	l := total.Latency
+	if l.AverageMS <= 0 || l.P50MS <= 0 || l.P50MS > l.P90MS || l.P90MS > l.P99MS {
+		t.Errorf("latency %+v, want positive, increasing percentiles", l)
+	}
+	// The day started with the process.
+	if stats.Today.Requests != total.Requests || !stats.Today.Start.Equal(total.Start) {
+		t.Errorf("today %+v, want the same as the total %+v on the first day", stats.Today, total)
+	}
+
+	// The numbers agree with those of /metrics.
+	body := serve(h, http.MethodGet, "/metrics", "").Body.String()
+	for _, series := range []string{
+		fmt.Sprintf("sentiment_api_analyzed_characters_total %d", total.AnalyzedChars),
+		`sentiment_api_http_requests_total{path="/v1/analyze",status="200"} 2`,
+		`sentiment_api_cache_lookups_total{result="hit"} 1`,
+	} {
+		if !strings.Contains(body, series+"\n") {
+			t.Errorf("the metrics lack the series\n\t%s", series)
+		}
+	}
+	if total.AnalyzedChars < int64(len("I love this")) {
+		t.Errorf("analyzed characters = %d, want at least those of the first text", total.AnalyzedChars)
+	}
+}
+
+func TestStatsAuth(t *testing.T) {
+	cfg := testConfig()
+	cfg.AdminAPIKeys = []string{"admin"}
+	h := newTestServer(t, cfg).Handler()
+	for _, key := range []string{"", "wrong"} {
+		if w := getStats(t, h, key); w.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: status = %d, want 401", key, w.Code)
+		}
+	}
+
+	// Without admin credentials the endpoint is off.
+	h = newTestServer(t, testConfig()).Handler()
+	if w := getStats(t, h, ""); w.Code != http.StatusNotFound {
+		t.Errorf("without admin credentials: status = %d, want 404", w.Code)
+	}
+}
+
+func TestStatsToday(t *testing.T) {
+	m := NewMetrics()
+	m.requests.WithLabelValues("/v1/analyze", "200").Add(3)
+	m.analyzedChars.Add(100)
+	// A new day starts: the counters of today restart from there.
+	m.startDay(time.Now())
+	m.requests.WithLabelValues("/v1/analyze", "200").Add(2)
+	m.requests.WithLabelValues("/v1/analyze", "400").Inc()
+
+	stats, err := m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total.Requests != 6 || stats.Total.AnalyzedChars != 100 {
+		t.Errorf("total %+v, want 6 requests and 100 characters", stats.Total)
+	}
+	today := stats.Today
+	if today.Requests != 3 || today.AnalyzedChars != 0 || len(today.Endpoints) != 1 || today.Endpoints[0].Statuses["200"] != 2 || today.Endpoints[0].Statuses["400"] != 1 {
+		t.Errorf("today %+v, want the 3 requests since the day started", today)
+	}
+	if !today.Start.After(stats.Total.Start) {
+		t.Errorf("today starts at %v, want after the process start %v", today.Start, stats.Total.Start)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	// 10 observations up to 0.1, 80 up to 0.5 and 10 up to 1.
+	h := histogramSnapshot{
+		count:  100,
+		bounds: []float64{0.1, 0.5, 1},
+		counts: []uint64{10, 90, 100},
+	}
+	for _, tt := range []struct{ q, want float64 }{
+		{0.05, 0.05},
+		{0.1, 0.1},
+		{0.5, 0.3},
+		{0.95, 0.75},
+		{1, 1},
+	} {
+		if got := h.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	// Observations beyond the last bucket are reported at its bound.
+	h.count = 200
+	if got := h.quantile(0.99); got != 1 {
+		t.Errorf("quantile(0.99) beyond the buckets = %v, want 1", got)
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStorageQueueSize bounds the analysis records waiting to be saved.
+const DefaultStorageQueueSize = 1000
+
+const (
+	// storedTextBytes is how much of the text an AnalysisRecord keeps.
+	storedTextBytes = 500
+	// storageWriteTimeout bounds a single Storage.Save.
+	storageWriteTimeout = 10 * time.Second
+)
+
+// AnalysisRecord is one sentiment analysis as kept by a Storage.
+type AnalysisRecord struct {
+	// ID identifies the record within its Storage, which assigns it.
+	ID string `firestore:"-"`
+	// TextHash is the hex SHA-256 of the full text.
+	TextHash string `firestore:"text_hash"`
+	// Text is the start of the text, at most storedTextBytes long.
+	Text      string    `firestore:"text"`
+	Sentiment string    `firestore:"sentiment"`
+	Score     float64   `firestore:"score"`
+	Magnitude float64   `firestore:"magnitude"`
+	Language  string    `firestore:"language"`
+	Timestamp time.Time `firestore:"timestamp"`
+	RequestID string    `firestore:"request_id"`
+}
+
+// Storage keeps a record of the analyses served. Records are saved in the
+// background, so a slow or failing Storage never holds up requests.
+type Storage interface {
+	Save(ctx context.Context, rec AnalysisRecord) error
+	// List returns up to q.Limit records matching q, newest first, with
+	// records of the same Timestamp ordered by descending ID.
+	List(ctx context.Context, q HistoryQuery) ([]AnalysisRecord, error)
+}
+
+// HistoryQuery selects the records returned by Storage.List. Zero fields do
+// not filter.
+type HistoryQuery struct {
+	Sentiment string
+	MinScore  *float64
+	// Since and Until bound Timestamp, Since inclusive and Until exclusive.
+	Since, Until time.Time
+	// After, when set, resumes a listing after the record it points to.
+	After *HistoryCursor
+	Limit int
+}
+
+// HistoryCursor is the position of a record in a listing.
+type HistoryCursor struct {
+	Timestamp time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// before reports whether rec comes before the position c in a listing.
+func (c HistoryCursor) before(rec AnalysisRecord) bool {
+	if !rec.Timestamp.Equal(c.Timestamp) {
+		return rec.Timestamp.After(c.Timestamp)
+	}
+	return rec.ID >= c.ID
+}
+
+func (q HistoryQuery) matches(rec AnalysisRecord) bool {
+	switch {
+	case q.Sentiment != "" && rec.Sentiment != q.Sentiment,
+		q.MinScore != nil && rec.Score < *q.MinScore,
+		!q.Since.IsZero() && rec.Timestamp.Before(q.Since),
+		!q.Until.IsZero() && !rec.Timestamp.Before(q.Until),
+		q.After != nil && q.After.before(rec):
+		return false
+	}
+	return true
+}
+
+// MemoryStorage is a Storage that keeps records in memory, for tests and
+// local development.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	records []AnalysisRecord
+	nextID  int
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (m *MemoryStorage) Save(_ context.Context, rec AnalysisRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	// Zero-padded so that IDs sort in the order they were assigned.
+	rec.ID = fmt.Sprintf("%016d", m.nextID)
+	m.records = append(m.records, rec)
+	return nil
+}
+
+func (m *MemoryStorage) List(_ context.Context, q HistoryQuery) ([]AnalysisRecord, error) {
+	m.mu.Lock()
+	var out []AnalysisRecord
+	for _, rec := range m.records {
+		if q.matches(rec) {
+			out = append(out, rec)
+		}
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b AnalysisRecord) int {
+		if c := b.Timestamp.Compare(a.Timestamp); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+// Records returns the saved records in the order they were saved.
+func (m *MemoryStorage) Records() []AnalysisRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.records)
+}
+
+// storageWriter saves records from a bounded queue in the background.
+// Records that do not fit in the queue are dropped.
+type storageWriter struct {
+	storage Storage
+	log     Logger
+	metrics *Metrics
+	queue   chan AnalysisRecord
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// SetStorage records every sentiment analysis served in storage, through a
+// queue of queueSize records. It must be called before serving requests.
+func (s *Server) SetStorage(storage Storage, queueSize int) {
+	w := &storageWriter{
+		storage: storage,
+		log:     s.log,
+		metrics: s.metrics,
+		queue:   make(chan AnalysisRecord, queueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	s.storage = w
+}
+
+func (w *storageWriter) run() {
+	defer close(w.done)
+	for rec := range w.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), storageWriteTimeout)
+		err := w.storage.Save(ctx, rec)
+		cancel()
+		if err != nil {
+			w.metrics.observeStorageWrite("error")
+			w.log.Warn("failed to save analysis record",
+				"request_id", rec.RequestID, "error", err.Error())
+			continue
+		}
+		w.metrics.observeStorageWrite("ok")
+	}
+}
+
+// enqueue queues rec for saving without blocking.
+func (w *storageWriter) enqueue(rec AnalysisRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		w.metrics.observeStorageWrite("dropped")
+		return
+	}
+	select {
+	case w.queue <- rec:
+	default:
+		w.metrics.observeStorageWrite("dropped")
+	}
+}
+
+// close stops accepting records and waits until the queued ones are saved
+// or ctx is done.
+func (w *storageWriter) close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// record queues the analysis of req for storage and export, where enabled.
+func (s *Server) record(ctx context.Context, req SentimentRequest, resp SentimentResponse, cached bool) {
+	if s.storage == nil && s.exporter == nil {
+		return
+	}
+	sum := sha256.Sum256([]byte(*req.Text))
+	textHash := hex.EncodeToString(sum[:])
+	now := time.Now().UTC()
+	if s.storage != nil {
+		s.storage.enqueue(AnalysisRecord{
+			TextHash:  textHash,
+			Text:      truncateText(*req.Text, storedTextBytes),
+			Sentiment: resp.Sentiment,
+			Score:     resp.Score,
+			Magnitude: resp.Magnitude,
+			Language:  resp.Language,
+			Timestamp: now,
+			RequestID: RequestIDFromContext(ctx),
+		})
+	}
+	if s.exporter != nil {
+		s.exporter.enqueue(AnalysisEvent{
+			Timestamp: now,
+			TextHash:  textHash,
+			Sentiment: resp.Sentiment,
+			Score:     resp.Score,
+			Magnitude: resp.Magnitude,
+			Language:  resp.Language,
+			LatencyMS: milliseconds(resp.upstreamTime),
+			Cached:    cached,
+			APIKeyID:  apiKeyIDFromContext(ctx),
+		})
+	}
+}
+
+// Close stops the background work of the server once it no longer serves
+// requests, waiting for queued analysis records, events and error reports to
+// be saved, exported and sent until ctx is done.
+func (s *Server) Close(ctx context.Context) error {
+	var errs []error
+	if s.storage != nil {
+		errs = append(errs, s.storage.close(ctx))
+	}
+	if s.exporter != nil {
+		errs = append(errs, s.exporter.close(ctx))
+	}
+	if s.reporter != nil {
+		errs = append(errs, s.reporter.close(ctx))
+	}
+	return errors.Join(errs...)
+}
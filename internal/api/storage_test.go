@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// newStorageServer returns a test server saving its analyses in storage.
+func newStorageServer(t *testing.T, storage Storage, queueSize int) *Server {
+	t.Helper()
+	s, err := NewServer(testConfig(), sentiment.Fake{}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	s.SetStorage(storage, queueSize)
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	s := newStorageServer(t, storage, DefaultStorageQueueSize)
+	h := s.Handler()
+
+	text := "I love it. " + strings.Repeat("x", storedTextBytes)
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(`{"text": "`+text+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(requestIDHeader, "storage-test")
+	w := httptest.NewRecorder()
+	before := time.Now()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	// Rejected requests are not analyses.
+	serve(h, http.MethodPost, "/v1/analyze", `{"text": ""}`)
+
+	// Close waits for the queue to drain.
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	records := storage.Records()
+	if len(records) != 1 {
+		t.Fatalf("records %+v, want one", records)
+	}
+	rec := records[0]
+	sum := sha256.Sum256([]byte(text))
+	if rec.TextHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("text hash %s, want the SHA-256 of the full text", rec.TextHash)
+	}
+	if len(rec.Text) > storedTextBytes || !strings.HasPrefix(text, rec.Text) || rec.Text == "" {
+		t.Errorf("text of %d bytes, want the start of the text, at most %d bytes", len(rec.Text), storedTextBytes)
+	}
+	if rec.Sentiment != "positive" || rec.Score <= 0 || rec.Magnitude <= 0 {
+		t.Errorf("record %+v, want the positive result", rec)
+	}
+	if rec.RequestID != "storage-test" || rec.ID == "" {
+		t.Errorf("request ID %q, ID %q, want the request ID and an ID", rec.RequestID, rec.ID)
+	}
+	if rec.Timestamp.Before(before.Add(-time.Second)) || rec.Timestamp.After(time.Now()) || rec.Timestamp.Location() != time.UTC {
+		t.Errorf("timestamp %v, want the UTC time of the request", rec.Timestamp)
+	}
+}
+
+// blockingStorage is a Storage whose saves wait until release is closed.
+type blockingStorage struct {
+	MemoryStorage
+	started chan struct{}
+	release chan struct{}
+	saves   atomic.Int32
+}
+
+func (b *blockingStorage) Save(ctx context.Context, rec AnalysisRecord) error {
+	if b.saves.Add(1) == 1 {
+		close(b.started)
+	}
+	<-b.release
+	return b.MemoryStorage.Save(ctx, rec)
+}
+
+// TestStorageBlocked checks that a storage that does not answer neither
+// slows nor fails requests: the records beyond the queue are dropped.
+func TestStorageBlocked(t *testing.T) {
+	storage := &blockingStorage{started: make(chan struct{}), release: make(chan struct{})}
+	const queueSize = 2
+	s := newStorageServer(t, storage, queueSize)
+	h := s.Handler()
+
+	analyze := func() {
+		t.Helper()
+		start := time.Now()
+		if w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "I love it"}`); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("request took %v with the storage blocked", d)
+		}
+	}
+	analyze()
+	<-storage.started
+	// One record is being saved: queueSize more fit in the queue.
+	for range 9 {
+		analyze()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close with the storage blocked: %v, want the deadline exceeded", err)
+	}
+	close(storage.release)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := len(storage.Records()); got != 1+queueSize {
+		t.Errorf("%d records saved, want %d", got, 1+queueSize)
+	}
+
+	body := serve(h, http.MethodGet, "/metrics", "").Body.String()
+	for _, want := range []string{
+		`sentiment_api_storage_writes_total{result="ok"} 3`,
+		`sentiment_api_storage_writes_total{result="dropped"} 7`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("the metrics lack the series\n\t%s", want)
+		}
+	}
+}
+
+// failingStorage is a Storage whose saves fail.
+type failingStorage struct{ MemoryStorage }
+
+func (*failingStorage) Save(context.Context, AnalysisRecord) error {
+	return errors.New("storage unavailable")
+}
+
+func TestStorageFailing(t *testing.T) {
+	s := newStorageServer(t, &failingStorage{}, DefaultStorageQueueSize)
+	h := s.Handler()
+	for range 3 {
+		if w := serve(h, http.MethodPost, "/v1/analyze", `{"text": "I love it"}`); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 whatever the storage; body %s", w.Code, w.Body)
+		}
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	want := `sentiment_api_storage_writes_total{result="error"} 3`
+	if body := serve(h, http.MethodGet, "/metrics", "").Body.String(); !strings.Contains(body, want+"\n") {
+		t.Errorf("the metrics lack the series\n\t%s", want)
+	}
+}
@@ -0,0 +1,30 @@
+window.onload = function () {
+  // The UI is served at <root>[/<version>]/docs/ui/. The spec lives next to
+  // it and its paths are relative to <root>, whatever path the service is
+  // mounted at.
+  var m = window.location.pathname.match(/^(.*?)(\/v[0-9]+)?\/docs\/ui(\/.*)?$/);
+  var root = m ? m[1] : "";
+  var url = root + (m && m[2] ? m[2] : "") + "/docs";
+
+  fetch(url)
+    .then(function (resp) {
+      if (!resp.ok) {
+        throw new Error("GET " + url + ": " + resp.status);
+      }
+      return resp.json();
+    })
+    .then(function (spec) {
+      spec.basePath = root || "/";
+      window.ui = SwaggerUIBundle({
+        spec: spec,
+        dom_id: "#swagger-ui",
+        deepLinking: true,
+        presets: [SwaggerUIBundle.presets.apis],
+        plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+        layout: "BaseLayout"
+      });
+    })
+    .catch(function (err) {
+      document.getElementById("swagger-ui").textContent = "Failed to load the API description: " + err.message;
+    });
+};
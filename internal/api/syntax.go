@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+// maxSyntaxTokens caps the number of tokens returned by /analyze/syntax so
+// that very long documents don't produce multi-megabyte responses.
+const maxSyntaxTokens = 1000
+
+type SyntaxRequest struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+	// Encoding is the unit of the offsets of the response: "utf8" (the
+	// default) for bytes, "utf16" for UTF-16 code units or "utf32" for code
+	// points.
+	Encoding string `json:"encoding,omitempty" enum:"utf8,utf16,utf32" default:"utf8" doc:"Unit of every begin_offset of the response: utf8 counts bytes, utf16 UTF-16 code units, as JavaScript strings do, and utf32 code points"`
+}
+
+// SyntaxResponse lists the tokens of the text in order. When the text has more
+// than maxSyntaxTokens tokens only the first maxSyntaxTokens are returned and
+// Truncated is set.
+type SyntaxResponse struct {
+	Tokens      []SyntaxToken `json:"tokens"`
+	TotalTokens int           `json:"total_tokens"`
+	Truncated   bool          `json:"truncated"`
+}
+
+type SyntaxToken struct {
+	Text           string         `json:"text"`
+	BeginOffset    int32          `json:"begin_offset"`
+	Lemma          string         `json:"lemma"`
+	PartOfSpeech   string         `json:"part_of_speech"`
+	DependencyEdge DependencyEdge `json:"dependency_edge"`
+}
+
+// DependencyEdge links a token to its head token in the dependency tree.
+type DependencyEdge struct {
+	HeadTokenIndex int32  `json:"head_token_index"`
+	Label          string `json:"label"`
+}
+
+func (s *Server) analyzeSyntaxHandler(w http.ResponseWriter, r *http.Request) {
+	var req SyntaxRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if err := s.validateText(req.Text); err != nil {
+		writeTextError(w, r, err)
+		return
+	}
+
+	lang, err := normalizeLanguage(req.Language)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	req.Language = lang
+	if _, err := encodingType(req.Encoding); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, err := s.analyzeSyntax(ctx, req)
+	if err != nil {
+		s.writeUpstreamError(w, r, err, "analyze syntax")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) analyzeSyntax(ctx context.Context, req SyntaxRequest) (SyntaxResponse, error) {
+	encoding, err := encodingType(req.Encoding)
+	if err != nil {
+		return SyntaxResponse{}, err
+	}
+	s.countAnalyzed(ctx, req.Text)
+	resp, err := s.lang.AnalyzeSyntax(ctx, &languagepb.AnalyzeSyntaxRequest{
+		Document: &languagepb.Document{
+			Source: &languagepb.Document_Content{
+				Content: req.Text,
+			},
+			Type:     languagepb.Document_PLAIN_TEXT,
+			Language: req.Language,
+		},
+		EncodingType: encoding,
+	})
+	if err != nil {
+		return SyntaxResponse{}, err
+	}
+
+	tokens := resp.Tokens
+	out := SyntaxResponse{
+		TotalTokens: len(tokens),
+	}
+	if len(tokens) > maxSyntaxTokens {
+		tokens = tokens[:maxSyntaxTokens]
+		out.Truncated = true
+	}
+
+	out.Tokens = make([]SyntaxToken, 0, len(tokens))
+	for _, token := range tokens {
+		out.Tokens = append(out.Tokens, SyntaxToken{
+			Text:         token.GetText().GetContent(),
+			BeginOffset:  token.GetText().GetBeginOffset(),
+			Lemma:        token.GetLemma(),
+			PartOfSpeech: token.GetPartOfSpeech().GetTag().String(),
+			DependencyEdge: DependencyEdge{
+				HeadTokenIndex: token.GetDependencyEdge().GetHeadTokenIndex(),
+				Label:          token.GetDependencyEdge().GetLabel().String(),
+			},
+		})
+	}
+
+	return out, nil
+}
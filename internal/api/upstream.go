@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// requestContext derives the context for the upstream calls made on behalf of
+// r. It is cancelled when the client disconnects or the request timeout
+// elapses, whichever comes first.
+func (s *Server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), s.requestTimeout)
+}
+
+// writeUpstreamError reports a failed Language API call made to action. Nothing
+// is written when the client has already gone away.
+func (s *Server) writeUpstreamError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	id := RequestIDFromContext(r.Context())
+	var (
+		openErr       *sentiment.CircuitOpenError
+		overloadedErr *sentiment.OverloadedError
+	)
+	switch {
+	case r.Context().Err() != nil:
+		s.log.Info("client disconnected before upstream call completed",
+			"request_id", id, "action", action, "error", err.Error())
+	case errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded:
+		s.log.Warn("upstream call timed out",
+			"request_id", id, "action", action, "error", err.Error())
+		noteFailure(r.Context(), "upstream call timed out: "+err.Error(), "writeUpstreamError")
+		writeError(w, r, http.StatusGatewayTimeout, codeUpstreamTimeout, "the Language API did not respond in time")
+	case errors.As(err, &openErr):
+		s.log.Warn("upstream call rejected by the circuit breaker",
+			"request_id", id, "action", action)
+		setRetryAfter(w, openErr.RetryAfter)
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "the Language API is unavailable, retry later")
+	case errors.As(err, &overloadedErr):
+		s.log.Warn("upstream call rejected: too many calls in flight",
+			"request_id", id, "action", action)
+		setRetryAfter(w, overloadedErr.RetryAfter)
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "too many requests are being analyzed, retry later")
+	default:
+		s.log.Error("upstream call failed",
+			"request_id", id, "action", action, "error", err.Error())
+		noteFailure(r.Context(), "failed to "+action+": "+err.Error(), "writeUpstreamError")
+		writeError(w, r, http.StatusInternalServerError, codeUpstreamError, "failed to "+action)
+	}
+}
+
+// upstreamStatus returns the status code writeUpstreamError answers err
+// with.
+func upstreamStatus(err error) int {
+	var (
+		openErr       *sentiment.CircuitOpenError
+		overloadedErr *sentiment.OverloadedError
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case errors.As(err, &openErr), errors.As(err, &overloadedErr):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// retryableError reports whether an analysis that failed with err may
+// succeed when retried later, as queued work is.
+func retryableError(err error) bool {
+	var openErr *sentiment.CircuitOpenError
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || errors.As(err, &openErr) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition, codes.Unimplemented:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// hangingAnalyzer is a Language API that does not answer: each call blocks
+// until its context is done, signalling started first, and sends the error
+// of the context to ended.
+type hangingAnalyzer struct {
+	started chan struct{}
+	ended   chan error
+}
+
+func newHangingAnalyzer() *hangingAnalyzer {
+	return &hangingAnalyzer{started: make(chan struct{}, 1), ended: make(chan error, 1)}
+}
+
+func (a *hangingAnalyzer) Analyze(ctx context.Context, _ sentiment.Document) (sentiment.Result, error) {
+	a.started <- struct{}{}
+	<-ctx.Done()
+	a.ended <- ctx.Err()
+	return sentiment.Result{}, ctx.Err()
+}
+
+func newHangingServer(t *testing.T, timeout time.Duration) (*Server, *hangingAnalyzer) {
+	t.Helper()
+	cfg := testConfig()
+	cfg.RequestTimeout = timeout
+	a := newHangingAnalyzer()
+	s, err := NewServer(cfg, a, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s, a
+}
+
+func TestRequestTimeout(t *testing.T) {
+	s, a := newHangingServer(t, 50*time.Millisecond)
+
+	w := serve(s.Handler(), http.MethodPost, "/v1/analyze", `{"text": "hello"}`)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if resp.Error.Code != codeUpstreamTimeout || resp.Error.RequestID == "" {
+		t.Errorf("error = %+v, want %q with a request ID", resp.Error, codeUpstreamTimeout)
+	}
+	if err := <-a.ended; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("upstream call ended with %v, want the deadline", err)
+	}
+}
+
+func TestClientDisconnectCancelsUpstream(t *testing.T) {
+	s, a := newHangingServer(t, time.Minute)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/v1/analyze", strings.NewReader(`{"text": "hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	errc := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		errc <- err
+	}()
+
+	<-a.started
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("client error = %v, want it canceled", err)
+	}
+	select {
+	case err := <-a.ended:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("upstream call ended with %v, want it canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the upstream call was not canceled when the client disconnected")
+	}
+}
+
+func TestOverloadedRetryAfter(t *testing.T) {
+	s, err := NewServer(testConfig(), failingAnalyzer{&sentiment.OverloadedError{RetryAfter: 1500 * time.Millisecond}}, stubLanguage{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	w := serve(s.Handler(), http.MethodPost, "/v1/analyze", `{"text": "hello"}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want the delay rounded up to 2 seconds", got)
+	}
+}
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Pages are fetched with fetchTimeout, following at most fetchMaxRedirects
+// redirects, and at most fetchMaxBytes of the body are read.
+const (
+	fetchTimeout      = 10 * time.Second
+	fetchMaxRedirects = 5
+	fetchMaxBytes     = 2 << 20
+)
+
+var (
+	errURLNotAllowed   = errors.New("URL is not allowed")
+	errUnsupportedPage = errors.New("unsupported content type")
+)
+
+// fetchError is a failure to fetch a page: either no response, or a non-2xx
+// Status.
+type fetchError struct {
+	Status string
+	err    error
+}
+
+func (e *fetchError) Error() string {
+	if e.Status != "" {
+		return "fetching the URL returned " + e.Status
+	}
+	return "failed to fetch the URL: " + e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+type URLRequest struct {
+	URL              string `json:"url" required:"true" format:"uri"`
+	Language         string `json:"language,omitempty" doc:"ISO-639-1 language code of the page; detected automatically when omitted"`
+	IncludeSentences bool   `json:"include_sentences,omitempty"`
+}
+
+type URLResponse struct {
+	SentimentResponse
+	// FinalURL is the URL of the page analyzed, after redirects.
+	FinalURL string `json:"final_url" doc:"URL of the page analyzed, after redirects"`
+	// BytesAnalyzed is the size of the text extracted from the page.
+	BytesAnalyzed int `json:"bytes_analyzed" doc:"Size of the text extracted from the page"`
+}
+
+// newFetchClient returns the client used to fetch pages. It refuses to
+// connect to loopback, private and other non-public addresses. The check is
+// made on the address actually dialed, so it also covers redirects and DNS
+// names resolving to internal addresses.
+func newFetchClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(addr.Addr()) {
+				return fmt.Errorf("%w: %s is not a public address", errURLNotAllowed, address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: fetchTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   fetchTimeout,
+			ResponseHeaderTimeout: fetchTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= fetchMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", fetchMaxRedirects)
+			}
+			return checkFetchURL(req.URL)
+		},
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not
+// count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// checkFetchURL rejects URLs that are not plain http or https.
+func checkFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", errURLNotAllowed)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: host is missing", errURLNotAllowed)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed", errURLNotAllowed)
+	}
+	return nil
+}
+
+func (s *Server) analyzeURLHandler(w http.ResponseWriter, r *http.Request) {
+	var req URLRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid url: "+err.Error())
+		return
+	}
+	if err := checkFetchURL(u); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeURLNotAllowed, err.Error())
+		return
+	}
+
+	lang, err := normalizeLanguage(req.Language)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	text, page, err := s.fetchText(r.Context(), u)
+	if err != nil {
+		s.writeFetchError(w, r, err)
+		return
+	}
+
+	text = truncateText(text, s.maxTextBytes)
+	if strings.TrimSpace(text) == "" {
+		writeError(w, r, http.StatusUnprocessableEntity, codeEmptyText, "the page contains no text")
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, _, err := s.analyzeCached(ctx, SentimentRequest{
+		Text:             &text,
+		Language:         lang,
+		IncludeSentences: req.IncludeSentences,
+	})
+	if err != nil {
+		s.writeUpstreamError(w, r, err, "analyze sentiment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(URLResponse{
+		SentimentResponse: resp,
+		FinalURL:          page.url,
+		BytesAnalyzed:     len(text),
+	})
+}
+
+// fetchedPage is a response of fetchBody.
+type fetchedPage struct {
+	body      []byte
+	mediaType string
+	// url is the URL of the page after redirects, and redirects the URLs
+	// redirected from, in order, starting with the one requested.
+	url       string
+	redirects []string
+	// status is the status code of the last response, 0 if there was none.
+	status int
+}
+
+// fetchText fetches u and returns the text of the page. HTML pages have their
+// markup, scripts and styles removed.
+func (s *Server) fetchText(ctx context.Context, u *url.URL) (string, fetchedPage, error) {
+	ctx, span := tracer.Start(ctx, "fetch.url")
+	text, page, err := s.doFetch(ctx, u)
+	endSpan(span, err)
+	return text, page, err
+}
+
+func (s *Server) doFetch(ctx context.Context, u *url.URL) (string, fetchedPage, error) {
+	page, err := s.fetchBody(ctx, u, "text/html, text/plain;q=0.9")
+	if err != nil {
+		return "", page, err
+	}
+	switch page.mediaType {
+	case "text/plain":
+		return strings.ToValidUTF8(string(page.body), ""), page, nil
+	case "text/html", "application/xhtml+xml":
+		return htmlText(string(page.body)), page, nil
+	default:
+		return "", page, fmt.Errorf("%w %q: only HTML and plain text pages can be analyzed", errUnsupportedPage, page.mediaType)
+	}
+}
+
+// fetchBody fetches u, asking for the media types in accept, and returns at
+// most fetchMaxBytes of the body. The page is returned with what is known of
+// it on errors as well.
+func (s *Server) fetchBody(ctx context.Context, u *url.URL, accept string) (fetchedPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fetchedPage{}, err
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := s.fetcher.Do(req)
+	if err != nil {
+		if errors.Is(err, errURLNotAllowed) || ctx.Err() != nil {
+			return fetchedPage{}, err
+		}
+		return fetchedPage{}, &fetchError{err: err}
+	}
+	defer resp.Body.Close()
+
+	page := fetchedPage{url: resp.Request.URL.String(), status: resp.StatusCode}
+	for r := resp.Request; r.Response != nil; {
+		r = r.Response.Request
+		page.redirects = append(page.redirects, r.URL.String())
+	}
+	slices.Reverse(page.redirects)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return page, &fetchError{Status: resp.Status}
+	}
+
+	page.mediaType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if page.body, err = io.ReadAll(io.LimitReader(resp.Body, fetchMaxBytes)); err != nil {
+		return page, &fetchError{err: err}
+	}
+	return page, nil
+}
+
+// writeFetchError reports a failure of fetchBody, or of the checks of what it
+// fetched.
+func (s *Server) writeFetchError(w http.ResponseWriter, r *http.Request, err error) {
+	var fetchErr *fetchError
+	switch {
+	case errors.Is(err, errURLNotAllowed):
+		writeError(w, r, http.StatusBadRequest, codeURLNotAllowed, err.Error())
+	case errors.Is(err, errUnsupportedPage):
+		writeError(w, r, http.StatusUnprocessableEntity, codeUnsupportedMedia, err.Error())
+	case errors.As(err, &fetchErr):
+		s.log.Warn("failed to fetch URL",
+			"request_id", RequestIDFromContext(r.Context()), "error", err.Error())
+		writeError(w, r, http.StatusBadGateway, codeFetchFailed, err.Error())
+	default:
+		s.writeUpstreamError(w, r, err, "fetch the URL")
+	}
+}
+
+// fetchStatus returns the status code writeFetchError answers err with.
+func fetchStatus(err error) int {
+	var fetchErr *fetchError
+	switch {
+	case errors.Is(err, errURLNotAllowed):
+		return http.StatusBadRequest
+	case errors.Is(err, errUnsupportedPage):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &fetchErr):
+		return http.StatusBadGateway
+	default:
+		return upstreamStatus(err)
+	}
+}
+
+// htmlText returns the text content of an HTML document, skipping scripts,
+// styles and other elements that are not displayed as text.
+func htmlText(doc string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(doc))
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); hiddenElement(string(name)) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); hiddenElement(string(name)) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func hiddenElement(name string) bool {
+	switch name {
+	case "script", "style", "noscript", "template", "head", "svg":
+		return true
+	default:
+		return false
+	}
+}
+
+// truncateText shortens text to at most n bytes without splitting a
+// character.
+func truncateText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultURLsTimeout bounds an /analyze/urls request unless configured
+// otherwise.
+const DefaultURLsTimeout = 30 * time.Second
+
+type URLsRequest struct {
+	URLs     []string `json:"urls" required:"true"`
+	Language string   `json:"language,omitempty" doc:"ISO-639-1 language code of the pages; detected automatically when omitted"`
+}
+
+// URLsResponse is sent with 200 as soon as the request itself is valid,
+// however many of its URLs fail.
+type URLsResponse struct {
+	Results []URLResult  `json:"results" doc:"In input order"`
+	Summary BatchSummary `json:"summary"`
+}
+
+// URLResult is the outcome for one URL. A URL given more than once is
+// fetched once and gets the same result every time.
+type URLResult struct {
+	URL         string   `json:"url" doc:"The URL as given"`
+	FinalURL    string   `json:"final_url,omitempty" doc:"URL of the page analyzed, after redirects"`
+	Redirects   []string `json:"redirects,omitempty" doc:"URLs redirected from, in order, starting with the one requested"`
+	FetchStatus int      `json:"fetch_status,omitempty" doc:"Status code the page was fetched with; absent when no response was received"`
+	BatchResult
+}
+
+func (s *Server) analyzeURLsHandler(w http.ResponseWriter, r *http.Request) {
+	var req URLsRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if len(req.URLs) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "urls must contain at least one item")
+		return
+	}
+	lang, err := normalizeLanguage(req.Language)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	// Every valid URL is fetched once, however many times it is given;
+	// unique[fetches[i]] is the one of req.URLs[i], which is invalid when
+	// fetches[i] is -1.
+	resp := URLsResponse{Results: make([]URLResult, len(req.URLs))}
+	fetches := make([]int, len(req.URLs))
+	var unique []*url.URL
+	seen := make(map[string]int)
+	for i, raw := range req.URLs {
+		fetches[i] = -1
+		u, err := url.Parse(raw)
+		if err == nil {
+			err = checkFetchURL(u)
+		}
+		if err != nil {
+			resp.Results[i].BatchResult = BatchResult{Status: http.StatusBadRequest, Error: "invalid url: " + err.Error()}
+			continue
+		}
+		// The fragment is not sent, so it does not make another page.
+		u.Fragment, u.RawFragment = "", ""
+		j, ok := seen[u.String()]
+		if !ok {
+			j = len(unique)
+			seen[u.String()] = j
+			unique = append(unique, u)
+		}
+		fetches[i] = j
+	}
+
+	// The pool runs until the client goes away, so that the URLs left when
+	// the deadline passes still get a result, failing right away.
+	ctx, cancel := context.WithTimeout(r.Context(), s.urlsTimeout)
+	defer cancel()
+	requestID := RequestIDFromContext(r.Context())
+	results := mapSlice(r.Context(), s.batchWorkers, unique, func(_ context.Context, _ int, u *url.URL) URLResult {
+		return s.analyzeURLItem(ctx, requestID, u, lang)
+	})
+	if len(results) < len(unique) {
+		return
+	}
+
+	for i, j := range fetches {
+		if j >= 0 {
+			resp.Results[i] = results[j]
+		}
+		resp.Results[i].URL = req.URLs[i]
+		if resp.Results[i].Error != "" {
+			resp.Summary.Failed++
+		} else {
+			resp.Summary.Succeeded++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// analyzeURLItem fetches and analyzes one URL of an /analyze/urls request.
+func (s *Server) analyzeURLItem(ctx context.Context, requestID string, u *url.URL, lang string) URLResult {
+	if err := ctx.Err(); err != nil {
+		return URLResult{BatchResult: BatchResult{Status: upstreamStatus(err), Error: "the URL was not fetched before the deadline of the request"}}
+	}
+
+	text, page, err := s.fetchText(ctx, u)
+	result := URLResult{FinalURL: page.url, Redirects: page.redirects, FetchStatus: page.status}
+	if err != nil {
+		s.log.Warn("failed to fetch URL",
+			"request_id", requestID, "url", u.String(), "error", err.Error())
+		result.BatchResult = BatchResult{Status: fetchStatus(err), Error: err.Error()}
+		return result
+	}
+
+	text = truncateText(text, s.maxTextBytes)
+	if strings.TrimSpace(text) == "" {
+		result.BatchResult = BatchResult{Status: http.StatusUnprocessableEntity, Error: "the page contains no text"}
+		return result
+	}
+
+	actx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	resp, _, err := s.analyzeCached(actx, SentimentRequest{Text: &text, Language: lang})
+	if err != nil {
+		s.log.Error("failed to analyze URL",
+			"request_id", requestID, "url", u.String(), "error", err.Error())
+		result.BatchResult = BatchResult{Status: upstreamStatus(err), Error: err.Error()}
+		return result
+	}
+	result.BatchResult = BatchResult{Status: http.StatusOK, SentimentResponse: &resp}
+	return result
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	errMissingText  = errors.New("text is required")
+	errEmptyText    = errors.New("text must not be empty or whitespace only")
+	errTextTooLarge = errors.New("text is too large")
+)
+
+// ErrInvalidRequest is wrapped by the errors Server.Analyze returns for
+// requests that fail validation.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// validateText rejects texts that are not worth sending to the Language API.
+func (s *Server) validateText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errEmptyText
+	}
+	if len(text) > s.maxTextBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", errTextTooLarge, len(text), s.maxTextBytes)
+	}
+	return nil
+}
+
+// requestError is a problem with a field of the request other than its text.
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// writeTextError reports an error returned by validateText or
+// validateSentimentRequest.
+func writeTextError(w http.ResponseWriter, r *http.Request, err error) {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	case errors.Is(err, errTextTooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeTextTooLarge, err.Error())
+	case errors.Is(err, errMissingText):
+		writeError(w, r, http.StatusBadRequest, codeMissingText, err.Error())
+	default:
+		writeError(w, r, http.StatusBadRequest, codeEmptyText, err.Error())
+	}
+}
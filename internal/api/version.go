@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// BuildInfo identifies the running build.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit" doc:"Git commit the binary was built from"`
+	BuildTime string `json:"build_time" doc:"RFC 3339 time of the build, or of the commit when only that is known"`
+	GoVersion string `json:"go_version"`
+}
+
+// SetBuildInfo sets the build served by /version and exported as the
+// build_info metric.
+func (s *Server) SetBuildInfo(info BuildInfo) {
+	s.build = info
+	s.metrics.observeBuildInfo(info)
+}
+
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.build)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	h := s.Handler()
+	old := BuildInfo{Version: "v1.0.0", Commit: "0123abc", BuildTime: "2026-09-01T10:00:00Z", GoVersion: "go1.26.0"}
+	s.SetBuildInfo(old)
+	info := BuildInfo{Version: "v1.2.3", Commit: "abc0123", BuildTime: "2026-10-01T12:00:00Z", GoVersion: "go1.26.1"}
+	s.SetBuildInfo(info)
+
+	w := serve(h, http.MethodGet, "/version", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	if got != info {
+		t.Errorf("version %+v, want %+v", got, info)
+	}
+
+	// Only the latest build is exported.
+	body := serve(h, http.MethodGet, "/metrics", "").Body.String()
+	want := `sentiment_api_build_info{commit="abc0123",go_version="go1.26.1",version="v1.2.3"} 1`
+	if !strings.Contains(body, want+"\n") {
+		t.Errorf("the metrics lack the series\n\t%s", want)
+	}
+	if strings.Contains(body, old.Commit) {
+		t.Errorf("the metrics still export the build %+v", old)
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket connections are pinged every wsPingInterval and dropped if no pong
+// arrives within wsPongWait. At most wsMaxInFlight messages per connection
+// are analyzed at once; further messages wait.
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsWriteWait    = 10 * time.Second
+	wsMaxInFlight  = 8
+)
+
+// WSMessage is a frame sent by the client on /ws.
+type WSMessage struct {
+	ID               string  `json:"id" doc:"Echoed in the matching WSResult"`
+	Text             *string `json:"text" required:"true"`
+	Language         string  `json:"language,omitempty"`
+	IncludeSentences bool    `json:"include_sentences,omitempty"`
+}
+
+// WSResult is the frame sent back for each WSMessage, carrying its ID and
+// either the analysis or an error.
+type WSResult struct {
+	ID string `json:"id"`
+	*SentimentResponse
+	Error *ErrorDetail `json:"error,omitempty"`
+}
+
+// checkWSOrigin accepts upgrades from non-browser clients, from the same
+// host and from the origins allowed by the CORS policy.
+func (s *Server) checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || s.cors.allowed(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// wsHandler upgrades GET /ws to a WebSocket on which the client sends
+// WSMessage frames and receives a WSResult frame for each, in completion
+// order. The connection is closed with "going away" once Shutdown is called.
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkWSOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response.
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	out := make(chan WSResult, wsMaxInFlight)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		defer cancel()
+		s.writeWS(conn, out)
+	}()
+
+	conn.SetReadLimit(s.maxBodyBytes)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	sem := make(chan struct{}, wsMaxInFlight)
+	var wg sync.WaitGroup
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) && ctx.Err() == nil {
+				s.log.Info("websocket read failed",
+					"request_id", RequestIDFromContext(ctx), "error", err.Error())
+			}
+			break
+		}
+
+		var msg WSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			select {
+			case out <- WSResult{Error: &ErrorDetail{
+				Code:      codeInvalidRequest,
+				Message:   "invalid JSON message: " + err.Error(),
+				RequestID: RequestIDFromContext(ctx),
+			}}:
+			case <-writerDone:
+			}
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			select {
+			case out <- s.analyzeWSMessage(ctx, msg):
+			case <-writerDone:
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(out)
+	<-writerDone
+}
+
+// writeWS is the connection's only writer: it sends the results from out,
+// pings the client and closes the connection on shutdown or once out is
+// closed.
+func (s *Server) writeWS(conn *websocket.Conn, out <-chan WSResult) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	closeWith := func(code int, text string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+		conn.Close()
+	}
+
+	for {
+		select {
+		case result, ok := <-out:
+			if !ok {
+				closeWith(websocket.CloseNormalClosure, "")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(result); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				conn.Close()
+				return
+			}
+		case <-s.shutdown:
+			closeWith(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+	}
+}
+
+func (s *Server) analyzeWSMessage(ctx context.Context, msg WSMessage) WSResult {
+	result := WSResult{ID: msg.ID}
+	fail := func(code, message string) WSResult {
+		result.Error = &ErrorDetail{Code: code, Message: message, RequestID: RequestIDFromContext(ctx)}
+		return result
+	}
+
+	if msg.Text == nil {
+		return fail(codeMissingText, errMissingText.Error())
+	}
+	if err := s.validateText(*msg.Text); err != nil {
+		if errors.Is(err, errTextTooLarge) {
+			return fail(codeTextTooLarge, err.Error())
+		}
+		return fail(codeEmptyText, err.Error())
+	}
+	lang, err := normalizeLanguage(msg.Language)
+	if err != nil {
+		return fail(codeInvalidRequest, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	resp, _, err := s.analyzeCached(ctx, SentimentRequest{
+		Text:             msg.Text,
+		Language:         lang,
+		IncludeSentences: msg.IncludeSentences,
+	})
+	if err != nil {
+		s.log.Error("failed to analyze websocket message",
+			"request_id", RequestIDFromContext(ctx), "id", msg.ID, "error", err.Error())
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fail(codeUpstreamTimeout, "the Language API did not respond in time")
+		}
+		return fail(codeUpstreamError, "failed to analyze sentiment")
+	}
+	result.SentimentResponse = &resp
+	return result
+}
+
+// Shutdown asks long-lived connections such as WebSockets to close. It is
+// meant to be registered with http.Server.RegisterOnShutdown, since
+// http.Server.Shutdown does not wait for hijacked connections.
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
@@ -0,0 +1,5 @@
+// Package sentimentv1 holds the code generated from
+// proto/sentiment/v1/sentiment.proto.
+package sentimentv1
+
+//go:generate protoc -I ../../../../proto --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative sentiment/v1/sentiment.proto
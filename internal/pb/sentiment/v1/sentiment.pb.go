@@ -0,0 +1,620 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: sentiment/v1/sentiment.proto
+
+package sentimentv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DocumentType int32
+
+const (
+	DocumentType_DOCUMENT_TYPE_UNSPECIFIED DocumentType = 0
+	DocumentType_DOCUMENT_TYPE_PLAIN_TEXT  DocumentType = 1
+	// HTML documents have their markup ignored.
+	DocumentType_DOCUMENT_TYPE_HTML DocumentType = 2
+)
+
+// Enum value maps for DocumentType.
+var (
+	DocumentType_name = map[int32]string{
+		0: "DOCUMENT_TYPE_UNSPECIFIED",
+		1: "DOCUMENT_TYPE_PLAIN_TEXT",
+		2: "DOCUMENT_TYPE_HTML",
+	}
+	DocumentType_value = map[string]int32{
+		"DOCUMENT_TYPE_UNSPECIFIED": 0,
+		"DOCUMENT_TYPE_PLAIN_TEXT":  1,
+		"DOCUMENT_TYPE_HTML":        2,
+	}
+)
+
+func (x DocumentType) Enum() *DocumentType {
+	p := new(DocumentType)
+	*p = x
+	return p
+}
+
+func (x DocumentType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DocumentType) Descriptor() protoreflect.EnumDescriptor {
+	return file_sentiment_v1_sentiment_proto_enumTypes[0].Descriptor()
+}
+
+func (DocumentType) Type() protoreflect.EnumType {
+	return &file_sentiment_v1_sentiment_proto_enumTypes[0]
+}
+
+func (x DocumentType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DocumentType.Descriptor instead.
+func (DocumentType) EnumDescriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{0}
+}
+
+type AnalyzeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Text  string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	// ISO-639-1 language code; detected automatically when empty.
+	Language         string `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"`
+	IncludeSentences bool   `protobuf:"varint,3,opt,name=include_sentences,json=includeSentences,proto3" json:"include_sentences,omitempty"`
+	// Defaults to plain text.
+	DocumentType  DocumentType `protobuf:"varint,4,opt,name=document_type,json=documentType,proto3,enum=sentiment.v1.DocumentType" json:"document_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeRequest) Reset() {
+	*x = AnalyzeRequest{}
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeRequest) ProtoMessage() {}
+
+func (x *AnalyzeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeRequest.ProtoReflect.Descriptor instead.
+func (*AnalyzeRequest) Descriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AnalyzeRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *AnalyzeRequest) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *AnalyzeRequest) GetIncludeSentences() bool {
+	if x != nil {
+		return x.IncludeSentences
+	}
+	return false
+}
+
+func (x *AnalyzeRequest) GetDocumentType() DocumentType {
+	if x != nil {
+		return x.DocumentType
+	}
+	return DocumentType_DOCUMENT_TYPE_UNSPECIFIED
+}
+
+type AnalyzeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "positive", "negative" or "neutral".
+	Sentiment string `protobuf:"bytes,1,opt,name=sentiment,proto3" json:"sentiment,omitempty"`
+	// Absolute value of the document score, from 0 to 1. Deprecated: use
+	// score, which keeps the sign.
+	//
+	// Deprecated: Marked as deprecated in sentiment/v1/sentiment.proto.
+	SentimentScore float32 `protobuf:"fixed32,2,opt,name=sentiment_score,json=sentimentScore,proto3" json:"sentiment_score,omitempty"`
+	Magnitude      float32 `protobuf:"fixed32,3,opt,name=magnitude,proto3" json:"magnitude,omitempty"`
+	// Language of the text, as given or as detected.
+	Language  string               `protobuf:"bytes,4,opt,name=language,proto3" json:"language,omitempty"`
+	Sentences []*SentenceSentiment `protobuf:"bytes,5,rep,name=sentences,proto3" json:"sentences,omitempty"`
+	// Analyzer that produced the result: "gcp", or "local" when the Language
+	// API was unavailable.
+	Provider string `protobuf:"bytes,6,opt,name=provider,proto3" json:"provider,omitempty"`
+	// Document score, from -1 (negative) to 1 (positive).
+	Score float32 `protobuf:"fixed32,7,opt,name=score,proto3" json:"score,omitempty"`
+	// Whether language was detected rather than given in the request.
+	LanguageDetected bool `protobuf:"varint,8,opt,name=language_detected,json=languageDetected,proto3" json:"language_detected,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *AnalyzeResponse) Reset() {
+	*x = AnalyzeResponse{}
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeResponse) ProtoMessage() {}
+
+func (x *AnalyzeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeResponse.ProtoReflect.Descriptor instead.
+func (*AnalyzeResponse) Descriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AnalyzeResponse) GetSentiment() string {
+	if x != nil {
+		return x.Sentiment
+	}
+	return ""
+}
+
+// Deprecated: Marked as deprecated in sentiment/v1/sentiment.proto.
+func (x *AnalyzeResponse) GetSentimentScore() float32 {
+	if x != nil {
+		return x.SentimentScore
+	}
+	return 0
+}
+
+func (x *AnalyzeResponse) GetMagnitude() float32 {
+	if x != nil {
+		return x.Magnitude
+	}
+	return 0
+}
+
+func (x *AnalyzeResponse) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *AnalyzeResponse) GetSentences() []*SentenceSentiment {
+	if x != nil {
+		return x.Sentences
+	}
+	return nil
+}
+
+func (x *AnalyzeResponse) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *AnalyzeResponse) GetScore() float32 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *AnalyzeResponse) GetLanguageDetected() bool {
+	if x != nil {
+		return x.LanguageDetected
+	}
+	return false
+}
+
+type SentenceSentiment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Score         float32                `protobuf:"fixed32,2,opt,name=score,proto3" json:"score,omitempty"`
+	Magnitude     float32                `protobuf:"fixed32,3,opt,name=magnitude,proto3" json:"magnitude,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SentenceSentiment) Reset() {
+	*x = SentenceSentiment{}
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SentenceSentiment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SentenceSentiment) ProtoMessage() {}
+
+func (x *SentenceSentiment) ProtoReflect() protoreflect.Message {
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SentenceSentiment.ProtoReflect.Descriptor instead.
+func (*SentenceSentiment) Descriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SentenceSentiment) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *SentenceSentiment) GetScore() float32 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *SentenceSentiment) GetMagnitude() float32 {
+	if x != nil {
+		return x.Magnitude
+	}
+	return 0
+}
+
+type AnalyzeStreamRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Echoed in the matching AnalyzeStreamResponse.
+	Id            string          `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Request       *AnalyzeRequest `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeStreamRequest) Reset() {
+	*x = AnalyzeStreamRequest{}
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeStreamRequest) ProtoMessage() {}
+
+func (x *AnalyzeStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeStreamRequest.ProtoReflect.Descriptor instead.
+func (*AnalyzeStreamRequest) Descriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *AnalyzeStreamRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AnalyzeStreamRequest) GetRequest() *AnalyzeRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type AnalyzeStreamResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are valid to be assigned to Result:
+	//
+	//	*AnalyzeStreamResponse_Response
+	//	*AnalyzeStreamResponse_Error
+	Result        isAnalyzeStreamResponse_Result `protobuf_oneof:"result"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeStreamResponse) Reset() {
+	*x = AnalyzeStreamResponse{}
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeStreamResponse) ProtoMessage() {}
+
+func (x *AnalyzeStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeStreamResponse.ProtoReflect.Descriptor instead.
+func (*AnalyzeStreamResponse) Descriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AnalyzeStreamResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AnalyzeStreamResponse) GetResult() isAnalyzeStreamResponse_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *AnalyzeStreamResponse) GetResponse() *AnalyzeResponse {
+	if x != nil {
+		if x, ok := x.Result.(*AnalyzeStreamResponse_Response); ok {
+			return x.Response
+		}
+	}
+	return nil
+}
+
+func (x *AnalyzeStreamResponse) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Result.(*AnalyzeStreamResponse_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isAnalyzeStreamResponse_Result interface {
+	isAnalyzeStreamResponse_Result()
+}
+
+type AnalyzeStreamResponse_Response struct {
+	Response *AnalyzeResponse `protobuf:"bytes,2,opt,name=response,proto3,oneof"`
+}
+
+type AnalyzeStreamResponse_Error struct {
+	Error *Error `protobuf:"bytes,3,opt,name=error,proto3,oneof"`
+}
+
+func (*AnalyzeStreamResponse_Response) isAnalyzeStreamResponse_Result() {}
+
+func (*AnalyzeStreamResponse_Error) isAnalyzeStreamResponse_Result() {}
+
+// Error mirrors the error object of the HTTP API.
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_sentiment_v1_sentiment_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_sentiment_v1_sentiment_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_sentiment_v1_sentiment_proto protoreflect.FileDescriptor
+
+const file_sentiment_v1_sentiment_proto_rawDesc = "" +
+	"\n" +
+	"\x1csentiment/v1/sentiment.proto\x12\fsentiment.v1\"\xae\x01\n" +
+	"\x0eAnalyzeRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\x12+\n" +
+	"\x11include_sentences\x18\x03 \x01(\bR\x10includeSentences\x12?\n" +
+	"\rdocument_type\x18\x04 \x01(\x0e2\x1a.sentiment.v1.DocumentTypeR\fdocumentType\"\xb4\x02\n" +
+	"\x0fAnalyzeResponse\x12\x1c\n" +
+	"\tsentiment\x18\x01 \x01(\tR\tsentiment\x12+\n" +
+	"\x0fsentiment_score\x18\x02 \x01(\x02B\x02\x18\x01R\x0esentimentScore\x12\x1c\n" +
+	"\tmagnitude\x18\x03 \x01(\x02R\tmagnitude\x12\x1a\n" +
+	"\blanguage\x18\x04 \x01(\tR\blanguage\x12=\n" +
+	"\tsentences\x18\x05 \x03(\v2\x1f.sentiment.v1.SentenceSentimentR\tsentences\x12\x1a\n" +
+	"\bprovider\x18\x06 \x01(\tR\bprovider\x12\x14\n" +
+	"\x05score\x18\a \x01(\x02R\x05score\x12+\n" +
+	"\x11language_detected\x18\b \x01(\bR\x10languageDetected\"[\n" +
+	"\x11SentenceSentiment\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x02R\x05score\x12\x1c\n" +
+	"\tmagnitude\x18\x03 \x01(\x02R\tmagnitude\"^\n" +
+	"\x14AnalyzeStreamRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x126\n" +
+	"\arequest\x18\x02 \x01(\v2\x1c.sentiment.v1.AnalyzeRequestR\arequest\"\x9b\x01\n" +
+	"\x15AnalyzeStreamResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12;\n" +
+	"\bresponse\x18\x02 \x01(\v2\x1d.sentiment.v1.AnalyzeResponseH\x00R\bresponse\x12+\n" +
+	"\x05error\x18\x03 \x01(\v2\x13.sentiment.v1.ErrorH\x00R\x05errorB\b\n" +
+	"\x06result\"5\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage*c\n" +
+	"\fDocumentType\x12\x1d\n" +
+	"\x19DOCUMENT_TYPE_UNSPECIFIED\x10\x00\x12\x1c\n" +
+	"\x18DOCUMENT_TYPE_PLAIN_TEXT\x10\x01\x12\x16\n" +
+	"\x12DOCUMENT_TYPE_HTML\x10\x022\xb8\x01\n" +
+	"\x10SentimentService\x12F\n" +
+	"\aAnalyze\x12\x1c.sentiment.v1.AnalyzeRequest\x1a\x1d.sentiment.v1.AnalyzeResponse\x12\\\n" +
+	"\rAnalyzeStream\x12\".sentiment.v1.AnalyzeStreamRequest\x1a#.sentiment.v1.AnalyzeStreamResponse(\x010\x01BYZWgithub.com/53jk1/sentiment-analysis-api-golang-gcp/internal/pb/sentiment/v1;sentimentv1b\x06proto3"
+
+var (
+	file_sentiment_v1_sentiment_proto_rawDescOnce sync.Once
+	file_sentiment_v1_sentiment_proto_rawDescData []byte
+)
+
+func file_sentiment_v1_sentiment_proto_rawDescGZIP() []byte {
+	file_sentiment_v1_sentiment_proto_rawDescOnce.Do(func() {
+		file_sentiment_v1_sentiment_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sentiment_v1_sentiment_proto_rawDesc), len(file_sentiment_v1_sentiment_proto_rawDesc)))
+	})
+	return file_sentiment_v1_sentiment_proto_rawDescData
+}
+
+var file_sentiment_v1_sentiment_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_sentiment_v1_sentiment_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_sentiment_v1_sentiment_proto_goTypes = []any{
+	(DocumentType)(0),             // 0: sentiment.v1.DocumentType
+	(*AnalyzeRequest)(nil),        // 1: sentiment.v1.AnalyzeRequest
+	(*AnalyzeResponse)(nil),       // 2: sentiment.v1.AnalyzeResponse
+	(*SentenceSentiment)(nil),     // 3: sentiment.v1.SentenceSentiment
+	(*AnalyzeStreamRequest)(nil),  // 4: sentiment.v1.AnalyzeStreamRequest
+	(*AnalyzeStreamResponse)(nil), // 5: sentiment.v1.AnalyzeStreamResponse
+	(*Error)(nil),                 // 6: sentiment.v1.Error
+}
+var file_sentiment_v1_sentiment_proto_depIdxs = []int32{
+	0, // 0: sentiment.v1.AnalyzeRequest.document_type:type_name -> sentiment.v1.DocumentType
+	3, // 1: sentiment.v1.AnalyzeResponse.sentences:type_name -> sentiment.v1.SentenceSentiment
+	1, // 2: sentiment.v1.AnalyzeStreamRequest.request:type_name -> sentiment.v1.AnalyzeRequest
+	2, // 3: sentiment.v1.AnalyzeStreamResponse.response:type_name -> sentiment.v1.AnalyzeResponse
+	6, // 4: sentiment.v1.AnalyzeStreamResponse.error:type_name -> sentiment.v1.Error
+	1, // 5: sentiment.v1.SentimentService.Analyze:input_type -> sentiment.v1.AnalyzeRequest
+	4, // 6: sentiment.v1.SentimentService.AnalyzeStream:input_type -> sentiment.v1.AnalyzeStreamRequest
+	2, // 7: sentiment.v1.SentimentService.Analyze:output_type -> sentiment.v1.AnalyzeResponse
+	5, // 8: sentiment.v1.SentimentService.AnalyzeStream:output_type -> sentiment.v1.AnalyzeStreamResponse
+	7, // [7:9] is the sub-list for method output_type
+	5, // [5:7] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_sentiment_v1_sentiment_proto_init() }
+func file_sentiment_v1_sentiment_proto_init() {
+	if File_sentiment_v1_sentiment_proto != nil {
+		return
+	}
+	file_sentiment_v1_sentiment_proto_msgTypes[4].OneofWrappers = []any{
+		(*AnalyzeStreamResponse_Response)(nil),
+		(*AnalyzeStreamResponse_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sentiment_v1_sentiment_proto_rawDesc), len(file_sentiment_v1_sentiment_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sentiment_v1_sentiment_proto_goTypes,
+		DependencyIndexes: file_sentiment_v1_sentiment_proto_depIdxs,
+		EnumInfos:         file_sentiment_v1_sentiment_proto_enumTypes,
+		MessageInfos:      file_sentiment_v1_sentiment_proto_msgTypes,
+	}.Build()
+	File_sentiment_v1_sentiment_proto = out.File
+	file_sentiment_v1_sentiment_proto_goTypes = nil
+	file_sentiment_v1_sentiment_proto_depIdxs = nil
+}
@@ -0,0 +1,166 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: sentiment/v1/sentiment.proto
+
+package sentimentv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SentimentService_Analyze_FullMethodName       = "/sentiment.v1.SentimentService/Analyze"
+	SentimentService_AnalyzeStream_FullMethodName = "/sentiment.v1.SentimentService/AnalyzeStream"
+)
+
+// SentimentServiceClient is the client API for SentimentService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SentimentService is the gRPC counterpart of POST /analyze.
+type SentimentServiceClient interface {
+	// Analyze analyzes the sentiment of one text.
+	Analyze(ctx context.Context, in *AnalyzeRequest, opts ...grpc.CallOption) (*AnalyzeResponse, error)
+	// AnalyzeStream analyzes each request as it arrives and sends back one
+	// response per request, in completion order. Failures are reported per
+	// item; the stream itself only fails if it can't be read or written.
+	AnalyzeStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AnalyzeStreamRequest, AnalyzeStreamResponse], error)
+}
+
+type sentimentServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSentimentServiceClient(cc grpc.ClientConnInterface) SentimentServiceClient {
+	return &sentimentServiceClient{cc}
+}
+
+func (c *sentimentServiceClient) Analyze(ctx context.Context, in *AnalyzeRequest, opts ...grpc.CallOption) (*AnalyzeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AnalyzeResponse)
+	err := c.cc.Invoke(ctx, SentimentService_Analyze_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sentimentServiceClient) AnalyzeStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AnalyzeStreamRequest, AnalyzeStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SentimentService_ServiceDesc.Streams[0], SentimentService_AnalyzeStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AnalyzeStreamRequest, AnalyzeStreamResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SentimentService_AnalyzeStreamClient = grpc.BidiStreamingClient[AnalyzeStreamRequest, AnalyzeStreamResponse]
+
+// SentimentServiceServer is the server API for SentimentService service.
+// All implementations must embed UnimplementedSentimentServiceServer
+// for forward compatibility.
+//
+// SentimentService is the gRPC counterpart of POST /analyze.
+type SentimentServiceServer interface {
+	// Analyze analyzes the sentiment of one text.
+	Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error)
+	// AnalyzeStream analyzes each request as it arrives and sends back one
+	// response per request, in completion order. Failures are reported per
+	// item; the stream itself only fails if it can't be read or written.
+	AnalyzeStream(grpc.BidiStreamingServer[AnalyzeStreamRequest, AnalyzeStreamResponse]) error
+	mustEmbedUnimplementedSentimentServiceServer()
+}
+
+// UnimplementedSentimentServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSentimentServiceServer struct{}
+
+func (UnimplementedSentimentServiceServer) Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Analyze not implemented")
+}
+func (UnimplementedSentimentServiceServer) AnalyzeStream(grpc.BidiStreamingServer[AnalyzeStreamRequest, AnalyzeStreamResponse]) error {
+	return status.Error(codes.Unimplemented, "method AnalyzeStream not implemented")
+}
+func (UnimplementedSentimentServiceServer) mustEmbedUnimplementedSentimentServiceServer() {}
+func (UnimplementedSentimentServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeSentimentServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SentimentServiceServer will
+// result in compilation errors.
+type UnsafeSentimentServiceServer interface {
+	mustEmbedUnimplementedSentimentServiceServer()
+}
+
+func RegisterSentimentServiceServer(s grpc.ServiceRegistrar, srv SentimentServiceServer) {
+	// If the following call panics, it indicates UnimplementedSentimentServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SentimentService_ServiceDesc, srv)
+}
+
+func _SentimentService_Analyze_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnalyzeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentimentServiceServer).Analyze(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SentimentService_Analyze_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentimentServiceServer).Analyze(ctx, req.(*AnalyzeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SentimentService_AnalyzeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SentimentServiceServer).AnalyzeStream(&grpc.GenericServerStream[AnalyzeStreamRequest, AnalyzeStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SentimentService_AnalyzeStreamServer = grpc.BidiStreamingServer[AnalyzeStreamRequest, AnalyzeStreamResponse]
+
+// SentimentService_ServiceDesc is the grpc.ServiceDesc for SentimentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SentimentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sentiment.v1.SentimentService",
+	HandlerType: (*SentimentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Analyze",
+			Handler:    _SentimentService_Analyze_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AnalyzeStream",
+			Handler:       _SentimentService_AnalyzeStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "sentiment/v1/sentiment.proto",
+}
@@ -0,0 +1,129 @@
+package sentiment
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"strings"
+
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+// Names of the analyzers, as reported in Result.Provider.
+const (
+	ProviderGCP   = "gcp"
+	ProviderLocal = "local"
+	ProviderFake  = "fake"
+)
+
+// Result is the sentiment of a document. Score ranges from -1 (negative) to 1
+// (positive); Magnitude is the overall strength of emotion and is unbounded.
+type Result struct {
+	Score     float64
+	Magnitude float64
+	Sentences []Sentence
+	// Language is the language of the document, as given or as detected.
+	Language string
+	// Provider names the analyzer that produced the result.
+	Provider string
+	// Raw is the Language API response the result was read from, or nil
+	// when another analyzer produced it.
+	Raw *languagepb.AnalyzeSentimentResponse
+}
+
+// Sentence is the sentiment of one sentence of a document.
+type Sentence struct {
+	Text      string
+	Score     float64
+	Magnitude float64
+}
+
+// DocumentType is the format of a Document's text.
+type DocumentType int
+
+const (
+	PlainText DocumentType = iota
+	// HTML documents have their markup ignored.
+	HTML
+)
+
+// Document is a text to analyze.
+type Document struct {
+	Text string
+	// Language is an ISO-639-1 code, or empty to let the analyzer detect
+	// the language.
+	Language string
+	Type     DocumentType
+}
+
+// plainText returns the text of d with any HTML markup removed.
+func (d Document) plainText() string {
+	if d.Type != HTML {
+		return d.Text
+	}
+
+	var b strings.Builder
+	inTag := false
+	for _, r := range d.Text {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b.WriteByte(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
+
+// Analyzer analyzes the sentiment of a document.
+type Analyzer interface {
+	Analyze(ctx context.Context, doc Document) (Result, error)
+}
+
+// Analyze implements Analyzer with the Language API.
+func (c *Client) Analyze(ctx context.Context, doc Document) (Result, error) {
+	docType := languagepb.Document_PLAIN_TEXT
+	if doc.Type == HTML {
+		docType = languagepb.Document_HTML
+	}
+	resp, err := c.AnalyzeSentiment(ctx, &languagepb.AnalyzeSentimentRequest{
+		Document: &languagepb.Document{
+			Source: &languagepb.Document_Content{
+				Content: doc.Text,
+			},
+			Type:     docType,
+			Language: doc.Language,
+		},
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	out := Result{
+		Score:     widen(resp.GetDocumentSentiment().GetScore()),
+		Magnitude: widen(resp.GetDocumentSentiment().GetMagnitude()),
+		Sentences: make([]Sentence, 0, len(resp.Sentences)),
+		Language:  resp.GetLanguage(),
+		Provider:  ProviderGCP,
+		Raw:       resp,
+	}
+	for _, sentence := range resp.Sentences {
+		out.Sentences = append(out.Sentences, Sentence{
+			Text:      sentence.GetText().GetContent(),
+			Score:     widen(sentence.GetSentiment().GetScore()),
+			Magnitude: widen(sentence.GetSentiment().GetMagnitude()),
+		})
+	}
+	return out, nil
+}
+
+// widen returns the float64 nearest to the shortest decimal form of f, so
+// that the 0.3 of the Language API stays 0.3 rather than becoming
+// 0.30000001192092896.
+func widen(f float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	return v
+}
@@ -0,0 +1,221 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	// StateClosed lets every call through while counting failures.
+	StateClosed BreakerState = iota
+	// StateHalfOpen lets a single probe call through to test recovery.
+	StateHalfOpen
+	// StateOpen fails every call without trying.
+	StateOpen
+)
+
+// BreakerStates lists every BreakerState.
+var BreakerStates = []BreakerState{StateClosed, StateHalfOpen, StateOpen}
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// Defaults for BreakerConfig.
+const (
+	DefaultBreakerFailureRate = 0.5
+	DefaultBreakerMinRequests = 20
+	DefaultBreakerWindow      = time.Minute
+	DefaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// halfOpenRetryAfter is the hint given to calls rejected while a probe is in
+// flight.
+const halfOpenRetryAfter = time.Second
+
+// BreakerConfig configures a Breaker.
+type BreakerConfig struct {
+	// FailureRate is the fraction of failed calls, from 0 to 1, at which the
+	// breaker opens.
+	FailureRate float64
+	// MinRequests is the number of calls a window must contain before its
+	// failure rate is considered.
+	MinRequests int
+	// Window is the period over which calls are counted while closed.
+	Window time.Duration
+	// OpenTimeout is how long the breaker stays open before probing.
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerConfig returns the configuration used unless configured
+// otherwise.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureRate: DefaultBreakerFailureRate,
+		MinRequests: DefaultBreakerMinRequests,
+		Window:      DefaultBreakerWindow,
+		OpenTimeout: DefaultBreakerOpenTimeout,
+	}
+}
+
+// CircuitOpenError is returned by a Breaker that rejects a call without
+// trying it.
+type CircuitOpenError struct {
+	// RetryAfter is when the breaker will next let a call through.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "circuit breaker is open"
+}
+
+// Breaker is an Analyzer that stops calling a failing Analyzer. Once the
+// failure rate within a window reaches the configured threshold it opens and
+// fails calls immediately with *CircuitOpenError. After OpenTimeout it lets a
+// single probe through: success closes it again, failure reopens it.
+//
+// Errors caused by the request, such as an invalid argument, count as
+// successes; calls whose context was cancelled, or that a Limiter did not let
+// through, are not counted.
+type Breaker struct {
+	analyzer      Analyzer
+	cfg           BreakerConfig
+	onStateChange func(BreakerState)
+	now           func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// NewBreaker returns a closed Breaker around analyzer. onStateChange, if not
+// nil, is called with the new state on every transition while the Breaker's
+// lock is held, so it must not call back into the Breaker.
+func NewBreaker(analyzer Analyzer, cfg BreakerConfig, onStateChange func(BreakerState)) *Breaker {
+	return &Breaker{
+		analyzer:      analyzer,
+		cfg:           cfg,
+		onStateChange: onStateChange,
+		now:           time.Now,
+	}
+}
+
+// Analyze implements Analyzer.
+func (b *Breaker) Analyze(ctx context.Context, doc Document) (Result, error) {
+	if err := b.allow(); err != nil {
+		return Result{}, err
+	}
+
+	result, err := b.analyzer.Analyze(ctx, doc)
+	if errors.Is(err, context.Canceled) || overloaded(err) {
+		b.release()
+	} else {
+		b.record(err != nil && upstreamFailure(err))
+	}
+	return result, err
+}
+
+// State returns the current state.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) allow() error {
+	now := b.now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if wait := b.openedAt.Add(b.cfg.OpenTimeout).Sub(now); wait > 0 {
+			return &CircuitOpenError{RetryAfter: wait}
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+	case StateHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{RetryAfter: halfOpenRetryAfter}
+		}
+		b.probing = true
+	default:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+	return nil
+}
+
+func (b *Breaker) record(failed bool) {
+	now := b.now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		b.probing = false
+		if failed {
+			b.open(now)
+			return
+		}
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+		b.setState(StateClosed)
+	case StateClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.FailureRate*float64(b.requests) {
+			b.open(now)
+		}
+	}
+}
+
+// release gives up a call's slot without judging the outcome.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.openedAt = now
+	b.setState(StateOpen)
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onStateChange != nil {
+		b.onStateChange(state)
+	}
+}
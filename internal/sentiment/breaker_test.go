@@ -0,0 +1,214 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUnavailable = status.Error(codes.Unavailable, "unavailable")
+
+// analyzerFunc turns a function into an Analyzer.
+type analyzerFunc func(ctx context.Context, doc Document) (Result, error)
+
+func (f analyzerFunc) Analyze(ctx context.Context, doc Document) (Result, error) {
+	return f(ctx, doc)
+}
+
+// breakerTest is a Breaker around an analyzer failing with err, on a clock
+// that only moves when told to.
+type breakerTest struct {
+	*Breaker
+	now    time.Time
+	err    error
+	calls  int
+	states []BreakerState
+	// during, if set, is called within the next call of the analyzer.
+	during func()
+}
+
+func newBreakerTest() *breakerTest {
+	bt := &breakerTest{now: time.Unix(1_700_000_000, 0)}
+	cfg := BreakerConfig{FailureRate: 0.5, MinRequests: 4, Window: time.Minute, OpenTimeout: 30 * time.Second}
+	bt.Breaker = NewBreaker(analyzerFunc(func(context.Context, Document) (Result, error) {
+		bt.calls++
+		if during := bt.during; during != nil {
+			bt.during = nil
+			during()
+		}
+		return Result{}, bt.err
+	}), cfg, func(s BreakerState) { bt.states = append(bt.states, s) })
+	bt.Breaker.now = func() time.Time { return bt.now }
+	return bt
+}
+
+// call analyzes a text, failing with err.
+func (bt *breakerTest) call(err error) error {
+	bt.err = err
+	_, err = bt.Analyze(context.Background(), Document{Text: "text"})
+	return err
+}
+
+// open fails enough calls to open the breaker.
+func (bt *breakerTest) open(t *testing.T) {
+	t.Helper()
+	for range 4 {
+		bt.call(errUnavailable)
+	}
+	if bt.State() != StateOpen {
+		t.Fatalf("state = %s after 4 failures, want open", bt.State())
+	}
+}
+
+func circuitOpen(err error) (time.Duration, bool) {
+	var e *CircuitOpenError
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+	return e.RetryAfter, true
+}
+
+func TestBreakerOpensAtFailureRate(t *testing.T) {
+	bt := newBreakerTest()
+	for i := range 3 {
+		bt.call(errUnavailable)
+		if bt.State() != StateClosed {
+			t.Fatalf("state = %s after %d failures, want closed below MinRequests", bt.State(), i+1)
+		}
+	}
+	bt.call(errUnavailable)
+	if bt.State() != StateOpen {
+		t.Fatalf("state = %s after 4 failures, want open", bt.State())
+	}
+
+	calls := bt.calls
+	retryAfter, ok := circuitOpen(bt.call(nil))
+	if !ok {
+		t.Fatal("call while open was not rejected with a CircuitOpenError")
+	}
+	if retryAfter != 30*time.Second {
+		t.Errorf("RetryAfter = %s, want 30s", retryAfter)
+	}
+	if bt.calls != calls {
+		t.Error("the analyzer was called while open")
+	}
+}
+
+func TestBreakerStaysClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []error
+	}{
+		{"below the failure rate", []error{errUnavailable, nil, nil, nil, nil}},
+		{"invalid requests", []error{status.Error(codes.InvalidArgument, "bad"), status.Error(codes.InvalidArgument, "bad"), status.Error(codes.InvalidArgument, "bad"), status.Error(codes.InvalidArgument, "bad")}},
+		{"cancelled calls", []error{context.Canceled, context.Canceled, context.Canceled, context.Canceled}},
+		{"overloaded calls", []error{&OverloadedError{}, &OverloadedError{}, &OverloadedError{}, &OverloadedError{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt := newBreakerTest()
+			for _, err := range tt.errs {
+				bt.call(err)
+			}
+			if bt.State() != StateClosed {
+				t.Errorf("state = %s, want closed", bt.State())
+			}
+		})
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	bt := newBreakerTest()
+	for range 3 {
+		bt.call(errUnavailable)
+	}
+	// The failures of the previous window are forgotten.
+	bt.now = bt.now.Add(time.Minute)
+	bt.call(errUnavailable)
+	if bt.State() != StateClosed {
+		t.Errorf("state = %s, want closed in a new window", bt.State())
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		probeErr  error
+		wantState BreakerState
+		wantLog   []BreakerState
+	}{
+		{"probe succeeds", nil, StateClosed, []BreakerState{StateOpen, StateHalfOpen, StateClosed}},
+		{"probe fails", errUnavailable, StateOpen, []BreakerState{StateOpen, StateHalfOpen, StateOpen}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt := newBreakerTest()
+			bt.open(t)
+
+			bt.now = bt.now.Add(29 * time.Second)
+			if retryAfter, ok := circuitOpen(bt.call(nil)); !ok || retryAfter != time.Second {
+				t.Fatalf("call before OpenTimeout: RetryAfter %s, rejected %t; want 1s, rejected", retryAfter, ok)
+			}
+
+			bt.now = bt.now.Add(time.Second)
+			var duringProbe BreakerState
+			var concurrent error
+			bt.during = func() {
+				duringProbe = bt.State()
+				// Only one probe is let through at a time.
+				_, concurrent = bt.Analyze(context.Background(), Document{Text: "text"})
+			}
+			calls := bt.calls
+			bt.call(tt.probeErr)
+			if bt.calls != calls+1 {
+				t.Fatalf("the analyzer was called %d times, want once for the probe", bt.calls-calls)
+			}
+			if duringProbe != StateHalfOpen {
+				t.Errorf("state during the probe = %s, want half_open", duringProbe)
+			}
+			if retryAfter, ok := circuitOpen(concurrent); !ok || retryAfter != halfOpenRetryAfter {
+				t.Errorf("call during the probe: error %v, want a CircuitOpenError with RetryAfter %s", concurrent, halfOpenRetryAfter)
+			}
+
+			if bt.State() != tt.wantState {
+				t.Errorf("state = %s, want %s", bt.State(), tt.wantState)
+			}
+			if len(bt.states) != len(tt.wantLog) {
+				t.Fatalf("transitions = %v, want %v", bt.states, tt.wantLog)
+			}
+			for i := range bt.states {
+				if bt.states[i] != tt.wantLog[i] {
+					t.Fatalf("transitions = %v, want %v", bt.states, tt.wantLog)
+				}
+			}
+			if tt.wantState == StateOpen {
+				// The timeout starts over from the failed probe.
+				if retryAfter, ok := circuitOpen(bt.call(nil)); !ok || retryAfter != 30*time.Second {
+					t.Errorf("call after a failed probe: RetryAfter %s, rejected %t; want 30s, rejected", retryAfter, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerCancelledProbe(t *testing.T) {
+	bt := newBreakerTest()
+	bt.open(t)
+	bt.now = bt.now.Add(30 * time.Second)
+
+	bt.call(context.Canceled)
+	if bt.State() != StateHalfOpen {
+		t.Fatalf("state = %s after a cancelled probe, want half_open", bt.State())
+	}
+	// The slot of the cancelled probe is given to the next call.
+	if err := bt.call(nil); err != nil {
+		t.Fatalf("next probe: %v", err)
+	}
+	if bt.State() != StateClosed {
+		t.Errorf("state = %s, want closed", bt.State())
+	}
+}
@@ -0,0 +1,220 @@
+// Package sentiment wraps the Google Cloud Natural Language API clients.
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	language "cloud.google.com/go/language/apiv1"
+	languagev2 "cloud.google.com/go/language/apiv2"
+	languagev2pb "cloud.google.com/go/language/apiv2/languagepb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+var tracer = otel.Tracer("github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment")
+
+// Observer is notified of the outcome of every Language API call.
+type Observer interface {
+	ObserveCall(method string, duration time.Duration, err error)
+}
+
+// Client is a Natural Language API client shared by all requests. The
+// underlying v1 and v2 clients are created on first use; a failed creation is
+// not cached so that a later call can retry. Every call is traced and
+// reported to the Observer.
+type Client struct {
+	observer Observer
+	retry    RetryPolicy
+	opts     []option.ClientOption
+	limiter  *Limiter
+	// newV1 creates the v1 client, language.NewClient but in tests.
+	newV1 func(ctx context.Context, opts ...option.ClientOption) (*language.Client, error)
+
+	mu sync.Mutex
+	v1 *language.Client
+	v2 *languagev2.Client
+}
+
+// NewClient returns a Client reporting to observer, which may be nil.
+// AnalyzeSentiment calls are retried according to retry. The v1 and v2
+// clients are both created with opts.
+func NewClient(observer Observer, retry RetryPolicy, opts ...option.ClientOption) *Client {
+	return &Client{observer: observer, retry: retry, opts: opts, newV1: language.NewClient}
+}
+
+// SetLimiter bounds the calls in flight with l; every attempt of a retried
+// call waits for its own slot. It must be called before the first call.
+func (c *Client) SetLimiter(l *Limiter) {
+	c.limiter = l
+}
+
+// AnalyzeSentiment retries transient failures according to the Client's
+// RetryPolicy; each attempt is traced and observed separately.
+func (c *Client) AnalyzeSentiment(ctx context.Context, req *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	client, err := c.v1Client()
+	if err != nil {
+		return nil, err
+	}
+	var resp *languagepb.AnalyzeSentimentResponse
+	err = c.retry.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = call(ctx, c, "AnalyzeSentiment", req.GetDocument(), func(ctx context.Context) (*languagepb.AnalyzeSentimentResponse, error) {
+			return client.AnalyzeSentiment(ctx, req)
+		})
+		return err
+	})
+	return resp, err
+}
+
+func (c *Client) AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	client, err := c.v1Client()
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, c, "AnalyzeEntitySentiment", req.GetDocument(), func(ctx context.Context) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+		return client.AnalyzeEntitySentiment(ctx, req)
+	})
+}
+
+func (c *Client) AnalyzeEntities(ctx context.Context, req *languagepb.AnalyzeEntitiesRequest) (*languagepb.AnalyzeEntitiesResponse, error) {
+	client, err := c.v1Client()
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, c, "AnalyzeEntities", req.GetDocument(), func(ctx context.Context) (*languagepb.AnalyzeEntitiesResponse, error) {
+		return client.AnalyzeEntities(ctx, req)
+	})
+}
+
+func (c *Client) AnalyzeSyntax(ctx context.Context, req *languagepb.AnalyzeSyntaxRequest) (*languagepb.AnalyzeSyntaxResponse, error) {
+	client, err := c.v1Client()
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, c, "AnalyzeSyntax", req.GetDocument(), func(ctx context.Context) (*languagepb.AnalyzeSyntaxResponse, error) {
+		return client.AnalyzeSyntax(ctx, req)
+	})
+}
+
+func (c *Client) ClassifyText(ctx context.Context, req *languagepb.ClassifyTextRequest) (*languagepb.ClassifyTextResponse, error) {
+	client, err := c.v1Client()
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, c, "ClassifyText", req.GetDocument(), func(ctx context.Context) (*languagepb.ClassifyTextResponse, error) {
+		return client.ClassifyText(ctx, req)
+	})
+}
+
+// ModerateText calls the v2 API, the only version offering moderation.
+func (c *Client) ModerateText(ctx context.Context, req *languagev2pb.ModerateTextRequest) (*languagev2pb.ModerateTextResponse, error) {
+	client, err := c.v2Client()
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, c, "ModerateText", req.GetDocument(), func(ctx context.Context) (*languagev2pb.ModerateTextResponse, error) {
+		return client.ModerateText(ctx, req)
+	})
+}
+
+// Connect creates the v1 client now rather than on first use, so that
+// missing credentials are noticed at startup.
+func (c *Client) Connect() error {
+	_, err := c.v1Client()
+	return err
+}
+
+// Close releases the underlying clients that were created.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	if c.v1 != nil {
+		errs = append(errs, c.v1.Close())
+		c.v1 = nil
+	}
+	if c.v2 != nil {
+		errs = append(errs, c.v2.Close())
+		c.v2 = nil
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) v1Client() (*language.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.v1 != nil {
+		return c.v1, nil
+	}
+
+	client, err := c.newV1(context.Background(), c.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	c.v1 = client
+	return client, nil
+}
+
+func (c *Client) v2Client() (*languagev2.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.v2 != nil {
+		return c.v2, nil
+	}
+
+	client, err := languagev2.NewClient(context.Background(), c.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create v2 client: %w", err)
+	}
+	c.v2 = client
+	return client, nil
+}
+
+// document is implemented by the v1 and v2 Document messages.
+type document interface {
+	GetContent() string
+}
+
+// call runs fn inside a client span for method, once the limiter lets it
+// through, and reports the outcome to the observer.
+func call[T any](ctx context.Context, c *Client, method string, doc document, fn func(context.Context) (T, error)) (T, error) {
+	ctx, span := tracer.Start(ctx, "language."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.method", method),
+			attribute.Int("document.size_bytes", len(doc.GetContent())),
+		),
+	)
+	defer span.End()
+
+	release, err := c.limiter.acquire(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		var zero T
+		return zero, err
+	}
+	defer release()
+
+	start := time.Now()
+	resp, err := fn(ctx)
+	if c.observer != nil {
+		c.observer.ObserveCall(method, time.Since(start), err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return resp, err
+}
@@ -0,0 +1,136 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	language "cloud.google.com/go/language/apiv1"
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+)
+
+func TestClientCreatesV1ClientOnce(t *testing.T) {
+	var created atomic.Int32
+	c := NewClient(nil, RetryPolicy{})
+	c.newV1 = func(context.Context, ...option.ClientOption) (*language.Client, error) {
+		created.Add(1)
+		return &language.Client{}, nil
+	}
+
+	const n = 50
+	clients := make([]*language.Client, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := c.v1Client()
+			if err != nil {
+				t.Errorf("v1Client: %v", err)
+			}
+			clients[i] = client
+		}()
+	}
+	wg.Wait()
+
+	if got := created.Load(); got != 1 {
+		t.Fatalf("created %d clients for %d concurrent calls, want 1", got, n)
+	}
+	for i, client := range clients {
+		if client != clients[0] {
+			t.Fatalf("call %d got a different client", i)
+		}
+	}
+}
+
+func TestClientRetriesFailedCreation(t *testing.T) {
+	var created atomic.Int32
+	c := NewClient(nil, RetryPolicy{})
+	c.newV1 = func(context.Context, ...option.ClientOption) (*language.Client, error) {
+		if created.Add(1) == 1 {
+			return nil, errors.New("no credentials")
+		}
+		return &language.Client{}, nil
+	}
+
+	if err := c.Connect(); err == nil {
+		t.Fatal("Connect succeeded, want the creation error")
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect after a failed creation: %v", err)
+	}
+	if got := created.Load(); got != 2 {
+		t.Fatalf("created %d times, want 2", got)
+	}
+}
+
+// recordingLanguageService is a Language API recording the requests of
+// AnalyzeSentiment.
+type recordingLanguageService struct {
+	languagepb.UnimplementedLanguageServiceServer
+	mu       sync.Mutex
+	requests []*languagepb.AnalyzeSentimentRequest
+}
+
+func (s *recordingLanguageService) AnalyzeSentiment(_ context.Context, req *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	return &languagepb.AnalyzeSentimentResponse{
+		DocumentSentiment: &languagepb.Sentiment{Score: 0.3, Magnitude: 0.6},
+		Language:          "en",
+		Sentences: []*languagepb.Sentence{{
+			Text:      &languagepb.TextSpan{Content: "Fine."},
+			Sentiment: &languagepb.Sentiment{Score: 0.3, Magnitude: 0.6},
+		}},
+	}, nil
+}
+
+func (s *recordingLanguageService) last() *languagepb.AnalyzeSentimentRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func TestClientAnalyze(t *testing.T) {
+	srv := &recordingLanguageService{}
+	c := newTestClient(t, srv)
+
+	tests := []struct {
+		name string
+		doc  Document
+		want languagepb.Document_Type
+	}{
+		{"plain text", Document{Text: "Fine.", Type: PlainText}, languagepb.Document_PLAIN_TEXT},
+		{"default", Document{Text: "Fine."}, languagepb.Document_PLAIN_TEXT},
+		{"HTML", Document{Text: "<p>Fine.</p>", Type: HTML, Language: "en"}, languagepb.Document_HTML},
+	}
+	for _, tt := range tests {
+		res, err := c.Analyze(context.Background(), tt.doc)
+		if err != nil {
+			t.Fatalf("%s: Analyze: %v", tt.name, err)
+		}
+		req := srv.last()
+		if got := req.GetDocument().GetType(); got != tt.want {
+			t.Errorf("%s: document type %v, want %v", tt.name, got, tt.want)
+		}
+		// The markup is sent as is, for the Language API to strip.
+		if got := req.GetDocument().GetContent(); got != tt.doc.Text {
+			t.Errorf("%s: content %q, want %q", tt.name, got, tt.doc.Text)
+		}
+		if got := req.GetDocument().GetLanguage(); got != tt.doc.Language {
+			t.Errorf("%s: language %q, want %q", tt.name, got, tt.doc.Language)
+		}
+		// The float32 scores are widened to their shortest decimal form.
+		if res.Score != 0.3 || res.Magnitude != 0.6 || res.Provider != ProviderGCP || len(res.Sentences) != 1 || res.Sentences[0].Score != 0.3 {
+			t.Errorf("%s: result %+v, want the scores of the response", tt.name, res)
+		}
+		// The language is the one the Language API detected.
+		if res.Language != "en" {
+			t.Errorf("%s: language %q, want en from the response", tt.name, res.Language)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sentiment
+
+import (
+	"context"
+	"strings"
+)
+
+var (
+	fakePositiveWords = map[string]bool{
+		"amazing": true, "awesome": true, "best": true, "love": true, "excellent": true,
+		"fantastic": true, "good": true, "great": true, "happy": true, "like": true,
+		"nice": true, "perfect": true, "wonderful": true,
+	}
+	fakeNegativeWords = map[string]bool{
+		"angry": true, "awful": true, "bad": true, "broken": true, "disappointing": true,
+		"hate": true, "horrible": true, "poor": true, "sad": true, "terrible": true,
+		"worse": true, "worst": true, "wrong": true,
+	}
+)
+
+// Fake is an Analyzer for local development and CI that needs no
+// credentials. It counts words from a small built-in list of positive and
+// negative words, so the same text always gets the same result. The scores
+// are not meant to be accurate.
+type Fake struct{}
+
+// Analyze implements Analyzer. Each sentence scores the balance of positive
+// and negative words it contains, and its magnitude is their count. The
+// document score is the mean sentence score and its magnitude their sum.
+func (Fake) Analyze(ctx context.Context, doc Document) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	out := Result{Language: doc.Language, Provider: ProviderFake}
+	for _, s := range splitSentences(doc.plainText()) {
+		var pos, neg int
+		for _, word := range words(s) {
+			switch {
+			case fakePositiveWords[word]:
+				pos++
+			case fakeNegativeWords[word]:
+				neg++
+			}
+		}
+
+		sentence := Sentence{Text: s, Magnitude: float64(pos + neg)}
+		if pos+neg > 0 {
+			sentence.Score = float64(pos-neg) / float64(pos+neg)
+		}
+		out.Sentences = append(out.Sentences, sentence)
+		out.Score += sentence.Score
+		out.Magnitude += sentence.Magnitude
+	}
+	if len(out.Sentences) > 0 {
+		out.Score /= float64(len(out.Sentences))
+	}
+	return out, nil
+}
+
+// splitSentences splits text after each run of '.', '!' or '?', dropping
+// blank sentences.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		if next := i + 1; next < len(text) && strings.ContainsRune(".!?", rune(text[next])) {
+			continue
+		}
+		if s := strings.TrimSpace(text[start : i+1]); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = i + 1
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
@@ -0,0 +1,50 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Fallback is an Analyzer that serves a request from Secondary when Primary
+// fails. Errors caused by the request itself, such as an invalid argument or
+// a cancelled context, are returned without falling back. If Secondary fails
+// too, Primary's error is returned.
+type Fallback struct {
+	Primary   Analyzer
+	Secondary Analyzer
+	// OnFallback, if set, is called with Primary's error before Secondary is
+	// tried.
+	OnFallback func(ctx context.Context, err error)
+}
+
+// Analyze implements Analyzer.
+func (f Fallback) Analyze(ctx context.Context, doc Document) (Result, error) {
+	result, err := f.Primary.Analyze(ctx, doc)
+	if err == nil || !upstreamFailure(err) {
+		return result, err
+	}
+
+	if f.OnFallback != nil {
+		f.OnFallback(ctx, err)
+	}
+	result, fallbackErr := f.Secondary.Analyze(ctx, doc)
+	if fallbackErr != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// upstreamFailure reports whether err means the analyzer itself is failing,
+// as opposed to rejecting the request or the caller giving up.
+func upstreamFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if st, ok := status.FromError(err); ok && st.Code() == codes.InvalidArgument {
+		return false
+	}
+	return true
+}
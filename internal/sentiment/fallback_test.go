@@ -0,0 +1,99 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFallback(t *testing.T) {
+	secondaryErr := errors.New("secondary failed")
+	tests := []struct {
+		name         string
+		primaryErr   error
+		secondaryErr error
+		wantProvider string
+		wantErr      error
+		wantFallback bool
+	}{
+		{"primary succeeds", nil, nil, ProviderGCP, nil, false},
+		{"unavailable", errUnavailable, nil, ProviderLocal, nil, true},
+		{"deadline", status.Error(codes.DeadlineExceeded, "slow"), nil, ProviderLocal, nil, true},
+		{"breaker open", fmt.Errorf("analyze: %w", &CircuitOpenError{RetryAfter: time.Second}), nil, ProviderLocal, nil, true},
+		// The request itself is at fault: the secondary would not help.
+		{"invalid argument", status.Error(codes.InvalidArgument, "bad document"), nil, "", status.Error(codes.InvalidArgument, "bad document"), false},
+		{"canceled", context.Canceled, nil, "", context.Canceled, false},
+		// Both fail: the error of the primary is kept.
+		{"secondary fails", errUnavailable, secondaryErr, "", errUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryCalls, secondaryCalls int
+			var fellBack []error
+			f := Fallback{
+				Primary: analyzerFunc(func(context.Context, Document) (Result, error) {
+					primaryCalls++
+					if tt.primaryErr != nil {
+						return Result{}, tt.primaryErr
+					}
+					return Result{Score: 0.5, Provider: ProviderGCP}, nil
+				}),
+				Secondary: analyzerFunc(func(context.Context, Document) (Result, error) {
+					secondaryCalls++
+					if tt.secondaryErr != nil {
+						return Result{}, tt.secondaryErr
+					}
+					return Result{Score: 0.4, Provider: ProviderLocal}, nil
+				}),
+				OnFallback: func(_ context.Context, err error) { fellBack = append(fellBack, err) },
+			}
+
+			res, err := f.Analyze(context.Background(), Document{Text: "text"})
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil || res.Provider != tt.wantProvider {
+				t.Errorf("Analyze = %+v, %v, want a result of %s", res, err, tt.wantProvider)
+			}
+			if primaryCalls != 1 {
+				t.Errorf("primary called %d times, want once", primaryCalls)
+			}
+			if want := map[bool]int{true: 1, false: 0}[tt.wantFallback]; secondaryCalls != want || len(fellBack) != want {
+				t.Errorf("secondary called %d times, OnFallback %d times, want %d", secondaryCalls, len(fellBack), want)
+			}
+			if tt.wantFallback && !errors.Is(fellBack[0], tt.primaryErr) {
+				t.Errorf("OnFallback got %v, want %v", fellBack[0], tt.primaryErr)
+			}
+		})
+	}
+}
+
+// TestFallbackToLexicon falls back from a failing Language API to the local
+// analyzer, as ANALYZER_FALLBACK=local does.
+func TestFallbackToLexicon(t *testing.T) {
+	f := Fallback{
+		Primary: analyzerFunc(func(context.Context, Document) (Result, error) {
+			return Result{}, errUnavailable
+		}),
+		Secondary: Lexicon{},
+	}
+	res, err := f.Analyze(context.Background(), Document{Text: "I love it"})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if res.Provider != ProviderLocal || res.Score <= 0 {
+		t.Errorf("result %+v, want a positive local one", res)
+	}
+
+	// A text the local analyzer cannot handle gets the original error.
+	_, err = f.Analyze(context.Background(), Document{Text: "dobry", Language: "pl"})
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("unsupported language: %v, want the Language API error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsupportedLanguage is returned by Lexicon for texts not in English.
+var ErrUnsupportedLanguage = errors.New("language not supported by the local analyzer")
+
+// lexiconScores rates English words from -5 (very negative) to 5 (very
+// positive), in the style of the AFINN word list.
+var lexiconScores = map[string]float64{
+	"abandon": -2, "abuse": -3, "adore": 3, "amazing": 4, "angry": -3,
+	"annoyed": -2, "annoying": -2, "anxious": -2, "appreciate": 2, "awesome": 4,
+	"awful": -3, "bad": -3, "beautiful": 3, "best": 3, "better": 2,
+	"boring": -3, "brilliant": 4, "broken": -1, "bug": -2, "buggy": -2,
+	"calm": 2, "cheap": -1, "clean": 2, "comfortable": 2, "confused": -2,
+	"crash": -2, "crap": -3, "cry": -1, "damn": -2, "dead": -3,
+	"delight": 3, "delighted": 3, "difficult": -1, "dirty": -2, "disappointed": -2,
+	"disappointing": -2, "disaster": -2, "dislike": -2, "dreadful": -3, "easy": 1,
+	"enjoy": 2, "enjoyed": 2, "error": -2, "excellent": 3, "excited": 3,
+	"exciting": 3, "fail": -2, "failed": -2, "failure": -2, "fantastic": 4,
+	"fast": 1, "fine": 2, "fun": 4, "funny": 4, "glad": 3,
+	"good": 3, "great": 3, "happy": 3, "hate": -3, "hated": -3,
+	"helpful": 2, "hopeless": -2, "horrible": -3, "hurt": -2, "ideal": 2,
+	"impressive": 3, "inadequate": -2, "incredible": 3, "joy": 3, "kind": 2,
+	"lame": -2, "like": 2, "liked": 2, "lost": -3, "love": 3,
+	"loved": 3, "lovely": 3, "mess": -2, "miserable": -3, "nice": 3,
+	"outstanding": 5, "pain": -2, "perfect": 3, "pleasant": 3, "pleased": 3,
+	"poor": -2, "problem": -2, "recommend": 2, "regret": -2, "reliable": 2,
+	"rude": -2, "sad": -2, "satisfied": 2, "scam": -2, "slow": -2,
+	"smooth": 1, "sorry": -1, "stupid": -2, "success": 2, "superb": 5,
+	"terrible": -3, "thank": 2, "thanks": 2, "ugly": -3, "unhappy": -2,
+	"upset": -2, "useful": 2, "useless": -2, "waste": -1, "weak": -2,
+	"win": 4, "wonderful": 4, "worried": -3, "worse": -3, "worst": -3,
+	"worthless": -2, "wow": 4, "wrong": -2,
+}
+
+// A negation flips, and dampens, the score of the next few words; a booster
+// strengthens the word that follows it.
+var (
+	negations = map[string]bool{
+		"not": true, "no": true, "never": true, "none": true, "nothing": true,
+		"neither": true, "nor": true, "cannot": true, "without": true,
+		"isn't": true, "aren't": true, "wasn't": true, "weren't": true, "don't": true,
+		"doesn't": true, "didn't": true, "won't": true, "wouldn't": true, "can't": true,
+		"couldn't": true, "shouldn't": true, "hardly": true,
+	}
+	boosters = map[string]float64{
+		"absolutely": 1.5, "extremely": 1.5, "incredibly": 1.5, "really": 1.25,
+		"so": 1.25, "totally": 1.5, "very": 1.25, "barely": 0.5, "slightly": 0.5,
+		"somewhat": 0.75,
+	}
+)
+
+const (
+	negationScope  = 3
+	negationFactor = -0.75
+	// lexiconAlpha controls how quickly the normalized score approaches ±1
+	// as word scores accumulate; 15 is the value used by VADER.
+	lexiconAlpha = 15
+	// lexiconMaxWordScore scales magnitudes to roughly the range reported by
+	// the Language API.
+	lexiconMaxWordScore = 5
+)
+
+// Lexicon is an Analyzer that scores English text with a built-in word list,
+// without calling any external service. It is much less accurate than the
+// Language API and is meant as a fallback during outages.
+type Lexicon struct{}
+
+// Analyze implements Analyzer. It returns ErrUnsupportedLanguage when the
+// document language is set to anything but English.
+func (Lexicon) Analyze(ctx context.Context, doc Document) (Result, error) {
+	if doc.Language != "" && doc.Language != "en" {
+		return Result{}, ErrUnsupportedLanguage
+	}
+
+	out := Result{Language: "en", Provider: ProviderLocal}
+	var total float64
+	for _, s := range splitSentences(doc.plainText()) {
+		sum, abs := scoreWords(words(s))
+		total += sum
+		out.Sentences = append(out.Sentences, Sentence{
+			Text:      s,
+			Score:     normalizeScore(sum),
+			Magnitude: abs / lexiconMaxWordScore,
+		})
+		out.Magnitude += abs / lexiconMaxWordScore
+	}
+	out.Score = normalizeScore(total)
+	return out, nil
+}
+
+// scoreWords sums the lexicon scores of words, applying negations and
+// boosters, and also returns the sum of the absolute scores.
+func scoreWords(words []string) (sum, abs float64) {
+	negated := 0
+	boost := 1.0
+	for _, word := range words {
+		if negations[word] {
+			negated = negationScope
+			continue
+		}
+		if b, ok := boosters[word]; ok {
+			boost = b
+			continue
+		}
+
+		score := lexiconScores[word] * boost
+		if negated > 0 {
+			score *= negationFactor
+			negated--
+		}
+		boost = 1
+		sum += score
+		abs += math.Abs(score)
+	}
+	return sum, abs
+}
+
+func normalizeScore(sum float64) float64 {
+	return sum / math.Sqrt(sum*sum+lexiconAlpha)
+}
+
+// words splits s into lowercase words, keeping apostrophes so that
+// contractions such as "don't" stay whole.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+}
@@ -0,0 +1,101 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLexicon(t *testing.T) {
+	analyze := func(text string) Result {
+		t.Helper()
+		res, err := Lexicon{}.Analyze(context.Background(), Document{Text: text})
+		if err != nil {
+			t.Fatalf("Analyze(%q): %v", text, err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		text string
+		sign float64
+	}{
+		{"I love it", 1},
+		{"This is terrible", -1},
+		{"The sky is blue", 0},
+		// A negation flips the words that follow it.
+		{"I do not love it", -1},
+		{"It isn't bad", 1},
+		{"Never terrible", 1},
+		// Past its scope, it does not.
+		{"Not that it matters at all, I love it", 1},
+	}
+	for _, tt := range tests {
+		res := analyze(tt.text)
+		if math.Copysign(1, res.Score) != math.Copysign(1, tt.sign) || (tt.sign == 0) != (res.Score == 0) {
+			t.Errorf("score of %q = %v, want the sign of %v", tt.text, res.Score, tt.sign)
+		}
+		if res.Score < -1 || res.Score > 1 {
+			t.Errorf("score of %q = %v, outside [-1, 1]", tt.text, res.Score)
+		}
+		if res.Provider != ProviderLocal || res.Language != "en" {
+			t.Errorf("%q: provider %q, language %q, want local and en", tt.text, res.Provider, res.Language)
+		}
+	}
+
+	// A negation dampens as well as flips.
+	if love, notLove := analyze("love").Score, analyze("not love").Score; -notLove >= love {
+		t.Errorf("score of \"not love\" %v, want weaker than that of \"love\" %v", notLove, love)
+	}
+	// Boosters strengthen the next word, and more words more.
+	good := analyze("good")
+	for _, stronger := range []string{"very good", "extremely good", "good and great"} {
+		if res := analyze(stronger); res.Score <= good.Score || res.Magnitude <= good.Magnitude {
+			t.Errorf("%q: score %v, magnitude %v, want above those of \"good\", %v and %v", stronger, res.Score, res.Magnitude, good.Score, good.Magnitude)
+		}
+	}
+	if res := analyze("slightly good"); res.Score >= good.Score {
+		t.Errorf("\"slightly good\": score %v, want below that of \"good\" %v", res.Score, good.Score)
+	}
+	// Case and punctuation do not matter.
+	if a, b := analyze("GREAT!!!"), analyze("great"); a.Score != b.Score {
+		t.Errorf("score of \"GREAT!!!\" %v, want that of \"great\" %v", a.Score, b.Score)
+	}
+
+	res := analyze("I love it. This is awful. It is blue.")
+	if len(res.Sentences) != 3 {
+		t.Fatalf("sentences = %+v, want 3", res.Sentences)
+	}
+	if res.Sentences[0].Score <= 0 || res.Sentences[1].Score >= 0 || res.Sentences[2].Score != 0 {
+		t.Errorf("sentences = %+v, want positive, negative and neutral", res.Sentences)
+	}
+	var sum float64
+	for _, s := range res.Sentences {
+		sum += s.Magnitude
+	}
+	if math.Abs(res.Magnitude-sum) > 1e-9 {
+		t.Errorf("magnitude %v, want the sum of the sentences %v", res.Magnitude, sum)
+	}
+}
+
+func TestLexiconLanguage(t *testing.T) {
+	for _, lang := range []string{"", "en"} {
+		if _, err := (Lexicon{}).Analyze(context.Background(), Document{Text: "good", Language: lang}); err != nil {
+			t.Errorf("language %q: %v", lang, err)
+		}
+	}
+	if _, err := (Lexicon{}).Analyze(context.Background(), Document{Text: "dobry", Language: "pl"}); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("language pl: %v, want ErrUnsupportedLanguage", err)
+	}
+}
+
+func TestLexiconHTML(t *testing.T) {
+	res, err := Lexicon{}.Analyze(context.Background(), Document{Text: `<p class="bad">I love it</p>`, Type: HTML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Score <= 0 {
+		t.Errorf("score %v, want the markup ignored and the text positive", res.Score)
+	}
+}
@@ -0,0 +1,103 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Defaults for NewLimiter.
+const (
+	DefaultMaxInFlight  = 32
+	DefaultQueueTimeout = time.Second
+)
+
+// overloadedRetryAfter is the hint given to calls that waited for a slot in
+// vain.
+const overloadedRetryAfter = time.Second
+
+// OverloadedError is returned for a call that could not start within the
+// queue timeout of a Limiter because the maximum number of calls were in
+// flight.
+type OverloadedError struct {
+	// RetryAfter is a suggestion of when to try again.
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return "too many Language API calls in flight"
+}
+
+// Limiter bounds the number of Language API calls a Client makes at the same
+// time, so that a burst of requests is smoothed out instead of exhausting the
+// per-minute quota. A call beyond the limit waits for a slot for up to the
+// queue timeout. A nil *Limiter lets every call through.
+type Limiter struct {
+	sem          *semaphore.Weighted
+	queueTimeout time.Duration
+	onChange     func(inFlight, queued int)
+
+	mu       sync.Mutex
+	inFlight int
+	queued   int
+}
+
+// NewLimiter returns a Limiter letting maxInFlight calls through at a time.
+// onChange, if not nil, is called with the number of calls in flight and
+// waiting on every change while the Limiter's lock is held, so it must not
+// call back into the Limiter.
+func NewLimiter(maxInFlight int, queueTimeout time.Duration, onChange func(inFlight, queued int)) *Limiter {
+	return &Limiter{
+		sem:          semaphore.NewWeighted(int64(maxInFlight)),
+		queueTimeout: queueTimeout,
+		onChange:     onChange,
+	}
+}
+
+// acquire waits for a slot and returns the function releasing it. It fails
+// with *OverloadedError once the queue timeout elapses, or with the error of
+// ctx if it is done first.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if l.sem.TryAcquire(1) {
+		l.update(1, 0)
+	} else {
+		l.update(0, 1)
+		wait, cancel := context.WithTimeout(ctx, l.queueTimeout)
+		err := l.sem.Acquire(wait, 1)
+		cancel()
+		if err != nil {
+			l.update(0, -1)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, &OverloadedError{RetryAfter: overloadedRetryAfter}
+		}
+		l.update(1, -1)
+	}
+	return func() {
+		l.update(-1, 0)
+		l.sem.Release(1)
+	}, nil
+}
+
+func (l *Limiter) update(inFlight, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight += inFlight
+	l.queued += queued
+	if l.onChange != nil {
+		l.onChange(l.inFlight, l.queued)
+	}
+}
+
+// overloaded reports whether err was returned by a Limiter.
+func overloaded(err error) bool {
+	var e *OverloadedError
+	return errors.As(err, &e)
+}
@@ -0,0 +1,227 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// counts records the calls of the onChange of a Limiter.
+type counts struct {
+	mu   sync.Mutex
+	seen [][2]int
+}
+
+func (c *counts) onChange(inFlight, queued int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen = append(c.seen, [2]int{inFlight, queued})
+}
+
+func (c *counts) last() [2]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seen[len(c.seen)-1]
+}
+
+// waitQueued waits until c reports n queued calls.
+func (c *counts) waitQueued(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.last()[1] != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("counts %v, want %d queued", c.last(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	var c counts
+	l := NewLimiter(1, 20*time.Millisecond, c.onChange)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = l.acquire(context.Background())
+	var overloadedErr *OverloadedError
+	if !errors.As(err, &overloadedErr) || overloadedErr.RetryAfter <= 0 {
+		t.Fatalf("acquire beyond the limit = %v, want *OverloadedError with a RetryAfter", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("gave up after %s, before the queue timeout", waited)
+	}
+	if got := c.last(); got != [2]int{1, 0} {
+		t.Errorf("counts after the timeout = %v, want 1 in flight and none queued", got)
+	}
+
+	release()
+	if release, err = l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after a release: %v", err)
+	}
+	release()
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	var c counts
+	l := NewLimiter(1, time.Minute, c.onChange)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx)
+		errc <- err
+	}()
+	c.waitQueued(t, 1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) || overloaded(err) {
+		t.Errorf("acquire canceled while queued = %v, want context.Canceled", err)
+	}
+	if got := c.last(); got != [2]int{1, 0} {
+		t.Errorf("counts after the cancellation = %v, want 1 in flight and none queued", got)
+	}
+}
+
+func TestLimiterOnChange(t *testing.T) {
+	var c counts
+	l := NewLimiter(1, time.Minute, c.onChange)
+	first, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		second, err := l.acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		second()
+	}()
+	c.waitQueued(t, 1)
+	first()
+	<-done
+
+	want := [][2]int{
+		{1, 0}, // the first call starts
+		{1, 1}, // the second waits
+		{0, 1}, // the first ends
+		{1, 0}, // the second starts
+		{0, 0}, // the second ends
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.seen) != len(want) {
+		t.Fatalf("onChange calls = %v, want %v", c.seen, want)
+	}
+	for i := range want {
+		if c.seen[i] != want[i] {
+			t.Fatalf("onChange calls = %v, want %v", c.seen, want)
+		}
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire of a nil Limiter: %v", err)
+	}
+	release()
+}
+
+// slowLanguageService is a Language API taking delay to answer and recording
+// the most calls it had in flight at once.
+type slowLanguageService struct {
+	languagepb.UnimplementedLanguageServiceServer
+	delay    time.Duration
+	inFlight atomic.Int32
+	max      atomic.Int32
+}
+
+func (s *slowLanguageService) AnalyzeSentiment(context.Context, *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		m := s.max.Load()
+		if n <= m || s.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	return &languagepb.AnalyzeSentimentResponse{DocumentSentiment: &languagepb.Sentiment{}}, nil
+}
+
+// newTestClient returns a Client of srv.
+func newTestClient(t *testing.T, srv languagepb.LanguageServiceServer) *Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	languagepb.RegisterLanguageServiceServer(gs, srv)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	c := NewClient(nil, RetryPolicy{},
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientLimiter(t *testing.T) {
+	const limit, calls = 3, 12
+	srv := &slowLanguageService{delay: 20 * time.Millisecond}
+	c := newTestClient(t, srv)
+	var cs counts
+	c.SetLimiter(NewLimiter(limit, time.Minute, cs.onChange))
+
+	var wg sync.WaitGroup
+	for range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Analyze(context.Background(), Document{Text: "text"}); err != nil {
+				t.Errorf("Analyze: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := srv.max.Load(); got != limit {
+		t.Errorf("at most %d calls in flight, want %d", got, limit)
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	maxQueued := 0
+	for _, seen := range cs.seen {
+		if seen[0] > limit {
+			t.Fatalf("the limiter reported %d calls in flight, over %d", seen[0], limit)
+		}
+		maxQueued = max(maxQueued, seen[1])
+	}
+	if maxQueued == 0 {
+		t.Error("no call waited for a slot")
+	}
+}
@@ -0,0 +1,95 @@
+package sentiment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		bound   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{9, time.Second},
+	}
+	for _, tt := range tests {
+		var lowest, highest time.Duration = tt.bound, 0
+		for range 1000 {
+			d := p.delay(tt.attempt)
+			if d < 0 || d > tt.bound {
+				t.Fatalf("delay(%d) = %s, want between 0 and %s", tt.attempt, d, tt.bound)
+			}
+			lowest, highest = min(lowest, d), max(highest, d)
+		}
+		// Full jitter spreads the delays over the whole range.
+		if lowest > tt.bound/4 || highest < tt.bound*3/4 {
+			t.Errorf("delay(%d) ranged over [%s, %s], want most of [0, %s]", tt.attempt, lowest, highest, tt.bound)
+		}
+	}
+
+	if d := (RetryPolicy{MaxAttempts: 3}).delay(2); d != 0 {
+		t.Errorf("delay without BaseDelay = %s, want 0", d)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	invalid := status.Error(codes.InvalidArgument, "invalid")
+
+	tests := []struct {
+		name      string
+		errs      []error // of each attempt, the last repeated
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"transient failure", []error{unavailable, nil}, 2, nil},
+		{"attempts exhausted", []error{unavailable}, 3, unavailable},
+		{"not retryable", []error{invalid}, 1, invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := p.do(context.Background(), func(context.Context) error {
+				err := tt.errs[min(calls, len(tt.errs)-1)]
+				calls++
+				return err
+			})
+			if err != tt.wantErr {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoDeadline(t *testing.T) {
+	// No retry is attempted that could not complete before the deadline, so
+	// the delays of up to an hour are not waited for.
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	start := time.Now()
+	err := p.do(ctx, func(context.Context) error { return unavailable })
+	if err != unavailable {
+		t.Errorf("error = %v, want the last error of fn", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("do returned after %s, want right away", elapsed)
+	}
+}
@@ -0,0 +1,186 @@
+package sentiment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProviderScripted names the Scripted analyzer in Result.Provider.
+const ProviderScripted = "scripted"
+
+// Script is the content of the file of a Scripted analyzer, such as
+//
+//	{
+//	  "rules": [
+//	    {"text": "this is great", "score": 0.9, "magnitude": 0.9},
+//	    {"pattern": "(?i)quota", "error": "RESOURCE_EXHAUSTED"}
+//	  ],
+//	  "default": {"score": 0, "magnitude": 0}
+//	}
+type Script struct {
+	// Rules are tried in order; the first that matches the text answers it.
+	Rules []ScriptRule `json:"rules"`
+	// Default answers the texts no rule matches.
+	Default ScriptOutcome `json:"default"`
+}
+
+// ScriptRule answers the texts equal to Text or, when Pattern is set
+// instead, those matching the regular expression Pattern.
+type ScriptRule struct {
+	Text    string `json:"text,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	ScriptOutcome
+
+	re *regexp.Regexp
+}
+
+// ScriptOutcome is the result of a rule: a score and magnitude or, when
+// Error is set, a gRPC error with that code, such as RESOURCE_EXHAUSTED or
+// DEADLINE_EXCEEDED, and Message.
+type ScriptOutcome struct {
+	Score     float64 `json:"score"`
+	Magnitude float64 `json:"magnitude"`
+	// Language is reported as detected when the document has none.
+	Language string `json:"language,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Message  string `json:"message,omitempty"`
+
+	code codes.Code
+}
+
+// Scripted is an Analyzer for end-to-end tests that answers every text as
+// the script in a JSON file says, so that a test suite can expect exact
+// labels and exercise the error paths of the Language API. The file is read
+// again whenever it changes; an invalid new version is reported to
+// OnReloadError, if set, and the previous one kept.
+type Scripted struct {
+	path          string
+	OnReloadError func(error)
+
+	mu      sync.Mutex
+	script  *Script
+	modTime time.Time
+}
+
+// NewScripted returns the Scripted analyzer of the script at path. It fails
+// if the file cannot be read or is invalid.
+func NewScripted(path string) (*Scripted, error) {
+	a := &Scripted{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if a.script, err = readScript(path); err != nil {
+		return nil, err
+	}
+	a.modTime = info.ModTime()
+	return a, nil
+}
+
+// readScript reads and validates the script at path.
+func readScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range script.Rules {
+		rule := &script.Rules[i]
+		if (rule.Text == "") == (rule.Pattern == "") {
+			return nil, fmt.Errorf("%s: rule %d: exactly one of text and pattern must be set", path, i)
+		}
+		if rule.Pattern != "" {
+			if rule.re, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("%s: rule %d: %w", path, i, err)
+			}
+		}
+		if err := rule.parseError(); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i, err)
+		}
+	}
+	if err := script.Default.parseError(); err != nil {
+		return nil, fmt.Errorf("%s: default: %w", path, err)
+	}
+	return &script, nil
+}
+
+// parseError reads the code of o.Error.
+func (o *ScriptOutcome) parseError() error {
+	if o.Error == "" {
+		return nil
+	}
+	if err := o.code.UnmarshalJSON([]byte(strconv.Quote(o.Error))); err != nil || o.code == codes.OK {
+		return fmt.Errorf("unknown gRPC code %q", o.Error)
+	}
+	return nil
+}
+
+// current returns the script, read again first if the file changed.
+func (a *Scripted) current() *Script {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	info, err := os.Stat(a.path)
+	if err != nil || info.ModTime().Equal(a.modTime) {
+		return a.script
+	}
+	script, err := readScript(a.path)
+	if err != nil {
+		if a.OnReloadError != nil {
+			a.OnReloadError(err)
+		}
+	} else {
+		a.script = script
+	}
+	// An invalid version is reported once, not on every call.
+	a.modTime = info.ModTime()
+	return a.script
+}
+
+// Analyze implements Analyzer.
+func (a *Scripted) Analyze(ctx context.Context, doc Document) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	script := a.current()
+	outcome := script.Default
+	for _, rule := range script.Rules {
+		if rule.re == nil && rule.Text == doc.Text || rule.re != nil && rule.re.MatchString(doc.Text) {
+			outcome = rule.ScriptOutcome
+			break
+		}
+	}
+	if outcome.Error != "" {
+		msg := outcome.Message
+		if msg == "" {
+			msg = "scripted " + outcome.Error
+		}
+		return Result{}, status.Error(outcome.code, msg)
+	}
+
+	out := Result{
+		Score:     outcome.Score,
+		Magnitude: outcome.Magnitude,
+		Language:  doc.Language,
+		Provider:  ProviderScripted,
+	}
+	if out.Language == "" {
+		out.Language = outcome.Language
+	}
+	for _, s := range splitSentences(doc.plainText()) {
+		out.Sentences = append(out.Sentences, Sentence{Text: s, Score: outcome.Score, Magnitude: outcome.Magnitude})
+	}
+	return out, nil
+}
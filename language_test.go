@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordingLanguageService is a Language API keeping the user agent of the
+// calls it answers.
+type recordingLanguageService struct {
+	languagepb.UnimplementedLanguageServiceServer
+
+	mu         sync.Mutex
+	userAgents []string
+}
+
+func (s *recordingLanguageService) AnalyzeSentiment(ctx context.Context, _ *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.mu.Lock()
+	s.userAgents = append(s.userAgents, strings.Join(md.Get("user-agent"), " "))
+	s.mu.Unlock()
+	return &languagepb.AnalyzeSentimentResponse{
+		DocumentSentiment: &languagepb.Sentiment{Score: 0.5, Magnitude: 0.5},
+		Language:          "en",
+	}, nil
+}
+
+// startLanguageService serves svc on a local port and returns its address.
+func startLanguageService(t *testing.T, svc languagepb.LanguageServiceServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	languagepb.RegisterLanguageServiceServer(srv, svc)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestLanguageOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		lc   func(addr string) languageConfig
+		// extra are the options of the test dialing the fake service
+		// without TLS.
+		extra []option.ClientOption
+	}{
+		{
+			name: "emulator",
+			lc: func(addr string) languageConfig {
+				return languageConfig{EmulatorHost: addr, UserAgent: "tickets/1.0"}
+			},
+		},
+		{
+			name: "endpoint",
+			lc: func(addr string) languageConfig {
+				return languageConfig{Endpoint: addr, UserAgent: "tickets/1.0"}
+			},
+			extra: []option.ClientOption{
+				option.WithoutAuthentication(),
+				option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &recordingLanguageService{}
+			addr := startLanguageService(t, svc)
+			opts, err := loadLanguageOptions(tt.lc(addr))
+			if err != nil {
+				t.Fatalf("loadLanguageOptions: %v", err)
+			}
+			client := sentiment.NewClient(api.NewMetrics(), sentiment.RetryPolicy{MaxAttempts: 1}, append(opts, tt.extra...)...)
+			defer client.Close()
+			res, err := client.Analyze(context.Background(), sentiment.Document{Text: "I love it"})
+			if err != nil {
+				t.Fatalf("Analyze: %v", err)
+			}
+			if res.Language != "en" {
+				t.Errorf("result %+v, want that of the fake service", res)
+			}
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
+			if len(svc.userAgents) != 1 || !strings.Contains(svc.userAgents[0], "tickets/1.0") {
+				t.Errorf("user agents %q, want one call with tickets/1.0", svc.userAgents)
+			}
+		})
+	}
+}
+
+func TestLanguageCredentials(t *testing.T) {
+	dir := t.TempDir()
+	creds := `{"type": "service_account", "project_id": "test"}`
+	credsFile := filepath.Join(dir, "creds.json")
+	writeFile(t, credsFile, []byte(creds))
+	badFile := filepath.Join(dir, "bad.json")
+	writeFile(t, badFile, []byte(`{"type": "api_key"}`))
+
+	for _, lc := range []languageConfig{{CredentialsJSON: creds}, {CredentialsFile: credsFile}} {
+		opts, err := loadLanguageOptions(lc)
+		if err != nil || len(opts) != 1 {
+			t.Errorf("loadLanguageOptions(%+v) = %d options, %v, want the credentials", lc, len(opts), err)
+		}
+	}
+
+	tests := []struct {
+		lc      languageConfig
+		wantErr string
+	}{
+		{languageConfig{CredentialsJSON: "not JSON"}, "LANGUAGE_CREDENTIALS_JSON: invalid credentials JSON"},
+		{languageConfig{CredentialsJSON: `{"type": "gdch_service_account"}`}, `LANGUAGE_CREDENTIALS_JSON: unsupported credentials type "gdch_service_account"`},
+		{languageConfig{CredentialsJSON: `{}`}, `LANGUAGE_CREDENTIALS_JSON: unsupported credentials type ""`},
+		{languageConfig{CredentialsFile: badFile}, `LANGUAGE_CREDENTIALS_FILE: unsupported credentials type "api_key"`},
+		{languageConfig{CredentialsFile: filepath.Join(dir, "missing.json")}, "LANGUAGE_CREDENTIALS_FILE: open"},
+	}
+	for _, tt := range tests {
+		if _, err := loadLanguageOptions(tt.lc); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("loadLanguageOptions(%+v) = %v, want an error with %q", tt.lc, err, tt.wantErr)
+		}
+	}
+}
+
+// TestLanguageCredentialsStartup checks that invalid credentials stop the
+// process before it serves anything.
+func TestLanguageCredentialsStartup(t *testing.T) {
+	t.Setenv("ANALYZER", "gcp")
+	t.Setenv("LANGUAGE_CREDENTIALS_JSON", `{"type": "api_key"}`)
+	var stdout, stderr bytes.Buffer
+	if code := runCommand([]string{"analyze", "I love this"}, strings.NewReader(""), &stdout, &stderr); code != exitFailure {
+		t.Errorf("exit code = %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr.String(), `LANGUAGE_CREDENTIALS_JSON: unsupported credentials type "api_key"`) {
+		t.Errorf("stderr = %q, want the invalid setting named", stderr.String())
+	}
+}
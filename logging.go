@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// Formats of the process logs, selected by LOG_FORMAT.
+const (
+	logFormatJSON = "json" // JSON lines
+	logFormatText = "text" // key=value lines, for local runs
+	logFormatGCP  = "gcp"  // JSON lines with the fields Cloud Logging reads
+)
+
+// newLogger returns the logger of the process, writing to w in format the
+// entries of at least level, which may change while it is in use.
+func newLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	switch format {
+	case "", logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})), nil
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})), nil
+	case logFormatGCP:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: gcpAttr})), nil
+	default:
+		return nil, fmt.Errorf("LOG_FORMAT: unknown format %q: must be %s, %s or %s", format, logFormatJSON, logFormatText, logFormatGCP)
+	}
+}
+
+// gcpAttr renames the level and message of entries to the severity and
+// message fields of Cloud Logging, which otherwise logs every entry of a
+// JSON payload at the default severity.
+func gcpAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		level, _ := a.Value.Any().(slog.Level)
+		return slog.String("severity", severity(level))
+	case slog.MessageKey:
+		a.Key = "message"
+	}
+	return a
+}
+
+func severity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// gcpProject returns the project the process runs in: project, as set by
+// GOOGLE_CLOUD_PROJECT, or on Google Cloud the project of the metadata
+// server.
+func gcpProject(ctx context.Context, project string) string {
+	if project != "" {
+		return project
+	}
+	if !metadata.OnGCE() {
+		return ""
+	}
+	project, _ = metadata.ProjectIDWithContext(ctx)
+	return project
+}
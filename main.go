@@ -1,193 +1,957 @@
 package main
 
 import (
-	language "cloud.google.com/go/language/apiv1"
+	"bufio"
+	"cmp"
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
-type SentimentRequest struct {
-	Text string `json:"text"`
+// defaultShutdownTimeout is how long in-flight requests are given to finish
+// after a termination signal unless SHUTDOWN_TIMEOUT says otherwise. Cloud Run
+// kills the container 10 seconds after SIGTERM by default; the rest is left
+// for flushing traces and closing clients.
+const defaultShutdownTimeout = 8 * time.Second
+
+// traceFlushTimeout bounds the export of the remaining spans on exit.
+const traceFlushTimeout = time.Second
+
+// defaultPort is the HTTP port unless PORT, as set by Cloud Run, says
+// otherwise.
+const defaultPort = 8080
+
+// defaultGRPCAddr is where the gRPC API listens unless GRPC_ADDR says
+// otherwise.
+const defaultGRPCAddr = ":9090"
+
+// Modes of the process, selected by MODE.
+const (
+	modeHTTP   = "http"   // serve the HTTP and gRPC APIs
+	modePubSub = "pubsub" // run the Pub/Sub worker, serving only the ops endpoints
+	modeBoth   = "both"   // do both
+)
+
+// main runs the command named by the first argument: serve, the default, or
+// analyze.
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
 
-type SentimentResponse struct {
-	Sentiment      string  `json:"sentiment"`
-	SentimentScore float32 `json:"sentiment_score"`
+// runCommand runs the command named by args[0], with the rest of args, and
+// returns its exit code. Without a command, or with a flag first, it serves.
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "serve":
+		return runServe(args)
+	case "analyze":
+		return runAnalyze(args, stdin, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q: must be serve or analyze\n", cmd)
+		return exitUsage
+	}
 }
 
-func main() {
-	http.HandleFunc("/analyze", analyzeHandler)
-	http.HandleFunc("/healthcheck", healthcheckHandler)
-	http.HandleFunc("/docs", docsHandler)
+// runServe runs the serve command, which serves the API until a termination
+// signal. The settings come from the environment and the -config file.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", "", "read the settings the environment does not set from the YAML or JSON file at `path`")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [serve] [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
 
-	log.Println("Starting Sentiment Analysis API server on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
+	cf, err := loadConfigFile(*configPath)
+	if err != nil {
+		slog.New(slog.NewJSONHandler(os.Stdout, nil)).Error("server failed", "error", err.Error())
+		return exitFailure
 	}
+	e := newEnv(cf)
+	// The level is set once the settings are read, and again on reload.
+	level := new(slog.LevelVar)
+	logger, err := newLogger(os.Stdout, e.get("LOG_FORMAT"), level)
+	if err != nil {
+		slog.New(slog.NewJSONHandler(os.Stdout, nil)).Error("server failed", "error", e.explain(err).Error())
+		return exitFailure
+	}
+	if err := run(logger, level, e); err != nil {
+		logger.Error("server failed", "error", e.explain(err).Error())
+		return exitFailure
+	}
+	return exitOK
 }
 
-func analyzeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+// run serves the API with the settings of e, and logs at the level of the
+// settings.
+func run(logger *slog.Logger, level *slog.LevelVar, e *env) error {
+	// Secret references are resolved before any setting is read.
+	sec := newSecrets()
+	defer sec.close()
+	e, err := sec.resolve(context.Background(), e)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(e)
+	if err != nil {
+		return err
+	}
+	level.Set(cfg.LogLevel)
+
+	apiTLS, err := loadTLS(cfg.TLS)
+	if err != nil {
+		return err
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("set up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("failed to flush traces", "error", err.Error())
+		}
+	}()
 
-	var req SentimentRequest
-	if err := decoder.Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	cache, closeCache, err := loadCache(cfg.Cache)
+	if err != nil {
+		return err
 	}
+	defer closeCache()
 
-	ctx := context.Background()
-	client, err := language.NewClient(ctx)
+	storage, closeStorage, err := loadStorage(cfg.Storage)
 	if err != nil {
-		log.Printf("Failed to create client: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return err
 	}
+	defer closeStorage()
 
-	resp, err := client.AnalyzeSentiment(ctx, &languagepb.AnalyzeSentimentRequest{
-		Document: &languagepb.Document{
-			Source: &languagepb.Document_Content{
-				Content: req.Text,
-			},
-			Type:     languagepb.Document_PLAIN_TEXT,
-			Language: "en",
-		},
+	inserter, closeInserter, err := loadExporter(cfg.Export)
+	if err != nil {
+		return err
+	}
+	defer closeInserter()
+
+	metrics := api.NewMetrics()
+	as, err := loadAnalyzer(logger, metrics, cfg.Analyzer)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := as.lang.Close(); err != nil {
+			logger.Warn("failed to close Language API clients", "error", err.Error())
+		}
+	}()
+
+	s, err := api.NewServer(cfg.API, as.analyzer, as.lang, cache, logger, metrics)
+	if err != nil {
+		return err
+	}
+	build := buildInfo()
+	s.SetBuildInfo(build)
+	var certs *certificates
+	if apiTLS != nil {
+		certs = apiTLS.files
+	}
+	rl := newReloader(logger, level, s, certs, sec, cfg, e)
+	s.SetReloader(rl.reload)
+	if storage != nil {
+		s.SetStorage(storage, cfg.Storage.QueueSize)
+	}
+	if inserter != nil {
+		s.SetEventExporter(inserter, cfg.Export.ExportConfig)
+	}
+	if err := loadIDTokenAuth(s, cfg.IDToken); err != nil {
+		return err
+	}
+	closeAsync, err := loadAsync(s, cfg.Async)
+	if err != nil {
+		return err
+	}
+	defer closeAsync()
+	closeGCS, err := loadGCS(s, cfg.GCS)
+	if err != nil {
+		return err
+	}
+	defer closeGCS()
+	if err := loadErrorReporting(s, build, cfg.ErrorReporting, cfg.Project); err != nil {
+		return err
+	}
+	closeQuotas, err := loadQuotas(s, cfg.Quotas, cfg.Cache)
+	if err != nil {
+		return err
+	}
+	defer closeQuotas()
+
+	s.AddHealthCheck("language_api", func(ctx context.Context) error {
+		_, err := as.probe.Analyze(ctx, sentiment.Document{Text: "ok", Language: "en"})
+		return err
 	})
+	if rc, ok := cache.(*api.RedisCache); ok {
+		s.AddOptionalHealthCheck("redis", rc.Ping)
+	}
+	if storage != nil {
+		s.AddOptionalHealthCheck("storage", func(ctx context.Context) error {
+			_, err := storage.List(ctx, api.HistoryQuery{Limit: 1})
+			return err
+		})
+	}
+
+	srv := &http.Server{
+		Addr:    net.JoinHostPort("", strconv.Itoa(cfg.Port)),
+		Handler: s.Handler(),
+	}
+	if cfg.Mode == modePubSub {
+		srv.Handler = s.OpsHandler()
+	}
+	if apiTLS != nil {
+		srv.TLSConfig = apiTLS.config()
+	}
+	if err := loadH2C(srv, cfg.H2C); err != nil {
+		return err
+	}
+	srv.RegisterOnShutdown(s.Shutdown)
+
+	var (
+		grpcSrv *grpc.Server
+		grpcLis net.Listener
+	)
+	if cfg.Mode != modePubSub {
+		if grpcLis, err = net.Listen("tcp", cfg.GRPCAddr); err != nil {
+			return fmt.Errorf("GRPC_ADDR: %w", err)
+		}
+		grpcSrv = s.GRPCServer()
+	}
+
+	pprofSrv, pprofLis, err := loadPprof(cfg.Pprof, s)
+	if err != nil {
+		return err
+	}
+	redirectSrv, redirectLis, err := loadRedirect(apiTLS, cfg.TLS.RedirectAddr, cfg.Port)
 	if err != nil {
-		log.Printf("Failed to analyze sentiment: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return err
+	}
+
+	var worker *api.PubSubWorker
+	if cfg.Mode != modeHTTP {
+		var closeWorker func()
+		if worker, closeWorker, err = loadPubSubWorker(s, cfg.PubSub); err != nil {
+			return err
+		}
+		defer closeWorker()
 	}
 
-	var sentiment string
-	var sentimentScore float32
-	if sc := resp.DocumentSentiment.Score; sc > 0 {
-		sentiment = "positive"
-		sentimentScore = sc
-	} else if sc < 0 {
-		sentiment = "negative"
-		sentimentScore = -sc
+	logger.Info("effective configuration", append([]any{
+		"version", build.Version,
+		"commit", build.Commit,
+		"build_time", build.BuildTime,
+		"go_version", build.GoVersion,
+		"mode", cfg.Mode,
+		"log_format", cfg.LogFormat,
+		"log_level", cfg.LogLevel.String(),
+		"port", cfg.Port,
+		"grpc_addr", cfg.GRPCAddr,
+		"shutdown_timeout", cfg.ShutdownTimeout.String(),
+		"tls", apiTLS.mode(),
+		"tls_client_auth", apiTLS != nil && apiTLS.mutual(),
+		"tls_autocert_hosts", cfg.TLS.AutocertHosts,
+		"tls_redirect_addr", cfg.TLS.RedirectAddr,
+		"h2c", cfg.H2C,
+		"analyzer", cfg.Analyzer.Name,
+		"analyzer_fallback", cfg.Analyzer.Fallback,
+		"language_endpoint", cmp.Or(cfg.Analyzer.Language.EmulatorHost, cfg.Analyzer.Language.Endpoint),
+		"language_max_in_flight", cfg.Analyzer.MaxInFlight,
+		"breaker_failure_rate", cfg.Analyzer.Breaker.FailureRate,
+		"retry_max_attempts", cfg.Analyzer.Retry.MaxAttempts,
+		"cache", cacheBackend(cache),
+		"storage", storage != nil,
+		"bigquery_export", inserter != nil,
+		"id_token_service_accounts", cfg.IDToken.ServiceAccounts,
+		"async", cfg.Async.Queue != "",
+		"gcs_buckets", cfg.GCS.Buckets,
+		"quotas", cfg.Quotas.Backend,
+		"error_reporting", cfg.ErrorReporting.Enabled,
+		"pprof", pprofSrv != nil,
+	}, append(e.attrs(), configAttrs(cfg.API)...)...)...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 5)
+	go func() {
+		logger.Info("starting Sentiment Analysis API server", "addr", srv.Addr, "mode", cfg.Mode, "version", build.Version, "commit", build.Commit, "api_key_auth", s.APIKeyAuth(), "tls", apiTLS.mode())
+		if apiTLS != nil {
+			errCh <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- srv.ListenAndServe()
+	}()
+	if grpcSrv != nil {
+		go func() {
+			logger.Info("starting gRPC server", "addr", grpcLis.Addr().String())
+			errCh <- grpcSrv.Serve(grpcLis)
+		}()
+	}
+	if pprofSrv != nil {
+		defer pprofSrv.Close()
+		go func() {
+			logger.Info("starting pprof server", "addr", pprofLis.Addr().String())
+			errCh <- pprofSrv.Serve(pprofLis)
+		}()
+	}
+	if redirectSrv != nil {
+		go func() {
+			logger.Info("starting HTTPS redirect server", "addr", redirectLis.Addr().String())
+			errCh <- redirectSrv.Serve(redirectLis)
+		}()
+	}
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	workerDone := make(chan struct{})
+	if worker != nil {
+		go func() {
+			defer close(workerDone)
+			logger.Info("starting Pub/Sub worker")
+			if err := worker.Run(workerCtx); err != nil {
+				errCh <- fmt.Errorf("Pub/Sub worker: %w", err)
+			}
+		}()
 	} else {
-		sentiment = "neutral"
+		close(workerDone)
+	}
+	go awaitClient(ctx, logger, as.connect, s.Readiness())
+	go reloadOnHangup(ctx, logger, rl.reload)
+	if cfg.SecretsRefresh > 0 {
+		go refreshAPIKeys(ctx, logger, rl, cfg.SecretsRefresh)
 	}
 
-	json.NewEncoder(w).Encode(SentimentResponse{
-		Sentiment:      sentiment,
-		SentimentScore: sentimentScore,
-	})
+	select {
+	case err := <-errCh:
+		stopWorker()
+		if grpcSrv != nil {
+			grpcSrv.Stop()
+		}
+		if redirectSrv != nil {
+			redirectSrv.Close()
+		}
+		srv.Close()
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	s.Readiness().MarkDraining()
+
+	logger.Info("shutting down", "drain_timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// The worker nacks the messages still being analyzed, so that they are
+	// redelivered, and stops once the results it has are published.
+	stopWorker()
+	grpcDone := make(chan struct{})
+	go func() {
+		if grpcSrv != nil {
+			grpcSrv.GracefulStop()
+		}
+		close(grpcDone)
+	}()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("failed to shut down gracefully", "error", err.Error())
+	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("failed to shut down the HTTPS redirect server gracefully", "error", err.Error())
+		}
+	}
+	select {
+	case <-grpcDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("failed to shut down the gRPC server gracefully", "error", shutdownCtx.Err().Error())
+		if grpcSrv != nil {
+			grpcSrv.Stop()
+		}
+	}
+	select {
+	case <-workerDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("failed to stop the Pub/Sub worker gracefully", "error", shutdownCtx.Err().Error())
+	}
+	if err := s.Close(shutdownCtx); err != nil {
+		logger.Warn("failed to save the queued analysis records", "error", err.Error())
+	}
+	return nil
 }
 
-func healthcheckHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-}
-
-func docsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
-	swagger := `{
-	"swagger": "2.0",
-	"info": {
-		"title": "Sentiment Analysis API",
-		"description": "A simple API to analyze the sentiment of a text",
-		"version": "1.0.0"
-	},
-	"host": "localhost:8080",
-	"basePath": "/",
-	"paths": {
-		"/analyze": {
-			"post": {
-				"summary": "Analyze the sentiment of a text",
-				"description": "Analyze the sentiment of a text",
-				"consumes": [
-					"application/json"
-				],
-				"produces": [
-					"application/json"
-				],	
-				"parameters": [	
-					{
-						"name": "body",
-						"in": "body",	
-						"schema": {
-							"$ref": "#/definitions/SentimentRequest"
-						}	
-					}
-				],	
-				"responses": {
-					"200": {
-						"description": "Success",
-						"schema": {
-							"$ref": "#/definitions/SentimentResponse"	
-						}	
-					},
-					"400": {
-						"description": "Bad Request"	
-					},	
-					"405": {
-						"description": "Method Not Allowed"
-					}
-				}	
-			}
-		},	
-		"/healthcheck": {	
-			"get": {	
-				"summary": "Healthcheck",	
-				"description": "Healthcheck",	
-				"produces": [	
-					"application/json"
-				],	
-				"responses": {	
-					"200": {
-						"description": "Success"
-					},
-					"405": {
-						"description": "Method Not Allowed"	
-					}
-				}	
-			}	
-		}	
-	},	
-	"definitions": {	
-		"SentimentRequest": {	
-			"type": "object",
-			"properties": {	
-				"text": {	
-					"type": "string"	
-				}	
-			}	
-		},	
-		"SentimentResponse": {	
-			"type": "object",	
-			"properties": {	
-				"sentiment": {	
-					"type": "string"
-				},	
-				"sentiment_score": {	
-					"type": "number"	
-				}	
-			}	
-		}	
-	}
-}`
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(swagger))
+// connectRetryInterval is how often client creation is retried at startup.
+const connectRetryInterval = 5 * time.Second
+
+// awaitClient calls connect until it succeeds, then marks the server ready.
+// It gives up when ctx is done.
+func awaitClient(ctx context.Context, logger *slog.Logger, connect func() error, readiness *api.Readiness) {
+	for {
+		err := connect()
+		if err == nil {
+			logger.Info("Language API client ready")
+			readiness.MarkReady()
+			return
+		}
+		logger.Error("failed to create Language API client, retrying",
+			"error", err.Error(), "retry_in", connectRetryInterval.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(connectRetryInterval):
+		}
+	}
+}
+
+// analyzerSetup is the sentiment analyzer selected by analyzerConfig,
+// wrapped as configured, and what it is made of.
+type analyzerSetup struct {
+	analyzer sentiment.Analyzer
+	// probe is the selected analyzer alone, which the healthcheck calls so
+	// that neither the circuit breaker nor the fallback can hide a failing
+	// Language API.
+	probe sentiment.Analyzer
+	// lang is the Language API client, which the other analyses use
+	// whatever the analyzer. The caller closes it.
+	lang *sentiment.Client
+	// connect creates the clients of the selected analyzer.
+	connect func() error
+}
+
+// loadAnalyzer builds the sentiment analyzer and the Language API client
+// configured by ac.
+func loadAnalyzer(logger *slog.Logger, metrics *api.Metrics, ac analyzerConfig) (*analyzerSetup, error) {
+	langOpts, err := loadLanguageOptions(ac.Language)
+	if err != nil {
+		return nil, err
+	}
+	lang := sentiment.NewClient(metrics, ac.Retry, langOpts...)
+	if ac.MaxInFlight > 0 {
+		lang.SetLimiter(sentiment.NewLimiter(ac.MaxInFlight, ac.QueueTimeout, metrics.ObserveLimiter))
+	}
+
+	var analyzer sentiment.Analyzer = lang
+	connect := lang.Connect
+	switch ac.Name {
+	case "fake":
+		logger.Warn("using the fake sentiment analyzer; scores are not meaningful")
+		analyzer = sentiment.Fake{}
+		connect = func() error { return nil }
+	case "scripted":
+		scripted, err := sentiment.NewScripted(ac.Script)
+		if err != nil {
+			return nil, fmt.Errorf("ANALYZER_SCRIPT: %w", err)
+		}
+		scripted.OnReloadError = func(err error) {
+			logger.Warn("failed to reload the analyzer script, keeping the previous version", "error", err.Error())
+		}
+		logger.Warn("using the scripted sentiment analyzer; scores come from the script", "script", ac.Script)
+		analyzer = scripted
+		connect = func() error { return nil }
+	}
+	probe := analyzer
+
+	if ac.Breaker.FailureRate > 0 {
+		analyzer = sentiment.NewBreaker(analyzer, ac.Breaker, metrics.ObserveBreakerState)
+	}
+	if ac.Fallback == "local" {
+		analyzer = sentiment.Fallback{
+			Primary:   analyzer,
+			Secondary: sentiment.Lexicon{},
+			OnFallback: func(_ context.Context, err error) {
+				logger.Warn("sentiment analysis failed, falling back to the local analyzer", "error", err.Error())
+			},
+		}
+	}
+
+	return &analyzerSetup{
+		analyzer: analyzer,
+		probe:    probe,
+		lang:     lang,
+		connect:  connect,
+	}, nil
+}
+
+// loadAPIConfig reads the settings of the API server from e.
+// The access log follows logFormat unless ACCESS_LOG_FORMAT says otherwise,
+// with the traces of project in the GCP format.
+func loadAPIConfig(e *env, logFormat, project string) (api.Config, error) {
+	var cfg api.Config
+	var err error
+
+	if cfg.RequestTimeout, err = e.duration("REQUEST_TIMEOUT", api.DefaultRequestTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxTextBytes, err = e.integer("MAX_TEXT_BYTES", api.DefaultMaxTextBytes, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxChunks, err = e.integer("MAX_CHUNKS", api.DefaultMaxChunks, 1); err != nil {
+		return cfg, err
+	}
+	maxBodyBytes, err := e.integer("MAX_BODY_BYTES", api.DefaultMaxBodyBytes, 1)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MaxBodyBytes = int64(maxBodyBytes)
+	if cfg.LenientJSON, err = e.boolean("LENIENT_JSON", false); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBatchItems, err = e.integer("MAX_BATCH_ITEMS", api.DefaultMaxBatchItems, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchConcurrency, err = e.integer("BATCH_CONCURRENCY", api.DefaultBatchConcurrency, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxFileBytes, err = e.integer("MAX_FILE_BYTES", api.DefaultMaxFileBytes, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.FeedMaxEntries, err = e.integer("FEED_MAX_ENTRIES", api.DefaultFeedMaxEntries, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.URLsTimeout, err = e.duration("URLS_TIMEOUT", api.DefaultURLsTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.TrustedProxyHops, err = e.integer("TRUSTED_PROXY_HOPS", 0, 0); err != nil {
+		return cfg, err
+	}
+	if cfg.NeutralBand, err = e.float("NEUTRAL_BAND", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.NeutralBand >= 1 {
+		return cfg, fmt.Errorf("NEUTRAL_BAND: must be less than 1, got %g", cfg.NeutralBand)
+	}
+	// Scores are left unrounded unless SCORE_PRECISION is set; 0 rounds
+	// them to whole numbers.
+	if precision, err := e.integer("SCORE_PRECISION", -1, 0); err != nil {
+		return cfg, err
+	} else if precision >= 0 {
+		cfg.ScorePrecision = &precision
+	}
+	if cfg.IdempotencyTTL, err = e.duration("IDEMPOTENCY_TTL", api.DefaultIdempotencyTTL); err != nil {
+		return cfg, err
+	}
+	if cfg.HistoryPreviewBytes, err = e.integer("HISTORY_PREVIEW_BYTES", api.DefaultHistoryPreviewBytes, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.SlowRequestThreshold, err = e.duration("SLOW_REQUEST_THRESHOLD", api.DefaultSlowRequestThreshold); err != nil {
+		return cfg, err
+	}
+
+	if cfg.APIKeys, err = loadAPIKeys(e); err != nil {
+		return cfg, err
+	}
+
+	cfg.SigningSecrets = e.list("SIGNING_SECRETS", nil)
+	if cfg.SignatureMaxSkew, err = e.duration("SIGNATURE_MAX_SKEW", api.DefaultSignatureMaxSkew); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Debug, err = e.boolean("DEBUG_RESPONSES", false); err != nil {
+		return cfg, err
+	}
+	cfg.DebugAPIKeys = e.list("DEBUG_API_KEYS", nil)
+	cfg.AdminAPIKeys = e.list("ADMIN_API_KEYS", nil)
+	cfg.AdminAuth = api.BasicAuthConfig{
+		Username:     e.get("ADMIN_USERNAME"),
+		Password:     e.get("ADMIN_PASSWORD"),
+		PasswordHash: e.get("ADMIN_PASSWORD_HASH"),
+	}
+	cfg.APIIPFilter = api.IPFilterConfig{
+		Allow: e.list("API_ALLOWED_CIDRS", nil),
+		Deny:  e.list("API_DENIED_CIDRS", nil),
+	}
+	cfg.AdminIPFilter = api.IPFilterConfig{
+		Allow: e.list("ADMIN_ALLOWED_CIDRS", nil),
+		Deny:  e.list("ADMIN_DENIED_CIDRS", nil),
+	}
+
+	if cfg.RateLimit.RPS, err = e.float("RATE_LIMIT_RPS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimit.Burst, err = e.integer("RATE_LIMIT_BURST", 0, 1); err != nil {
+		return cfg, err
+	}
+
+	if cfg.LoadShedding.MaxInFlight, err = e.integer("MAX_IN_FLIGHT_REQUESTS", 0, 0); err != nil {
+		return cfg, err
+	}
+	if cfg.LoadShedding.QueueTimeout, err = e.duration("IN_FLIGHT_QUEUE_TIMEOUT", 0); err != nil {
+		return cfg, err
+	}
+
+	cfg.CORS = api.CORSConfig{
+		AllowedOrigins: e.list("CORS_ALLOWED_ORIGINS", nil),
+		AllowedMethods: e.list("CORS_ALLOWED_METHODS", nil),
+		AllowedHeaders: e.list("CORS_ALLOWED_HEADERS", nil),
+	}
+	if cfg.CORS.MaxAge, err = e.duration("CORS_MAX_AGE", api.DefaultCORSMaxAge); err != nil {
+		return cfg, err
+	}
+
+	cfg.SecurityHeaders = api.DefaultSecurityHeaders()
+	for name, v := range map[string]*string{
+		"X_FRAME_OPTIONS":              &cfg.SecurityHeaders.FrameOptions,
+		"REFERRER_POLICY":              &cfg.SecurityHeaders.ReferrerPolicy,
+		"DOCS_CONTENT_SECURITY_POLICY": &cfg.SecurityHeaders.DocsCSP,
+		"STRICT_TRANSPORT_SECURITY":    &cfg.SecurityHeaders.HSTS,
+	} {
+		// An empty value leaves the header out.
+		if value, ok := e.lookup(name); ok {
+			*v = value
+		}
+	}
+
+	cfg.AccessLog = api.AccessLogConfig{
+		Format:  e.get("ACCESS_LOG_FORMAT"),
+		Output:  os.Stdout,
+		Exclude: e.list("ACCESS_LOG_EXCLUDE", nil),
+	}
+	if logFormat == logFormatGCP {
+		if cfg.AccessLog.Format == "" {
+			cfg.AccessLog.Format = api.AccessLogGCP
+		}
+		cfg.AccessLog.ProjectID = gcpProject(context.Background(), project)
+	}
+	return cfg, nil
+}
+
+// loadLanguageOptions returns the options of the Language API clients
+// configured by lc.
+func loadLanguageOptions(lc languageConfig) ([]option.ClientOption, error) {
+	var opts []option.ClientOption
+	if lc.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(lc.Endpoint))
+	}
+	if lc.EmulatorHost != "" {
+		opts = append(opts,
+			option.WithEndpoint(lc.EmulatorHost),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		)
+	}
+
+	credsVar, credsJSON := "LANGUAGE_CREDENTIALS_JSON", lc.CredentialsJSON
+	if lc.CredentialsFile != "" {
+		data, err := os.ReadFile(lc.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("LANGUAGE_CREDENTIALS_FILE: %w", err)
+		}
+		credsVar, credsJSON = "LANGUAGE_CREDENTIALS_FILE", string(data)
+	}
+	if credsJSON != "" {
+		credsType, err := credentialsType([]byte(credsJSON))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", credsVar, err)
+		}
+		opts = append(opts, option.WithAuthCredentialsJSON(credsType, []byte(credsJSON)))
+	}
+
+	if lc.UserAgent != "" {
+		opts = append(opts, option.WithUserAgent(lc.UserAgent))
+	}
+	return opts, nil
+}
+
+// credentialsType returns the type of the credentials JSON data, which must
+// be one of those the Language API accepts.
+func credentialsType(data []byte) (option.CredentialsType, error) {
+	var creds struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", fmt.Errorf("invalid credentials JSON: %w", err)
+	}
+	switch t := option.CredentialsType(creds.Type); t {
+	case option.ServiceAccount, option.AuthorizedUser, option.ImpersonatedServiceAccount, option.ExternalAccount:
+		return t, nil
+	}
+	return "", fmt.Errorf("unsupported credentials type %q: must be service_account, authorized_user, impersonated_service_account or external_account", creds.Type)
+}
+
+// loadRetryPolicy reads RETRY_MAX_ATTEMPTS, RETRY_BASE_DELAY and
+// RETRY_MAX_DELAY.
+func loadRetryPolicy(e *env) (sentiment.RetryPolicy, error) {
+	p := sentiment.DefaultRetryPolicy()
+	var err error
+	if p.MaxAttempts, err = e.integer("RETRY_MAX_ATTEMPTS", p.MaxAttempts, 1); err != nil {
+		return p, err
+	}
+	if p.BaseDelay, err = e.duration("RETRY_BASE_DELAY", p.BaseDelay); err != nil {
+		return p, err
+	}
+	if p.MaxDelay, err = e.duration("RETRY_MAX_DELAY", p.MaxDelay); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// loadBreakerConfig reads BREAKER_FAILURE_RATE, BREAKER_MIN_REQUESTS,
+// BREAKER_WINDOW and BREAKER_OPEN_TIMEOUT. A failure rate of 0 disables the
+// circuit breaker.
+func loadBreakerConfig(e *env) (sentiment.BreakerConfig, error) {
+	cfg := sentiment.DefaultBreakerConfig()
+	var err error
+	if cfg.FailureRate, err = e.float("BREAKER_FAILURE_RATE", cfg.FailureRate); err != nil {
+		return cfg, err
+	}
+	if cfg.FailureRate > 1 {
+		return cfg, fmt.Errorf("BREAKER_FAILURE_RATE: must be at most 1, got %g", cfg.FailureRate)
+	}
+	if cfg.MinRequests, err = e.integer("BREAKER_MIN_REQUESTS", cfg.MinRequests, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.Window, err = e.duration("BREAKER_WINDOW", cfg.Window); err != nil {
+		return cfg, err
+	}
+	if cfg.OpenTimeout, err = e.duration("BREAKER_OPEN_TIMEOUT", cfg.OpenTimeout); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// loadAPIKeys reads keys from the comma-separated API_KEYS variable and from
+// the file named by API_KEYS_FILE, which holds one key per line; blank lines
+// and lines starting with # are ignored.
+func loadAPIKeys(e *env) ([]string, error) {
+	keys := e.list("API_KEYS", nil)
+
+	path := e.get("API_KEYS_FILE")
+	if path == "" {
+		return keys, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+	}
+	return keys, nil
+}
+
+// cacheBackend names the kind of cache for logging.
+func cacheBackend(cache api.Cache) string {
+	switch cache.(type) {
+	case nil:
+		return "none"
+	case *api.RedisCache:
+		return "redis"
+	default:
+		return "memory"
+	}
+}
+
+// loadCache builds the result cache configured by cc. The cache is nil when
+// caching is disabled. The returned function releases it.
+func loadCache(cc cacheConfig) (api.Cache, func(), error) {
+	noop := func() {}
+	switch cc.Backend {
+	case "redis":
+		rc := api.NewRedisCache(cc.RedisAddr, cc.RedisKeyPrefix, cc.TTL)
+		return rc, func() { rc.Close() }, nil
+	case "memory":
+		if cc.MaxEntries > 0 {
+			return api.NewLRUCache(cc.MaxEntries, cc.TTL), noop, nil
+		}
+	}
+	return nil, noop, nil
+}
+
+// loadStorage builds the analysis storage selected by sc, which is nil when
+// storage is disabled. The returned function releases it.
+func loadStorage(sc storageConfig) (api.Storage, func(), error) {
+	if sc.Backend != "firestore" {
+		return nil, func() {}, nil
+	}
+	fs, err := api.NewFirestoreStorage(context.Background(), sc.FirestoreProject, sc.FirestoreCollection)
+	if err != nil {
+		return nil, nil, fmt.Errorf("STORAGE: %w", err)
+	}
+	return fs, func() { fs.Close() }, nil
+}
+
+// loadExporter builds the BigQuery event inserter of ec, which is nil unless
+// BIGQUERY_DATASET enables the export. The returned function releases it.
+func loadExporter(ec exportConfig) (api.EventInserter, func(), error) {
+	if ec.Dataset == "" {
+		return nil, func() {}, nil
+	}
+	bq, err := api.NewBigQueryInserter(context.Background(), ec.Project, ec.Dataset, ec.Table)
+	if err != nil {
+		return nil, nil, fmt.Errorf("BIGQUERY_DATASET: %w", err)
+	}
+	return bq, func() { bq.Close() }, nil
+}
+
+// loadPubSubWorker builds the Pub/Sub worker of pc. The returned function
+// closes its client.
+func loadPubSubWorker(s *api.Server, pc pubSubConfig) (*api.PubSubWorker, func(), error) {
+	client, err := pubsub.NewClient(context.Background(), cmp.Or(pc.Project, pubsub.DetectProjectID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("PUBSUB_PROJECT: %w", err)
+	}
+	return s.NewPubSubWorker(client, pc.Subscription, pc.ResultTopic, pc.PubSubConfig), func() { client.Close() }, nil
+}
+
+// loadIDTokenAuth enables the authentication of the service accounts of ic,
+// if any, with ID tokens.
+func loadIDTokenAuth(s *api.Server, ic idTokenConfig) error {
+	if len(ic.ServiceAccounts) == 0 {
+		return nil
+	}
+	validator, err := idtoken.NewValidator(context.Background())
+	if err != nil {
+		return fmt.Errorf("ID_TOKEN_SERVICE_ACCOUNTS: %w", err)
+	}
+	s.SetIDTokenAuth(api.IDTokenConfig{Validator: validator, Audience: ic.Audience, ServiceAccounts: ic.ServiceAccounts})
+	return nil
+}
+
+// loadAsync enables asynchronous analysis through the Cloud Tasks queue of
+// ac, if any. The returned function closes the queue.
+func loadAsync(s *api.Server, ac asyncConfig) (func(), error) {
+	if ac.Queue == "" {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	verify, err := api.NewCloudTasksVerifier(ctx, ac.HandlerURL, ac.ServiceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("TASKS_HANDLER_URL: %w", err)
+	}
+	q, err := api.NewCloudTasksQueue(ctx, ac.Queue, ac.HandlerURL, ac.ServiceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("CLOUD_TASKS_QUEUE: %w", err)
+	}
+	s.SetAsync(api.AsyncConfig{Queue: q, Verify: verify, CallbackSecret: []byte(ac.CallbackSecret)})
+	return func() { q.Close() }, nil
+}
+
+// loadGCS enables the analysis of the buckets of gc, if any. The returned
+// function closes the Cloud Storage client.
+func loadGCS(s *api.Server, gc api.GCSConfig) (func(), error) {
+	if len(gc.Buckets) == 0 {
+		return func() {}, nil
+	}
+	store, err := api.NewGCSObjectStore(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("GCS_BUCKETS: %w", err)
+	}
+	s.SetObjectStore(store, gc)
+	return func() { store.Close() }, nil
+}
+
+// defaultErrorReportingService is the service errors are reported for
+// unless K_SERVICE, as set by Cloud Run, says otherwise.
+const defaultErrorReportingService = "sentiment-analysis-api"
+
+// loadErrorReporting reports failed requests to Error Reporting when ec
+// enables it, in the project of ec or else project, the project the process
+// runs in.
+func loadErrorReporting(s *api.Server, build api.BuildInfo, ec errorReportingConfig, project string) error {
+	if !ec.Enabled {
+		return nil
+	}
+	ctx := context.Background()
+	project = cmp.Or(ec.Project, gcpProject(ctx, project))
+	if project == "" {
+		return errors.New("ERROR_REPORTING: set ERROR_REPORTING_PROJECT or GOOGLE_CLOUD_PROJECT outside Google Cloud")
+	}
+	reporter, err := api.NewCloudErrorReporter(ctx, project, ec.Service, build.Version)
+	if err != nil {
+		return fmt.Errorf("ERROR_REPORTING: %w", err)
+	}
+	s.SetErrorReporter(reporter)
+	return nil
+}
+
+// loadQuotas enables usage accounting and daily quotas per API key with the
+// counter of qc, whose redis backend is the one of cc. The returned function
+// releases the counter.
+func loadQuotas(s *api.Server, qc quotaConfig, cc cacheConfig) (func(), error) {
+	noop := func() {}
+	cfg := api.QuotaConfig{Default: qc.Default, Keys: qc.Keys, ResetOffset: qc.ResetOffset}
+	switch qc.Backend {
+	case "memory":
+		cfg.Counter = api.NewMemoryQuotaCounter()
+	case "redis":
+		rc := api.NewRedisQuotaCounter(cc.RedisAddr, cc.RedisKeyPrefix)
+		s.AddOptionalHealthCheck("redis_quotas", rc.Ping)
+		cfg.Counter = rc
+		noop = func() { rc.Close() }
+	default:
+		return noop, nil
+	}
+	s.SetQuotas(cfg)
+	return noop, nil
+}
+
+// parseQuotaKeys parses entries of the form <API key ID>:<requests>:<chars>,
+// where 0 is unlimited.
+func parseQuotaKeys(entries []string) (map[string]api.QuotaLimits, error) {
+	keys := make(map[string]api.QuotaLimits)
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("entry %q is not <API key ID>:<requests>:<chars>", entry)
+		}
+		requests, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || requests < 0 {
+			return nil, fmt.Errorf("entry %q: invalid request quota", entry)
+		}
+		chars, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || chars < 0 {
+			return nil, fmt.Errorf("entry %q: invalid character quota", entry)
+		}
+		keys[parts[0]] = api.QuotaLimits{Requests: requests, Chars: chars}
+	}
+	return keys, nil
 }
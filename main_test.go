@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+)
+
+// freePort returns a TCP port nothing listens on at the time.
+func freePort(t *testing.T) int {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// startRun runs the server with the settings of vars, on a free port with
+// the fake analyzer, and returns its address once it serves, along with the
+// result of run.
+func startRun(t *testing.T, vars map[string]string) (string, <-chan error) {
+	t.Helper()
+	port := freePort(t)
+	e := testEnv(map[string]string{
+		"PORT":             strconv.Itoa(port),
+		"GRPC_ADDR":        "127.0.0.1:0",
+		"ANALYZER":         "fake",
+		"SHUTDOWN_TIMEOUT": "5s",
+	})
+	for name, v := range vars {
+		e.vars[name] = v
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- run(slog.New(slog.NewTextHandler(io.Discard, nil)), new(slog.LevelVar), e)
+	}()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/livez")
+		if err == nil {
+			resp.Body.Close()
+			return addr, done
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("run: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the server did not start: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	addr, done := startRun(t, nil)
+
+	// The fake analyzer needs no client, so the server gets ready at once.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		ready, err := http.Get("http://" + addr + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ready.Body.Close()
+		if ready.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/readyz before the shutdown: status = %d, want 200", ready.StatusCode)
+		}
+	}
+
+	// The request is in flight until its body is sent. The server asks for
+	// the body once the handler reads it: the connection was accepted
+	// before the listener is closed.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	body := `{"text": "I love this"}`
+	fmt.Fprintf(conn, "POST /v1/analyze HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", addr, len(body))
+	br := bufio.NewReader(conn)
+	if resp, err := http.ReadResponse(br, nil); err != nil || resp.StatusCode != http.StatusContinue {
+		t.Fatalf("response to the headers: %v, %v, want 100 Continue", resp, err)
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	// The listener is closed once the shutdown starts.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		c.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("the server still accepts connections after SIGTERM")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("run returned before the request in flight completed: %v", err)
+	default:
+	}
+
+	if _, err := io.WriteString(conn, body); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading the response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status of the request in flight = %d, want 200", resp.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the shutdown")
+	}
+}
+
+func TestAwaitClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var ready api.Readiness
+	awaitClient(context.Background(), logger, func() error { return nil }, &ready)
+	if !ready.Ready() {
+		t.Error("not ready once the client is created")
+	}
+
+	// A client that cannot be created keeps the server unready until the
+	// shutdown.
+	ctx, cancel := context.WithCancel(context.Background())
+	var unready api.Readiness
+	calls := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		awaitClient(ctx, logger, func() error {
+			calls++
+			return errors.New("no credentials")
+		}, &unready)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("awaitClient did not return once the context was done")
+	}
+	if calls == 0 || unready.Ready() || unready.Started() {
+		t.Errorf("%d attempts, ready %t, started %t; want attempts and neither", calls, unready.Ready(), unready.Started())
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+)
+
+// defaultPprofAddr is where the profiling endpoints listen unless PPROF_ADDR
+// says otherwise. The loopback interface keeps them out of reach of clients;
+// they are meant for kubectl port-forward or a shell in the container.
+const defaultPprofAddr = "localhost:6060"
+
+// pprofHandler serves the net/http/pprof handlers under /debug/pprof/ only.
+// Importing net/http/pprof also registers them on http.DefaultServeMux, which
+// is never served.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// loadPprof returns the server of the profiling endpoints and its listener,
+// or nil unless pc enables them. They require the admin credentials of s when
+// it has any.
+func loadPprof(pc pprofConfig, s *api.Server) (*http.Server, net.Listener, error) {
+	if !pc.Enabled {
+		return nil, nil, nil
+	}
+	lis, err := net.Listen("tcp", pc.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PPROF_ADDR: %w", err)
+	}
+	// No write timeout: CPU profiles and traces take as long as requested.
+	srv := &http.Server{Handler: s.ProtectAdmin(pprofHandler()), ReadHeaderTimeout: 10 * time.Second}
+	return srv, lis, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stopRun stops the run of startRun and waits for it to return.
+func stopRun(t *testing.T, done <-chan error) {
+	t.Helper()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not return after the shutdown")
+	}
+}
+
+// getPprof gets the profiling endpoint path of addr with the API key key.
+func getPprof(t *testing.T, addr, path, key string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestPprofDisabled(t *testing.T) {
+	srv, lis, err := loadPprof(pprofConfig{Addr: "127.0.0.1:0"}, nil)
+	if srv != nil || lis != nil || err != nil {
+		t.Fatalf("loadPprof when disabled = %v, %v, %v, want nil", srv, lis, err)
+	}
+
+	addr, done := startRun(t, nil)
+	defer stopRun(t, done)
+	if code, _ := getPprof(t, addr, "/debug/pprof/", ""); code != http.StatusNotFound {
+		t.Errorf("status on the API port = %d, want 404", code)
+	}
+}
+
+func TestPprofEnabled(t *testing.T) {
+	pprofAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t)))
+	addr, done := startRun(t, map[string]string{
+		"ENABLE_PPROF": "true",
+		"PPROF_ADDR":   pprofAddr,
+	})
+	defer stopRun(t, done)
+
+	code, body := getPprof(t, pprofAddr, "/debug/pprof/", "")
+	if code != http.StatusOK || !strings.Contains(body, "goroutine") {
+		t.Errorf("index: status %d, body %q, want 200 and the profiles", code, body)
+	}
+	if code, _ := getPprof(t, pprofAddr, "/debug/pprof/cmdline", ""); code != http.StatusOK {
+		t.Errorf("cmdline: status = %d, want 200", code)
+	}
+	// Only the profiling endpoints are served there, and only there.
+	if code, _ := getPprof(t, pprofAddr, "/livez", ""); code != http.StatusNotFound {
+		t.Errorf("/livez on the pprof port: status = %d, want 404", code)
+	}
+	if code, _ := getPprof(t, addr, "/debug/pprof/", ""); code != http.StatusNotFound {
+		t.Errorf("index on the API port: status = %d, want 404", code)
+	}
+}
+
+func TestPprofAdmin(t *testing.T) {
+	pprofAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t)))
+	_, done := startRun(t, map[string]string{
+		"ENABLE_PPROF":   "true",
+		"PPROF_ADDR":     pprofAddr,
+		"ADMIN_API_KEYS": "admin",
+	})
+	defer stopRun(t, done)
+
+	for key, want := range map[string]int{
+		"":      http.StatusUnauthorized,
+		"wrong": http.StatusUnauthorized,
+		"admin": http.StatusOK,
+	} {
+		if code, _ := getPprof(t, pprofAddr, "/debug/pprof/", key); code != want {
+			t.Errorf("key %q: status = %d, want %d", key, code, want)
+		}
+	}
+}
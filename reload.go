@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+)
+
+// reloader reads the configuration again on SIGHUP and POST /admin/reload,
+// and applies what the running server can: the API keys, rate limits,
+// thresholds and log level, along with the TLS certificates. Changes to the
+// other settings are rejected with a warning, as they take a restart.
+type reloader struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+	server *api.Server
+	// certs is nil unless the API is served with certificate files.
+	certs   *certificates
+	secrets *secrets
+	// fixed is the configuration the process started with, without the
+	// settings reloads apply.
+	fixed config
+
+	mu sync.Mutex // serializes reloads and secret refreshes
+	// env is what the configuration in effect was read from.
+	env *env
+}
+
+func newReloader(logger *slog.Logger, level *slog.LevelVar, s *api.Server, certs *certificates, sec *secrets, cfg config, e *env) *reloader {
+	return &reloader{
+		logger:  logger,
+		level:   level,
+		server:  s,
+		certs:   certs,
+		secrets: sec,
+		fixed:   restartOnly(cfg),
+		env:     e,
+	}
+}
+
+// reload reads the configuration file, the secrets and the certificates
+// again, and returns the settings whose changes were rejected. An invalid
+// configuration or certificate changes nothing.
+func (rl *reloader) reload(ctx context.Context) ([]string, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Nothing is replaced until the whole configuration is read and
+	// accepted, so that a rejected one leaves the current one in effect.
+	file, err := rl.env.file.reload()
+	if err != nil {
+		return nil, err
+	}
+	// The environment of the process is fixed, but the file may reference
+	// new secrets, and the old ones may have changed.
+	e, err := rl.secrets.resolve(ctx, &env{vars: rl.env.vars, file: file})
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(e)
+	if err != nil {
+		return nil, e.explain(err)
+	}
+	// The certificates are only replaced once the server has taken the rest.
+	var (
+		cert *tls.Certificate
+		pool *x509.CertPool
+	)
+	if rl.certs != nil {
+		if cert, pool, err = rl.certs.read(); err != nil {
+			return nil, err
+		}
+	}
+	if err := rl.server.Reload(cfg.API.Reloadable()); err != nil {
+		return nil, err
+	}
+	if rl.certs != nil {
+		rl.certs.store(cert, pool)
+	}
+	rl.level.Set(cfg.LogLevel)
+	rl.env = e
+
+	rejected := changedSettings("", reflect.ValueOf(rl.fixed), reflect.ValueOf(restartOnly(cfg)))
+	if len(rejected) > 0 {
+		rl.logger.Warn("ignored configuration changes that take a restart", "settings", rejected)
+	}
+	rl.logger.Info("reloaded the configuration",
+		"api_keys", len(cfg.API.APIKeys),
+		"rate_limit_rps", cfg.API.RateLimit.RPS,
+		"rate_limit_burst", cfg.API.RateLimit.Burst,
+		"neutral_band", cfg.API.NeutralBand,
+		"slow_request_threshold", cfg.API.SlowRequestThreshold.String(),
+		"log_level", cfg.LogLevel.String(),
+	)
+	return rejected, nil
+}
+
+// refreshAPIKeys reads the secrets of the configuration in effect again,
+// including those referenced since startup, and replaces the API keys of the
+// server when API_KEYS or DEBUG_API_KEYS changed. It returns the number of
+// API keys and whether they were replaced.
+func (rl *reloader) refreshAPIKeys(ctx context.Context) (int, bool, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	e, err := rl.secrets.resolve(ctx, rl.env)
+	if err != nil {
+		return 0, false, err
+	}
+	if e.get("API_KEYS") == rl.env.get("API_KEYS") && e.get("DEBUG_API_KEYS") == rl.env.get("DEBUG_API_KEYS") {
+		return 0, false, nil
+	}
+	keys, err := loadAPIKeys(e)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := rl.server.SetAPIKeys(keys, e.list("DEBUG_API_KEYS", nil)); err != nil {
+		return 0, false, err
+	}
+	rl.env = e
+	return len(keys), true, nil
+}
+
+// restartOnly returns cfg without the settings reloads apply, which are
+// those of api.ReloadableConfig and the log level.
+func restartOnly(cfg config) config {
+	cfg.LogLevel = 0
+	cfg.API.APIKeys = nil
+	cfg.API.DebugAPIKeys = nil
+	cfg.API.AdminAPIKeys = nil
+	cfg.API.RateLimit = api.RateLimitConfig{}
+	cfg.API.NeutralBand = 0
+	cfg.API.SlowRequestThreshold = 0
+	return cfg
+}
+
+// changedSettings returns the dotted names of the settings that differ
+// between a and b, the values of the setting name. Structs are compared
+// field by field, unless they have unexported fields.
+func changedSettings(name string, a, b reflect.Value) []string {
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return nil
+	}
+	t := a.Type()
+	if t.Kind() != reflect.Struct || !allExported(t) {
+		return []string{name}
+	}
+	var changed []string
+	for i := range t.NumField() {
+		field := t.Field(i).Name
+		if name != "" {
+			field = name + "." + field
+		}
+		changed = append(changed, changedSettings(field, a.Field(i), b.Field(i))...)
+	}
+	return changed
+}
+
+func allExported(t reflect.Type) bool {
+	for i := range t.NumField() {
+		if !t.Field(i).IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+// reloadOnHangup calls reload on every SIGHUP until ctx is done. A failed
+// reload keeps the current configuration.
+func reloadOnHangup(ctx context.Context, logger *slog.Logger, reload func(context.Context) ([]string, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		if _, err := reload(ctx); err != nil {
+			logger.Warn("failed to reload the configuration, keeping the current one", "error", err.Error())
+		}
+	}
+}
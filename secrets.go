@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// secretRefPrefix marks a variable whose value is to be read from Secret
+// Manager, as in
+// sm://projects/P/secrets/S/versions/latest. The version defaults to latest.
+const secretRefPrefix = "sm://"
+
+var secretNamePattern = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+(/versions/[^/]+)?$`)
+
+// secretAccessor is the subset of the Secret Manager client used to read
+// secrets.
+type secretAccessor interface {
+	AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error)
+}
+
+// secrets reads the secrets of the variables holding a Secret Manager
+// reference, so that every setting may be given either way. Its client is
+// created on first use, so that settings without references need no
+// credentials.
+type secrets struct {
+	newClient func(context.Context) (secretAccessor, error)
+
+	mu     sync.Mutex
+	client secretAccessor
+}
+
+func newSecrets() *secrets {
+	return &secrets{newClient: func(ctx context.Context) (secretAccessor, error) {
+		client, err := secretmanager.NewClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}}
+}
+
+// resolve reads the secrets of the variables of e holding a reference, each
+// secret once however many variables reference it, and returns e with the
+// secrets in place of the references. The secrets e already has are read
+// again.
+func (s *secrets) resolve(ctx context.Context, e *env) (*env, error) {
+	refs := e.references()
+	if len(refs) == 0 {
+		return e.withSecrets(nil), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		client, err := s.newClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create Secret Manager client: %w", err)
+		}
+		s.client = client
+	}
+
+	bySecret := make(map[string]string)
+	values := make(map[string]string, len(refs))
+	for name, ref := range refs {
+		secret, err := secretName(ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		value, ok := bySecret[secret]
+		if !ok {
+			if value, err = s.access(ctx, secret); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			bySecret[secret] = value
+		}
+		values[name] = value
+	}
+	return e.withSecrets(values), nil
+}
+
+// secretName returns the name of the secret version ref refers to.
+func secretName(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, secretRefPrefix)
+	if !secretNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid secret reference %q: must be %sprojects/P/secrets/S[/versions/V]", ref, secretRefPrefix)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	return name, nil
+}
+
+func (s *secrets) access(ctx context.Context, name string) (string, error) {
+	resp, err := s.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.PermissionDenied:
+		return "", fmt.Errorf("access to secret %s denied; the service account needs roles/secretmanager.secretAccessor on it: %w", name, err)
+	case codes.NotFound:
+		return "", fmt.Errorf("secret %s not found: %w", name, err)
+	default:
+		return "", fmt.Errorf("read secret %s: %w", name, err)
+	}
+	// Secrets created from files often end with a newline.
+	return strings.TrimRight(string(resp.GetPayload().GetData()), "\r\n"), nil
+}
+
+func (s *secrets) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.client.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// refreshAPIKeys reads the secrets again every interval until ctx is done,
+// through rl so that the references of the configuration last reloaded are
+// read, and hands the server the API keys whenever API_KEYS or
+// DEBUG_API_KEYS change. The other settings take new secrets on reload.
+func refreshAPIKeys(ctx context.Context, logger *slog.Logger, rl *reloader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		keys, replaced, err := rl.refreshAPIKeys(ctx)
+		if err != nil {
+			logger.Warn("failed to refresh secrets, keeping the current API keys", "error", err.Error())
+			continue
+		}
+		if replaced {
+			logger.Info("replaced the API keys", "api_keys", keys)
+		}
+	}
+}
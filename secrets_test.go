@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/sentiment"
+)
+
+// fakeAccessor serves the secrets of values, by version name, and counts the
+// reads of each.
+type fakeAccessor struct {
+	mu     sync.Mutex
+	values map[string]string
+	errs   map[string]error
+	reads  map[string]int
+}
+
+func newFakeAccessor(values map[string]string) *fakeAccessor {
+	return &fakeAccessor{values: values, errs: make(map[string]error), reads: make(map[string]int)}
+}
+
+func (f *fakeAccessor) AccessSecretVersion(_ context.Context, req *secretmanagerpb.AccessSecretVersionRequest, _ ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads[req.Name]++
+	if err := f.errs[req.Name]; err != nil {
+		return nil, err
+	}
+	v, ok := f.values[req.Name]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "no such secret")
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{Payload: &secretmanagerpb.SecretPayload{Data: []byte(v)}}, nil
+}
+
+func (f *fakeAccessor) set(name, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[name] = value
+}
+
+// fakeSecrets returns secrets reading from f, and counts the clients it
+// creates in *clients.
+func fakeSecrets(f *fakeAccessor, clients *int) *secrets {
+	return &secrets{newClient: func(context.Context) (secretAccessor, error) {
+		*clients++
+		return f, nil
+	}}
+}
+
+const (
+	keysSecret  = "projects/p/secrets/keys/versions/latest"
+	adminSecret = "projects/p/secrets/admin/versions/2"
+)
+
+func TestSecretsResolve(t *testing.T) {
+	f := newFakeAccessor(map[string]string{keysSecret: "k1,k2\n", adminSecret: "hunter2"})
+	var clients int
+	sec := fakeSecrets(f, &clients)
+
+	cf, err := loadConfigFile(writeConfigFile(t, "config.yaml", "auth:\n  admin_password: sm://projects/p/secrets/admin/versions/2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := sec.resolve(context.Background(), &env{vars: map[string]string{
+		"API_KEYS":       "sm://projects/p/secrets/keys",
+		"DEBUG_API_KEYS": "sm://projects/p/secrets/keys/versions/latest",
+		"ADMIN_USERNAME": "admin",
+	}, file: cf})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		// The version defaults to latest, and the final newline is dropped.
+		"API_KEYS":       "k1,k2",
+		"DEBUG_API_KEYS": "k1,k2",
+		// References of the file are read as well.
+		"ADMIN_PASSWORD": "hunter2",
+		"ADMIN_USERNAME": "admin",
+	} {
+		if got := e.get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if v, _ := e.raw("API_KEYS"); v != "sm://projects/p/secrets/keys" {
+		t.Errorf("raw API_KEYS = %q, want the reference", v)
+	}
+	// Both variables referencing the keys share one read.
+	if f.reads[keysSecret] != 1 || f.reads[adminSecret] != 1 {
+		t.Errorf("reads = %v, want one of each secret", f.reads)
+	}
+
+	// Resolving again reads the secrets again, with the same client.
+	f.set(keysSecret, "k3")
+	if e, err = sec.resolve(context.Background(), e); err != nil {
+		t.Fatalf("resolve again: %v", err)
+	}
+	if got := e.get("API_KEYS"); got != "k3" {
+		t.Errorf("API_KEYS after a second resolve = %q, want k3", got)
+	}
+	if clients != 1 {
+		t.Errorf("created %d clients, want 1", clients)
+	}
+}
+
+func TestSecretsResolveWithoutReferences(t *testing.T) {
+	sec := &secrets{newClient: func(context.Context) (secretAccessor, error) {
+		t.Error("created a Secret Manager client without references")
+		return nil, errors.New("no client")
+	}}
+	e, err := sec.resolve(context.Background(), testEnv(map[string]string{"API_KEYS": "k1"}))
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if got := e.get("API_KEYS"); got != "k1" {
+		t.Errorf("API_KEYS = %q, want k1", got)
+	}
+	sec.close()
+}
+
+func TestSecretsResolveErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  string
+		err  error
+		want string
+	}{
+		{"invalid reference", "sm://secrets/keys", nil, "API_KEYS: invalid secret reference"},
+		{"not found", "sm://projects/p/secrets/missing", nil, "API_KEYS: secret projects/p/secrets/missing/versions/latest not found"},
+		{"permission denied", "sm://projects/p/secrets/keys", status.Error(codes.PermissionDenied, "denied"), "API_KEYS: access to secret projects/p/secrets/keys/versions/latest denied; the service account needs roles/secretmanager.secretAccessor"},
+		{"unavailable", "sm://projects/p/secrets/keys", status.Error(codes.Unavailable, "down"), "API_KEYS: read secret projects/p/secrets/keys/versions/latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAccessor(map[string]string{keysSecret: "k1"})
+			f.errs[keysSecret] = tt.err
+			var clients int
+			_, err := fakeSecrets(f, &clients).resolve(context.Background(), testEnv(map[string]string{"API_KEYS": tt.ref}))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("resolve error = %v, want one starting with %q", err, tt.want)
+			}
+		})
+	}
+
+	sec := &secrets{newClient: func(context.Context) (secretAccessor, error) {
+		return nil, errors.New("no credentials")
+	}}
+	_, err := sec.resolve(context.Background(), testEnv(map[string]string{"API_KEYS": "sm://projects/p/secrets/keys"}))
+	if err == nil || !strings.Contains(err.Error(), "create Secret Manager client: no credentials") {
+		t.Errorf("resolve without a client: error %v", err)
+	}
+}
+
+// newTestReloader returns the reloader of a server built from the settings
+// of e, with the secrets of sec, as run does.
+func newTestReloader(t *testing.T, sec *secrets, e *env) (*reloader, *api.Server) {
+	t.Helper()
+	e, err := sec.resolve(context.Background(), e)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	cfg, err := loadConfig(e)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	cfg.API.AccessLog.Output = io.Discard
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := api.NewServer(cfg.API, sentiment.Fake{}, nil, nil, logger, api.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(s.Shutdown)
+	return newReloader(logger, new(slog.LevelVar), s, nil, sec, cfg, e), s
+}
+
+// accepts reports whether s lets a request with the API key through.
+func accepts(s *api.Server, key string) bool {
+	r := httptest.NewRequest(http.MethodPost, "/v1/analyze", strings.NewReader(`{"text": "good"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	return w.Code != http.StatusUnauthorized
+}
+
+func TestRefreshAPIKeys(t *testing.T) {
+	f := newFakeAccessor(map[string]string{keysSecret: "k1"})
+	var clients int
+	rl, s := newTestReloader(t, fakeSecrets(f, &clients), testEnv(map[string]string{"API_KEYS": "sm://projects/p/secrets/keys"}))
+	if !accepts(s, "k1") {
+		t.Fatal("the key of the secret is rejected")
+	}
+
+	if n, replaced, err := rl.refreshAPIKeys(context.Background()); err != nil || replaced {
+		t.Errorf("refresh of unchanged keys = %d, %t, %v, want nothing replaced", n, replaced, err)
+	}
+
+	f.set(keysSecret, "k2,k3")
+	n, replaced, err := rl.refreshAPIKeys(context.Background())
+	if err != nil || !replaced || n != 2 {
+		t.Fatalf("refresh of rotated keys = %d, %t, %v, want 2 keys replaced", n, replaced, err)
+	}
+	if accepts(s, "k1") || !accepts(s, "k2") {
+		t.Error("the rotated keys are not in effect")
+	}
+
+	// A failed read keeps the current keys.
+	f.errs[keysSecret] = status.Error(codes.Unavailable, "down")
+	if _, _, err := rl.refreshAPIKeys(context.Background()); err == nil {
+		t.Error("refresh succeeded while Secret Manager is down")
+	}
+	if !accepts(s, "k2") {
+		t.Error("a failed refresh dropped the keys")
+	}
+}
+
+func TestRefreshAPIKeysAfterReload(t *testing.T) {
+	f := newFakeAccessor(map[string]string{keysSecret: "k2"})
+	var clients int
+	path := writeConfigFile(t, "config.yaml", "auth:\n  api_keys: [k1]\n")
+	cf, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl, s := newTestReloader(t, fakeSecrets(f, &clients), &env{vars: map[string]string{}, file: cf})
+
+	// The reloaded file references a secret the process started without.
+	if err := os.WriteFile(path, []byte("auth:\n  api_keys: [sm://projects/p/secrets/keys]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.reload(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if accepts(s, "k1") || !accepts(s, "k2") {
+		t.Fatal("the keys of the reloaded file are not in effect")
+	}
+
+	f.set(keysSecret, "k3")
+	if _, replaced, err := rl.refreshAPIKeys(context.Background()); err != nil || !replaced {
+		t.Fatalf("refresh after reload = %t, %v, want the keys replaced", replaced, err)
+	}
+	if !accepts(s, "k3") {
+		t.Error("the refresh did not read the secret referenced since the reload")
+	}
+}
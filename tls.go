@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLS is how the API listener is served over TLS: with the
+// certificates of files, or with those obtained from Let's Encrypt by acme.
+// Exactly one of them is set.
+type serverTLS struct {
+	files *certificates
+	acme  *autocert.Manager
+}
+
+// loadTLS sets up the TLS of the API listener as tc says. It returns nil
+// when tc does not enable TLS.
+//
+// Certificates are requested from Let's Encrypt for the AutocertHosts as
+// they are first needed, and kept in AutocertCacheDir across restarts.
+// Let's Encrypt validates the hosts on port 443, or on port 80 when
+// TLS_REDIRECT_ADDR listens there.
+func loadTLS(tc tlsConfig) (*serverTLS, error) {
+	if len(tc.AutocertHosts) == 0 {
+		files, err := loadCertificates(tc)
+		if err != nil || files == nil {
+			return nil, err
+		}
+		return &serverTLS{files: files}, nil
+	}
+	if err := os.MkdirAll(tc.AutocertCacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("TLS_AUTOCERT_CACHE_DIR: %w", err)
+	}
+	return &serverTLS{acme: &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(tc.AutocertHosts...),
+		Cache:      autocert.DirCache(tc.AutocertCacheDir),
+		Email:      tc.AutocertEmail,
+	}}, nil
+}
+
+// config returns the TLS configuration of the API listener.
+func (t *serverTLS) config() *tls.Config {
+	if t.acme != nil {
+		cfg := t.acme.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		return cfg
+	}
+	return t.files.config()
+}
+
+// mutual reports whether clients must present a certificate.
+func (t *serverTLS) mutual() bool {
+	return t.files != nil && t.files.mutual()
+}
+
+// mode names how certificates are obtained, for logging.
+func (t *serverTLS) mode() string {
+	switch {
+	case t == nil:
+		return "none"
+	case t.acme != nil:
+		return "autocert"
+	default:
+		return "files"
+	}
+}
+
+// loadRedirect returns the server redirecting plain HTTP requests on addr
+// to HTTPS on port, and its listener, or nil when addr is empty. With
+// autocert it also answers the HTTP-01 challenges of Let's Encrypt.
+func loadRedirect(t *serverTLS, addr string, port int) (*http.Server, net.Listener, error) {
+	if addr == "" {
+		return nil, nil, nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("TLS_REDIRECT_ADDR: %w", err)
+	}
+	var h http.Handler = redirectToHTTPS(port)
+	if t.acme != nil {
+		h = t.acme.HTTPHandler(h)
+	}
+	return &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}, lis, nil
+}
+
+// redirectToHTTPS redirects every request to the same URL over HTTPS on
+// port. Only GET and HEAD are redirected permanently; other methods get a
+// 308 so that clients repeat them with their body.
+func redirectToHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+// certificates holds the server certificate of the API listener and the CAs
+// client certificates are verified against, and reads them again on
+// reload. Handshakes pick up the current ones, so that rotated certificates
+// are served without closing the listener.
+type certificates struct {
+	certFile, keyFile, caFile string
+
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+}
+
+// loadCertificates reads the PEM certificate and key the API is served with
+// over TLS, and the PEM bundle of the CAs that must have signed the
+// certificates of clients, from the files of tc. It returns nil when tc
+// names no certificate, and fails if a file cannot be read.
+func loadCertificates(tc tlsConfig) (*certificates, error) {
+	if tc.CertFile == "" {
+		return nil, nil
+	}
+	c := &certificates{certFile: tc.CertFile, keyFile: tc.KeyFile, caFile: tc.ClientCAFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads the certificate, key and client CAs from their files and
+// replaces the current ones, or keeps them if any file is invalid.
+func (c *certificates) reload() error {
+	cert, pool, err := c.read()
+	if err != nil {
+		return err
+	}
+	c.store(cert, pool)
+	return nil
+}
+
+// read reads the certificate, key and client CAs from their files without
+// replacing the current ones. The pool is nil without TLS_CLIENT_CA_FILE.
+func (c *certificates) read() (*tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("TLS_CERT_FILE: %w", err)
+	}
+	var pool *x509.CertPool
+	if c.caFile != "" {
+		data, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("TLS_CLIENT_CA_FILE: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("TLS_CLIENT_CA_FILE: no PEM certificate in %s", c.caFile)
+		}
+	}
+	return &cert, pool, nil
+}
+
+// store makes cert and pool, as returned by read, the current ones.
+func (c *certificates) store(cert *tls.Certificate, pool *x509.CertPool) {
+	c.cert.Store(cert)
+	c.clientCAs.Store(pool)
+}
+
+// mutual reports whether clients must present a certificate.
+func (c *certificates) mutual() bool {
+	return c.caFile != ""
+}
+
+// config returns the TLS configuration of the API listener. Every handshake
+// gets the certificates current at the time.
+func (c *certificates) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.cert.Load(), nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert.Load()},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if pool := c.clientCAs.Load(); pool != nil {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/53jk1/sentiment-analysis-api-golang-gcp/internal/api"
+)
+
+// testCA is a certificate authority of a test.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for name signed by ca, and its key, in PEM.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// clientCert returns a client certificate for name signed by ca.
+func (ca *testCA) clientCert(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, name, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCA := newTestCA(t, "server CA")
+	clientCA := newTestCA(t, "client CA")
+	otherCA := newTestCA(t, "other CA")
+
+	dir := t.TempDir()
+	tc := tlsConfig{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	certPEM, keyPEM := serverCA.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, tc.CertFile, certPEM)
+	writeFile(t, tc.KeyFile, keyPEM)
+	writeFile(t, tc.ClientCAFile, clientCA.pem)
+
+	certs, err := loadCertificates(tc)
+	if err != nil {
+		t.Fatalf("loadCertificates: %v", err)
+	}
+	if !certs.mutual() {
+		t.Fatal("mutual TLS is off with a client CA")
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, api.ClientCommonName(r))
+	}))
+	ts.TLS = certs.config()
+	var handshakeErrors syncBuffer
+	ts.Config.ErrorLog = log.New(&handshakeErrors, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots,
+			// The certificate is sent even if the server does not list its
+			// CA, so that the server is the one to reject it.
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(certs) == 0 {
+					return &tls.Certificate{}, nil
+				}
+				return &certs[0], nil
+			},
+		}}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if cn, err := get(clientCA.clientCert(t, "svc-a")); err != nil || cn != "svc-a" {
+		t.Errorf("valid client certificate: %q, %v; want the common name svc-a", cn, err)
+	}
+	if _, err := get(); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+	untrusted := otherCA.clientCert(t, "svc-b")
+	if _, err := get(untrusted); err == nil {
+		t.Error("request with a client certificate of an untrusted CA succeeded")
+	}
+	// The server logs why, possibly after the client saw the alert.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		logged := handshakeErrors.String()
+		if strings.Contains(logged, "didn't provide a certificate") && strings.Contains(logged, "unknown authority") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handshake errors:\n%s\nwant a missing certificate and an unknown authority", logged)
+		}
+	}
+
+	// A reload trusts the CAs of the file from the next handshake on, on the
+	// same listener.
+	writeFile(t, tc.ClientCAFile, append(clientCA.pem, otherCA.pem...))
+	if err := certs.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if cn, err := get(untrusted); err != nil || cn != "svc-b" {
+		t.Errorf("client certificate of a CA added by the reload: %q, %v; want the common name svc-b", cn, err)
+	}
+
+	// An invalid file keeps the current CAs.
+	writeFile(t, tc.ClientCAFile, []byte("not PEM"))
+	if err := certs.reload(); err == nil {
+		t.Error("reload of an invalid CA file succeeded")
+	}
+	if _, err := get(untrusted); err != nil {
+		t.Errorf("a failed reload dropped the CAs: %v", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, for the logs of a
+// server.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}